@@ -1,8 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"yourapp/internal/app"
 	"yourapp/internal/config"
 )
@@ -14,14 +21,40 @@ func main() {
 		log.Fatal("Failed to load config:", err)
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	// Initialize router
-	router := app.NewRouter(cfg)
+	router, shutdown := app.NewRouter(cfg)
 
 	// Start server
-	addr := fmt.Sprintf("%s:%s", cfg.ServerHost, cfg.ServerPort)
-	log.Printf("Server starting on %s", addr)
-	if err := router.Run(addr); err != nil {
+	server := &http.Server{
+		Addr:    fmt.Sprintf("%s:%s", cfg.ServerHost, cfg.ServerPort),
+		Handler: router,
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Server starting on %s", server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		log.Println("Shutting down server...")
+	case err := <-serverErr:
+		shutdown()
 		log.Fatal("Failed to start server:", err)
 	}
-}
 
+	// Finish the requests in flight, then stop the email worker and relay
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Warning: Failed to shut down HTTP server: %v", err)
+	}
+	shutdown()
+
+	log.Println("Server stopped")
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os/signal"
+	"syscall"
+
+	"yourapp/internal/app"
+	"yourapp/internal/config"
+)
+
+// The worker sends queued emails, so mail-sending pods can be scaled apart
+// from the API servers
+func main() {
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("Failed to load config:", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	worker, err := app.NewWorker(cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize worker:", err)
+	}
+
+	if err := worker.Run(ctx); err != nil {
+		log.Fatal("Worker failed:", err)
+	}
+}
@@ -0,0 +1,254 @@
+package app
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"yourapp/internal/repository"
+	"yourapp/internal/service"
+	"yourapp/internal/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminHandler struct {
+	adminService service.AdminService
+	rbacService  service.RBACService
+	auditLogger  service.AuditLogger
+}
+
+func NewAdminHandler(adminService service.AdminService, rbacService service.RBACService, auditLogger service.AuditLogger) *AdminHandler {
+	return &AdminHandler{
+		adminService: adminService,
+		rbacService:  rbacService,
+		auditLogger:  auditLogger,
+	}
+}
+
+// ListUsers handles paginated user listing with filters
+// GET /api/v1/admin/users?email=&verified=&active=&login_type=&created_from=&created_to=&page=&page_size=
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	filter := repository.UserFilter{
+		Email:     c.Query("email"),
+		LoginType: c.Query("login_type"),
+	}
+
+	var err error
+	if filter.IsVerified, err = parseBoolQuery(c, "verified"); err != nil {
+		util.BadRequest(c, "verified must be true or false")
+		return
+	}
+	if filter.IsActive, err = parseBoolQuery(c, "active"); err != nil {
+		util.BadRequest(c, "active must be true or false")
+		return
+	}
+	if filter.CreatedFrom, err = parseTimeQuery(c, "created_from"); err != nil {
+		util.BadRequest(c, "created_from must be a date (YYYY-MM-DD) or RFC3339 timestamp")
+		return
+	}
+	if filter.CreatedTo, err = parseTimeQuery(c, "created_to"); err != nil {
+		util.BadRequest(c, "created_to must be a date (YYYY-MM-DD) or RFC3339 timestamp")
+		return
+	}
+	filter.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	filter.PageSize, _ = strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	resp, err := h.adminService.ListUsers(filter)
+	if err != nil {
+		util.InternalServerError(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Users retrieved successfully", resp)
+}
+
+// GetUser handles user detail view
+// GET /api/v1/admin/users/:id
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	detail, err := h.adminService.GetUser(c.Param("id"))
+	if err != nil {
+		util.NotFound(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "User retrieved successfully", detail)
+}
+
+// ActivateUser handles account activation
+// POST /api/v1/admin/users/:id/activate
+func (h *AdminHandler) ActivateUser(c *gin.Context) {
+	if err := h.adminService.SetUserActive(c.Param("id"), true, requestMeta(c)); err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "User activated successfully", nil)
+}
+
+// DeactivateUser handles account deactivation
+// POST /api/v1/admin/users/:id/deactivate
+func (h *AdminHandler) DeactivateUser(c *gin.Context) {
+	if err := h.adminService.SetUserActive(c.Param("id"), false, requestMeta(c)); err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "User deactivated successfully", nil)
+}
+
+// VerifyUser handles forced email verification
+// POST /api/v1/admin/users/:id/verify
+func (h *AdminHandler) VerifyUser(c *gin.Context) {
+	if err := h.adminService.VerifyUser(c.Param("id"), requestMeta(c)); err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "User verified successfully", nil)
+}
+
+// ForcePasswordReset handles forcing a user to reset their password
+// POST /api/v1/admin/users/:id/force-password-reset
+func (h *AdminHandler) ForcePasswordReset(c *gin.Context) {
+	if err := h.adminService.ForcePasswordReset(c.Param("id"), requestMeta(c)); err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Password reset required. Reset code sent to the user's email.", nil)
+}
+
+// SetUserRoles handles replacing a user's roles
+// PUT /api/v1/admin/users/:id/roles
+func (h *AdminHandler) SetUserRoles(c *gin.Context) {
+	var req struct {
+		Roles []string `json:"roles" binding:"required,min=1"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := h.adminService.SetUserRoles(c.Param("id"), req.Roles, requestMeta(c)); err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "User roles updated successfully", gin.H{"roles": req.Roles})
+}
+
+// RevokeSessions handles signing a user out of every session
+// DELETE /api/v1/admin/users/:id/sessions
+func (h *AdminHandler) RevokeSessions(c *gin.Context) {
+	revoked, err := h.adminService.RevokeSessions(c.Param("id"), requestMeta(c))
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Sessions revoked successfully", gin.H{"revoked": revoked})
+}
+
+// Impersonate handles issuing a short-lived token to act as another user
+// POST /api/v1/admin/users/:id/impersonate
+func (h *AdminHandler) Impersonate(c *gin.Context) {
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	resp, err := h.adminService.Impersonate(c.Param("id"), req.Reason, requestMeta(c))
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Impersonation started", resp)
+}
+
+// StopImpersonation handles ending an impersonation session
+// POST /api/v1/auth/impersonation/stop
+func (h *AdminHandler) StopImpersonation(c *gin.Context) {
+	if err := h.adminService.StopImpersonation(requestMeta(c)); err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Impersonation stopped", nil)
+}
+
+// ListRoles handles listing roles with their permissions
+// GET /api/v1/admin/roles
+func (h *AdminHandler) ListRoles(c *gin.Context) {
+	roles, err := h.rbacService.ListRoles()
+	if err != nil {
+		util.InternalServerError(c, "Failed to retrieve roles")
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Roles retrieved successfully", gin.H{"roles": roles})
+}
+
+// ListAuditEvents handles querying the audit log
+// GET /api/v1/admin/audit-events?action=&actor_id=&target_user_id=&request_id=&from=&to=&page=&page_size=
+func (h *AdminHandler) ListAuditEvents(c *gin.Context) {
+	filter := repository.AuditFilter{
+		Action:       c.Query("action"),
+		ActorID:      c.Query("actor_id"),
+		TargetUserID: c.Query("target_user_id"),
+		RequestID:    c.Query("request_id"),
+	}
+
+	var err error
+	if filter.From, err = parseTimeQuery(c, "from"); err != nil {
+		util.BadRequest(c, "from must be a date (YYYY-MM-DD) or RFC3339 timestamp")
+		return
+	}
+	if filter.To, err = parseTimeQuery(c, "to"); err != nil {
+		util.BadRequest(c, "to must be a date (YYYY-MM-DD) or RFC3339 timestamp")
+		return
+	}
+	filter.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	filter.PageSize, _ = strconv.Atoi(c.DefaultQuery("page_size", "50"))
+
+	resp, err := h.auditLogger.Search(filter)
+	if err != nil {
+		util.InternalServerError(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Audit events retrieved successfully", resp)
+}
+
+func parseBoolQuery(c *gin.Context, key string) (*bool, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+func parseTimeQuery(c *gin.Context, key string) (*time.Time, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	if parsed, err := time.Parse("2006-01-02", value); err == nil {
+		return &parsed, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
@@ -0,0 +1,61 @@
+package app
+
+import (
+	"net/http"
+
+	"yourapp/internal/service"
+	"yourapp/internal/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyHandler struct {
+	apiKeyService service.APIKeyService
+}
+
+func NewAPIKeyHandler(apiKeyService service.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: apiKeyService,
+	}
+}
+
+// CreateAPIKey handles creating a personal API key; the key is only returned once
+// POST /api/v1/users/me/api-keys
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	var req service.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	resp, err := h.apiKeyService.Create(c.GetString("userID"), req, c.GetStringSlice("scopes"), requestMeta(c))
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusCreated, "API key created. Copy it now, it will not be shown again.", resp)
+}
+
+// ListAPIKeys handles listing the current user's API keys
+// GET /api/v1/users/me/api-keys
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.apiKeyService.List(c.GetString("userID"))
+	if err != nil {
+		util.InternalServerError(c, "Failed to retrieve API keys")
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "API keys retrieved successfully", gin.H{"api_keys": keys})
+}
+
+// RevokeAPIKey handles revoking one of the current user's API keys
+// DELETE /api/v1/users/me/api-keys/:id
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	if err := h.apiKeyService.Revoke(c.GetString("userID"), c.Param("id"), requestMeta(c)); err != nil {
+		util.NotFound(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "API key revoked successfully", nil)
+}
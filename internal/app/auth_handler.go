@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strings"
 
+	"yourapp/internal/model"
 	"yourapp/internal/service"
 	"yourapp/internal/util"
 
@@ -12,15 +13,18 @@ import (
 	"github.com/go-playground/validator/v10"
 )
 
+// APIKeyHeader is an alternative to "Authorization: Bearer" for API keys
+const APIKeyHeader = "X-API-Key"
+
 type AuthHandler struct {
-	authService service.AuthService
-	jwtSecret   string
+	authService   service.AuthService
+	apiKeyService service.APIKeyService
 }
 
-func NewAuthHandler(authService service.AuthService, jwtSecret string) *AuthHandler {
+func NewAuthHandler(authService service.AuthService, apiKeyService service.APIKeyService) *AuthHandler {
 	return &AuthHandler{
-		authService: authService,
-		jwtSecret:   jwtSecret,
+		authService:   authService,
+		apiKeyService: apiKeyService,
 	}
 }
 
@@ -33,7 +37,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.authService.Register(req)
+	resp, err := h.authService.Register(req, requestMeta(c))
 	if err != nil {
 		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
 		return
@@ -51,7 +55,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.authService.Login(req)
+	resp, err := h.authService.Login(req, requestMeta(c))
 	if err != nil {
 		if strings.Contains(err.Error(), "not verified") {
 			// Return special response for unverified email with email in data
@@ -82,7 +86,7 @@ func (h *AuthHandler) VerifyOTP(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.authService.VerifyOTP(req.Email, req.OTPCode)
+	resp, err := h.authService.VerifyOTP(req.Email, req.OTPCode, requestMeta(c))
 	if err != nil {
 		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
 		return
@@ -120,7 +124,7 @@ func (h *AuthHandler) GoogleOAuth(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.authService.GoogleOAuth(req)
+	resp, err := h.authService.GoogleOAuth(req, requestMeta(c))
 	if err != nil {
 		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
 		return
@@ -134,6 +138,7 @@ func (h *AuthHandler) GoogleOAuth(c *gin.Context) {
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	var req struct {
 		RefreshToken string `json:"refresh_token" binding:"required"`
+		Scope        string `json:"scope,omitempty"` // optional subset of the granted scopes
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -141,7 +146,7 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.authService.RefreshToken(req.RefreshToken)
+	resp, err := h.authService.RefreshToken(req.RefreshToken, req.Scope, requestMeta(c))
 	if err != nil {
 		util.Unauthorized(c, err.Error())
 		return
@@ -162,7 +167,7 @@ func (h *AuthHandler) RequestResetPassword(c *gin.Context) {
 		return
 	}
 
-	if err := h.authService.RequestResetPassword(req.Email); err != nil {
+	if err := h.authService.RequestResetPassword(req.Email, requestMeta(c)); err != nil {
 		// Return error if email doesn't exist or other error occurs
 		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
 		return
@@ -217,7 +222,7 @@ func (h *AuthHandler) VerifyResetPassword(c *gin.Context) {
 		return
 	}
 
-	if err := h.authService.VerifyResetPassword(req.Email, req.OTPCode, req.NewPassword); err != nil {
+	if err := h.authService.VerifyResetPassword(req.Email, req.OTPCode, req.NewPassword, requestMeta(c)); err != nil {
 		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
 		return
 	}
@@ -238,7 +243,7 @@ func (h *AuthHandler) ResetPassword(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.authService.ResetPassword(req.Token, req.NewPassword)
+	resp, err := h.authService.ResetPassword(req.Token, req.NewPassword, requestMeta(c))
 	if err != nil {
 		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
 		return
@@ -259,7 +264,7 @@ func (h *AuthHandler) VerifyEmail(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.authService.VerifyEmail(req.Token)
+	resp, err := h.authService.VerifyEmail(req.Token, requestMeta(c))
 	if err != nil {
 		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
 		return
@@ -286,9 +291,40 @@ func (h *AuthHandler) GetMe(c *gin.Context) {
 	util.SuccessResponse(c, http.StatusOK, "User retrieved successfully", gin.H{"user": user})
 }
 
-// AuthMiddleware validates JWT token
+// UpdateLocale handles changing the language of the current user's emails
+// PUT /api/v1/users/me/locale
+func (h *AuthHandler) UpdateLocale(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	var req service.UpdateLocaleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	user, err := h.authService.UpdateLocale(userID.(string), req.Locale)
+	if err != nil {
+		util.InternalServerError(c, "Failed to update locale")
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Locale updated successfully", gin.H{"user": user})
+}
+
+// AuthMiddleware validates a JWT access token or an API key, sent either as
+// "Authorization: Bearer" or in the X-API-Key header. Access tokens stop
+// working as soon as their session is revoked or their user deactivated.
 func (h *AuthHandler) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if apiKey := c.GetHeader(APIKeyHeader); apiKey != "" {
+			h.authenticateAPIKey(c, apiKey)
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			util.Unauthorized(c, "Authorization header required")
@@ -304,16 +340,149 @@ func (h *AuthHandler) AuthMiddleware() gin.HandlerFunc {
 		}
 
 		token := parts[1]
-		claims, err := util.ValidateToken(token, h.jwtSecret)
+		if strings.HasPrefix(token, model.APIKeyPrefix) {
+			h.authenticateAPIKey(c, token)
+			return
+		}
+
+		claims, err := h.authService.AuthenticateAccessToken(token)
 		if err != nil {
-			util.Unauthorized(c, "Invalid or expired token")
+			util.Unauthorized(c, err.Error())
 			c.Abort()
 			return
 		}
 
+		if claims.UserID == "" && claims.ClientID != "" {
+			// Client credentials token: a service principal whose scopes are its permissions
+			scopes := model.ParseScope(claims.Scope)
+			c.Set("clientID", claims.ClientID)
+			c.Set("permissions", scopes)
+			c.Set("scopes", scopes)
+			c.Next()
+			return
+		}
+
 		c.Set("userID", claims.UserID)
 		c.Set("email", claims.Email)
 		c.Set("userType", claims.UserType)
+		c.Set("permissions", claims.Permissions)
+		c.Set("clientID", claims.ClientID)
+		c.Set("sessionID", claims.SessionID)
+		c.Set("tokenOrgID", claims.OrgID)
+		c.Set("scopes", model.ParseScope(claims.Scope))
+		if claims.Actor != nil {
+			// Impersonation token: userID is the impersonated user, actorID the admin
+			c.Set("actorID", claims.Actor.Subject)
+			c.Set("actorEmail", claims.Actor.Email)
+		}
 		c.Next()
 	}
 }
+
+// authenticateAPIKey sets the request identity from an API key. Permissions
+// are narrowed to the key's scopes.
+func (h *AuthHandler) authenticateAPIKey(c *gin.Context, rawKey string) {
+	principal, err := h.apiKeyService.Authenticate(rawKey, c.ClientIP())
+	if err != nil {
+		util.Unauthorized(c, "Invalid or expired API key")
+		c.Abort()
+		return
+	}
+
+	c.Set("userID", principal.User.ID)
+	c.Set("email", principal.User.Email)
+	c.Set("userType", principal.User.UserType)
+	c.Set("permissions", principal.Permissions)
+	c.Set("apiKeyID", principal.Key.ID)
+	c.Set("scopes", []string(principal.Key.Scopes))
+	c.Next()
+}
+
+// DenyAPIKey restricts a route to interactive logins, e.g. so an API key
+// cannot mint further keys. Service principals are refused as well. Must be
+// used after AuthMiddleware.
+func (h *AuthHandler) DenyAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("apiKeyID") != "" {
+			util.Forbidden(c, "This action is not allowed with an API key")
+			c.Abort()
+			return
+		}
+		if c.GetString("userID") == "" {
+			util.Forbidden(c, "This action requires a user login")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// DenyClientToken restricts a route to tokens the user obtained by signing in
+// to this service directly. Tokens issued to OAuth clients are refused, so a
+// third-party app cannot mint credentials beyond what the user consented to.
+// Must be used after AuthMiddleware.
+func (h *AuthHandler) DenyClientToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("clientID") != "" {
+			util.Forbidden(c, "This action is not allowed with an OAuth client token")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// DenyImpersonation blocks sensitive operations (credential or email changes,
+// data exports, admin actions) when the token was issued for impersonation.
+// Must be used after AuthMiddleware.
+func (h *AuthHandler) DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("actorID") != "" {
+			util.Forbidden(c, "This action is not allowed while impersonating a user")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePermission allows the request only if the token grants every listed
+// permission. Must be used after AuthMiddleware.
+func (h *AuthHandler) RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted := c.GetStringSlice("permissions")
+		for _, required := range permissions {
+			if !hasPermission(granted, required) {
+				util.Forbidden(c, "Insufficient permissions")
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// RequireScopes allows the request only if the credential (access token or
+// API key) was granted every listed scope. Must be used after AuthMiddleware.
+func (h *AuthHandler) RequireScopes(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted := c.GetStringSlice("scopes")
+		for _, required := range scopes {
+			if !hasPermission(granted, required) {
+				util.ErrorResponse(c, http.StatusForbidden, "Insufficient scope", gin.H{"required_scopes": scopes})
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+func hasPermission(granted []string, required string) bool {
+	for _, p := range granted {
+		if p == required {
+			return true
+		}
+	}
+	return false
+}
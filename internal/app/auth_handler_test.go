@@ -0,0 +1,179 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+	"yourapp/internal/service"
+	"yourapp/internal/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testJWTSecret = "test-secret"
+
+// stubOAuthRepo knows a single client
+type stubOAuthRepo struct {
+	repository.OAuthRepository
+	clientID string
+}
+
+func (r *stubOAuthRepo) FindClientByClientID(clientID string) (*model.OAuthClient, error) {
+	if clientID != r.clientID {
+		return nil, errors.New("record not found")
+	}
+	return &model.OAuthClient{ClientID: clientID}, nil
+}
+
+// newTestAuthService authenticates tokens of the "svc" client. Service
+// principal tokens need no other repository, refresh tokens are rejected
+// before any lookup.
+func newTestAuthService() service.AuthService {
+	return service.NewAuthService(nil, nil, &stubOAuthRepo{clientID: "svc"}, nil, nil, testJWTSecret)
+}
+
+func newTestAuthMiddleware() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	authHandler := NewAuthHandler(newTestAuthService(), nil)
+
+	r := gin.New()
+	r.GET("/protected", authHandler.AuthMiddleware(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"client_id": c.GetString("clientID")})
+	})
+	return r
+}
+
+func requestWithBearer(r http.Handler, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthMiddlewareRejectsRefreshTokens(t *testing.T) {
+	r := newTestAuthMiddleware()
+
+	refresh, _ := util.GenerateRefreshTokenWithClaims(util.JWTClaims{UserID: "user-1", SessionID: "session-1"}, testJWTSecret)
+	if w := requestWithBearer(r, refresh); w.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh token: status %d, want 401", w.Code)
+	}
+
+	reset, _ := util.GenerateResetPasswordToken("user-1", "ana@example.com", testJWTSecret)
+	if w := requestWithBearer(r, reset); w.Code != http.StatusUnauthorized {
+		t.Fatalf("reset token: status %d, want 401", w.Code)
+	}
+}
+
+func TestAuthMiddlewareAcceptsServicePrincipals(t *testing.T) {
+	r := newTestAuthMiddleware()
+
+	token, _ := util.GenerateTokenWithClaims(util.JWTClaims{TokenType: util.TokenTypeAccess, ClientID: "svc", Scope: "users:read"}, testJWTSecret, time.Minute)
+	if w := requestWithBearer(r, token); w.Code != http.StatusOK {
+		t.Fatalf("client credentials token: status %d, want 200: %s", w.Code, w.Body)
+	}
+
+	deleted, _ := util.GenerateTokenWithClaims(util.JWTClaims{TokenType: util.TokenTypeAccess, ClientID: "deleted", Scope: "users:read"}, testJWTSecret, time.Minute)
+	if w := requestWithBearer(r, deleted); w.Code != http.StatusUnauthorized {
+		t.Fatalf("token of a deleted client: status %d, want 401", w.Code)
+	}
+}
+
+// stubAPIKeyService accepts a single raw key
+type stubAPIKeyService struct {
+	service.APIKeyService
+	key string
+}
+
+func (s *stubAPIKeyService) Authenticate(rawKey, ipAddress string) (*service.APIKeyPrincipal, error) {
+	if rawKey != s.key {
+		return nil, errors.New("invalid or expired API key")
+	}
+	return &service.APIKeyPrincipal{
+		User:        &model.User{ID: "user-1", Email: "ana@example.com"},
+		Key:         &model.APIKey{ID: "key-1", Scopes: model.StringList{model.PermissionUsersRead}},
+		Permissions: []string{model.PermissionUsersRead},
+	}, nil
+}
+
+func TestAuthMiddlewareAcceptsAPIKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const key = model.APIKeyPrefix + "abc_secret"
+	authHandler := NewAuthHandler(newTestAuthService(), &stubAPIKeyService{key: key})
+
+	r := gin.New()
+	r.GET("/protected", authHandler.AuthMiddleware(), authHandler.RequirePermission(model.PermissionUsersRead), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("apiKeyID"))
+	})
+	r.POST("/keys", authHandler.AuthMiddleware(), authHandler.DenyAPIKey(), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+
+	if w := requestWithBearer(r, key); w.Code != http.StatusOK || w.Body.String() != "key-1" {
+		t.Fatalf("bearer API key: status %d, body %q", w.Code, w.Body)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set(APIKeyHeader, key)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("X-API-Key header: status %d", w.Code)
+	}
+
+	if w := requestWithBearer(r, key+"x"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong key: status %d, want 401", w.Code)
+	}
+
+	// An API key cannot mint further keys
+	req = httptest.NewRequest(http.MethodPost, "/keys", nil)
+	req.Header.Set(APIKeyHeader, key)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("key creation with an API key: status %d, want 403", w.Code)
+	}
+}
+
+func TestDenyClientTokenRefusesOAuthClients(t *testing.T) {
+	r := newTestAuthMiddleware()
+	authHandler := NewAuthHandler(newTestAuthService(), nil)
+	r.POST("/keys", authHandler.AuthMiddleware(), authHandler.DenyClientToken(), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+
+	token, _ := util.GenerateTokenWithClaims(util.JWTClaims{TokenType: util.TokenTypeAccess, ClientID: "svc", Scope: "users:read"}, testJWTSecret, time.Minute)
+	req := httptest.NewRequest(http.MethodPost, "/keys", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("client token: status %d, want 403", w.Code)
+	}
+}
+
+func TestRequireScopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	authHandler := NewAuthHandler(newTestAuthService(), nil)
+	r := gin.New()
+	r.GET("/protected", authHandler.AuthMiddleware(), authHandler.RequireScopes(model.ScopeProfileRead), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	granted, _ := util.GenerateTokenWithClaims(util.JWTClaims{TokenType: util.TokenTypeAccess, ClientID: "svc", Scope: "profile:read users:read"}, testJWTSecret, time.Minute)
+	if w := requestWithBearer(r, granted); w.Code != http.StatusOK {
+		t.Fatalf("granted scope: status %d, want 200", w.Code)
+	}
+
+	missing, _ := util.GenerateTokenWithClaims(util.JWTClaims{TokenType: util.TokenTypeAccess, ClientID: "svc", Scope: "users:read"}, testJWTSecret, time.Minute)
+	w := requestWithBearer(r, missing)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), model.ScopeProfileRead) {
+		t.Fatalf("missing scope: status %d, body %s", w.Code, w.Body)
+	}
+}
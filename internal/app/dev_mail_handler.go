@@ -0,0 +1,158 @@
+package app
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+
+	"yourapp/internal/service"
+	"yourapp/internal/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DevMailHandler serves the development mail catcher. It is only mounted when
+// EMAIL_DEV_INBOX is enabled, since it shows every email, codes included.
+type DevMailHandler struct {
+	inbox *service.DevInbox
+}
+
+func NewDevMailHandler(inbox *service.DevInbox) *DevMailHandler {
+	return &DevMailHandler{
+		inbox: inbox,
+	}
+}
+
+// devMailSummary is the JSON shape of a caught email
+type devMailSummary struct {
+	ID         int      `json:"id"`
+	ReceivedAt string   `json:"received_at"`
+	To         []string `json:"to"`
+	Subject    string   `json:"subject"`
+	Text       string   `json:"text"`
+}
+
+var devMailPages = template.Must(template.New("list").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="UTF-8"><title>Dev mail</title>
+<style>body{font-family:sans-serif;margin:2em}table{border-collapse:collapse;width:100%}td,th{padding:.4em;border-bottom:1px solid #ddd;text-align:left}</style></head>
+<body>
+<h1>Dev mail</h1>
+<form method="post" action="/_dev/mail/clear"><button>Clear</button></form>
+<table>
+<tr><th>Received</th><th>To</th><th>Subject</th></tr>
+{{range .}}<tr><td>{{.ReceivedAt.Format "15:04:05"}}</td><td>{{range .Email.To}}{{.}} {{end}}</td><td><a href="/_dev/mail/{{.ID}}">{{.Email.Subject}}</a></td></tr>
+{{else}}<tr><td colspan="3">No emails yet.</td></tr>
+{{end}}</table>
+</body>
+</html>
+{{define "show"}}<!DOCTYPE html>
+<html>
+<head><meta charset="UTF-8"><title>{{.Email.Subject}}</title>
+<style>body{font-family:sans-serif;margin:2em}iframe{width:100%;height:70vh;border:1px solid #ddd}pre{white-space:pre-wrap;background:#f6f6f6;padding:1em}</style></head>
+<body>
+<p><a href="/_dev/mail">&larr; All emails</a> | <a href="/_dev/mail/{{.ID}}/raw">Raw source</a></p>
+<h1>{{.Email.Subject}}</h1>
+<p>From: {{.Email.FromName}} &lt;{{.Email.From}}&gt;<br>To: {{range .Email.To}}{{.}} {{end}}<br>Date: {{.Email.Date.Format "2006-01-02 15:04:05"}}</p>
+<iframe sandbox src="/_dev/mail/{{.ID}}/html"></iframe>
+<h2>Text</h2>
+<pre>{{.Email.Text}}</pre>
+</body>
+</html>{{end}}`))
+
+// Index handles listing caught emails as a page
+// GET /_dev/mail
+func (h *DevMailHandler) Index(c *gin.Context) {
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := devMailPages.ExecuteTemplate(c.Writer, "list", h.inbox.List()); err != nil {
+		log.Printf("Failed to render dev mail list: %v", err)
+	}
+}
+
+// List handles listing caught emails as JSON, e.g. to read OTP codes in scripts
+// GET /_dev/mail/messages
+func (h *DevMailHandler) List(c *gin.Context) {
+	mails := h.inbox.List()
+	summaries := make([]devMailSummary, 0, len(mails))
+	for _, mail := range mails {
+		summaries = append(summaries, devMailSummary{
+			ID:         mail.ID,
+			ReceivedAt: mail.ReceivedAt.Format("2006-01-02T15:04:05Z07:00"),
+			To:         mail.Email.To,
+			Subject:    mail.Email.Subject,
+			Text:       mail.Email.Text,
+		})
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Emails retrieved successfully", gin.H{"messages": summaries})
+}
+
+// Show handles showing a caught email with its HTML preview
+// GET /_dev/mail/:id
+func (h *DevMailHandler) Show(c *gin.Context) {
+	mail, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := devMailPages.ExecuteTemplate(c.Writer, "show", mail); err != nil {
+		log.Printf("Failed to render dev mail: %v", err)
+	}
+}
+
+// HTML handles serving a caught email's HTML body for the preview frame
+// GET /_dev/mail/:id/html
+func (h *DevMailHandler) HTML(c *gin.Context) {
+	mail, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	// Emails must not run scripts or load anything but images
+	c.Header("Content-Security-Policy", "default-src 'none'; img-src * data:; style-src 'unsafe-inline'; sandbox")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(mail.Email.HTML))
+}
+
+// Raw handles serving a caught email's MIME source
+// GET /_dev/mail/:id/raw
+func (h *DevMailHandler) Raw(c *gin.Context) {
+	mail, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	raw, err := mail.Email.Bytes()
+	if err != nil {
+		util.InternalServerError(c, err.Error())
+		return
+	}
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", raw)
+}
+
+// Clear handles discarding every caught email
+// POST /_dev/mail/clear, DELETE /_dev/mail/messages
+func (h *DevMailHandler) Clear(c *gin.Context) {
+	h.inbox.Clear()
+	if c.Request.Method == http.MethodPost {
+		c.Redirect(http.StatusSeeOther, "/_dev/mail")
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Emails cleared successfully", nil)
+}
+
+func (h *DevMailHandler) find(c *gin.Context) (service.DevMail, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		util.NotFound(c, "Email not found")
+		return service.DevMail{}, false
+	}
+	mail, ok := h.inbox.Get(id)
+	if !ok {
+		util.NotFound(c, "Email not found")
+		return service.DevMail{}, false
+	}
+	return mail, true
+}
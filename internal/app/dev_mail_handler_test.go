@@ -0,0 +1,140 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"yourapp/internal/config"
+	"yourapp/internal/service"
+	"yourapp/internal/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestDevMailRouter(t *testing.T) (*gin.Engine, service.EmailService, *service.CaptureTransport) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{ClientURL: "https://app.example.com", EmailFrom: "no-reply@example.com"}
+	capture := service.NewCaptureTransport()
+	inbox := service.NewDevInbox(capture, 10)
+
+	r := gin.New()
+	registerDevMailRoutes(r, inbox)
+	return r, service.NewEmailServiceWithTransport(cfg, inbox), capture
+}
+
+func devMailRequest(r http.Handler, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestDevMailInboxIsOptIn(t *testing.T) {
+	if _, inbox := newEmailService(&config.Config{}); inbox != nil {
+		t.Fatal("dev inbox enabled by default")
+	}
+	if _, inbox := newEmailService(&config.Config{EmailDevInbox: true}); inbox == nil {
+		t.Fatal("EMAIL_DEV_INBOX did not enable the dev inbox")
+	}
+}
+
+func TestDevMailListsCaughtEmails(t *testing.T) {
+	r, emails, capture := newTestDevMailRouter(t)
+	if err := emails.Send("ana@example.com", util.EmailTypeOTP, "en", util.OTPEmailData{Code: "123456", ExpiresMinutes: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := emails.Send("bob@example.com", util.EmailTypeWelcome, "en", util.WelcomeEmailData{Name: "Bob"}); err != nil {
+		t.Fatal(err)
+	}
+	// The inbox passes every email on to the real transport
+	if len(capture.Emails()) != 2 {
+		t.Fatalf("transport got %d emails", len(capture.Emails()))
+	}
+
+	w := devMailRequest(r, http.MethodGet, "/_dev/mail/messages")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	var resp struct {
+		Data struct {
+			Messages []devMailSummary `json:"messages"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	messages := resp.Data.Messages
+	if len(messages) != 2 || messages[0].To[0] != "bob@example.com" || messages[1].To[0] != "ana@example.com" {
+		t.Fatalf("messages = %+v, want newest first", messages)
+	}
+	// Scripts read OTP codes from the text body
+	if !strings.Contains(messages[1].Text, "123456") {
+		t.Fatalf("OTP email text = %q", messages[1].Text)
+	}
+
+	w = devMailRequest(r, http.MethodGet, "/_dev/mail")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `href="/_dev/mail/1"`) {
+		t.Fatalf("index page = %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDevMailShowsEmail(t *testing.T) {
+	r, emails, _ := newTestDevMailRouter(t)
+	name := `<script>alert(1)</script>`
+	if err := emails.Send("ana@example.com", util.EmailTypeWelcome, "en", util.WelcomeEmailData{Name: name}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := devMailRequest(r, http.MethodGet, "/_dev/mail/1")
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), name) || !strings.Contains(w.Body.String(), `<iframe sandbox src="/_dev/mail/1/html">`) {
+		t.Fatalf("show page = %d %s", w.Code, w.Body.String())
+	}
+
+	// The HTML preview cannot run scripts even though it is served as is
+	w = devMailRequest(r, http.MethodGet, "/_dev/mail/1/html")
+	if csp := w.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "default-src 'none'") || !strings.Contains(csp, "sandbox") {
+		t.Fatalf("preview CSP = %q", csp)
+	}
+
+	w = devMailRequest(r, http.MethodGet, "/_dev/mail/1/raw")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "MIME-Version: 1.0") || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("raw source = %d %s", w.Code, w.Body.String())
+	}
+
+	for _, path := range []string{"/_dev/mail/2", "/_dev/mail/x/raw", "/_dev/mail/0/html"} {
+		if w := devMailRequest(r, http.MethodGet, path); w.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want 404", path, w.Code)
+		}
+	}
+}
+
+func TestDevMailClear(t *testing.T) {
+	r, emails, _ := newTestDevMailRouter(t)
+	send := func() {
+		if err := emails.Send("ana@example.com", util.EmailTypeOTP, "en", util.OTPEmailData{Code: "123456"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	send()
+	w := devMailRequest(r, http.MethodPost, "/_dev/mail/clear")
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/_dev/mail" {
+		t.Fatalf("clear form = %d %s", w.Code, w.Header().Get("Location"))
+	}
+	if w := devMailRequest(r, http.MethodGet, "/_dev/mail/1"); w.Code != http.StatusNotFound {
+		t.Fatal("cleared email still shown")
+	}
+
+	send()
+	if w := devMailRequest(r, http.MethodDelete, "/_dev/mail/messages"); w.Code != http.StatusOK {
+		t.Fatalf("clear API = %d", w.Code)
+	}
+	// IDs keep counting after a clear, so old links never show a newer email
+	send()
+	if w := devMailRequest(r, http.MethodGet, "/_dev/mail/3"); w.Code != http.StatusOK {
+		t.Fatalf("email after clear = %d", w.Code)
+	}
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"yourapp/internal/service"
+	"yourapp/internal/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+type EmailQueueHandler struct {
+	emailQueueService service.EmailQueueService
+}
+
+func NewEmailQueueHandler(emailQueueService service.EmailQueueService) *EmailQueueHandler {
+	return &EmailQueueHandler{
+		emailQueueService: emailQueueService,
+	}
+}
+
+// ListDeadLetters handles inspecting the email dead-letter queue
+// GET /api/v1/admin/email-dlq?limit=
+func (h *EmailQueueHandler) ListDeadLetters(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	resp, err := h.emailQueueService.ListDeadLetters(limit)
+	if err != nil {
+		h.queueError(c, err)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Dead-lettered emails retrieved successfully", resp)
+}
+
+// ReplayDeadLetters handles moving dead-lettered emails back to the email queue
+// POST /api/v1/admin/email-dlq/replay
+func (h *EmailQueueHandler) ReplayDeadLetters(c *gin.Context) {
+	var req service.ReplayDeadLettersRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			util.BadRequest(c, err.Error())
+			return
+		}
+	}
+
+	replayed, err := h.emailQueueService.ReplayDeadLetters(req.MessageIDs, requestMeta(c))
+	if err != nil {
+		h.queueError(c, err)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Dead-lettered emails replayed successfully", gin.H{"replayed": replayed})
+}
+
+func (h *EmailQueueHandler) queueError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrEmailQueueUnavailable) {
+		util.ErrorResponse(c, http.StatusServiceUnavailable, err.Error(), nil)
+		return
+	}
+	util.InternalServerError(c, err.Error())
+}
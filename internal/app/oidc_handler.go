@@ -0,0 +1,301 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+
+	"yourapp/internal/service"
+	"yourapp/internal/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OIDCHandler serves the OpenID Connect provider endpoints. Protocol
+// endpoints answer in OAuth format instead of the usual response envelope.
+type OIDCHandler struct {
+	oidcService service.OIDCService
+}
+
+func NewOIDCHandler(oidcService service.OIDCService) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService: oidcService,
+	}
+}
+
+// Discovery handles the OpenID Connect discovery document
+// GET /.well-known/openid-configuration
+func (h *OIDCHandler) Discovery(c *gin.Context) {
+	c.JSON(http.StatusOK, h.oidcService.Discovery())
+}
+
+// JWKS handles publishing the ID token signing keys
+// GET /oauth/jwks
+func (h *OIDCHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.JSON(http.StatusOK, h.oidcService.JWKS())
+}
+
+// Authorize handles the start of the authorization code flow by sending the
+// browser to the consent page, or back to the client on error
+// GET /oauth/authorize
+func (h *OIDCHandler) Authorize(c *gin.Context) {
+	var req service.AuthorizeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		oauthErrorResponse(c, err)
+		return
+	}
+
+	location, err := h.oidcService.StartAuthorization(req, c.Request.URL.RawQuery)
+	if err != nil {
+		oauthErrorResponse(c, err)
+		return
+	}
+
+	c.Redirect(http.StatusFound, location)
+}
+
+// GetConsent handles describing an authorization request to the signed-in user
+// GET /oauth/consent
+func (h *OIDCHandler) GetConsent(c *gin.Context) {
+	var req service.AuthorizeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	details, err := h.oidcService.GetConsent(c.GetString("userID"), req)
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Authorization request retrieved successfully", details)
+}
+
+// SubmitConsent handles the user's approve or deny decision
+// POST /oauth/consent
+func (h *OIDCHandler) SubmitConsent(c *gin.Context) {
+	var req struct {
+		service.AuthorizeRequest
+		Approve bool `json:"approve"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	location, err := h.oidcService.Authorize(c.GetString("userID"), req.AuthorizeRequest, req.Approve, requestMeta(c))
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Authorization decision recorded", gin.H{"redirect_to": location})
+}
+
+// Token handles the token endpoint
+// POST /oauth/token
+func (h *OIDCHandler) Token(c *gin.Context) {
+	var req service.TokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		oauthErrorResponse(c, err)
+		return
+	}
+
+	// client_secret_basic takes precedence over credentials in the body
+	if clientID, clientSecret, ok := c.Request.BasicAuth(); ok {
+		req.ClientID = clientID
+		req.ClientSecret = clientSecret
+	}
+
+	resp, err := h.oidcService.Token(req, requestMeta(c))
+	if err != nil {
+		oauthErrorResponse(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	c.JSON(http.StatusOK, resp)
+}
+
+// DeviceAuthorization handles a device starting the device authorization flow
+// POST /oauth/device/code
+func (h *OIDCHandler) DeviceAuthorization(c *gin.Context) {
+	var req service.DeviceAuthorizationRequest
+	if err := c.ShouldBind(&req); err != nil {
+		oauthErrorResponse(c, err)
+		return
+	}
+
+	if clientID, clientSecret, ok := c.Request.BasicAuth(); ok {
+		req.ClientID = clientID
+		req.ClientSecret = clientSecret
+	}
+
+	resp, err := h.oidcService.DeviceAuthorization(req)
+	if err != nil {
+		oauthErrorResponse(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetDeviceConsent handles describing a device request to the signed-in user
+// GET /oauth/device
+func (h *OIDCHandler) GetDeviceConsent(c *gin.Context) {
+	userCode := c.Query("user_code")
+	if userCode == "" {
+		util.BadRequest(c, "user_code is required")
+		return
+	}
+
+	details, err := h.oidcService.GetDeviceConsent(c.GetString("userID"), userCode)
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Device request retrieved successfully", details)
+}
+
+// SubmitDeviceConsent handles the user's approve or deny decision for a device
+// POST /oauth/device
+func (h *OIDCHandler) SubmitDeviceConsent(c *gin.Context) {
+	var req struct {
+		UserCode string `json:"user_code" binding:"required"`
+		Approve  bool   `json:"approve"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := h.oidcService.DecideDevice(c.GetString("userID"), req.UserCode, req.Approve, requestMeta(c)); err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	message := "Device denied"
+	if req.Approve {
+		message = "Device approved. You can return to your device."
+	}
+	util.SuccessResponse(c, http.StatusOK, message, nil)
+}
+
+// Introspect handles token introspection for resource servers
+// POST /oauth/introspect
+func (h *OIDCHandler) Introspect(c *gin.Context) {
+	var req service.TokenActionRequest
+	if err := c.ShouldBind(&req); err != nil {
+		oauthErrorResponse(c, err)
+		return
+	}
+
+	if clientID, clientSecret, ok := c.Request.BasicAuth(); ok {
+		req.ClientID = clientID
+		req.ClientSecret = clientSecret
+	}
+
+	resp, err := h.oidcService.Introspect(req)
+	if err != nil {
+		oauthErrorResponse(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, resp)
+}
+
+// Revoke handles revoking a refresh token or API key
+// POST /oauth/revoke
+func (h *OIDCHandler) Revoke(c *gin.Context) {
+	var req service.TokenActionRequest
+	if err := c.ShouldBind(&req); err != nil {
+		oauthErrorResponse(c, err)
+		return
+	}
+
+	if clientID, clientSecret, ok := c.Request.BasicAuth(); ok {
+		req.ClientID = clientID
+		req.ClientSecret = clientSecret
+	}
+
+	if err := h.oidcService.Revoke(req, requestMeta(c)); err != nil {
+		oauthErrorResponse(c, err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// UserInfo handles returning claims about the token's user
+// GET /oauth/userinfo
+func (h *OIDCHandler) UserInfo(c *gin.Context) {
+	info, err := h.oidcService.UserInfo(c.GetString("userID"), c.GetStringSlice("scopes"))
+	if err != nil {
+		util.NotFound(c, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+// CreateClient handles registering an OAuth client; the secret is only returned once
+// POST /api/v1/admin/oauth-clients
+func (h *OIDCHandler) CreateClient(c *gin.Context) {
+	var req service.CreateOAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	resp, err := h.oidcService.CreateClient(req, c.GetStringSlice("permissions"), requestMeta(c))
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusCreated, "OAuth client created. Copy the secret now, it will not be shown again.", resp)
+}
+
+// ListClients handles listing registered OAuth clients
+// GET /api/v1/admin/oauth-clients
+func (h *OIDCHandler) ListClients(c *gin.Context) {
+	clients, err := h.oidcService.ListClients()
+	if err != nil {
+		util.InternalServerError(c, "Failed to retrieve OAuth clients")
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "OAuth clients retrieved successfully", gin.H{"clients": clients})
+}
+
+// DeleteClient handles removing an OAuth client
+// DELETE /api/v1/admin/oauth-clients/:clientId
+func (h *OIDCHandler) DeleteClient(c *gin.Context) {
+	if err := h.oidcService.DeleteClient(c.Param("clientId"), requestMeta(c)); err != nil {
+		util.NotFound(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "OAuth client deleted successfully", nil)
+}
+
+// oauthErrorResponse writes an RFC 6749 error body
+func oauthErrorResponse(c *gin.Context, err error) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		oauthErr = &service.OAuthError{Status: http.StatusBadRequest, Code: "invalid_request", Description: err.Error()}
+	}
+
+	if oauthErr.Status == http.StatusUnauthorized {
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(oauthErr.Status, oauthErr)
+}
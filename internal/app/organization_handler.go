@@ -0,0 +1,295 @@
+package app
+
+import (
+	"net/http"
+
+	"yourapp/internal/service"
+	"yourapp/internal/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OrgIDHeader selects the active organization for tenant-scoped routes
+const OrgIDHeader = "X-Org-ID"
+
+type OrganizationHandler struct {
+	orgService service.OrganizationService
+}
+
+func NewOrganizationHandler(orgService service.OrganizationService) *OrganizationHandler {
+	return &OrganizationHandler{
+		orgService: orgService,
+	}
+}
+
+// CreateOrganization handles creating an organization owned by the current user
+// POST /api/v1/orgs
+func (h *OrganizationHandler) CreateOrganization(c *gin.Context) {
+	var req service.CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	org, err := h.orgService.CreateOrganization(req, requestMeta(c))
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusCreated, "Organization created successfully", gin.H{"organization": org})
+}
+
+// ListOrganizations handles listing the current user's memberships
+// GET /api/v1/orgs
+func (h *OrganizationHandler) ListOrganizations(c *gin.Context) {
+	memberships, err := h.orgService.ListForUser(c.GetString("userID"))
+	if err != nil {
+		util.InternalServerError(c, "Failed to retrieve organizations")
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Organizations retrieved successfully", gin.H{"memberships": memberships})
+}
+
+// SwitchOrganization handles reissuing tokens with the org_id claim set
+// POST /api/v1/orgs/:id/switch
+func (h *OrganizationHandler) SwitchOrganization(c *gin.Context) {
+	resp, err := h.orgService.SwitchOrganization(c.GetString("userID"), c.GetString("sessionID"), c.Param("id"), c.GetStringSlice("scopes"))
+	if err != nil {
+		util.Forbidden(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Organization switched successfully", resp)
+}
+
+// GetCurrentOrganization handles showing the active organization and the caller's role
+// GET /api/v1/org
+func (h *OrganizationHandler) GetCurrentOrganization(c *gin.Context) {
+	org, err := h.orgService.GetOrganization(c.GetString("orgID"))
+	if err != nil {
+		util.NotFound(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Organization retrieved successfully", gin.H{
+		"organization": org,
+		"role":         c.GetString("orgRole"),
+	})
+}
+
+// ListMembers handles listing members of the active organization
+// GET /api/v1/org/members
+func (h *OrganizationHandler) ListMembers(c *gin.Context) {
+	members, err := h.orgService.ListMembers(c.GetString("orgID"))
+	if err != nil {
+		util.InternalServerError(c, "Failed to retrieve members")
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Members retrieved successfully", gin.H{"members": members})
+}
+
+// RemoveMember handles removing a member from the active organization
+// DELETE /api/v1/org/members/:userId
+func (h *OrganizationHandler) RemoveMember(c *gin.Context) {
+	if err := h.orgService.RemoveMember(c.GetString("orgID"), c.Param("userId"), requestMeta(c)); err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Member removed successfully", nil)
+}
+
+// Invite handles inviting someone to the active organization by email
+// POST /api/v1/org/invitations
+func (h *OrganizationHandler) Invite(c *gin.Context) {
+	var req service.InviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	invitation, err := h.orgService.Invite(c.GetString("orgID"), req, requestMeta(c))
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusCreated, "Invitation sent successfully", gin.H{"invitation": invitation})
+}
+
+// ListInvitations handles listing pending invitations of the active organization
+// GET /api/v1/org/invitations
+func (h *OrganizationHandler) ListInvitations(c *gin.Context) {
+	invitations, err := h.orgService.ListInvitations(c.GetString("orgID"))
+	if err != nil {
+		util.InternalServerError(c, "Failed to retrieve invitations")
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Invitations retrieved successfully", gin.H{"invitations": invitations})
+}
+
+// ListDomains handles listing the email domains of the active organization
+// GET /api/v1/org/domains
+func (h *OrganizationHandler) ListDomains(c *gin.Context) {
+	domains, err := h.orgService.ListDomains(c.GetString("orgID"))
+	if err != nil {
+		util.InternalServerError(c, "Failed to retrieve domains")
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Domains retrieved successfully", gin.H{"domains": domains})
+}
+
+// AddDomain handles claiming an email domain; the response names the DNS
+// TXT record that verifies it
+// POST /api/v1/org/domains
+func (h *OrganizationHandler) AddDomain(c *gin.Context) {
+	var req struct {
+		Domain string `json:"domain" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	domain, err := h.orgService.AddDomain(c.GetString("orgID"), req.Domain, requestMeta(c))
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	name, value := service.DomainVerificationRecord(domain)
+	util.SuccessResponse(c, http.StatusCreated, "Domain added successfully", gin.H{
+		"domain":     domain,
+		"dns_record": gin.H{"type": "TXT", "name": name, "value": value},
+	})
+}
+
+// VerifyDomain handles checking the DNS TXT record of a claimed domain
+// POST /api/v1/org/domains/:domain/verify
+func (h *OrganizationHandler) VerifyDomain(c *gin.Context) {
+	domain, err := h.orgService.VerifyDomain(c.GetString("orgID"), c.Param("domain"), requestMeta(c))
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Domain verified successfully", gin.H{"domain": domain})
+}
+
+// RemoveDomain handles dropping a claimed email domain
+// DELETE /api/v1/org/domains/:domain
+func (h *OrganizationHandler) RemoveDomain(c *gin.Context) {
+	if err := h.orgService.RemoveDomain(c.GetString("orgID"), c.Param("domain"), requestMeta(c)); err != nil {
+		util.NotFound(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Domain removed successfully", nil)
+}
+
+// GetInvitation handles previewing an invitation before accepting it
+// GET /api/v1/invitations/:token
+func (h *OrganizationHandler) GetInvitation(c *gin.Context) {
+	preview, err := h.orgService.GetInvitation(c.Param("token"))
+	if err != nil {
+		util.NotFound(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Invitation retrieved successfully", preview)
+}
+
+// AcceptInvitation handles accepting an invitation as the signed-in user
+// POST /api/v1/invitations/accept
+func (h *OrganizationHandler) AcceptInvitation(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	membership, err := h.orgService.AcceptInvitation(req.Token, requestMeta(c))
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Invitation accepted successfully", gin.H{"membership": membership})
+}
+
+// AcceptInvitationWithRegistration handles creating an account and accepting an invitation in one step
+// POST /api/v1/invitations/register
+func (h *OrganizationHandler) AcceptInvitationWithRegistration(c *gin.Context) {
+	var req service.InvitedRegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	resp, membership, err := h.orgService.AcceptInvitationWithRegistration(req, requestMeta(c))
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusCreated, "Registration successful. Invitation accepted.", gin.H{
+		"user":          resp.User,
+		"access_token":  resp.AccessToken,
+		"refresh_token": resp.RefreshToken,
+		"expires_in":    resp.ExpiresIn,
+		"membership":    membership,
+	})
+}
+
+// RequireOrganization resolves the active organization from the X-Org-ID
+// header, falling back to the token's org_id claim, and checks that the
+// caller is a member. Sets "orgID" and "orgRole". Must be used after AuthMiddleware.
+func (h *OrganizationHandler) RequireOrganization() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID := c.GetHeader(OrgIDHeader)
+		if orgID == "" {
+			orgID = c.GetString("tokenOrgID")
+		}
+		if orgID == "" {
+			util.BadRequest(c, "Organization required: send the X-Org-ID header or switch organization")
+			c.Abort()
+			return
+		}
+
+		membership, err := h.orgService.GetMembership(orgID, c.GetString("userID"))
+		if err != nil {
+			util.Forbidden(c, err.Error())
+			c.Abort()
+			return
+		}
+
+		c.Set("orgID", membership.OrganizationID)
+		c.Set("orgRole", membership.Role)
+		c.Next()
+	}
+}
+
+// RequireOrgRole allows the request only if the caller's role in the active
+// organization is one of roles. Must be used after RequireOrganization.
+func (h *OrganizationHandler) RequireOrgRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgRole := c.GetString("orgRole")
+		for _, role := range roles {
+			if orgRole == role {
+				c.Next()
+				return
+			}
+		}
+		util.Forbidden(c, "Insufficient organization role")
+		c.Abort()
+	}
+}
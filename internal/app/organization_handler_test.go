@@ -0,0 +1,85 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"yourapp/internal/model"
+	"yourapp/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stubOrgService knows a single membership per organization
+type stubOrgService struct {
+	service.OrganizationService
+	members map[string]model.Membership // org ID to membership
+}
+
+func (s *stubOrgService) GetMembership(orgID, userID string) (*model.Membership, error) {
+	membership, ok := s.members[orgID]
+	if !ok || membership.UserID != userID {
+		return nil, errors.New("you are not a member of this organization")
+	}
+	return &membership, nil
+}
+
+func newTestOrgRouter(tokenOrgID string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := NewOrganizationHandler(&stubOrgService{members: map[string]model.Membership{
+		"org-a": {OrganizationID: "org-a", UserID: "user-1", Role: model.OrgRoleAdmin},
+		"org-b": {OrganizationID: "org-b", UserID: "user-1", Role: model.OrgRoleMember},
+	}})
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("userID", "user-1")
+		if tokenOrgID != "" {
+			c.Set("tokenOrgID", tokenOrgID)
+		}
+	})
+	r.GET("/org", h.RequireOrganization(), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("orgID")+":"+c.GetString("orgRole"))
+	})
+	r.DELETE("/org", h.RequireOrganization(), h.RequireOrgRole(model.OrgRoleOwner, model.OrgRoleAdmin), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	return r
+}
+
+func orgRequest(r http.Handler, method, orgHeader string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/org", nil)
+	if orgHeader != "" {
+		req.Header.Set(OrgIDHeader, orgHeader)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRequireOrganizationResolvesActiveTenant(t *testing.T) {
+	if w := orgRequest(newTestOrgRouter(""), http.MethodGet, ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("no organization: status %d, want 400", w.Code)
+	}
+	if w := orgRequest(newTestOrgRouter("org-a"), http.MethodGet, ""); w.Body.String() != "org-a:admin" {
+		t.Fatalf("token claim: got %q", w.Body)
+	}
+	// The header takes precedence over the token's claim
+	if w := orgRequest(newTestOrgRouter("org-a"), http.MethodGet, "org-b"); w.Body.String() != "org-b:member" {
+		t.Fatalf("header: got %q", w.Body)
+	}
+	if w := orgRequest(newTestOrgRouter(""), http.MethodGet, "org-c"); w.Code != http.StatusForbidden {
+		t.Fatalf("foreign organization: status %d, want 403", w.Code)
+	}
+}
+
+func TestRequireOrgRole(t *testing.T) {
+	if w := orgRequest(newTestOrgRouter(""), http.MethodDelete, "org-a"); w.Code != http.StatusNoContent {
+		t.Fatalf("admin: status %d, want 204", w.Code)
+	}
+	if w := orgRequest(newTestOrgRouter(""), http.MethodDelete, "org-b"); w.Code != http.StatusForbidden {
+		t.Fatalf("member: status %d, want 403", w.Code)
+	}
+}
@@ -0,0 +1,19 @@
+package app
+
+import (
+	"yourapp/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestMeta collects the caller's identity and client details for the service layer
+func requestMeta(c *gin.Context) service.RequestMeta {
+	return service.RequestMeta{
+		ActorID:        c.GetString("userID"),
+		ImpersonatorID: c.GetString("actorID"),
+		ClientID:       c.GetString("clientID"),
+		IPAddress:      c.ClientIP(),
+		UserAgent:      c.Request.UserAgent(),
+		RequestID:      c.GetString("requestID"),
+	}
+}
@@ -2,7 +2,6 @@ package app
 
 import (
 	"log"
-	"time"
 	"yourapp/internal/config"
 	"yourapp/internal/middleware"
 	"yourapp/internal/model"
@@ -15,7 +14,10 @@ import (
 	"gorm.io/gorm"
 )
 
-func NewRouter(cfg *config.Config) *gin.Engine {
+// NewRouter wires the API. The returned shutdown stops the in-process email
+// worker and outbox relay and closes RabbitMQ; call it once the HTTP server
+// has stopped taking requests.
+func NewRouter(cfg *config.Config) (*gin.Engine, func()) {
 	// Set Gin mode
 	if cfg.ServerPort == "5000" {
 		gin.SetMode(gin.DebugMode)
@@ -25,6 +27,9 @@ func NewRouter(cfg *config.Config) *gin.Engine {
 
 	r := gin.Default()
 
+	// Request ID middleware (used to correlate logs and audit events)
+	r.Use(middleware.RequestID())
+
 	// CORS middleware
 	r.Use(corsMiddleware(cfg.ClientURL))
 
@@ -42,56 +47,151 @@ func NewRouter(cfg *config.Config) *gin.Engine {
 	}
 
 	// Auto migrate
-	if err := db.AutoMigrate(&model.User{}); err != nil {
+	if err := autoMigrate(db); err != nil {
 		panic("Failed to migrate database: " + err.Error())
 	}
 
 	// Initialize repositories
 	userRepo := repository.NewUserRepository(db)
+	dataExportRepo := repository.NewDataExportRepository(db)
+	roleRepo := repository.NewRoleRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	orgRepo := repository.NewOrganizationRepository(db)
+	apiKeyRepo := repository.NewAPIKeyRepository(db)
+	oauthRepo := repository.NewOAuthRepository(db)
+	samlRepo := repository.NewSAMLRepository(db)
+	scimRepo := repository.NewSCIMRepository(db)
+	emailDeliveryRepo := repository.NewEmailDeliveryRepository(db)
+	outboxRepo := repository.NewOutboxRepository(db)
+
+	// Seed built-in roles and permissions
+	rbacService := service.NewRBACService(roleRepo, userRepo, cfg)
+	if err := rbacService.SeedDefaults(); err != nil {
+		panic("Failed to seed roles: " + err.Error())
+	}
+
+	// Load the OpenID Connect signing key
+	if cfg.OIDCSigningKeyFile == "" {
+		log.Println("Warning: OIDC_SIGNING_KEY_FILE not set, using an ephemeral key. ID tokens will not verify after a restart.")
+	}
+	signingKey, err := util.LoadSigningKey(cfg.OIDCSigningKeyFile)
+	if err != nil {
+		panic("Failed to load OIDC signing key: " + err.Error())
+	}
 
-	// Initialize RabbitMQ with retry logic
-	rabbitMQ := initRabbitMQWithRetry(cfg)
+	// The client keeps connecting in the background while RabbitMQ is
+	// unreachable; emails wait in the outbox until it is up
+	rabbitMQ := util.NewRabbitMQClient(cfg)
 
 	// Initialize email service
-	emailService := service.NewEmailService(cfg)
+	emailService, devInbox := newEmailService(cfg)
 
-	// Initialize email worker if RabbitMQ is available
+	// Run the email worker and outbox relay in-process unless a standalone
+	// worker (cmd/worker) sends the emails
 	var emailWorker *service.EmailWorker
-	if rabbitMQ != nil {
-		emailWorker = service.NewEmailWorker(emailService, rabbitMQ)
+	var outboxRelay *service.OutboxRelay
+	if !cfg.EmailWorkerEnabled {
+		log.Println("Email worker disabled in the API server (EMAIL_WORKER_ENABLED=false). Run cmd/worker to send emails.")
+	} else {
+		outboxRelay = service.NewOutboxRelay(outboxRepo, rabbitMQ, nil)
+		outboxRelay.Start()
+		emailWorker = service.NewEmailWorker(emailService, emailDeliveryRepo, rabbitMQ, nil, cfg)
 		if err := emailWorker.Start(); err != nil {
 			log.Printf("Warning: Failed to start email worker: %v", err)
 		} else {
 			log.Println("Email worker started successfully")
 		}
-	} else {
-		log.Println("Email worker not started - RabbitMQ connection failed. Will retry on first email send.")
-		// Start background goroutine to retry RabbitMQ connection and start email worker
-		go func() {
-			for {
-				time.Sleep(10 * time.Second)
-				newRabbitMQ := initRabbitMQWithRetry(cfg)
-				if newRabbitMQ != nil {
-					log.Println("RabbitMQ reconnected! Starting email worker...")
-					emailWorker = service.NewEmailWorker(emailService, newRabbitMQ)
-					if err := emailWorker.Start(); err != nil {
-						log.Printf("Warning: Failed to start email worker after reconnect: %v", err)
-					} else {
-						log.Println("Email worker started successfully after reconnect")
-						// Update rabbitMQ in authService (we'll need to modify authService to support this)
-						// For now, we'll rely on the reconnect logic in PublishEmail
-						break
-					}
-				}
+	}
+
+	// Same order as the standalone worker: stop taking jobs, let the relay
+	// finish its batch, then close the connection
+	shutdown := func() {
+		if emailWorker != nil {
+			if err := emailWorker.Stop(); err != nil {
+				log.Printf("Warning: Email worker did not stop cleanly: %v", err)
 			}
-		}()
+		}
+		if outboxRelay != nil {
+			outboxRelay.Stop()
+		}
+		if err := rabbitMQ.Close(); err != nil {
+			log.Printf("Warning: Failed to close RabbitMQ connection: %v", err)
+		}
 	}
 
 	// Initialize services
-	authService := service.NewAuthServiceWithConfig(userRepo, cfg.JWTSecret, rabbitMQ, cfg)
+	auditLogger := service.NewAuditLogger(auditRepo)
+	authService := service.NewAuthServiceWithConfig(userRepo, sessionRepo, oauthRepo, rbacService, auditLogger, cfg.JWTSecret, cfg)
+	dataExportService := service.NewDataExportService(dataExportRepo, userRepo, sessionRepo, auditRepo, emailDeliveryRepo, auditLogger, cfg)
+	adminService := service.NewAdminService(userRepo, sessionRepo, rbacService, authService, auditLogger)
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo, userRepo, rbacService, auditLogger)
+	orgService := service.NewOrganizationService(orgRepo, userRepo, authService, auditLogger, cfg)
+	oidcService := service.NewOIDCService(oauthRepo, userRepo, sessionRepo, authService, apiKeyService, rbacService, auditLogger, signingKey, cfg)
+	samlService := service.NewSAMLService(samlRepo, orgRepo, userRepo, authService, rbacService, auditLogger, cfg)
+	scimService := service.NewSCIMService(scimRepo, orgRepo, userRepo, sessionRepo, rbacService, auditLogger, cfg)
+	emailQueueService := service.NewEmailQueueService(rabbitMQ, auditLogger)
 
 	// Initialize handlers
-	authHandler := NewAuthHandler(authService, cfg.JWTSecret)
+	authHandler := NewAuthHandler(authService, apiKeyService)
+	userHandler := NewUserHandler(dataExportService, auditLogger)
+	adminHandler := NewAdminHandler(adminService, rbacService, auditLogger)
+	orgHandler := NewOrganizationHandler(orgService)
+	apiKeyHandler := NewAPIKeyHandler(apiKeyService)
+	oidcHandler := NewOIDCHandler(oidcService)
+	samlHandler := NewSAMLHandler(samlService)
+	scimHandler := NewSCIMHandler(scimService)
+	emailQueueHandler := NewEmailQueueHandler(emailQueueService)
+
+	// Development mail catcher
+	if devInbox != nil {
+		registerDevMailRoutes(r, devInbox)
+	}
+
+	// OpenID Connect provider
+	r.GET("/.well-known/openid-configuration", oidcHandler.Discovery)
+	oauth := r.Group("/oauth")
+	{
+		oauth.GET("/authorize", oidcHandler.Authorize)
+		oauth.GET("/consent", authHandler.AuthMiddleware(), authHandler.DenyAPIKey(), oidcHandler.GetConsent)
+		oauth.POST("/consent", authHandler.AuthMiddleware(), authHandler.DenyAPIKey(), authHandler.DenyImpersonation(), oidcHandler.SubmitConsent)
+		oauth.POST("/token", oidcHandler.Token)
+		oauth.POST("/device/code", oidcHandler.DeviceAuthorization)
+		oauth.GET("/device", authHandler.AuthMiddleware(), authHandler.DenyAPIKey(), oidcHandler.GetDeviceConsent)
+		oauth.POST("/device", authHandler.AuthMiddleware(), authHandler.DenyAPIKey(), authHandler.DenyImpersonation(), oidcHandler.SubmitDeviceConsent)
+		oauth.POST("/introspect", oidcHandler.Introspect)
+		oauth.POST("/revoke", oidcHandler.Revoke)
+		oauth.GET("/userinfo", authHandler.AuthMiddleware(), authHandler.RequireScopes(model.ScopeOpenID), oidcHandler.UserInfo)
+		oauth.POST("/userinfo", authHandler.AuthMiddleware(), authHandler.RequireScopes(model.ScopeOpenID), oidcHandler.UserInfo)
+		oauth.GET("/jwks", oidcHandler.JWKS)
+	}
+
+	// SAML single sign-on, one service provider per organization
+	saml := r.Group("/saml/:slug")
+	{
+		saml.GET("/metadata", samlHandler.Metadata)
+		saml.GET("/login", samlHandler.Login)
+		saml.POST("/acs", samlHandler.ACS)
+	}
+
+	// SCIM 2.0 provisioning, authenticated by organization SCIM tokens
+	scim := r.Group("/scim/v2", scimHandler.RequireSCIMToken())
+	{
+		scim.GET("/ServiceProviderConfig", scimHandler.ServiceProviderConfig)
+		scim.GET("/ResourceTypes", scimHandler.ResourceTypes)
+		scim.GET("/Users", scimHandler.ListUsers)
+		scim.POST("/Users", scimHandler.CreateUser)
+		scim.GET("/Users/:id", scimHandler.GetUser)
+		scim.PUT("/Users/:id", scimHandler.ReplaceUser)
+		scim.PATCH("/Users/:id", scimHandler.PatchUser)
+		scim.DELETE("/Users/:id", scimHandler.DeleteUser)
+		scim.GET("/Groups", scimHandler.ListGroups)
+		scim.POST("/Groups", scimHandler.UnsupportedGroupChange)
+		scim.GET("/Groups/:id", scimHandler.GetGroup)
+		scim.PUT("/Groups/:id", scimHandler.ReplaceGroup)
+		scim.PATCH("/Groups/:id", scimHandler.PatchGroup)
+		scim.DELETE("/Groups/:id", scimHandler.UnsupportedGroupChange)
+	}
 
 	// API routes
 	api := r.Group("/api/v1")
@@ -109,9 +209,97 @@ func NewRouter(cfg *config.Config) *gin.Engine {
 			auth.POST("/verify-reset-password", authHandler.VerifyResetPassword)
 			auth.POST("/reset-password", authHandler.ResetPassword)
 			auth.POST("/verify-email", authHandler.VerifyEmail)
+			auth.POST("/saml/exchange", samlHandler.ExchangeCode)
 
 			// Protected routes
-			auth.GET("/me", authHandler.AuthMiddleware(), authHandler.GetMe)
+			auth.GET("/me", authHandler.AuthMiddleware(), authHandler.RequireScopes(model.ScopeProfileRead), authHandler.GetMe)
+			auth.POST("/impersonation/stop", authHandler.AuthMiddleware(), adminHandler.StopImpersonation)
+		}
+
+		// User routes
+		users := api.Group("/users")
+		{
+			me := users.Group("/me", authHandler.AuthMiddleware())
+			{
+				me.POST("/export", authHandler.DenyImpersonation(), authHandler.RequireScopes(model.ScopeProfileWrite), userHandler.RequestDataExport)
+				me.GET("/security-activity", authHandler.RequireScopes(model.ScopeProfileRead), userHandler.GetSecurityActivity)
+				me.PUT("/locale", authHandler.DenyImpersonation(), authHandler.RequireScopes(model.ScopeProfileWrite), authHandler.UpdateLocale)
+
+				apiKeys := me.Group("/api-keys", authHandler.DenyAPIKey())
+				{
+					apiKeys.GET("", apiKeyHandler.ListAPIKeys)
+					apiKeys.POST("", authHandler.DenyImpersonation(), authHandler.DenyClientToken(), apiKeyHandler.CreateAPIKey)
+					apiKeys.DELETE("/:id", apiKeyHandler.RevokeAPIKey)
+				}
+			}
+		}
+
+		// Data export downloads (link sent by email)
+		api.GET("/exports/:token", userHandler.DownloadDataExport)
+
+		// Organization routes
+		orgs := api.Group("/orgs", authHandler.AuthMiddleware())
+		{
+			orgs.POST("", authHandler.RequireScopes(model.ScopeOrgsWrite), orgHandler.CreateOrganization)
+			orgs.GET("", authHandler.RequireScopes(model.ScopeOrgsRead), orgHandler.ListOrganizations)
+			orgs.POST("/:id/switch", authHandler.RequireScopes(model.ScopeOrgsRead), orgHandler.SwitchOrganization)
+		}
+
+		// Active organization routes (X-Org-ID header or org_id claim)
+		org := api.Group("/org", authHandler.AuthMiddleware(), orgHandler.RequireOrganization())
+		{
+			org.GET("", authHandler.RequireScopes(model.ScopeOrgsRead), orgHandler.GetCurrentOrganization)
+			org.GET("/members", authHandler.RequireScopes(model.ScopeOrgsRead), orgHandler.ListMembers)
+			org.DELETE("/members/:userId", authHandler.RequireScopes(model.ScopeOrgsWrite), orgHandler.RequireOrgRole(model.OrgRoleOwner, model.OrgRoleAdmin), orgHandler.RemoveMember)
+			org.GET("/invitations", authHandler.RequireScopes(model.ScopeOrgsRead), orgHandler.RequireOrgRole(model.OrgRoleOwner, model.OrgRoleAdmin), orgHandler.ListInvitations)
+			org.POST("/invitations", authHandler.RequireScopes(model.ScopeOrgsWrite), orgHandler.RequireOrgRole(model.OrgRoleOwner, model.OrgRoleAdmin), orgHandler.Invite)
+			org.GET("/domains", authHandler.RequireScopes(model.ScopeOrgsRead), orgHandler.RequireOrgRole(model.OrgRoleOwner, model.OrgRoleAdmin), orgHandler.ListDomains)
+			org.POST("/domains", authHandler.DenyImpersonation(), authHandler.RequireScopes(model.ScopeOrgsWrite), orgHandler.RequireOrgRole(model.OrgRoleOwner), orgHandler.AddDomain)
+			org.POST("/domains/:domain/verify", authHandler.DenyImpersonation(), authHandler.RequireScopes(model.ScopeOrgsWrite), orgHandler.RequireOrgRole(model.OrgRoleOwner), orgHandler.VerifyDomain)
+			org.DELETE("/domains/:domain", authHandler.DenyImpersonation(), authHandler.RequireScopes(model.ScopeOrgsWrite), orgHandler.RequireOrgRole(model.OrgRoleOwner), orgHandler.RemoveDomain)
+			org.GET("/saml", authHandler.RequireScopes(model.ScopeOrgsRead), orgHandler.RequireOrgRole(model.OrgRoleOwner, model.OrgRoleAdmin), samlHandler.GetProvider)
+			org.PUT("/saml", authHandler.DenyImpersonation(), authHandler.RequireScopes(model.ScopeOrgsWrite), orgHandler.RequireOrgRole(model.OrgRoleOwner), samlHandler.ConfigureProvider)
+			org.DELETE("/saml", authHandler.DenyImpersonation(), authHandler.RequireScopes(model.ScopeOrgsWrite), orgHandler.RequireOrgRole(model.OrgRoleOwner), samlHandler.DeleteProvider)
+			org.GET("/scim-tokens", authHandler.RequireScopes(model.ScopeOrgsRead), orgHandler.RequireOrgRole(model.OrgRoleOwner, model.OrgRoleAdmin), scimHandler.ListTokens)
+			org.POST("/scim-tokens", authHandler.DenyImpersonation(), authHandler.RequireScopes(model.ScopeOrgsWrite), orgHandler.RequireOrgRole(model.OrgRoleOwner), scimHandler.CreateToken)
+			org.DELETE("/scim-tokens/:id", authHandler.DenyImpersonation(), authHandler.RequireScopes(model.ScopeOrgsWrite), orgHandler.RequireOrgRole(model.OrgRoleOwner), scimHandler.RevokeToken)
+		}
+
+		// Invitation acceptance (link sent by email)
+		invitations := api.Group("/invitations")
+		{
+			invitations.GET("/:token", orgHandler.GetInvitation)
+			invitations.POST("/accept", authHandler.AuthMiddleware(), authHandler.RequireScopes(model.ScopeOrgsWrite), orgHandler.AcceptInvitation)
+			invitations.POST("/register", orgHandler.AcceptInvitationWithRegistration)
+		}
+
+		// Admin routes
+		admin := api.Group("/admin", authHandler.AuthMiddleware(), authHandler.DenyImpersonation())
+		{
+			admin.GET("/roles", authHandler.RequirePermission(model.PermissionRolesRead), adminHandler.ListRoles)
+			admin.GET("/audit-events", authHandler.RequirePermission(model.PermissionAuditRead), adminHandler.ListAuditEvents)
+			admin.GET("/email-dlq", authHandler.RequirePermission(model.PermissionEmailQueueRead), emailQueueHandler.ListDeadLetters)
+			admin.POST("/email-dlq/replay", authHandler.RequirePermission(model.PermissionEmailQueueWrite), emailQueueHandler.ReplayDeadLetters)
+
+			oauthClients := admin.Group("/oauth-clients")
+			{
+				oauthClients.GET("", authHandler.RequirePermission(model.PermissionClientsRead), oidcHandler.ListClients)
+				oauthClients.POST("", authHandler.RequirePermission(model.PermissionClientsWrite), oidcHandler.CreateClient)
+				oauthClients.DELETE("/:clientId", authHandler.RequirePermission(model.PermissionClientsWrite), oidcHandler.DeleteClient)
+			}
+
+			adminUsers := admin.Group("/users")
+			{
+				adminUsers.GET("", authHandler.RequirePermission(model.PermissionUsersRead), adminHandler.ListUsers)
+				adminUsers.GET("/:id", authHandler.RequirePermission(model.PermissionUsersRead), adminHandler.GetUser)
+				adminUsers.POST("/:id/activate", authHandler.RequirePermission(model.PermissionUsersWrite), adminHandler.ActivateUser)
+				adminUsers.POST("/:id/deactivate", authHandler.RequirePermission(model.PermissionUsersWrite), adminHandler.DeactivateUser)
+				adminUsers.POST("/:id/verify", authHandler.RequirePermission(model.PermissionUsersWrite), adminHandler.VerifyUser)
+				adminUsers.POST("/:id/force-password-reset", authHandler.RequirePermission(model.PermissionUsersWrite), adminHandler.ForcePasswordReset)
+				adminUsers.PUT("/:id/roles", authHandler.RequirePermission(model.PermissionRolesWrite), adminHandler.SetUserRoles)
+				adminUsers.DELETE("/:id/sessions", authHandler.RequirePermission(model.PermissionUsersWrite), adminHandler.RevokeSessions)
+				adminUsers.POST("/:id/impersonate", authHandler.RequirePermission(model.PermissionUsersImpersonate), adminHandler.Impersonate)
+			}
 		}
 	}
 
@@ -120,7 +308,21 @@ func NewRouter(cfg *config.Config) *gin.Engine {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
-	return r
+	return r, shutdown
+}
+
+func registerDevMailRoutes(r *gin.Engine, devInbox *service.DevInbox) {
+	devMailHandler := NewDevMailHandler(devInbox)
+	devMail := r.Group("/_dev/mail")
+	{
+		devMail.GET("", devMailHandler.Index)
+		devMail.POST("/clear", devMailHandler.Clear)
+		devMail.GET("/messages", devMailHandler.List)
+		devMail.DELETE("/messages", devMailHandler.Clear)
+		devMail.GET("/:id", devMailHandler.Show)
+		devMail.GET("/:id/html", devMailHandler.HTML)
+		devMail.GET("/:id/raw", devMailHandler.Raw)
+	}
 }
 
 func initDB(cfg *config.Config) (*gorm.DB, error) {
@@ -142,42 +344,52 @@ func initDB(cfg *config.Config) (*gorm.DB, error) {
 	return db, nil
 }
 
-// initRabbitMQWithRetry attempts to connect to RabbitMQ with exponential backoff retry
-func initRabbitMQWithRetry(cfg *config.Config) *util.RabbitMQClient {
-	maxRetries := 10
-	initialDelay := 2 * time.Second
-	maxDelay := 30 * time.Second
-
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		rabbitMQ, err := util.NewRabbitMQClient(cfg)
-		if err == nil {
-			log.Printf("RabbitMQ connected successfully on attempt %d", attempt)
-			return rabbitMQ
-		}
-
-		if attempt < maxRetries {
-			// Calculate delay with exponential backoff
-			delay := initialDelay * time.Duration(1<<uint(attempt-1))
-			if delay > maxDelay {
-				delay = maxDelay
-			}
+// autoMigrate creates or updates the tables of every model
+func autoMigrate(db *gorm.DB) error {
+	return db.AutoMigrate(
+		&model.User{},
+		&model.DataExport{},
+		&model.Role{},
+		&model.Permission{},
+		&model.UserRole{},
+		&model.Session{},
+		&model.AuditEvent{},
+		&model.Organization{},
+		&model.Membership{},
+		&model.Invitation{},
+		&model.OrganizationDomain{},
+		&model.APIKey{},
+		&model.OAuthClient{},
+		&model.OAuthAuthorizationCode{},
+		&model.OAuthConsent{},
+		&model.OAuthDeviceCode{},
+		&model.SAMLProvider{},
+		&model.SAMLLoginRequest{},
+		&model.SCIMToken{},
+		&model.EmailDelivery{},
+		&model.OutboxMessage{},
+	)
+}
 
-			log.Printf("Failed to connect to RabbitMQ (attempt %d/%d): %v. Retrying in %v...", attempt, maxRetries, err, delay)
-			time.Sleep(delay)
-		} else {
-			log.Printf("Warning: Failed to connect to RabbitMQ after %d attempts: %v. Email sending will be disabled.", maxRetries, err)
-			log.Println("Note: RabbitMQ will be retried automatically when email is sent (if connection is restored)")
-		}
+// newEmailService builds the email service on the configured transport. The
+// dev inbox, when enabled, catches every email before it reaches the
+// transport and is returned so its pages can be mounted.
+func newEmailService(cfg *config.Config) (service.EmailService, *service.DevInbox) {
+	emailTransport := service.NewTransport(cfg)
+	var devInbox *service.DevInbox
+	if cfg.EmailDevInbox {
+		devInbox = service.NewDevInbox(emailTransport, 200)
+		emailTransport = devInbox
+		log.Println("Warning: EMAIL_DEV_INBOX is enabled, emails are readable at /_dev/mail. Do not enable it in production.")
 	}
-
-	return nil
+	return service.NewEmailServiceWithTransport(cfg, emailTransport), devInbox
 }
 
 func corsMiddleware(clientURL string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", clientURL)
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Request-ID, X-Org-ID, X-API-Key")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
 
 		if c.Request.Method == "OPTIONS" {
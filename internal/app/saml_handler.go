@@ -0,0 +1,121 @@
+package app
+
+import (
+	"net/http"
+
+	"yourapp/internal/service"
+	"yourapp/internal/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SAMLHandler serves SAML single sign-on for organizations. The browser-facing
+// endpoints answer with redirects and XML instead of the usual envelope.
+type SAMLHandler struct {
+	samlService service.SAMLService
+}
+
+func NewSAMLHandler(samlService service.SAMLService) *SAMLHandler {
+	return &SAMLHandler{
+		samlService: samlService,
+	}
+}
+
+// Metadata handles publishing our service provider metadata for an organization
+// GET /saml/:slug/metadata
+func (h *SAMLHandler) Metadata(c *gin.Context) {
+	metadata, err := h.samlService.Metadata(c.Param("slug"))
+	if err != nil {
+		util.NotFound(c, err.Error())
+		return
+	}
+
+	c.Data(http.StatusOK, "application/samlmetadata+xml", metadata)
+}
+
+// Login handles sending the browser to the organization's identity provider
+// GET /saml/:slug/login
+func (h *SAMLHandler) Login(c *gin.Context) {
+	location, err := h.samlService.StartLogin(c.Param("slug"))
+	if err != nil {
+		util.NotFound(c, err.Error())
+		return
+	}
+
+	c.Redirect(http.StatusFound, location)
+}
+
+// ACS handles the identity provider posting its response back
+// POST /saml/:slug/acs
+func (h *SAMLHandler) ACS(c *gin.Context) {
+	samlResponse := c.PostForm("SAMLResponse")
+	if samlResponse == "" {
+		util.BadRequest(c, "SAMLResponse is required")
+		return
+	}
+
+	// 303 so the browser follows up with a GET
+	c.Redirect(http.StatusSeeOther, h.samlService.ConsumeResponse(c.Param("slug"), samlResponse, requestMeta(c)))
+}
+
+// ExchangeCode handles trading the SSO callback code for tokens
+// POST /api/v1/auth/saml/exchange
+func (h *SAMLHandler) ExchangeCode(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	resp, err := h.samlService.ExchangeCode(req.Code, requestMeta(c))
+	if err != nil {
+		util.Unauthorized(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Login successful", resp)
+}
+
+// GetProvider handles showing the active organization's identity provider
+// GET /api/v1/org/saml
+func (h *SAMLHandler) GetProvider(c *gin.Context) {
+	provider, err := h.samlService.GetProvider(c.GetString("orgID"))
+	if err != nil {
+		util.NotFound(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "SAML configuration retrieved successfully", gin.H{"provider": provider})
+}
+
+// ConfigureProvider handles setting the active organization's identity provider from its metadata
+// PUT /api/v1/org/saml
+func (h *SAMLHandler) ConfigureProvider(c *gin.Context) {
+	var req service.ConfigureSAMLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	provider, err := h.samlService.ConfigureProvider(c.GetString("orgID"), req, requestMeta(c))
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "SAML configuration saved successfully", gin.H{"provider": provider})
+}
+
+// DeleteProvider handles removing the active organization's identity provider
+// DELETE /api/v1/org/saml
+func (h *SAMLHandler) DeleteProvider(c *gin.Context) {
+	if err := h.samlService.DeleteProvider(c.GetString("orgID"), requestMeta(c)); err != nil {
+		util.NotFound(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "SAML configuration removed successfully", nil)
+}
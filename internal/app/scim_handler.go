@@ -0,0 +1,306 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"yourapp/internal/service"
+	"yourapp/internal/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scimContentType is the media type of SCIM requests and responses
+const scimContentType = "application/scim+json"
+
+// SCIMHandler serves the SCIM 2.0 provisioning API. SCIM endpoints answer with
+// SCIM resources and error messages instead of the usual envelope.
+type SCIMHandler struct {
+	scimService service.SCIMService
+}
+
+func NewSCIMHandler(scimService service.SCIMService) *SCIMHandler {
+	return &SCIMHandler{
+		scimService: scimService,
+	}
+}
+
+// scimJSON writes a SCIM response body
+func scimJSON(c *gin.Context, status int, body interface{}) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		scimErrorResponse(c, err)
+		return
+	}
+	c.Data(status, scimContentType, data)
+}
+
+// scimErrorResponse writes an error in the SCIM error schema (RFC 7644 section 3.12)
+func scimErrorResponse(c *gin.Context, err error) {
+	status, scimType, detail := http.StatusInternalServerError, "", "Internal server error"
+
+	var scimErr *service.SCIMError
+	if errors.As(err, &scimErr) {
+		status, scimType, detail = scimErr.Status, scimErr.ScimType, scimErr.Detail
+	} else {
+		log.Printf("SCIM request failed: %v", err)
+	}
+
+	body := gin.H{
+		"schemas": []string{util.SCIMSchemaError},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+	data, _ := json.Marshal(body)
+	c.Abort()
+	c.Data(status, scimContentType, data)
+}
+
+// RequireSCIMToken authenticates the organization's SCIM bearer token and
+// sets orgID for the request
+func (h *SCIMHandler) RequireSCIMToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		token, err := h.scimService.Authenticate(raw)
+		if err != nil {
+			scimErrorResponse(c, &service.SCIMError{Status: http.StatusUnauthorized, Detail: err.Error()})
+			return
+		}
+
+		c.Set("orgID", token.OrganizationID)
+		c.Set("scimTokenID", token.ID)
+		c.Next()
+	}
+}
+
+// ServiceProviderConfig handles describing the supported SCIM features
+// GET /scim/v2/ServiceProviderConfig
+func (h *SCIMHandler) ServiceProviderConfig(c *gin.Context) {
+	scimJSON(c, http.StatusOK, h.scimService.ServiceProviderConfig())
+}
+
+// ResourceTypes handles listing the SCIM resource types
+// GET /scim/v2/ResourceTypes
+func (h *SCIMHandler) ResourceTypes(c *gin.Context) {
+	scimJSON(c, http.StatusOK, h.scimService.ResourceTypes())
+}
+
+// ListUsers handles listing the organization's provisioned users
+// GET /scim/v2/Users
+func (h *SCIMHandler) ListUsers(c *gin.Context) {
+	var query service.SCIMListQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		scimErrorResponse(c, &service.SCIMError{Status: http.StatusBadRequest, ScimType: "invalidValue", Detail: err.Error()})
+		return
+	}
+
+	resp, err := h.scimService.ListUsers(c.GetString("orgID"), query)
+	if err != nil {
+		scimErrorResponse(c, err)
+		return
+	}
+
+	scimJSON(c, http.StatusOK, resp)
+}
+
+// GetUser handles showing a provisioned user
+// GET /scim/v2/Users/:id
+func (h *SCIMHandler) GetUser(c *gin.Context) {
+	user, err := h.scimService.GetUser(c.GetString("orgID"), c.Param("id"))
+	if err != nil {
+		scimErrorResponse(c, err)
+		return
+	}
+
+	scimJSON(c, http.StatusOK, user)
+}
+
+// CreateUser handles provisioning a user into the organization
+// POST /scim/v2/Users
+func (h *SCIMHandler) CreateUser(c *gin.Context) {
+	var req service.SCIMUser
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimErrorResponse(c, &service.SCIMError{Status: http.StatusBadRequest, ScimType: "invalidSyntax", Detail: err.Error()})
+		return
+	}
+
+	user, err := h.scimService.CreateUser(c.GetString("orgID"), req, requestMeta(c))
+	if err != nil {
+		scimErrorResponse(c, err)
+		return
+	}
+
+	c.Header("Location", user.Meta.Location)
+	scimJSON(c, http.StatusCreated, user)
+}
+
+// ReplaceUser handles replacing a provisioned user's attributes
+// PUT /scim/v2/Users/:id
+func (h *SCIMHandler) ReplaceUser(c *gin.Context) {
+	var req service.SCIMUser
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimErrorResponse(c, &service.SCIMError{Status: http.StatusBadRequest, ScimType: "invalidSyntax", Detail: err.Error()})
+		return
+	}
+
+	user, err := h.scimService.ReplaceUser(c.GetString("orgID"), c.Param("id"), req, requestMeta(c))
+	if err != nil {
+		scimErrorResponse(c, err)
+		return
+	}
+
+	scimJSON(c, http.StatusOK, user)
+}
+
+// PatchUser handles partially updating a provisioned user, e.g. deactivating it
+// PATCH /scim/v2/Users/:id
+func (h *SCIMHandler) PatchUser(c *gin.Context) {
+	var req service.SCIMPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimErrorResponse(c, &service.SCIMError{Status: http.StatusBadRequest, ScimType: "invalidSyntax", Detail: err.Error()})
+		return
+	}
+
+	user, err := h.scimService.PatchUser(c.GetString("orgID"), c.Param("id"), req, requestMeta(c))
+	if err != nil {
+		scimErrorResponse(c, err)
+		return
+	}
+
+	scimJSON(c, http.StatusOK, user)
+}
+
+// DeleteUser handles removing a user from the organization
+// DELETE /scim/v2/Users/:id
+func (h *SCIMHandler) DeleteUser(c *gin.Context) {
+	if err := h.scimService.DeleteUser(c.GetString("orgID"), c.Param("id"), requestMeta(c)); err != nil {
+		scimErrorResponse(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListGroups handles listing the organization role groups
+// GET /scim/v2/Groups
+func (h *SCIMHandler) ListGroups(c *gin.Context) {
+	var query service.SCIMListQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		scimErrorResponse(c, &service.SCIMError{Status: http.StatusBadRequest, ScimType: "invalidValue", Detail: err.Error()})
+		return
+	}
+
+	resp, err := h.scimService.ListGroups(c.GetString("orgID"), query)
+	if err != nil {
+		scimErrorResponse(c, err)
+		return
+	}
+
+	scimJSON(c, http.StatusOK, resp)
+}
+
+// GetGroup handles showing a role group and its members
+// GET /scim/v2/Groups/:id
+func (h *SCIMHandler) GetGroup(c *gin.Context) {
+	group, err := h.scimService.GetGroup(c.GetString("orgID"), c.Param("id"))
+	if err != nil {
+		scimErrorResponse(c, err)
+		return
+	}
+
+	scimJSON(c, http.StatusOK, group)
+}
+
+// ReplaceGroup handles replacing a role group's members
+// PUT /scim/v2/Groups/:id
+func (h *SCIMHandler) ReplaceGroup(c *gin.Context) {
+	var req service.SCIMGroup
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimErrorResponse(c, &service.SCIMError{Status: http.StatusBadRequest, ScimType: "invalidSyntax", Detail: err.Error()})
+		return
+	}
+
+	group, err := h.scimService.ReplaceGroup(c.GetString("orgID"), c.Param("id"), req, requestMeta(c))
+	if err != nil {
+		scimErrorResponse(c, err)
+		return
+	}
+
+	scimJSON(c, http.StatusOK, group)
+}
+
+// PatchGroup handles adding and removing role group members
+// PATCH /scim/v2/Groups/:id
+func (h *SCIMHandler) PatchGroup(c *gin.Context) {
+	var req service.SCIMPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimErrorResponse(c, &service.SCIMError{Status: http.StatusBadRequest, ScimType: "invalidSyntax", Detail: err.Error()})
+		return
+	}
+
+	group, err := h.scimService.PatchGroup(c.GetString("orgID"), c.Param("id"), req, requestMeta(c))
+	if err != nil {
+		scimErrorResponse(c, err)
+		return
+	}
+
+	scimJSON(c, http.StatusOK, group)
+}
+
+// UnsupportedGroupChange handles creating or deleting groups, which are fixed
+// POST /scim/v2/Groups, DELETE /scim/v2/Groups/:id
+func (h *SCIMHandler) UnsupportedGroupChange(c *gin.Context) {
+	scimErrorResponse(c, &service.SCIMError{
+		Status:   http.StatusForbidden,
+		ScimType: "mutability",
+		Detail:   "groups are the organization roles admin and member and cannot be created or deleted",
+	})
+}
+
+// CreateToken handles issuing a SCIM token for the active organization; the token is only returned once
+// POST /api/v1/org/scim-tokens
+func (h *SCIMHandler) CreateToken(c *gin.Context) {
+	var req service.CreateSCIMTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	resp, err := h.scimService.CreateToken(c.GetString("orgID"), req, requestMeta(c))
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusCreated, "SCIM token created. Copy it now, it will not be shown again.", resp)
+}
+
+// ListTokens handles listing the active organization's SCIM tokens
+// GET /api/v1/org/scim-tokens
+func (h *SCIMHandler) ListTokens(c *gin.Context) {
+	tokens, err := h.scimService.ListTokens(c.GetString("orgID"))
+	if err != nil {
+		util.InternalServerError(c, "Failed to retrieve SCIM tokens")
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "SCIM tokens retrieved successfully", gin.H{"scim_tokens": tokens})
+}
+
+// RevokeToken handles revoking one of the active organization's SCIM tokens
+// DELETE /api/v1/org/scim-tokens/:id
+func (h *SCIMHandler) RevokeToken(c *gin.Context) {
+	if err := h.scimService.RevokeToken(c.GetString("orgID"), c.Param("id"), requestMeta(c)); err != nil {
+		util.NotFound(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "SCIM token revoked successfully", nil)
+}
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"yourapp/internal/service"
+	"yourapp/internal/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UserHandler struct {
+	dataExportService service.DataExportService
+	auditLogger       service.AuditLogger
+}
+
+func NewUserHandler(dataExportService service.DataExportService, auditLogger service.AuditLogger) *UserHandler {
+	return &UserHandler{
+		dataExportService: dataExportService,
+		auditLogger:       auditLogger,
+	}
+}
+
+// RequestDataExport starts a personal data export for the current user
+// POST /api/v1/users/me/export
+func (h *UserHandler) RequestDataExport(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	export, err := h.dataExportService.RequestExport(userID.(string), requestMeta(c))
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusAccepted, "Data export started. A download link will be sent to your email.", gin.H{"export": export})
+}
+
+// GetSecurityActivity handles listing recent security events on the current user's account
+// GET /api/v1/users/me/security-activity?limit=
+func (h *UserHandler) GetSecurityActivity(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	events, err := h.auditLogger.RecentForUser(userID.(string), limit)
+	if err != nil {
+		util.InternalServerError(c, "Failed to retrieve security activity")
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Security activity retrieved successfully", gin.H{"events": events})
+}
+
+// DownloadDataExport serves a finished export archive from a time-limited link
+// GET /api/v1/exports/:token
+func (h *UserHandler) DownloadDataExport(c *gin.Context) {
+	export, err := h.dataExportService.GetDownload(c.Param("token"))
+	if err != nil {
+		util.NotFound(c, err.Error())
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.FileAttachment(export.FilePath, fmt.Sprintf("data-export-%s.zip", export.CreatedAt.Format("20060102")))
+}
@@ -0,0 +1,156 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"yourapp/internal/config"
+	"yourapp/internal/repository"
+	"yourapp/internal/service"
+	"yourapp/internal/util"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Worker sends emails outside the API server: it consumes the email queue,
+// relays the outbox and serves health and metrics endpoints on WorkerPort.
+// Run API servers with EMAIL_WORKER_ENABLED=false to leave the sending to it.
+type Worker struct {
+	cfg         *config.Config
+	db          *gorm.DB
+	rabbitMQ    *util.RabbitMQClient
+	metrics     *service.WorkerMetrics
+	emailWorker *service.EmailWorker
+	outboxRelay *service.OutboxRelay
+	devInbox    *service.DevInbox
+}
+
+func NewWorker(cfg *config.Config) (*Worker, error) {
+	db, err := initDB(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	if err := autoMigrate(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	// Unreachable at startup is not fatal: the client keeps connecting and
+	// /health reports RabbitMQ down meanwhile
+	rabbitMQ := util.NewRabbitMQClient(cfg)
+
+	emailService, devInbox := newEmailService(cfg)
+	metrics := service.NewWorkerMetrics()
+
+	return &Worker{
+		cfg:         cfg,
+		db:          db,
+		rabbitMQ:    rabbitMQ,
+		metrics:     metrics,
+		emailWorker: service.NewEmailWorker(emailService, repository.NewEmailDeliveryRepository(db), rabbitMQ, metrics, cfg),
+		outboxRelay: service.NewOutboxRelay(repository.NewOutboxRepository(db), rabbitMQ, metrics),
+		devInbox:    devInbox,
+	}, nil
+}
+
+// Run starts the worker and blocks until ctx is done, then lets the emails
+// being sent finish before closing the connections
+func (w *Worker) Run(ctx context.Context) error {
+	if err := w.emailWorker.Start(); err != nil {
+		w.rabbitMQ.Close()
+		return fmt.Errorf("failed to start email worker: %w", err)
+	}
+	w.outboxRelay.Start()
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf("%s:%s", w.cfg.ServerHost, w.cfg.WorkerPort),
+		Handler: w.router(),
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Worker health and metrics listening on %s", server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		log.Println("Shutting down worker...")
+	case err := <-serverErr:
+		runErr = fmt.Errorf("worker HTTP server failed: %w", err)
+	}
+
+	// Stop taking new jobs first; the relay and the connection are still
+	// needed while the emails in flight are retried or dead-lettered
+	if err := w.emailWorker.Stop(); err != nil {
+		log.Printf("Warning: Email worker did not stop cleanly: %v", err)
+	}
+	w.outboxRelay.Stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Warning: Failed to shut down worker HTTP server: %v", err)
+	}
+	if err := w.rabbitMQ.Close(); err != nil {
+		log.Printf("Warning: Failed to close RabbitMQ connection: %v", err)
+	}
+
+	log.Println("Worker stopped")
+	return runErr
+}
+
+func (w *Worker) router() *gin.Engine {
+	r := gin.New()
+	r.Use(gin.Recovery())
+
+	// Health check; fails while the database or RabbitMQ is unreachable so
+	// orchestrators can restart or stop routing to the worker
+	r.GET("/health", func(c *gin.Context) {
+		checks := gin.H{"database": "ok", "rabbitmq": "ok"}
+		healthy := true
+
+		if sqlDB, err := w.db.DB(); err != nil || sqlDB.PingContext(c.Request.Context()) != nil {
+			checks["database"] = "unavailable"
+			healthy = false
+		}
+		if !w.rabbitMQ.IsConnected() {
+			checks["rabbitmq"] = "reconnecting"
+			healthy = false
+		}
+
+		if !healthy {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "checks": checks})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "checks": checks})
+	})
+
+	// Prometheus metrics
+	r.GET("/metrics", func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.Status(http.StatusOK)
+		w.metrics.WritePrometheus(c.Writer)
+
+		connected := 0
+		if w.rabbitMQ.IsConnected() {
+			connected = 1
+		}
+		fmt.Fprintln(c.Writer, "# HELP rabbitmq_connected Whether the worker is connected to RabbitMQ.")
+		fmt.Fprintln(c.Writer, "# TYPE rabbitmq_connected gauge")
+		fmt.Fprintf(c.Writer, "rabbitmq_connected %d\n", connected)
+	})
+
+	// Development mail catcher, for the emails this worker sends
+	if w.devInbox != nil {
+		registerDevMailRoutes(r, w.devInbox)
+	}
+
+	return r
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"yourapp/internal/config"
+	"yourapp/internal/service"
+	"yourapp/internal/util"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// pingConnector stands in for Postgres in health checks: connecting fails
+// with err, and otherwise the connection answers pings
+type pingConnector struct{ err error }
+
+func (c pingConnector) Connect(context.Context) (driver.Conn, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return pingConn{}, nil
+}
+
+func (c pingConnector) Driver() driver.Driver { return nil }
+
+type pingConn struct{}
+
+func (pingConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (pingConn) Close() error                        { return nil }
+func (pingConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func newTestWorker(t *testing.T, dbErr error) *Worker {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	sqlDB := sql.OpenDB(pingConnector{err: dbErr})
+	t.Cleanup(func() { sqlDB.Close() })
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Worker{
+		cfg: &config.Config{},
+		db:  db,
+		// A client that has not connected, as while the supervisor reconnects
+		rabbitMQ: &util.RabbitMQClient{},
+		metrics:  service.NewWorkerMetrics(),
+	}
+}
+
+func workerHealth(t *testing.T, w *Worker) (int, map[string]string) {
+	t.Helper()
+	rec := devMailRequest(w.router(), http.MethodGet, "/health")
+	var resp struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if (rec.Code == http.StatusOK) != (resp.Status == "ok") {
+		t.Fatalf("status %d reported as %q", rec.Code, resp.Status)
+	}
+	return rec.Code, resp.Checks
+}
+
+func TestWorkerHealthReportsRabbitMQReconnecting(t *testing.T) {
+	code, checks := workerHealth(t, newTestWorker(t, nil))
+	if code != http.StatusServiceUnavailable || checks["database"] != "ok" || checks["rabbitmq"] != "reconnecting" {
+		t.Fatalf("health = %d %v", code, checks)
+	}
+}
+
+func TestWorkerHealthReportsDatabaseDown(t *testing.T) {
+	code, checks := workerHealth(t, newTestWorker(t, errors.New("connection refused")))
+	if code != http.StatusServiceUnavailable || checks["database"] != "unavailable" {
+		t.Fatalf("health = %d %v", code, checks)
+	}
+}
+
+func TestWorkerMetricsEndpoint(t *testing.T) {
+	rec := devMailRequest(newTestWorker(t, nil).router(), http.MethodGet, "/metrics")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("metrics = %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	for _, line := range []string{`email_jobs_total{result="sent"} 0`, "email_jobs_in_flight 0", "rabbitmq_connected 0"} {
+		if !strings.Contains(rec.Body.String(), line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, rec.Body.String())
+		}
+	}
+}
+
+func TestWorkerServesDevMailOnlyWhenEnabled(t *testing.T) {
+	w := newTestWorker(t, nil)
+	if rec := devMailRequest(w.router(), http.MethodGet, "/_dev/mail"); rec.Code != http.StatusNotFound {
+		t.Fatalf("dev mail without the inbox = %d", rec.Code)
+	}
+	w.devInbox = service.NewDevInbox(service.NewCaptureTransport(), 10)
+	if rec := devMailRequest(w.router(), http.MethodGet, "/_dev/mail"); rec.Code != http.StatusOK {
+		t.Fatalf("dev mail with the inbox = %d", rec.Code)
+	}
+}
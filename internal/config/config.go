@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -12,6 +13,7 @@ type Config struct {
 	ServerPort string
 	ServerHost string
 	ClientURL  string
+	APIURL     string // Public base URL of this API, used for links in emails
 
 	// Database
 	PostgresHost     string
@@ -25,6 +27,25 @@ type Config struct {
 	// JWT
 	JWTSecret string
 
+	// RBAC
+	AdminEmails []string // Users granted the admin role once they verify their email
+
+	// OpenID Connect provider
+	OIDCIssuer         string // Defaults to APIURL
+	OIDCSigningKeyFile string // PEM RSA private key used to sign ID tokens
+
+	// LDAP / Active Directory (disabled when LDAPURL is empty)
+	LDAPURL            string // ldap://host:389 or ldaps://host:636
+	LDAPStartTLS       bool
+	LDAPBindDN         string // Service account used to search; empty for anonymous search
+	LDAPBindPassword   string
+	LDAPBaseDN         string
+	LDAPUserFilter     string // {email} is replaced with the escaped login email
+	LDAPEmailAttribute string
+	LDAPNameAttribute  string
+	LDAPGroupAttribute string
+	LDAPGroupRoles     map[string]string // Group DN (lower-cased) to role name
+
 	// Google OAuth
 	GoogleClientID     string
 	GoogleClientSecret string
@@ -40,6 +61,8 @@ type Config struct {
 	RabbitMQUser     string
 	RabbitMQPassword string
 
+	RabbitMQPublishTimeoutSeconds int // How long a publish waits for the broker's confirm
+
 	// Email
 	EmailFrom    string
 	EmailName    string // Custom sender name (e.g., "Zacode")
@@ -48,10 +71,34 @@ type Config struct {
 	SMTPUsername string
 	SMTPPassword string
 
+	SMTPSecurity       string // starttls, tls (implicit TLS, port 465) or none
+	SMTPAuth           string // plain, login, cram-md5 or none
+	SMTPTimeoutSeconds int
+
+	EmailTransport     string // smtp, file, capture or log
+	EmailFileDir       string // Where the file transport writes
+	EmailFileFormat    string // maildir or eml
+	EmailDevInbox      bool   // Keep recent emails in memory and serve them at /_dev/mail
+	EmailTemplateDir   string // Optional directory overriding the embedded email templates
+	EmailDefaultLocale string // Locale used when the recipient's has no catalog
+	EmailMaxAttempts   int    // Send attempts before a job goes to the dead-letter queue
+
+	EmailWorkerEnabled bool   // Run the email worker and outbox relay inside the API server
+	WorkerPort         string // Health and metrics port of the standalone worker (cmd/worker)
+
+	EmailWorkerConcurrency        int // Emails the worker sends at once
+	EmailWorkerPrefetch           int // Unacked email jobs RabbitMQ sends the worker ahead
+	EmailWorkerStopTimeoutSeconds int // How long Stop waits for emails being sent
+	EmailDomainRatePerMinute      int // Emails per minute to one recipient domain; 0 disables the limit
+
 	// Rate Limiting
 	RateLimitEnabled bool
 	RateLimitRPS     int // Requests per second
 	RateLimitBurst   int // Burst size
+
+	// Data Export
+	ExportDir          string
+	ExportLinkTTLHours int
 }
 
 func Load() (*Config, error) {
@@ -63,6 +110,7 @@ func Load() (*Config, error) {
 		ServerPort: getEnv("PORT", "5000"),
 		ServerHost: getEnv("SERVER_HOST", "0.0.0.0"),
 		ClientURL:  getEnv("CLIENT_URL", "http://localhost:3000"),
+		APIURL:     getEnv("API_URL", "http://localhost:5000"),
 
 		// Database
 		PostgresHost:     getEnv("POSTGRES_HOST", "localhost"),
@@ -76,6 +124,25 @@ func Load() (*Config, error) {
 		// JWT
 		JWTSecret: getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
 
+		// RBAC
+		AdminEmails: getEnvList("ADMIN_EMAILS"),
+
+		// OpenID Connect provider (an ephemeral key is generated if no key file is set)
+		OIDCIssuer:         getEnv("OIDC_ISSUER", ""),
+		OIDCSigningKeyFile: getEnv("OIDC_SIGNING_KEY_FILE", ""),
+
+		// LDAP / Active Directory
+		LDAPURL:            getEnv("LDAP_URL", ""),
+		LDAPStartTLS:       getEnvBool("LDAP_START_TLS", false),
+		LDAPBindDN:         getEnv("LDAP_BIND_DN", ""),
+		LDAPBindPassword:   getEnv("LDAP_BIND_PASSWORD", ""),
+		LDAPBaseDN:         getEnv("LDAP_BASE_DN", ""),
+		LDAPUserFilter:     getEnv("LDAP_USER_FILTER", "(mail={email})"),
+		LDAPEmailAttribute: getEnv("LDAP_EMAIL_ATTRIBUTE", "mail"),
+		LDAPNameAttribute:  getEnv("LDAP_NAME_ATTRIBUTE", "cn"),
+		LDAPGroupAttribute: getEnv("LDAP_GROUP_ATTRIBUTE", "memberOf"),
+		LDAPGroupRoles:     getEnvGroupRoles("LDAP_GROUP_ROLES"),
+
 		// Google OAuth
 		GoogleClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
 		GoogleClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
@@ -91,6 +158,8 @@ func Load() (*Config, error) {
 		RabbitMQUser:     getEnv("RABBITMQ_USER", "guest"),
 		RabbitMQPassword: getEnv("RABBITMQ_PASSWORD", "guest"),
 
+		RabbitMQPublishTimeoutSeconds: getEnvInt("RABBITMQ_PUBLISH_TIMEOUT_SECONDS", 10),
+
 		// Email
 		EmailFrom:    getEnv("EMAIL_FROM", ""),
 		EmailName:    getEnv("EMAIL_NAME", "Zacode"),
@@ -99,10 +168,34 @@ func Load() (*Config, error) {
 		SMTPUsername: getEnv("SMTP_USERNAME", ""),
 		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
 
+		SMTPSecurity:       getEnv("SMTP_SECURITY", ""),
+		SMTPAuth:           getEnv("SMTP_AUTH", "plain"),
+		SMTPTimeoutSeconds: getEnvInt("SMTP_TIMEOUT_SECONDS", 10),
+
+		EmailTransport:     getEnv("EMAIL_TRANSPORT", ""),
+		EmailFileDir:       getEnv("EMAIL_FILE_DIR", "./mail"),
+		EmailFileFormat:    getEnv("EMAIL_FILE_FORMAT", "maildir"),
+		EmailDevInbox:      getEnvBool("EMAIL_DEV_INBOX", false),
+		EmailTemplateDir:   getEnv("EMAIL_TEMPLATE_DIR", ""),
+		EmailDefaultLocale: getEnv("EMAIL_DEFAULT_LOCALE", "id"),
+		EmailMaxAttempts:   getEnvInt("EMAIL_MAX_ATTEMPTS", 5),
+
+		EmailWorkerEnabled: getEnvBool("EMAIL_WORKER_ENABLED", true),
+		WorkerPort:         getEnv("WORKER_PORT", "9090"),
+
+		EmailWorkerConcurrency:        getEnvInt("EMAIL_WORKER_CONCURRENCY", 4),
+		EmailWorkerPrefetch:           getEnvInt("EMAIL_WORKER_PREFETCH", 16),
+		EmailWorkerStopTimeoutSeconds: getEnvInt("EMAIL_WORKER_STOP_TIMEOUT_SECONDS", 30),
+		EmailDomainRatePerMinute:      getEnvInt("EMAIL_DOMAIN_RATE_PER_MINUTE", 120),
+
 		// Rate Limiting (default: enabled, 100 req/sec, burst 200)
 		RateLimitEnabled: getEnvBool("RATE_LIMIT_ENABLED", true),
 		RateLimitRPS:     getEnvInt("RATE_LIMIT_RPS", 100),
 		RateLimitBurst:   getEnvInt("RATE_LIMIT_BURST", 200),
+
+		// Data Export (default: ./exports, download link valid 24 hours)
+		ExportDir:          getEnv("EXPORT_DIR", "./exports"),
+		ExportLinkTTLHours: getEnvInt("EXPORT_LINK_TTL_HOURS", 24),
 	}
 
 	// Build database URL if not provided
@@ -117,6 +210,32 @@ func Load() (*Config, error) {
 		)
 	}
 
+	if cfg.OIDCIssuer == "" {
+		cfg.OIDCIssuer = strings.TrimRight(cfg.APIURL, "/")
+	}
+
+	if err := cfg.resolveEmailTransport(); err != nil {
+		return nil, err
+	}
+
+	if cfg.RabbitMQPublishTimeoutSeconds < 1 {
+		return nil, fmt.Errorf("RABBITMQ_PUBLISH_TIMEOUT_SECONDS must be at least 1")
+	}
+
+	if cfg.EmailMaxAttempts < 1 {
+		return nil, fmt.Errorf("EMAIL_MAX_ATTEMPTS must be at least 1")
+	}
+	if cfg.EmailWorkerConcurrency < 1 || cfg.EmailWorkerPrefetch < cfg.EmailWorkerConcurrency {
+		return nil, fmt.Errorf("EMAIL_WORKER_CONCURRENCY must be at least 1 and EMAIL_WORKER_PREFETCH at least as large")
+	}
+	if cfg.EmailDomainRatePerMinute < 0 {
+		return nil, fmt.Errorf("EMAIL_DOMAIN_RATE_PER_MINUTE must not be negative")
+	}
+
+	if cfg.LDAPURL != "" && cfg.LDAPBaseDN == "" {
+		return nil, fmt.Errorf("LDAP_BASE_DN must be set when LDAP_URL is set")
+	}
+
 	// Validate required fields
 	if cfg.JWTSecret == "" || cfg.JWTSecret == "your-secret-key-change-in-production" {
 		return nil, fmt.Errorf("JWT_SECRET must be set")
@@ -125,6 +244,44 @@ func Load() (*Config, error) {
 	return cfg, nil
 }
 
+// resolveEmailTransport fills in transport defaults and rejects unknown
+// values. Without SMTP credentials emails are logged, as in development.
+func (cfg *Config) resolveEmailTransport() error {
+	if cfg.EmailTransport == "" {
+		cfg.EmailTransport = "log"
+		if cfg.SMTPUsername != "" && cfg.SMTPPassword != "" {
+			cfg.EmailTransport = "smtp"
+		}
+	}
+	if cfg.SMTPSecurity == "" {
+		cfg.SMTPSecurity = "starttls"
+		if cfg.SMTPPort == "465" {
+			cfg.SMTPSecurity = "tls"
+		}
+	}
+
+	switch {
+	case !oneOf(cfg.EmailTransport, "smtp", "file", "capture", "log"):
+		return fmt.Errorf("EMAIL_TRANSPORT must be smtp, file, capture or log")
+	case !oneOf(cfg.SMTPSecurity, "starttls", "tls", "none"):
+		return fmt.Errorf("SMTP_SECURITY must be starttls, tls or none")
+	case !oneOf(cfg.SMTPAuth, "plain", "login", "cram-md5", "none"):
+		return fmt.Errorf("SMTP_AUTH must be plain, login, cram-md5 or none")
+	case !oneOf(cfg.EmailFileFormat, "maildir", "eml"):
+		return fmt.Errorf("EMAIL_FILE_FORMAT must be maildir or eml")
+	}
+	return nil
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -151,3 +308,31 @@ func getEnvInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvGroupRoles parses "groupDN:role;groupDN:role". DNs contain commas and
+// equals signs, so entries are split on the last colon.
+func getEnvGroupRoles(key string) map[string]string {
+	mapping := map[string]string{}
+	for _, entry := range strings.Split(os.Getenv(key), ";") {
+		i := strings.LastIndex(entry, ":")
+		if i <= 0 {
+			continue
+		}
+		group := strings.ToLower(strings.TrimSpace(entry[:i]))
+		role := strings.TrimSpace(entry[i+1:])
+		if group != "" && role != "" {
+			mapping[group] = role
+		}
+	}
+	return mapping
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the request ID in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID assigns every request an ID, reusing the caller's X-Request-ID if
+// it looks sane, and exposes it as "requestID" in the gin context
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if requestID == "" || len(requestID) > 64 {
+			requestID = uuid.New().String()
+		}
+
+		c.Set("requestID", requestID)
+		c.Writer.Header().Set(RequestIDHeader, requestID)
+		c.Next()
+	}
+}
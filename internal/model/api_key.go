@@ -0,0 +1,80 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// APIKeyPrefix marks a bearer credential as an API key rather than a JWT
+const APIKeyPrefix = "ak_"
+
+// StringList is a list of strings stored in a jsonb column
+type StringList []string
+
+// Value implements driver.Valuer
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner
+func (l *StringList) Scan(value interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return errors.New("unsupported type for StringList")
+	}
+	return json.Unmarshal(b, l)
+}
+
+// APIKey is a long-lived personal credential for scripts and integrations.
+// Only a hash of the secret is stored; Prefix identifies the key in listings.
+type APIKey struct {
+	ID         string     `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID     string     `gorm:"type:uuid;index;not null" json:"user_id"`
+	Name       string     `gorm:"type:varchar(100);not null" json:"name"`
+	Prefix     string     `gorm:"type:varchar(20);uniqueIndex;not null" json:"prefix"`
+	SecretHash string     `gorm:"type:varchar(64);not null" json:"-"`
+	Scopes     StringList `gorm:"type:jsonb" json:"scopes"`
+	ExpiresAt  time.Time  `gorm:"type:timestamp;not null" json:"expires_at"`
+	LastUsedAt *time.Time `gorm:"type:timestamp" json:"last_used_at,omitempty"`
+	LastUsedIP string     `gorm:"type:varchar(45)" json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `gorm:"type:timestamp" json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// IsActive reports whether the key can still authenticate requests
+func (k *APIKey) IsActive() bool {
+	return k.RevokedAt == nil && k.ExpiresAt.After(time.Now())
+}
+
+// BeforeCreate hook to generate UUID
+func (k *APIKey) BeforeCreate(tx *gorm.DB) error {
+	if k.ID == "" {
+		k.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// TableName specifies the table name
+func (APIKey) TableName() string {
+	return "api_keys"
+}
@@ -0,0 +1,117 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Audit actions
+const (
+	AuditActionRegister              = "auth.register"
+	AuditActionLoginSucceeded        = "auth.login.succeeded"
+	AuditActionLoginFailed           = "auth.login.failed"
+	AuditActionOTPVerified           = "auth.otp.verified"
+	AuditActionEmailVerified         = "auth.email.verified"
+	AuditActionPasswordResetRequest  = "auth.password_reset.requested"
+	AuditActionPasswordResetComplete = "auth.password_reset.completed"
+	AuditActionGoogleLogin           = "auth.google.login"
+	AuditActionSSOLogin              = "auth.sso.login"
+	AuditActionTokenRefreshed        = "auth.token.refreshed"
+	AuditActionDataExportRequested   = "user.data_export.requested"
+	AuditActionAPIKeyCreated         = "user.api_key.created"
+	AuditActionAPIKeyRevoked         = "user.api_key.revoked"
+
+	AuditActionAdminUserActivated   = "admin.user.activated"
+	AuditActionAdminUserDeactivated = "admin.user.deactivated"
+	AuditActionAdminUserVerified    = "admin.user.verified"
+	AuditActionAdminPasswordReset   = "admin.user.password_reset_forced"
+	AuditActionAdminRolesChanged    = "admin.user.roles_changed"
+	AuditActionAdminSessionsRevoked = "admin.user.sessions_revoked"
+	AuditActionImpersonationStarted = "admin.impersonation.started"
+	AuditActionImpersonationStopped = "admin.impersonation.stopped"
+	AuditActionAdminEmailsReplayed  = "admin.email_dlq.replayed"
+
+	AuditActionOrgCreated            = "org.created"
+	AuditActionOrgInvitationSent     = "org.invitation.sent"
+	AuditActionOrgInvitationAccepted = "org.invitation.accepted"
+	AuditActionOrgMemberRemoved      = "org.member.removed"
+	AuditActionOrgSAMLConfigured     = "org.saml.configured"
+	AuditActionOrgSAMLRemoved        = "org.saml.removed"
+	AuditActionOrgSCIMTokenCreated   = "org.scim_token.created"
+	AuditActionOrgSCIMTokenRevoked   = "org.scim_token.revoked"
+	AuditActionOrgDomainAdded        = "org.domain.added"
+	AuditActionOrgDomainVerified     = "org.domain.verified"
+	AuditActionOrgDomainRemoved      = "org.domain.removed"
+
+	AuditActionSCIMUserUpdated  = "scim.user.updated"
+	AuditActionSCIMUserDeleted  = "scim.user.deleted"
+	AuditActionSCIMGroupUpdated = "scim.group.updated"
+
+	AuditActionOAuthClientCreated  = "oauth.client.created"
+	AuditActionOAuthClientDeleted  = "oauth.client.deleted"
+	AuditActionOAuthConsentGranted = "oauth.consent.granted"
+	AuditActionOAuthTokenIssued    = "oauth.token.issued"
+	AuditActionOAuthTokenRevoked   = "oauth.token.revoked"
+)
+
+// JSONMap is a free-form JSON object stored in a jsonb column
+type JSONMap map[string]interface{}
+
+// Value implements driver.Valuer
+func (m JSONMap) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner
+func (m *JSONMap) Scan(value interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return errors.New("unsupported type for JSONMap")
+	}
+	return json.Unmarshal(b, m)
+}
+
+type AuditEvent struct {
+	ID           string    `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Action       string    `gorm:"type:varchar(100);index;not null" json:"action"`
+	ActorID      *string   `gorm:"type:uuid;index" json:"actor_id,omitempty"`
+	TargetUserID *string   `gorm:"type:uuid;index" json:"target_user_id,omitempty"`
+	IPAddress    string    `gorm:"type:varchar(45)" json:"ip_address"`
+	UserAgent    string    `gorm:"type:text" json:"user_agent"`
+	RequestID    string    `gorm:"type:varchar(64);index" json:"request_id,omitempty"`
+	Metadata     JSONMap   `gorm:"type:jsonb" json:"metadata,omitempty"`
+	CreatedAt    time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (e *AuditEvent) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// TableName specifies the table name
+func (AuditEvent) TableName() string {
+	return "audit_events"
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Data export statuses
+const (
+	DataExportStatusPending = "pending"
+	DataExportStatusReady   = "ready"
+	DataExportStatusFailed  = "failed"
+)
+
+type DataExport struct {
+	ID          string     `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID      string     `gorm:"type:uuid;index;not null" json:"user_id"`
+	Status      string     `gorm:"type:varchar(20);default:'pending'" json:"status"` // pending, ready, failed
+	FilePath    string     `gorm:"type:text" json:"-"`
+	TokenHash   *string    `gorm:"type:varchar(64);uniqueIndex" json:"-"`
+	ExpiresAt   *time.Time `gorm:"type:timestamp" json:"expires_at,omitempty"`
+	CompletedAt *time.Time `gorm:"type:timestamp" json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (e *DataExport) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// TableName specifies the table name
+func (DataExport) TableName() string {
+	return "data_exports"
+}
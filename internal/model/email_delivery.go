@@ -0,0 +1,31 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// EmailDelivery records an email job the worker has sent, so a redelivered
+// job with the same idempotency key is acknowledged without sending again
+type EmailDelivery struct {
+	ID             string    `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	IdempotencyKey string    `gorm:"type:varchar(255);uniqueIndex;not null" json:"idempotency_key"`
+	Type           string    `gorm:"type:varchar(50);not null" json:"type"`
+	Recipient      string    `gorm:"type:varchar(255);not null" json:"recipient"`
+	SentAt         time.Time `gorm:"autoCreateTime" json:"sent_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (d *EmailDelivery) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == "" {
+		d.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// TableName specifies the table name
+func (EmailDelivery) TableName() string {
+	return "email_deliveries"
+}
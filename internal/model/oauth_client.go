@@ -0,0 +1,149 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OAuth grant types
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+// Device authorization statuses
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+)
+
+// OAuthClient is an application registered to sign users in through our
+// OpenID Connect provider, or a machine client using the client credentials
+// grant. Public clients (SPAs, mobile apps) have no secret and must use PKCE.
+type OAuthClient struct {
+	ID            string     `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ClientID      string     `gorm:"type:varchar(100);uniqueIndex;not null" json:"client_id"`
+	SecretHash    string     `gorm:"type:varchar(64)" json:"-"`
+	Name          string     `gorm:"type:varchar(255);not null" json:"name"`
+	IsPublic      bool       `gorm:"default:false" json:"is_public"`
+	RedirectURIs  StringList `gorm:"type:jsonb" json:"redirect_uris"`
+	AllowedScopes StringList `gorm:"type:jsonb" json:"allowed_scopes"`
+	GrantTypes    StringList `gorm:"type:jsonb" json:"grant_types"`
+	TokenTTL      int        `gorm:"default:0" json:"token_ttl"` // Client credentials access token lifetime in seconds, 0 for the default
+	CreatedByID   string     `gorm:"type:uuid" json:"created_by_id,omitempty"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// AllowsGrant reports whether the client may use the grant type
+func (c *OAuthClient) AllowsGrant(grantType string) bool {
+	for _, g := range c.GrantTypes {
+		if g == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsRedirectURI reports whether uri exactly matches a registered redirect URI
+func (c *OAuthClient) AllowsRedirectURI(uri string) bool {
+	for _, u := range c.RedirectURIs {
+		if u == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// OAuthAuthorizationCode is a single-use code issued after the user consents
+type OAuthAuthorizationCode struct {
+	ID                  string     `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	CodeHash            string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	ClientID            string     `gorm:"type:varchar(100);index;not null" json:"client_id"`
+	UserID              string     `gorm:"type:uuid;not null" json:"user_id"`
+	RedirectURI         string     `gorm:"type:text;not null" json:"redirect_uri"`
+	Scopes              StringList `gorm:"type:jsonb" json:"scopes"`
+	Nonce               string     `gorm:"type:varchar(255)" json:"-"`
+	CodeChallenge       string     `gorm:"type:varchar(128)" json:"-"`
+	CodeChallengeMethod string     `gorm:"type:varchar(10)" json:"-"`
+	SessionID           *string    `gorm:"type:uuid" json:"-"` // Session created when the code was exchanged
+	ExpiresAt           time.Time  `gorm:"type:timestamp;not null" json:"expires_at"`
+	UsedAt              *time.Time `gorm:"type:timestamp" json:"used_at,omitempty"`
+	CreatedAt           time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// OAuthDeviceCode is a pending device authorization (RFC 8628). The device
+// polls with the device code while the user approves the user code in a browser.
+type OAuthDeviceCode struct {
+	ID             string     `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	DeviceCodeHash string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	UserCode       string     `gorm:"type:varchar(16);uniqueIndex;not null" json:"user_code"`
+	ClientID       string     `gorm:"type:varchar(100);index;not null" json:"client_id"`
+	Scopes         StringList `gorm:"type:jsonb" json:"scopes"`
+	Status         string     `gorm:"type:varchar(20);not null;default:'pending'" json:"status"`
+	UserID         *string    `gorm:"type:uuid" json:"user_id,omitempty"` // Set once the user decides
+	Interval       int        `gorm:"not null" json:"interval"`           // Minimum seconds between polls
+	LastPolledAt   *time.Time `gorm:"type:timestamp" json:"last_polled_at,omitempty"`
+	DecidedAt      *time.Time `gorm:"type:timestamp" json:"decided_at,omitempty"`
+	ConsumedAt     *time.Time `gorm:"type:timestamp" json:"consumed_at,omitempty"`
+	ExpiresAt      time.Time  `gorm:"type:timestamp;not null" json:"expires_at"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// OAuthConsent remembers the scopes a user already approved for a client
+type OAuthConsent struct {
+	UserID    string     `gorm:"type:uuid;primaryKey" json:"user_id"`
+	ClientID  string     `gorm:"type:varchar(100);primaryKey" json:"client_id"`
+	Scopes    StringList `gorm:"type:jsonb" json:"scopes"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (c *OAuthClient) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == "" {
+		c.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// BeforeCreate hook to generate UUID
+func (a *OAuthAuthorizationCode) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == "" {
+		a.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// TableName specifies the table name
+func (OAuthClient) TableName() string {
+	return "oauth_clients"
+}
+
+// TableName specifies the table name
+func (OAuthAuthorizationCode) TableName() string {
+	return "oauth_authorization_codes"
+}
+
+// BeforeCreate hook to generate UUID
+func (d *OAuthDeviceCode) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == "" {
+		d.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// TableName specifies the table name
+func (OAuthDeviceCode) TableName() string {
+	return "oauth_device_codes"
+}
+
+// TableName specifies the table name
+func (OAuthConsent) TableName() string {
+	return "oauth_consents"
+}
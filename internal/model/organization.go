@@ -0,0 +1,110 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Per-organization membership roles
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+type Organization struct {
+	ID          string         `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Name        string         `gorm:"type:varchar(255);not null" json:"name"`
+	Slug        string         `gorm:"type:varchar(100);uniqueIndex;not null" json:"slug"`
+	CreatedByID string         `gorm:"type:uuid;not null" json:"created_by_id"`
+	CreatedAt   time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+type Membership struct {
+	ID             string        `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	OrganizationID string        `gorm:"type:uuid;not null;uniqueIndex:idx_membership_org_user" json:"organization_id"`
+	UserID         string        `gorm:"type:uuid;not null;uniqueIndex:idx_membership_org_user;index" json:"user_id"`
+	Role           string        `gorm:"type:varchar(20);not null;default:'member'" json:"role"` // owner, admin, member
+	Organization   *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+	User           *User         `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	CreatedAt      time.Time     `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type Invitation struct {
+	ID             string        `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	OrganizationID string        `gorm:"type:uuid;not null;index" json:"organization_id"`
+	Email          string        `gorm:"type:varchar(255);not null;index" json:"email"`
+	Role           string        `gorm:"type:varchar(20);not null;default:'member'" json:"role"`
+	InvitedByID    string        `gorm:"type:uuid;not null" json:"invited_by_id"`
+	ExpiresAt      time.Time     `gorm:"type:timestamp;not null" json:"expires_at"`
+	AcceptedAt     *time.Time    `gorm:"type:timestamp" json:"accepted_at,omitempty"`
+	Organization   *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+	CreatedAt      time.Time     `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// OrganizationDomain is an email domain claimed by an organization. It is
+// verified once the organization publishes its token in a DNS TXT record.
+type OrganizationDomain struct {
+	ID                string     `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	OrganizationID    string     `gorm:"type:uuid;not null;uniqueIndex:idx_org_domain" json:"organization_id"`
+	Domain            string     `gorm:"type:varchar(255);not null;uniqueIndex:idx_org_domain;index" json:"domain"`
+	VerificationToken string     `gorm:"type:varchar(100);not null" json:"verification_token"`
+	VerifiedAt        *time.Time `gorm:"type:timestamp" json:"verified_at,omitempty"`
+	CreatedAt         time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// IsPending reports whether the invitation can still be accepted
+func (i *Invitation) IsPending() bool {
+	return i.AcceptedAt == nil && i.ExpiresAt.After(time.Now())
+}
+
+// BeforeCreate hook to generate UUID
+func (o *Organization) BeforeCreate(tx *gorm.DB) error {
+	if o.ID == "" {
+		o.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// BeforeCreate hook to generate UUID
+func (m *Membership) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == "" {
+		m.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// BeforeCreate hook to generate UUID
+func (i *Invitation) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == "" {
+		i.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// BeforeCreate hook to generate UUID
+func (d *OrganizationDomain) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == "" {
+		d.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// TableName specifies the table name
+func (Organization) TableName() string {
+	return "organizations"
+}
+
+// TableName specifies the table name
+func (Membership) TableName() string {
+	return "memberships"
+}
+
+// TableName specifies the table name
+func (Invitation) TableName() string {
+	return "invitations"
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OutboxMessage is a message written in the same transaction as the change
+// that caused it. The outbox relay publishes it to RabbitMQ afterwards, so a
+// committed change never loses its message to a crash or a broker outage.
+type OutboxMessage struct {
+	ID          string     `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Exchange    string     `gorm:"type:varchar(255);not null" json:"exchange"`
+	RoutingKey  string     `gorm:"type:varchar(255);not null" json:"routing_key"`
+	MessageID   string     `gorm:"type:varchar(255);not null" json:"message_id"`
+	Type        string     `gorm:"type:varchar(100);not null" json:"type"`
+	Payload     []byte     `gorm:"type:bytea;not null" json:"-"`
+	Attempts    int        `gorm:"not null;default:0" json:"attempts"`
+	LastError   string     `gorm:"type:text" json:"last_error,omitempty"`
+	AvailableAt time.Time  `gorm:"index:idx_outbox_pending,where:sent_at IS NULL;not null" json:"available_at"`
+	SentAt      *time.Time `gorm:"index" json:"sent_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (m *OutboxMessage) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == "" {
+		m.ID = uuid.New().String()
+	}
+	if m.AvailableAt.IsZero() {
+		m.AvailableAt = time.Now()
+	}
+	return nil
+}
+
+// TableName specifies the table name
+func (OutboxMessage) TableName() string {
+	return "outbox"
+}
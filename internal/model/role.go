@@ -0,0 +1,97 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Built-in roles
+const (
+	RoleMember = "member"
+	RoleAdmin  = "admin"
+)
+
+// Permissions checked by route guards
+const (
+	PermissionUsersRead  = "users:read"
+	PermissionUsersWrite = "users:write"
+	PermissionRolesRead  = "roles:read"
+	PermissionRolesWrite = "roles:write"
+	PermissionAuditRead  = "audit:read"
+
+	PermissionUsersImpersonate = "users:impersonate"
+	PermissionClientsRead      = "oauth_clients:read"
+	PermissionClientsWrite     = "oauth_clients:write"
+	PermissionEmailQueueRead   = "email_queue:read"
+	PermissionEmailQueueWrite  = "email_queue:write"
+)
+
+// AllPermissions lists every permission checked by route guards
+var AllPermissions = []string{
+	PermissionUsersRead,
+	PermissionUsersWrite,
+	PermissionRolesRead,
+	PermissionRolesWrite,
+	PermissionUsersImpersonate,
+	PermissionAuditRead,
+	PermissionClientsRead,
+	PermissionClientsWrite,
+	PermissionEmailQueueRead,
+	PermissionEmailQueueWrite,
+}
+
+type Role struct {
+	ID          string       `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Name        string       `gorm:"type:varchar(50);uniqueIndex;not null" json:"name"`
+	Description string       `gorm:"type:varchar(255)" json:"description"`
+	Permissions []Permission `gorm:"many2many:role_permissions" json:"permissions,omitempty"`
+	CreatedAt   time.Time    `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time    `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+type Permission struct {
+	ID          string    `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Name        string    `gorm:"type:varchar(100);uniqueIndex;not null" json:"name"`
+	Description string    `gorm:"type:varchar(255)" json:"description"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type UserRole struct {
+	UserID    string    `gorm:"type:uuid;primaryKey" json:"user_id"`
+	RoleID    string    `gorm:"type:uuid;primaryKey" json:"role_id"`
+	Role      Role      `gorm:"foreignKey:RoleID" json:"role"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (r *Role) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == "" {
+		r.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// BeforeCreate hook to generate UUID
+func (p *Permission) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// TableName specifies the table name
+func (Role) TableName() string {
+	return "roles"
+}
+
+// TableName specifies the table name
+func (Permission) TableName() string {
+	return "permissions"
+}
+
+// TableName specifies the table name
+func (UserRole) TableName() string {
+	return "user_roles"
+}
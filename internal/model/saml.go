@@ -0,0 +1,57 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LoginTypeSAML marks users provisioned just-in-time by an organization's IdP
+const LoginTypeSAML = "saml"
+
+// SAMLProvider is an organization's SAML identity provider, configured from
+// the IdP's metadata
+type SAMLProvider struct {
+	ID             string     `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	OrganizationID string     `gorm:"type:uuid;uniqueIndex;not null" json:"organization_id"`
+	IdPEntityID    string     `gorm:"type:text;not null" json:"idp_entity_id"`
+	SSOURL         string     `gorm:"type:text;not null" json:"sso_url"`
+	Certificates   StringList `gorm:"type:jsonb" json:"certificates"`           // Base64 DER IdP signing certificates
+	EmailAttribute string     `gorm:"type:varchar(255)" json:"email_attribute"` // Empty to use the NameID
+	NameAttribute  string     `gorm:"type:varchar(255)" json:"name_attribute"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// SAMLLoginRequest tracks one SP-initiated login from AuthnRequest to token
+// exchange. Its ID is the AuthnRequest ID the IdP must answer with, so each
+// assertion can only be consumed once.
+type SAMLLoginRequest struct {
+	ID              string     `gorm:"type:varchar(64);primaryKey" json:"id"`
+	OrganizationID  string     `gorm:"type:uuid;not null;index" json:"organization_id"`
+	UserID          *string    `gorm:"type:uuid" json:"user_id,omitempty"`    // Set once the assertion is accepted
+	CodeHash        *string    `gorm:"type:varchar(64);uniqueIndex" json:"-"` // One-time code handed to the frontend
+	AuthenticatedAt *time.Time `gorm:"type:timestamp" json:"authenticated_at,omitempty"`
+	ExchangedAt     *time.Time `gorm:"type:timestamp" json:"exchanged_at,omitempty"`
+	ExpiresAt       time.Time  `gorm:"type:timestamp;not null" json:"expires_at"`
+	CreatedAt       time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (p *SAMLProvider) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// TableName specifies the table name
+func (SAMLProvider) TableName() string {
+	return "saml_providers"
+}
+
+// TableName specifies the table name
+func (SAMLLoginRequest) TableName() string {
+	return "saml_login_requests"
+}
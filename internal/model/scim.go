@@ -0,0 +1,38 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SCIMTokenPrefix marks a bearer credential as an organization's SCIM token
+const SCIMTokenPrefix = "scim_"
+
+// SCIMToken lets an organization's identity provider provision users through
+// the SCIM API. Like API keys only a hash of the secret is stored.
+type SCIMToken struct {
+	ID             string     `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	OrganizationID string     `gorm:"type:uuid;index;not null" json:"organization_id"`
+	Name           string     `gorm:"type:varchar(100);not null" json:"name"`
+	Prefix         string     `gorm:"type:varchar(20);uniqueIndex;not null" json:"prefix"`
+	SecretHash     string     `gorm:"type:varchar(64);not null" json:"-"`
+	CreatedByID    string     `gorm:"type:uuid;not null" json:"created_by_id"`
+	LastUsedAt     *time.Time `gorm:"type:timestamp" json:"last_used_at,omitempty"`
+	RevokedAt      *time.Time `gorm:"type:timestamp" json:"revoked_at,omitempty"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (t *SCIMToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == "" {
+		t.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// TableName specifies the table name
+func (SCIMToken) TableName() string {
+	return "scim_tokens"
+}
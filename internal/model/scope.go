@@ -0,0 +1,52 @@
+package model
+
+import "strings"
+
+// Scopes limit what a credential may do on behalf of its user. Permission
+// names (users:read, ...) are also valid scopes and narrow admin access.
+const (
+	ScopeProfileRead  = "profile:read"
+	ScopeProfileWrite = "profile:write"
+	ScopeOrgsRead     = "orgs:read"
+	ScopeOrgsWrite    = "orgs:write"
+
+	// OpenID Connect scopes
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// OIDCScopes only control which identity claims are released to a client
+var OIDCScopes = []string{
+	ScopeOpenID,
+	ScopeProfile,
+	ScopeEmail,
+}
+
+// UserScopes are the scopes every user may grant regardless of role
+var UserScopes = []string{
+	ScopeProfileRead,
+	ScopeProfileWrite,
+	ScopeOrgsRead,
+	ScopeOrgsWrite,
+}
+
+// ParseScope splits a space-delimited OAuth scope string
+func ParseScope(scope string) []string {
+	return strings.Fields(scope)
+}
+
+// FormatScope joins scopes into a space-delimited OAuth scope string
+func FormatScope(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// IsUserScope reports whether scope is one of UserScopes
+func IsUserScope(scope string) bool {
+	for _, s := range UserScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Session tracks a refresh token issued at login so it can be revoked
+type Session struct {
+	ID         string     `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID     string     `gorm:"type:uuid;index;not null" json:"user_id"`
+	ClientID   *string    `gorm:"type:varchar(100);index" json:"client_id,omitempty"` // OAuth client the session was granted to
+	IPAddress  string     `gorm:"type:varchar(45)" json:"ip_address"`
+	UserAgent  string     `gorm:"type:text" json:"user_agent"`
+	ExpiresAt  time.Time  `gorm:"type:timestamp;not null" json:"expires_at"`
+	LastUsedAt *time.Time `gorm:"type:timestamp" json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `gorm:"type:timestamp;index" json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// IsActive reports whether the session can still be used to refresh tokens
+func (s *Session) IsActive() bool {
+	return s.RevokedAt == nil && s.ExpiresAt.After(time.Now())
+}
+
+// BeforeCreate hook to generate UUID
+func (s *Session) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == "" {
+		s.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// TableName specifies the table name
+func (Session) TableName() string {
+	return "sessions"
+}
@@ -7,6 +7,9 @@ import (
 	"gorm.io/gorm"
 )
 
+// LoginTypeLDAP marks users created on their first directory login
+const LoginTypeLDAP = "ldap"
+
 type User struct {
 	ID             string         `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
 	Email          string         `gorm:"type:varchar(255);uniqueIndex;not null" json:"email"`
@@ -21,12 +24,15 @@ type User struct {
 	IsActive       bool           `gorm:"default:true" json:"is_active"`
 	IsVerified     bool           `gorm:"default:false" json:"is_verified"`
 	LastLogin      *time.Time     `gorm:"type:timestamp" json:"last_login,omitempty"`
-	LoginType      string         `gorm:"type:varchar(50);default:'credential'" json:"login_type"` // credential, google
+	LoginType      string         `gorm:"type:varchar(50);default:'credential'" json:"login_type"` // credential, google, saml, ldap
 	GoogleID       *string        `gorm:"type:varchar(255);uniqueIndex" json:"-"`
+	ProvisionedBy  *string        `gorm:"type:uuid;index" json:"-"` // organization whose IdP created a saml user
 	OTPCode        *string        `gorm:"type:varchar(6)" json:"-"`
 	OTPExpiresAt   *time.Time     `gorm:"type:timestamp" json:"-"`
 	ResetToken     *string        `gorm:"type:text" json:"-"`
 	ResetExpiresAt *time.Time     `gorm:"type:timestamp" json:"-"`
+	ResetRequired  bool           `gorm:"default:false" json:"password_reset_required"` // set by admin, cleared on password change
+	Locale         string         `gorm:"type:varchar(10)" json:"locale,omitempty"`     // preferred language for emails, empty for the default
 	CreatedAt      time.Time      `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt      time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
 	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
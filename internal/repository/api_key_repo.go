@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"time"
+
+	"yourapp/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type APIKeyRepository interface {
+	Create(key *model.APIKey) error
+	FindByPrefix(prefix string) (*model.APIKey, error)
+	FindByUserID(userID string) ([]model.APIKey, error)
+	CountActiveByUserID(userID string) (int64, error)
+	Touch(id, ipAddress string) error
+	Revoke(id, userID string) (int64, error)
+}
+
+type apiKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyRepository(db *gorm.DB) APIKeyRepository {
+	return &apiKeyRepository{db: db}
+}
+
+func (r *apiKeyRepository) Create(key *model.APIKey) error {
+	return r.db.Create(key).Error
+}
+
+func (r *apiKeyRepository) FindByPrefix(prefix string) (*model.APIKey, error) {
+	var key model.APIKey
+	err := r.db.Where("prefix = ?", prefix).First(&key).Error
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *apiKeyRepository) FindByUserID(userID string) ([]model.APIKey, error) {
+	var keys []model.APIKey
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+func (r *apiKeyRepository) CountActiveByUserID(userID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.APIKey{}).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Count(&count).Error
+	return count, err
+}
+
+// Touch records when and from where the key was last used
+func (r *apiKeyRepository) Touch(id, ipAddress string) error {
+	return r.db.Model(&model.APIKey{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"last_used_at": time.Now(),
+			"last_used_ip": ipAddress,
+		}).Error
+}
+
+func (r *apiKeyRepository) Revoke(id, userID string) (int64, error) {
+	result := r.db.Model(&model.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
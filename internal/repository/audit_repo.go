@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"time"
+
+	"yourapp/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// AuditFilter narrows down audit event queries; empty fields are ignored
+type AuditFilter struct {
+	Action       string
+	ActorID      string
+	TargetUserID string
+	RequestID    string
+	From         *time.Time
+	To           *time.Time
+	Page         int
+	PageSize     int
+}
+
+type AuditRepository interface {
+	Create(event *model.AuditEvent) error
+	List(filter AuditFilter) ([]model.AuditEvent, int64, error)
+	FindByTargetUserID(userID string, limit int) ([]model.AuditEvent, error)
+}
+
+type auditRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) AuditRepository {
+	return &auditRepository{db: db}
+}
+
+func (r *auditRepository) Create(event *model.AuditEvent) error {
+	return r.db.Create(event).Error
+}
+
+func (r *auditRepository) List(filter AuditFilter) ([]model.AuditEvent, int64, error) {
+	query := r.db.Model(&model.AuditEvent{})
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.ActorID != "" {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.TargetUserID != "" {
+		query = query.Where("target_user_id = ?", filter.TargetUserID)
+	}
+	if filter.RequestID != "" {
+		query = query.Where("request_id = ?", filter.RequestID)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var events []model.AuditEvent
+	err := query.Order("created_at DESC").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&events).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+func (r *auditRepository) FindByTargetUserID(userID string, limit int) ([]model.AuditEvent, error) {
+	var events []model.AuditEvent
+	query := r.db.Where("target_user_id = ?", userID).Order("created_at DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&events).Error
+	return events, err
+}
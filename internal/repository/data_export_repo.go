@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"yourapp/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type DataExportRepository interface {
+	Create(export *model.DataExport) error
+	Update(export *model.DataExport) error
+	UpdateWithOutbox(export *model.DataExport, messages ...*model.OutboxMessage) error
+	FindPendingByUserID(userID string, since time.Time) (*model.DataExport, error)
+	FindByTokenHash(tokenHash string) (*model.DataExport, error)
+	FindExpired(before time.Time) ([]model.DataExport, error)
+	Delete(id string) error
+}
+
+type dataExportRepository struct {
+	db *gorm.DB
+}
+
+func NewDataExportRepository(db *gorm.DB) DataExportRepository {
+	return &dataExportRepository{db: db}
+}
+
+func (r *dataExportRepository) Create(export *model.DataExport) error {
+	return r.db.Create(export).Error
+}
+
+func (r *dataExportRepository) Update(export *model.DataExport) error {
+	return r.db.Save(export).Error
+}
+
+// UpdateWithOutbox saves the export and queues its messages atomically
+func (r *dataExportRepository) UpdateWithOutbox(export *model.DataExport, messages ...*model.OutboxMessage) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(export).Error; err != nil {
+			return err
+		}
+		return addOutboxMessages(tx, messages)
+	})
+}
+
+// FindPendingByUserID ignores exports started before since, which were
+// abandoned by a process that stopped while building them
+func (r *dataExportRepository) FindPendingByUserID(userID string, since time.Time) (*model.DataExport, error) {
+	var export model.DataExport
+	err := r.db.Where("user_id = ? AND status = ? AND created_at > ?", userID, model.DataExportStatusPending, since).
+		Order("created_at DESC").
+		First(&export).Error
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func (r *dataExportRepository) FindByTokenHash(tokenHash string) (*model.DataExport, error) {
+	var export model.DataExport
+	err := r.db.Where("token_hash = ? AND status = ? AND expires_at > ?", tokenHash, model.DataExportStatusReady, time.Now()).
+		First(&export).Error
+	if err != nil {
+		return nil, errors.New("invalid or expired download link")
+	}
+	return &export, nil
+}
+
+func (r *dataExportRepository) FindExpired(before time.Time) ([]model.DataExport, error) {
+	var exports []model.DataExport
+	err := r.db.Where("expires_at IS NOT NULL AND expires_at <= ?", before).Find(&exports).Error
+	return exports, err
+}
+
+func (r *dataExportRepository) Delete(id string) error {
+	return r.db.Where("id = ?", id).Delete(&model.DataExport{}).Error
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"yourapp/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type EmailDeliveryRepository interface {
+	Exists(idempotencyKey string) (bool, error)
+	Record(delivery *model.EmailDelivery) error
+	FindByRecipient(recipient string) ([]model.EmailDelivery, error)
+}
+
+type emailDeliveryRepository struct {
+	db *gorm.DB
+}
+
+func NewEmailDeliveryRepository(db *gorm.DB) EmailDeliveryRepository {
+	return &emailDeliveryRepository{db: db}
+}
+
+func (r *emailDeliveryRepository) Exists(idempotencyKey string) (bool, error) {
+	var count int64
+	err := r.db.Model(&model.EmailDelivery{}).Where("idempotency_key = ?", idempotencyKey).Count(&count).Error
+	return count > 0, err
+}
+
+// Record is a no-op when the key was already recorded by a concurrent delivery
+func (r *emailDeliveryRepository) Record(delivery *model.EmailDelivery) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(delivery).Error
+}
+
+func (r *emailDeliveryRepository) FindByRecipient(recipient string) ([]model.EmailDelivery, error) {
+	var deliveries []model.EmailDelivery
+	err := r.db.Where("LOWER(recipient) = LOWER(?)", recipient).
+		Order("sent_at DESC").
+		Find(&deliveries).Error
+	return deliveries, err
+}
@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"time"
+
+	"yourapp/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OAuthRepository interface {
+	CreateClient(client *model.OAuthClient) error
+	FindClientByClientID(clientID string) (*model.OAuthClient, error)
+	ListClients() ([]model.OAuthClient, error)
+	DeleteClient(clientID string) (int64, error)
+	CreateCode(code *model.OAuthAuthorizationCode) error
+	FindCodeByHash(codeHash string) (*model.OAuthAuthorizationCode, error)
+	MarkCodeUsed(id string) (int64, error)
+	SetCodeSession(id, sessionID string) error
+	CreateDeviceCode(code *model.OAuthDeviceCode) error
+	FindDeviceCodeByHash(deviceCodeHash string) (*model.OAuthDeviceCode, error)
+	FindDeviceCodeByUserCode(userCode string) (*model.OAuthDeviceCode, error)
+	DecideDeviceCode(code *model.OAuthDeviceCode) (int64, error)
+	RecordDevicePoll(id string, interval int) error
+	ConsumeDeviceCode(id string) (int64, error)
+	FindConsent(userID, clientID string) (*model.OAuthConsent, error)
+	SaveConsent(consent *model.OAuthConsent) error
+}
+
+type oauthRepository struct {
+	db *gorm.DB
+}
+
+func NewOAuthRepository(db *gorm.DB) OAuthRepository {
+	return &oauthRepository{db: db}
+}
+
+func (r *oauthRepository) CreateClient(client *model.OAuthClient) error {
+	return r.db.Create(client).Error
+}
+
+func (r *oauthRepository) FindClientByClientID(clientID string) (*model.OAuthClient, error) {
+	var client model.OAuthClient
+	err := r.db.Where("client_id = ?", clientID).First(&client).Error
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (r *oauthRepository) ListClients() ([]model.OAuthClient, error) {
+	var clients []model.OAuthClient
+	err := r.db.Order("created_at DESC").Find(&clients).Error
+	return clients, err
+}
+
+func (r *oauthRepository) DeleteClient(clientID string) (int64, error) {
+	result := r.db.Where("client_id = ?", clientID).Delete(&model.OAuthClient{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *oauthRepository) CreateCode(code *model.OAuthAuthorizationCode) error {
+	return r.db.Create(code).Error
+}
+
+func (r *oauthRepository) FindCodeByHash(codeHash string) (*model.OAuthAuthorizationCode, error) {
+	var code model.OAuthAuthorizationCode
+	err := r.db.Where("code_hash = ?", codeHash).First(&code).Error
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+// MarkCodeUsed consumes the code; zero rows affected means it was already used
+func (r *oauthRepository) MarkCodeUsed(id string) (int64, error) {
+	result := r.db.Model(&model.OAuthAuthorizationCode{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+func (r *oauthRepository) SetCodeSession(id, sessionID string) error {
+	return r.db.Model(&model.OAuthAuthorizationCode{}).
+		Where("id = ?", id).
+		Update("session_id", sessionID).Error
+}
+
+func (r *oauthRepository) CreateDeviceCode(code *model.OAuthDeviceCode) error {
+	return r.db.Create(code).Error
+}
+
+func (r *oauthRepository) FindDeviceCodeByHash(deviceCodeHash string) (*model.OAuthDeviceCode, error) {
+	var code model.OAuthDeviceCode
+	err := r.db.Where("device_code_hash = ?", deviceCodeHash).First(&code).Error
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+func (r *oauthRepository) FindDeviceCodeByUserCode(userCode string) (*model.OAuthDeviceCode, error) {
+	var code model.OAuthDeviceCode
+	err := r.db.Where("user_code = ?", userCode).First(&code).Error
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+// DecideDeviceCode stores the user's decision and granted scopes; zero rows
+// affected means it was already decided
+func (r *oauthRepository) DecideDeviceCode(code *model.OAuthDeviceCode) (int64, error) {
+	result := r.db.Model(&model.OAuthDeviceCode{}).
+		Where("id = ? AND status = ?", code.ID, model.DeviceCodePending).
+		Updates(map[string]interface{}{
+			"status":     code.Status,
+			"user_id":    code.UserID,
+			"scopes":     code.Scopes,
+			"decided_at": code.DecidedAt,
+		})
+	return result.RowsAffected, result.Error
+}
+
+func (r *oauthRepository) RecordDevicePoll(id string, interval int) error {
+	return r.db.Model(&model.OAuthDeviceCode{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"last_polled_at": time.Now(),
+			"interval":       interval,
+		}).Error
+}
+
+// ConsumeDeviceCode marks an approved code as exchanged; zero rows affected
+// means it was already exchanged
+func (r *oauthRepository) ConsumeDeviceCode(id string) (int64, error) {
+	result := r.db.Model(&model.OAuthDeviceCode{}).
+		Where("id = ? AND consumed_at IS NULL", id).
+		Update("consumed_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+func (r *oauthRepository) FindConsent(userID, clientID string) (*model.OAuthConsent, error) {
+	var consent model.OAuthConsent
+	err := r.db.Where("user_id = ? AND client_id = ?", userID, clientID).First(&consent).Error
+	if err != nil {
+		return nil, err
+	}
+	return &consent, nil
+}
+
+func (r *oauthRepository) SaveConsent(consent *model.OAuthConsent) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "client_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"scopes", "updated_at"}),
+	}).Create(consent).Error
+}
@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"time"
+
+	"yourapp/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type OrganizationRepository interface {
+	CreateWithOwner(org *model.Organization, ownerID string) error
+	FindByID(id string) (*model.Organization, error)
+	FindBySlug(slug string) (*model.Organization, error)
+	FindMembership(orgID, userID string) (*model.Membership, error)
+	FindMembershipsByUserID(userID string) ([]model.Membership, error)
+	FindMembersByOrgID(orgID string) ([]model.Membership, error)
+	CreateMembership(membership *model.Membership) error
+	UpdateMembershipRole(orgID, userID, role string) error
+	DeleteMembership(orgID, userID string) error
+	CreateInvitation(invitation *model.Invitation) error
+	CreateInvitationWithOutbox(invitation *model.Invitation, messages ...*model.OutboxMessage) error
+	FindInvitationByID(id string) (*model.Invitation, error)
+	FindPendingInvitationsByOrgID(orgID string) ([]model.Invitation, error)
+	DeletePendingInvitations(orgID, email string) error
+	AcceptInvitation(invitation *model.Invitation, userID string) error
+	CreateDomain(domain *model.OrganizationDomain) error
+	FindDomain(orgID, domain string) (*model.OrganizationDomain, error)
+	FindDomainsByOrgID(orgID string) ([]model.OrganizationDomain, error)
+	FindVerifiedDomain(domain string) (*model.OrganizationDomain, error)
+	MarkDomainVerified(id string) error
+	DeleteDomain(orgID, domain string) (int64, error)
+}
+
+type organizationRepository struct {
+	db *gorm.DB
+}
+
+func NewOrganizationRepository(db *gorm.DB) OrganizationRepository {
+	return &organizationRepository{db: db}
+}
+
+// CreateWithOwner creates the organization and its owner membership atomically
+func (r *organizationRepository) CreateWithOwner(org *model.Organization, ownerID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.Membership{
+			OrganizationID: org.ID,
+			UserID:         ownerID,
+			Role:           model.OrgRoleOwner,
+		}).Error
+	})
+}
+
+func (r *organizationRepository) FindByID(id string) (*model.Organization, error) {
+	var org model.Organization
+	err := r.db.Where("id = ?", id).First(&org).Error
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func (r *organizationRepository) FindBySlug(slug string) (*model.Organization, error) {
+	var org model.Organization
+	err := r.db.Where("slug = ?", slug).First(&org).Error
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func (r *organizationRepository) FindMembership(orgID, userID string) (*model.Membership, error) {
+	var membership model.Membership
+	err := r.db.Where("organization_id = ? AND user_id = ?", orgID, userID).First(&membership).Error
+	if err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+func (r *organizationRepository) FindMembershipsByUserID(userID string) ([]model.Membership, error) {
+	var memberships []model.Membership
+	err := r.db.Preload("Organization").
+		Joins("JOIN organizations ON organizations.id = memberships.organization_id AND organizations.deleted_at IS NULL").
+		Where("memberships.user_id = ?", userID).
+		Order("memberships.created_at").
+		Find(&memberships).Error
+	return memberships, err
+}
+
+func (r *organizationRepository) FindMembersByOrgID(orgID string) ([]model.Membership, error) {
+	var memberships []model.Membership
+	err := r.db.Preload("User").
+		Where("organization_id = ?", orgID).
+		Order("created_at").
+		Find(&memberships).Error
+	return memberships, err
+}
+
+func (r *organizationRepository) CreateMembership(membership *model.Membership) error {
+	return r.db.Create(membership).Error
+}
+
+func (r *organizationRepository) UpdateMembershipRole(orgID, userID, role string) error {
+	return r.db.Model(&model.Membership{}).
+		Where("organization_id = ? AND user_id = ?", orgID, userID).
+		Update("role", role).Error
+}
+
+func (r *organizationRepository) DeleteMembership(orgID, userID string) error {
+	return r.db.Where("organization_id = ? AND user_id = ?", orgID, userID).Delete(&model.Membership{}).Error
+}
+
+func (r *organizationRepository) CreateInvitation(invitation *model.Invitation) error {
+	return r.db.Create(invitation).Error
+}
+
+// CreateInvitationWithOutbox creates the invitation and queues its email atomically
+func (r *organizationRepository) CreateInvitationWithOutbox(invitation *model.Invitation, messages ...*model.OutboxMessage) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(invitation).Error; err != nil {
+			return err
+		}
+		return addOutboxMessages(tx, messages)
+	})
+}
+
+func (r *organizationRepository) FindInvitationByID(id string) (*model.Invitation, error) {
+	var invitation model.Invitation
+	err := r.db.Preload("Organization").Where("id = ?", id).First(&invitation).Error
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (r *organizationRepository) FindPendingInvitationsByOrgID(orgID string) ([]model.Invitation, error) {
+	var invitations []model.Invitation
+	err := r.db.Where("organization_id = ? AND accepted_at IS NULL AND expires_at > ?", orgID, time.Now()).
+		Order("created_at DESC").
+		Find(&invitations).Error
+	return invitations, err
+}
+
+func (r *organizationRepository) DeletePendingInvitations(orgID, email string) error {
+	return r.db.Where("organization_id = ? AND LOWER(email) = LOWER(?) AND accepted_at IS NULL", orgID, email).
+		Delete(&model.Invitation{}).Error
+}
+
+// AcceptInvitation marks the invitation accepted and creates the membership atomically
+func (r *organizationRepository) AcceptInvitation(invitation *model.Invitation, userID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Invitation{}).
+			Where("id = ? AND accepted_at IS NULL", invitation.ID).
+			Update("accepted_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return tx.Create(&model.Membership{
+			OrganizationID: invitation.OrganizationID,
+			UserID:         userID,
+			Role:           invitation.Role,
+		}).Error
+	})
+}
+
+func (r *organizationRepository) CreateDomain(domain *model.OrganizationDomain) error {
+	return r.db.Create(domain).Error
+}
+
+func (r *organizationRepository) FindDomain(orgID, domain string) (*model.OrganizationDomain, error) {
+	var d model.OrganizationDomain
+	err := r.db.Where("organization_id = ? AND domain = ?", orgID, domain).First(&d).Error
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (r *organizationRepository) FindDomainsByOrgID(orgID string) ([]model.OrganizationDomain, error) {
+	var domains []model.OrganizationDomain
+	err := r.db.Where("organization_id = ?", orgID).Order("domain").Find(&domains).Error
+	return domains, err
+}
+
+// FindVerifiedDomain returns the claim of the organization that verified the domain
+func (r *organizationRepository) FindVerifiedDomain(domain string) (*model.OrganizationDomain, error) {
+	var d model.OrganizationDomain
+	err := r.db.Where("domain = ? AND verified_at IS NOT NULL", domain).First(&d).Error
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (r *organizationRepository) MarkDomainVerified(id string) error {
+	return r.db.Model(&model.OrganizationDomain{}).Where("id = ?", id).Update("verified_at", time.Now()).Error
+}
+
+func (r *organizationRepository) DeleteDomain(orgID, domain string) (int64, error) {
+	result := r.db.Where("organization_id = ? AND domain = ?", orgID, domain).Delete(&model.OrganizationDomain{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"time"
+
+	"yourapp/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type OutboxRepository interface {
+	Add(messages ...*model.OutboxMessage) error
+	ClaimPending(limit int, lease time.Duration) ([]model.OutboxMessage, error)
+	MarkSent(id string) error
+	MarkFailed(id string, reason string, retryAt time.Time) error
+	DeleteSentBefore(before time.Time) (int64, error)
+}
+
+type outboxRepository struct {
+	db *gorm.DB
+}
+
+func NewOutboxRepository(db *gorm.DB) OutboxRepository {
+	return &outboxRepository{db: db}
+}
+
+func (r *outboxRepository) Add(messages ...*model.OutboxMessage) error {
+	return addOutboxMessages(r.db, messages)
+}
+
+// ClaimPending leases due messages to the caller by pushing their
+// availability past the lease. Concurrent relays skip locked rows, and a
+// relay that dies mid-batch only delays its messages until the lease ends.
+func (r *outboxRepository) ClaimPending(limit int, lease time.Duration) ([]model.OutboxMessage, error) {
+	now := time.Now()
+	var messages []model.OutboxMessage
+	err := r.db.Raw(`
+		UPDATE outbox SET available_at = ?, attempts = attempts + 1
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE sent_at IS NULL AND available_at <= ?
+			ORDER BY created_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`, now.Add(lease), now, limit).Scan(&messages).Error
+	return messages, err
+}
+
+func (r *outboxRepository) MarkSent(id string) error {
+	return r.db.Model(&model.OutboxMessage{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"sent_at":    time.Now(),
+			"last_error": "",
+		}).Error
+}
+
+func (r *outboxRepository) MarkFailed(id string, reason string, retryAt time.Time) error {
+	return r.db.Model(&model.OutboxMessage{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"available_at": retryAt,
+			"last_error":   reason,
+		}).Error
+}
+
+func (r *outboxRepository) DeleteSentBefore(before time.Time) (int64, error) {
+	result := r.db.Where("sent_at IS NOT NULL AND sent_at < ?", before).Delete(&model.OutboxMessage{})
+	return result.RowsAffected, result.Error
+}
+
+// addOutboxMessages lets other repositories write messages inside their own
+// transactions
+func addOutboxMessages(tx *gorm.DB, messages []*model.OutboxMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	return tx.Create(messages).Error
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"errors"
+
+	"yourapp/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type RoleRepository interface {
+	FindAll() ([]model.Role, error)
+	FindByName(name string) (*model.Role, error)
+	FindByUserID(userID string) ([]model.Role, error)
+	FindPermissionNamesByRoleNames(roleNames []string) ([]string, error)
+	EnsureRole(name, description string, permissions []string) (*model.Role, error)
+	SetUserRoles(userID string, roleIDs []string) error
+	AddUserRole(userID, roleID string) error
+	ResetLegacyUserTypes() (int64, error)
+}
+
+type roleRepository struct {
+	db *gorm.DB
+}
+
+func NewRoleRepository(db *gorm.DB) RoleRepository {
+	return &roleRepository{db: db}
+}
+
+func (r *roleRepository) FindAll() ([]model.Role, error) {
+	var roles []model.Role
+	err := r.db.Preload("Permissions").Order("name").Find(&roles).Error
+	return roles, err
+}
+
+func (r *roleRepository) FindByName(name string) (*model.Role, error) {
+	var role model.Role
+	err := r.db.Preload("Permissions").Where("name = ?", name).First(&role).Error
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *roleRepository) FindByUserID(userID string) ([]model.Role, error) {
+	var roles []model.Role
+	err := r.db.Preload("Permissions").
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.name").
+		Find(&roles).Error
+	return roles, err
+}
+
+func (r *roleRepository) FindPermissionNamesByRoleNames(roleNames []string) ([]string, error) {
+	var names []string
+	err := r.db.Model(&model.Permission{}).
+		Distinct("permissions.name").
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN roles ON roles.id = role_permissions.role_id").
+		Where("roles.name IN ?", roleNames).
+		Order("permissions.name").
+		Pluck("permissions.name", &names).Error
+	return names, err
+}
+
+// EnsureRole creates the role and its permissions if missing and makes sure
+// the role is granted every listed permission
+func (r *roleRepository) EnsureRole(name, description string, permissions []string) (*model.Role, error) {
+	var role model.Role
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(model.Role{Name: name}).
+			Attrs(model.Role{Description: description}).
+			FirstOrCreate(&role).Error; err != nil {
+			return err
+		}
+
+		perms := make([]model.Permission, 0, len(permissions))
+		for _, permName := range permissions {
+			var perm model.Permission
+			if err := tx.Where(model.Permission{Name: permName}).FirstOrCreate(&perm).Error; err != nil {
+				return err
+			}
+			perms = append(perms, perm)
+		}
+
+		if len(perms) > 0 {
+			return tx.Model(&role).Association("Permissions").Append(perms)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *roleRepository) SetUserRoles(userID string, roleIDs []string) error {
+	if len(roleIDs) == 0 {
+		return errors.New("at least one role is required")
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&model.UserRole{}).Error; err != nil {
+			return err
+		}
+
+		userRoles := make([]model.UserRole, 0, len(roleIDs))
+		for _, roleID := range roleIDs {
+			userRoles = append(userRoles, model.UserRole{UserID: userID, RoleID: roleID})
+		}
+		return tx.Omit("Role").Create(&userRoles).Error
+	})
+}
+
+func (r *roleRepository) AddUserRole(userID, roleID string) error {
+	userRole := model.UserRole{UserID: userID, RoleID: roleID}
+	return r.db.Omit("Role").
+		Where("user_id = ? AND role_id = ?", userID, roleID).
+		FirstOrCreate(&userRole).Error
+}
+
+// ResetLegacyUserTypes sets user_type back to member for users without any
+// role. Before roles existed the column was copied from the registration
+// request, so it cannot be trusted for those accounts.
+func (r *roleRepository) ResetLegacyUserTypes() (int64, error) {
+	result := r.db.Model(&model.User{}).
+		Where("user_type <> ? AND NOT EXISTS (SELECT 1 FROM user_roles WHERE user_roles.user_id = users.id)", model.RoleMember).
+		Update("user_type", model.RoleMember)
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"time"
+
+	"yourapp/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SAMLRepository interface {
+	SaveProvider(provider *model.SAMLProvider) error
+	FindProviderByOrgID(orgID string) (*model.SAMLProvider, error)
+	DeleteProvider(orgID string) (int64, error)
+	CreateLoginRequest(request *model.SAMLLoginRequest) error
+	AuthenticateLoginRequest(id, orgID string) (int64, error)
+	SetLoginCode(id, userID, codeHash string) error
+	FindLoginRequestByCodeHash(codeHash string) (*model.SAMLLoginRequest, error)
+	MarkLoginExchanged(id string) (int64, error)
+}
+
+type samlRepository struct {
+	db *gorm.DB
+}
+
+func NewSAMLRepository(db *gorm.DB) SAMLRepository {
+	return &samlRepository{db: db}
+}
+
+// SaveProvider creates or replaces the organization's identity provider
+func (r *samlRepository) SaveProvider(provider *model.SAMLProvider) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "organization_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"idp_entity_id", "sso_url", "certificates", "email_attribute", "name_attribute", "updated_at"}),
+	}).Create(provider).Error
+}
+
+func (r *samlRepository) FindProviderByOrgID(orgID string) (*model.SAMLProvider, error) {
+	var provider model.SAMLProvider
+	err := r.db.Where("organization_id = ?", orgID).First(&provider).Error
+	if err != nil {
+		return nil, err
+	}
+	return &provider, nil
+}
+
+func (r *samlRepository) DeleteProvider(orgID string) (int64, error) {
+	result := r.db.Where("organization_id = ?", orgID).Delete(&model.SAMLProvider{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *samlRepository) CreateLoginRequest(request *model.SAMLLoginRequest) error {
+	return r.db.Create(request).Error
+}
+
+// AuthenticateLoginRequest claims a pending, unexpired request for an
+// assertion; zero rows affected means it was unknown or already used
+func (r *samlRepository) AuthenticateLoginRequest(id, orgID string) (int64, error) {
+	now := time.Now()
+	result := r.db.Model(&model.SAMLLoginRequest{}).
+		Where("id = ? AND organization_id = ? AND authenticated_at IS NULL AND expires_at > ?", id, orgID, now).
+		Update("authenticated_at", now)
+	return result.RowsAffected, result.Error
+}
+
+func (r *samlRepository) SetLoginCode(id, userID, codeHash string) error {
+	return r.db.Model(&model.SAMLLoginRequest{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"user_id":   userID,
+			"code_hash": codeHash,
+		}).Error
+}
+
+func (r *samlRepository) FindLoginRequestByCodeHash(codeHash string) (*model.SAMLLoginRequest, error) {
+	var request model.SAMLLoginRequest
+	err := r.db.Where("code_hash = ?", codeHash).First(&request).Error
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// MarkLoginExchanged consumes the login code; zero rows affected means it was already used
+func (r *samlRepository) MarkLoginExchanged(id string) (int64, error) {
+	result := r.db.Model(&model.SAMLLoginRequest{}).
+		Where("id = ? AND exchanged_at IS NULL", id).
+		Update("exchanged_at", time.Now())
+	return result.RowsAffected, result.Error
+}
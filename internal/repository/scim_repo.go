@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"yourapp/internal/model"
+	"yourapp/internal/util"
+
+	"gorm.io/gorm"
+)
+
+// SCIMRepository stores SCIM tokens and queries the members an organization
+// provisions. Only SAML users are visible through SCIM, so an IdP can never
+// modify accounts that sign in some other way.
+type SCIMRepository interface {
+	CreateToken(token *model.SCIMToken) error
+	FindTokenByPrefix(prefix string) (*model.SCIMToken, error)
+	FindTokensByOrgID(orgID string) ([]model.SCIMToken, error)
+	RevokeToken(id, orgID string) (int64, error)
+	TouchToken(id string) error
+	ListMembers(orgID string, filter *util.SCIMFilter, offset, limit int) ([]model.Membership, int64, error)
+	FindMember(orgID, userID string) (*model.Membership, error)
+	FindMembersByRole(orgID, role string) ([]model.Membership, error)
+}
+
+type scimRepository struct {
+	db *gorm.DB
+}
+
+func NewSCIMRepository(db *gorm.DB) SCIMRepository {
+	return &scimRepository{db: db}
+}
+
+func (r *scimRepository) CreateToken(token *model.SCIMToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *scimRepository) FindTokenByPrefix(prefix string) (*model.SCIMToken, error) {
+	var token model.SCIMToken
+	err := r.db.Where("prefix = ? AND revoked_at IS NULL", prefix).First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *scimRepository) FindTokensByOrgID(orgID string) ([]model.SCIMToken, error) {
+	var tokens []model.SCIMToken
+	err := r.db.Where("organization_id = ?", orgID).Order("created_at DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+func (r *scimRepository) RevokeToken(id, orgID string) (int64, error) {
+	result := r.db.Model(&model.SCIMToken{}).
+		Where("id = ? AND organization_id = ? AND revoked_at IS NULL", id, orgID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+func (r *scimRepository) TouchToken(id string) error {
+	return r.db.Model(&model.SCIMToken{}).Where("id = ?", id).Update("last_used_at", time.Now()).Error
+}
+
+// members scopes a query to the organization's SAML members
+func (r *scimRepository) members(orgID string) *gorm.DB {
+	return r.db.Model(&model.Membership{}).
+		Joins("JOIN users ON users.id = memberships.user_id AND users.deleted_at IS NULL").
+		Where("memberships.organization_id = ? AND users.login_type = ?", orgID, model.LoginTypeSAML)
+}
+
+func (r *scimRepository) ListMembers(orgID string, filter *util.SCIMFilter, offset, limit int) ([]model.Membership, int64, error) {
+	query := r.members(orgID)
+	if filter != nil {
+		clause, args, err := scimFilterSQL(filter)
+		if err != nil {
+			return nil, 0, err
+		}
+		query = query.Where(clause, args...)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var memberships []model.Membership
+	if limit == 0 {
+		return memberships, total, nil
+	}
+	err := query.Preload("User").
+		Order("users.created_at, users.id").
+		Offset(offset).
+		Limit(limit).
+		Find(&memberships).Error
+	return memberships, total, err
+}
+
+func (r *scimRepository) FindMember(orgID, userID string) (*model.Membership, error) {
+	var membership model.Membership
+	err := r.members(orgID).Preload("User").Where("memberships.user_id = ?", userID).First(&membership).Error
+	if err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+func (r *scimRepository) FindMembersByRole(orgID, role string) ([]model.Membership, error) {
+	var memberships []model.Membership
+	err := r.members(orgID).Preload("User").
+		Where("memberships.role = ?", role).
+		Order("users.created_at").
+		Find(&memberships).Error
+	return memberships, err
+}
+
+// scimUserColumns maps filterable User attributes to columns
+var scimUserColumns = map[string]string{
+	"id":                "users.id",
+	"username":          "COALESCE(users.username, users.email)",
+	"displayname":       "users.full_name",
+	"name.formatted":    "users.full_name",
+	"emails":            "users.email",
+	"emails.value":      "users.email",
+	"active":            "users.is_active",
+	"meta.created":      "users.created_at",
+	"meta.lastmodified": "users.updated_at",
+}
+
+// scimFilterSQL translates a SCIM filter into a WHERE clause. String
+// comparisons are case-insensitive, as the core attributes are not caseExact.
+func scimFilterSQL(f *util.SCIMFilter) (string, []interface{}, error) {
+	switch f.Op {
+	case "and", "or":
+		left, leftArgs, err := scimFilterSQL(f.Left)
+		if err != nil {
+			return "", nil, err
+		}
+		right, rightArgs, err := scimFilterSQL(f.Right)
+		if err != nil {
+			return "", nil, err
+		}
+		return "(" + left + " " + strings.ToUpper(f.Op) + " " + right + ")", append(leftArgs, rightArgs...), nil
+	case "not":
+		inner, args, err := scimFilterSQL(f.Left)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT " + inner, args, nil
+	}
+
+	column, ok := scimUserColumns[f.Attr]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: cannot filter on %s", util.ErrSCIMInvalidFilter, f.Attr)
+	}
+	if f.Op == "pr" {
+		return column + " IS NOT NULL", nil, nil
+	}
+
+	switch value := f.Value.(type) {
+	case bool:
+		if f.Attr != "active" || (f.Op != "eq" && f.Op != "ne") {
+			break
+		}
+		if f.Op == "ne" {
+			return column + " <> ?", []interface{}{value}, nil
+		}
+		return column + " = ?", []interface{}{value}, nil
+	case string:
+		if strings.HasPrefix(f.Attr, "meta.") {
+			at, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return "", nil, fmt.Errorf("%w: %s must be an RFC 3339 timestamp", util.ErrSCIMInvalidFilter, f.Attr)
+			}
+			if op, ok := scimSQLOperators[f.Op]; ok {
+				return column + " " + op + " ?", []interface{}{at}, nil
+			}
+			break
+		}
+		if f.Attr == "active" {
+			break
+		}
+		lowered := "LOWER(" + column + ")"
+		value = strings.ToLower(value)
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+		switch f.Op {
+		case "co":
+			return lowered + " LIKE ?", []interface{}{"%" + escaped + "%"}, nil
+		case "sw":
+			return lowered + " LIKE ?", []interface{}{escaped + "%"}, nil
+		case "ew":
+			return lowered + " LIKE ?", []interface{}{"%" + escaped}, nil
+		}
+		if op, ok := scimSQLOperators[f.Op]; ok {
+			return lowered + " " + op + " ?", []interface{}{value}, nil
+		}
+	}
+	return "", nil, fmt.Errorf("%w: unsupported comparison on %s", util.ErrSCIMInvalidFilter, f.Attr)
+}
+
+var scimSQLOperators = map[string]string{
+	"eq": "=",
+	"ne": "<>",
+	"gt": ">",
+	"ge": ">=",
+	"lt": "<",
+	"le": "<=",
+}
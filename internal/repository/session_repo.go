@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"time"
+
+	"yourapp/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type SessionRepository interface {
+	Create(session *model.Session) error
+	FindByID(id string) (*model.Session, error)
+	FindByUserID(userID string) ([]model.Session, error)
+	FindActiveByUserID(userID string) ([]model.Session, error)
+	Touch(id string, expiresAt time.Time) error
+	Revoke(id string) error
+	RevokeAllByUserID(userID string) (int64, error)
+}
+
+type sessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+func (r *sessionRepository) Create(session *model.Session) error {
+	return r.db.Create(session).Error
+}
+
+func (r *sessionRepository) FindByID(id string) (*model.Session, error) {
+	var session model.Session
+	err := r.db.Where("id = ?", id).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *sessionRepository) FindByUserID(userID string) ([]model.Session, error) {
+	var sessions []model.Session
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+func (r *sessionRepository) FindActiveByUserID(userID string) ([]model.Session, error) {
+	var sessions []model.Session
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("created_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// Touch records session use and slides its expiry forward
+func (r *sessionRepository) Touch(id string, expiresAt time.Time) error {
+	return r.db.Model(&model.Session{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"last_used_at": time.Now(),
+			"expires_at":   expiresAt,
+		}).Error
+}
+
+func (r *sessionRepository) Revoke(id string) error {
+	return r.db.Model(&model.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *sessionRepository) RevokeAllByUserID(userID string) (int64, error) {
+	result := r.db.Model(&model.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"errors"
+	"strings"
 	"time"
 
 	"yourapp/internal/model"
@@ -9,19 +10,39 @@ import (
 	"gorm.io/gorm"
 )
 
+// UserFilter narrows down user listings; nil fields are ignored
+type UserFilter struct {
+	Email       string
+	IsVerified  *bool
+	IsActive    *bool
+	LoginType   string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	Page        int
+	PageSize    int
+}
+
 type UserRepository interface {
 	Create(user *model.User) error
+	CreateWithOutbox(user *model.User, messages ...*model.OutboxMessage) error
 	FindByID(id string) (*model.User, error)
 	FindByEmail(email string) (*model.User, error)
 	FindByUsername(username string) (*model.User, error)
 	FindByGoogleID(googleID string) (*model.User, error)
 	Update(user *model.User) error
 	UpdateOTP(email string, otpCode string, expiresAt time.Time) error
+	UpdateOTPWithOutbox(email string, otpCode string, expiresAt time.Time, messages ...*model.OutboxMessage) error
 	VerifyOTP(email string, otpCode string) (*model.User, error)
 	UpdateResetToken(email string, token string, expiresAt time.Time) error
 	FindByResetToken(token string) (*model.User, error)
 	UpdatePassword(userID string, passwordHash string) error
 	UpdateLastLogin(userID string) error
+	UpdateUserType(userID string, userType string) error
+	List(filter UserFilter) ([]model.User, int64, error)
+	SetActive(userID string, active bool) error
+	MarkVerified(userID string) error
+	SetResetRequired(userID string, required bool) error
+	SetLocale(userID string, locale string) error
 }
 
 type userRepository struct {
@@ -36,6 +57,16 @@ func (r *userRepository) Create(user *model.User) error {
 	return r.db.Create(user).Error
 }
 
+// CreateWithOutbox creates the user and queues its messages atomically
+func (r *userRepository) CreateWithOutbox(user *model.User, messages ...*model.OutboxMessage) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return addOutboxMessages(tx, messages)
+	})
+}
+
 func (r *userRepository) FindByID(id string) (*model.User, error) {
 	var user model.User
 	err := r.db.Where("id = ?", id).First(&user).Error
@@ -85,6 +116,22 @@ func (r *userRepository) UpdateOTP(email string, otpCode string, expiresAt time.
 		}).Error
 }
 
+// UpdateOTPWithOutbox stores the new OTP and queues the email carrying it
+// atomically
+func (r *userRepository) UpdateOTPWithOutbox(email string, otpCode string, expiresAt time.Time, messages ...*model.OutboxMessage) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.User{}).
+			Where("email = ?", email).
+			Updates(map[string]interface{}{
+				"otp_code":       otpCode,
+				"otp_expires_at": expiresAt,
+			}).Error; err != nil {
+			return err
+		}
+		return addOutboxMessages(tx, messages)
+	})
+}
+
 func (r *userRepository) VerifyOTP(email string, otpCode string) (*model.User, error) {
 	var user model.User
 	err := r.db.Where("email = ? AND otp_code = ? AND otp_expires_at > ?", email, otpCode, time.Now()).First(&user).Error
@@ -129,6 +176,7 @@ func (r *userRepository) UpdatePassword(userID string, passwordHash string) erro
 			"password_hash":    passwordHash,
 			"reset_token":      nil,
 			"reset_expires_at": nil,
+			"reset_required":   false,
 		}).Error
 }
 
@@ -138,3 +186,77 @@ func (r *userRepository) UpdateLastLogin(userID string) error {
 		Where("id = ?", userID).
 		Update("last_login", now).Error
 }
+
+func (r *userRepository) UpdateUserType(userID string, userType string) error {
+	return r.db.Model(&model.User{}).
+		Where("id = ?", userID).
+		Update("user_type", userType).Error
+}
+
+// likeEscaper makes a search term match literally inside a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (r *userRepository) List(filter UserFilter) ([]model.User, int64, error) {
+	query := r.db.Model(&model.User{})
+	if filter.Email != "" {
+		query = query.Where(`email ILIKE ? ESCAPE '\'`, "%"+likeEscaper.Replace(filter.Email)+"%")
+	}
+	if filter.IsVerified != nil {
+		query = query.Where("is_verified = ?", *filter.IsVerified)
+	}
+	if filter.IsActive != nil {
+		query = query.Where("is_active = ?", *filter.IsActive)
+	}
+	if filter.LoginType != "" {
+		query = query.Where("login_type = ?", filter.LoginType)
+	}
+	if filter.CreatedFrom != nil {
+		query = query.Where("created_at >= ?", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		query = query.Where("created_at < ?", *filter.CreatedTo)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []model.User
+	err := query.Order("created_at DESC").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&users).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+func (r *userRepository) SetActive(userID string, active bool) error {
+	return r.db.Model(&model.User{}).
+		Where("id = ?", userID).
+		Update("is_active", active).Error
+}
+
+func (r *userRepository) MarkVerified(userID string) error {
+	return r.db.Model(&model.User{}).
+		Where("id = ?", userID).
+		Updates(map[string]interface{}{
+			"is_verified":    true,
+			"otp_code":       nil,
+			"otp_expires_at": nil,
+		}).Error
+}
+
+func (r *userRepository) SetResetRequired(userID string, required bool) error {
+	return r.db.Model(&model.User{}).
+		Where("id = ?", userID).
+		Update("reset_required", required).Error
+}
+
+func (r *userRepository) SetLocale(userID string, locale string) error {
+	return r.db.Model(&model.User{}).
+		Where("id = ?", userID).
+		Update("locale", locale).Error
+}
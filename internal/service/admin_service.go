@@ -0,0 +1,256 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+)
+
+type AdminService interface {
+	ListUsers(filter repository.UserFilter) (*UserListResponse, error)
+	GetUser(userID string) (*AdminUserDetail, error)
+	SetUserActive(userID string, active bool, meta RequestMeta) error
+	VerifyUser(userID string, meta RequestMeta) error
+	ForcePasswordReset(userID string, meta RequestMeta) error
+	SetUserRoles(userID string, roleNames []string, meta RequestMeta) error
+	RevokeSessions(userID string, meta RequestMeta) (int64, error)
+	Impersonate(userID, reason string, meta RequestMeta) (*ImpersonationResponse, error)
+	StopImpersonation(meta RequestMeta) error
+}
+
+type adminService struct {
+	userRepo    repository.UserRepository
+	sessionRepo repository.SessionRepository
+	rbacService RBACService
+	authService AuthService
+	auditLogger AuditLogger
+}
+
+type UserListResponse struct {
+	Users    []model.User `json:"users"`
+	Total    int64        `json:"total"`
+	Page     int          `json:"page"`
+	PageSize int          `json:"page_size"`
+}
+
+type AdminUserDetail struct {
+	User     *model.User     `json:"user"`
+	Roles    []string        `json:"roles"`
+	Sessions []model.Session `json:"sessions"`
+}
+
+func NewAdminService(userRepo repository.UserRepository, sessionRepo repository.SessionRepository, rbacService RBACService, authService AuthService, auditLogger AuditLogger) AdminService {
+	return &adminService{
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		rbacService: rbacService,
+		authService: authService,
+		auditLogger: auditLogger,
+	}
+}
+
+func (s *adminService) ListUsers(filter repository.UserFilter) (*UserListResponse, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 || filter.PageSize > 100 {
+		filter.PageSize = 20
+	}
+
+	users, total, err := s.userRepo.List(filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	return &UserListResponse{
+		Users:    users,
+		Total:    total,
+		Page:     filter.Page,
+		PageSize: filter.PageSize,
+	}, nil
+}
+
+func (s *adminService) GetUser(userID string) (*AdminUserDetail, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	roles, err := s.rbacService.GetUserRoleNames(user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get roles: %w", err)
+	}
+
+	sessions, err := s.sessionRepo.FindActiveByUserID(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+
+	return &AdminUserDetail{
+		User:     user,
+		Roles:    roles,
+		Sessions: sessions,
+	}, nil
+}
+
+func (s *adminService) SetUserActive(userID string, active bool, meta RequestMeta) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if !active && user.ID == meta.ActorID {
+		return errors.New("you cannot deactivate your own account")
+	}
+
+	if err := s.userRepo.SetActive(user.ID, active); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	action := model.AuditActionAdminUserActivated
+	if !active {
+		action = model.AuditActionAdminUserDeactivated
+		// Deactivated users must not keep refreshing their tokens
+		if _, err := s.sessionRepo.RevokeAllByUserID(user.ID); err != nil {
+			return fmt.Errorf("failed to revoke sessions: %w", err)
+		}
+	}
+
+	s.auditLogger.Log(action, meta, user.ID, nil)
+	return nil
+}
+
+func (s *adminService) VerifyUser(userID string, meta RequestMeta) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if user.IsVerified {
+		return errors.New("user is already verified")
+	}
+
+	if err := s.userRepo.MarkVerified(user.ID); err != nil {
+		return fmt.Errorf("failed to verify user: %w", err)
+	}
+
+	s.auditLogger.Log(model.AuditActionAdminUserVerified, meta, user.ID, nil)
+	return nil
+}
+
+// ForcePasswordReset blocks password login until the user resets their
+// password, signs them out everywhere and emails them a reset OTP
+func (s *adminService) ForcePasswordReset(userID string, meta RequestMeta) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if user.LoginType != "credential" {
+		return errors.New("password reset is only available for email and password accounts")
+	}
+
+	if err := s.userRepo.SetResetRequired(user.ID, true); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	if _, err := s.sessionRepo.RevokeAllByUserID(user.ID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	if err := s.authService.RequestResetPassword(user.Email, meta); err != nil {
+		return err
+	}
+
+	s.auditLogger.Log(model.AuditActionAdminPasswordReset, meta, user.ID, nil)
+	return nil
+}
+
+func (s *adminService) SetUserRoles(userID string, roleNames []string, meta RequestMeta) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	previous, err := s.rbacService.GetUserRoleNames(user)
+	if err != nil {
+		return fmt.Errorf("failed to get roles: %w", err)
+	}
+
+	if err := s.rbacService.SetUserRoles(user.ID, roleNames); err != nil {
+		return err
+	}
+
+	s.auditLogger.Log(model.AuditActionAdminRolesChanged, meta, user.ID, model.JSONMap{
+		"previous_roles": previous,
+		"roles":          roleNames,
+	})
+	return nil
+}
+
+func (s *adminService) RevokeSessions(userID string, meta RequestMeta) (int64, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return 0, errors.New("user not found")
+	}
+
+	revoked, err := s.sessionRepo.RevokeAllByUserID(user.ID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	s.auditLogger.Log(model.AuditActionAdminSessionsRevoked, meta, user.ID, model.JSONMap{
+		"revoked": revoked,
+	})
+	return revoked, nil
+}
+
+// Impersonate lets an admin act as another user for support purposes
+func (s *adminService) Impersonate(userID, reason string, meta RequestMeta) (*ImpersonationResponse, error) {
+	if meta.ImpersonatorID != "" {
+		return nil, errors.New("cannot start impersonation while impersonating")
+	}
+
+	if userID == meta.ActorID {
+		return nil, errors.New("you cannot impersonate yourself")
+	}
+
+	actor, err := s.userRepo.FindByID(meta.ActorID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	target, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if !target.IsActive {
+		return nil, errors.New("cannot impersonate a deactivated account")
+	}
+
+	resp, err := s.authService.IssueImpersonationToken(target, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	s.auditLogger.Log(model.AuditActionImpersonationStarted, meta, target.ID, model.JSONMap{
+		"reason":     reason,
+		"expires_in": resp.ExpiresIn,
+	})
+	return resp, nil
+}
+
+// StopImpersonation records the end of an impersonation; the client discards the token
+func (s *adminService) StopImpersonation(meta RequestMeta) error {
+	if meta.ImpersonatorID == "" {
+		return errors.New("not impersonating")
+	}
+
+	// Like every action taken with the token, the admin is recorded as
+	// impersonator_id next to the impersonated actor
+	s.auditLogger.Log(model.AuditActionImpersonationStopped, meta, meta.ActorID, nil)
+	return nil
+}
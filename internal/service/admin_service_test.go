@@ -0,0 +1,89 @@
+package service
+
+import (
+	"testing"
+
+	"yourapp/internal/model"
+)
+
+func newTestAdminService(t *testing.T, users ...*model.User) (AdminService, *authService, *fakeUserRepo, *fakeAuditLogger) {
+	t.Helper()
+	auth, userRepo, _, sessionRepo := newTestAuthService(t, nil, users...)
+	auditLogger := &fakeAuditLogger{}
+	admin := NewAdminService(userRepo, sessionRepo, auth.rbacService, auth, auditLogger)
+	return admin, auth, userRepo, auditLogger
+}
+
+func TestImpersonationIsAuditedWithRequestID(t *testing.T) {
+	target := &model.User{ID: "target", Email: "ana@example.com", IsActive: true}
+	admin := &model.User{ID: "admin", Email: "admin@example.com", IsActive: true}
+	s, auth, _, auditLogger := newTestAdminService(t, target, admin)
+
+	resp, err := s.Impersonate(target.ID, "ticket 42", RequestMeta{ActorID: admin.ID, RequestID: "req-start"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	started, ok := auditLogger.find(model.AuditActionImpersonationStarted)
+	if !ok || started.Meta.RequestID != "req-start" || started.TargetUserID != target.ID || started.Metadata["reason"] != "ticket 42" {
+		t.Fatalf("impersonation start audit = %+v", started)
+	}
+
+	// Requests made with the impersonation token carry both identities
+	claims, err := auth.AuthenticateAccessToken(resp.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := RequestMeta{ActorID: claims.UserID, ImpersonatorID: claims.Actor.Subject, RequestID: "req-stop", IPAddress: "10.0.0.1"}
+	if err := s.StopImpersonation(meta); err != nil {
+		t.Fatal(err)
+	}
+
+	stopped, ok := auditLogger.find(model.AuditActionImpersonationStopped)
+	if !ok {
+		t.Fatal("impersonation stop was not audited")
+	}
+	if stopped.Meta != meta || stopped.TargetUserID != target.ID {
+		t.Fatalf("impersonation stop audit = %+v, want meta %+v", stopped, meta)
+	}
+}
+
+func TestImpersonationCannotBeNested(t *testing.T) {
+	target := &model.User{ID: "target", Email: "ana@example.com", IsActive: true}
+	other := &model.User{ID: "other", Email: "bob@example.com", IsActive: true}
+	admin := &model.User{ID: "admin", Email: "admin@example.com", IsActive: true}
+	s, _, _, _ := newTestAdminService(t, target, other, admin)
+
+	if _, err := s.Impersonate(other.ID, "", RequestMeta{ActorID: target.ID, ImpersonatorID: admin.ID}); err == nil {
+		t.Fatal("impersonation started from an impersonation token")
+	}
+	if _, err := s.Impersonate(admin.ID, "", RequestMeta{ActorID: admin.ID}); err == nil {
+		t.Fatal("admin impersonated themselves")
+	}
+	if err := s.StopImpersonation(RequestMeta{ActorID: admin.ID}); err == nil {
+		t.Fatal("stop accepted without an impersonation token")
+	}
+}
+
+func TestDeactivationRevokesSessions(t *testing.T) {
+	user := &model.User{ID: "user-1", Email: "ana@example.com", IsActive: true}
+	admin := &model.User{ID: "admin", Email: "admin@example.com", IsActive: true}
+	s, auth, _, auditLogger := newTestAdminService(t, user, admin)
+
+	login, _ := auth.generateAuthResponse(user, RequestMeta{})
+	if err := s.SetUserActive(user.ID, false, RequestMeta{ActorID: admin.ID, RequestID: "req-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.AuthenticateAccessToken(login.AccessToken); err == nil {
+		t.Fatal("deactivated user's access token still works")
+	}
+	if _, err := auth.RefreshToken(login.RefreshToken, "", RequestMeta{}); err == nil {
+		t.Fatal("deactivated user's refresh token still works")
+	}
+	if event, ok := auditLogger.find(model.AuditActionAdminUserDeactivated); !ok || event.Meta.RequestID != "req-1" {
+		t.Fatalf("deactivation audit = %+v", event)
+	}
+
+	if err := s.SetUserActive(admin.ID, false, RequestMeta{ActorID: admin.ID}); err == nil {
+		t.Fatal("admin deactivated their own account")
+	}
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+	"yourapp/internal/util"
+)
+
+type APIKeyService interface {
+	Create(userID string, req CreateAPIKeyRequest, grantedScopes []string, meta RequestMeta) (*CreateAPIKeyResponse, error)
+	List(userID string) ([]model.APIKey, error)
+	Revoke(userID, keyID string, meta RequestMeta) error
+	Authenticate(rawKey, ipAddress string) (*APIKeyPrincipal, error)
+	Inspect(rawKey string) (*APIKeyPrincipal, error)
+	RevokeRaw(rawKey string, meta RequestMeta) error
+}
+
+const (
+	// maxActiveAPIKeys caps how many usable keys a user can hold at once
+	maxActiveAPIKeys = 25
+	// defaultAPIKeyTTLDays applies when the client does not choose an expiry
+	defaultAPIKeyTTLDays = 90
+	maxAPIKeyTTLDays     = 365
+	// apiKeyTouchInterval limits last-used writes to one per key per interval
+	apiKeyTouchInterval = time.Minute
+)
+
+type apiKeyService struct {
+	apiKeyRepo  repository.APIKeyRepository
+	userRepo    repository.UserRepository
+	rbacService RBACService
+	auditLogger AuditLogger
+}
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty"`
+}
+
+// CreateAPIKeyResponse carries the plaintext key, which is only shown once
+type CreateAPIKeyResponse struct {
+	APIKey *model.APIKey `json:"api_key"`
+	Key    string        `json:"key"`
+}
+
+// APIKeyPrincipal is the identity behind an authenticated API key
+type APIKeyPrincipal struct {
+	User        *model.User
+	Key         *model.APIKey
+	Permissions []string
+}
+
+func NewAPIKeyService(apiKeyRepo repository.APIKeyRepository, userRepo repository.UserRepository, rbacService RBACService, auditLogger AuditLogger) APIKeyService {
+	return &apiKeyService{
+		apiKeyRepo:  apiKeyRepo,
+		userRepo:    userRepo,
+		rbacService: rbacService,
+		auditLogger: auditLogger,
+	}
+}
+
+// Create issues a key for the user. A key cannot carry a scope the creating
+// token was not granted, so a narrowed token cannot mint a broader key.
+func (s *apiKeyService) Create(userID string, req CreateAPIKeyRequest, grantedScopes []string, meta RequestMeta) (*CreateAPIKeyResponse, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, errors.New("name is required")
+	}
+
+	scopes, err := s.validateScopes(user, req.Scopes, grantedScopes)
+	if err != nil {
+		return nil, err
+	}
+
+	ttlDays := req.ExpiresInDays
+	if ttlDays == 0 {
+		ttlDays = defaultAPIKeyTTLDays
+	}
+	if ttlDays < 1 || ttlDays > maxAPIKeyTTLDays {
+		return nil, fmt.Errorf("expires_in_days must be between 1 and %d", maxAPIKeyTTLDays)
+	}
+
+	active, err := s.apiKeyRepo.CountActiveByUserID(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count API keys: %w", err)
+	}
+	if active >= maxActiveAPIKeys {
+		return nil, fmt.Errorf("you can have at most %d active API keys", maxActiveAPIKeys)
+	}
+
+	prefix, err := util.GenerateSecureToken(6)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+	secret, err := util.GenerateSecureToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	key := &model.APIKey{
+		UserID:     user.ID,
+		Name:       name,
+		Prefix:     model.APIKeyPrefix + prefix,
+		SecretHash: util.HashToken(secret),
+		Scopes:     scopes,
+		ExpiresAt:  time.Now().Add(time.Duration(ttlDays) * 24 * time.Hour),
+	}
+	if err := s.apiKeyRepo.Create(key); err != nil {
+		return nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	s.auditLogger.Log(model.AuditActionAPIKeyCreated, meta, user.ID, model.JSONMap{
+		"api_key_id": key.ID,
+		"prefix":     key.Prefix,
+		"scopes":     []string(scopes),
+	})
+
+	return &CreateAPIKeyResponse{
+		APIKey: key,
+		Key:    key.Prefix + "_" + secret,
+	}, nil
+}
+
+// validateScopes accepts user scopes and permissions the user currently holds,
+// as far as the creating token was granted them
+func (s *apiKeyService) validateScopes(user *model.User, requested, granted []string) (model.StringList, error) {
+	permissions, err := s.rbacService.GetUserPermissions(user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve permissions: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	scopes := model.StringList{}
+	for _, scope := range requested {
+		scope = strings.TrimSpace(scope)
+		if seen[scope] {
+			continue
+		}
+		if !model.IsUserScope(scope) && !hasString(permissions, scope) {
+			return nil, fmt.Errorf("invalid scope: %s", scope)
+		}
+		if !hasString(granted, scope) {
+			return nil, fmt.Errorf("scope %q was not granted to this token", scope)
+		}
+		seen[scope] = true
+		scopes = append(scopes, scope)
+	}
+	return scopes, nil
+}
+
+func (s *apiKeyService) List(userID string) ([]model.APIKey, error) {
+	return s.apiKeyRepo.FindByUserID(userID)
+}
+
+func (s *apiKeyService) Revoke(userID, keyID string, meta RequestMeta) error {
+	revoked, err := s.apiKeyRepo.Revoke(keyID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	if revoked == 0 {
+		return errors.New("API key not found")
+	}
+
+	s.auditLogger.Log(model.AuditActionAPIKeyRevoked, meta, userID, model.JSONMap{"api_key_id": keyID})
+	return nil
+}
+
+// Authenticate resolves a raw "ak_<prefix>_<secret>" key to its user. The
+// principal's permissions are the user's current permissions narrowed to the
+// key's scopes.
+func (s *apiKeyService) Authenticate(rawKey, ipAddress string) (*APIKeyPrincipal, error) {
+	principal, err := s.Inspect(rawKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key := principal.Key
+	if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) > apiKeyTouchInterval {
+		if err := s.apiKeyRepo.Touch(key.ID, ipAddress); err != nil {
+			log.Printf("Failed to record API key use %s: %v", key.ID, err)
+		}
+	}
+
+	return principal, nil
+}
+
+// Inspect resolves a raw key like Authenticate without recording it as used
+func (s *apiKeyService) Inspect(rawKey string) (*APIKeyPrincipal, error) {
+	invalid := errors.New("invalid or expired API key")
+
+	key, err := s.findKey(rawKey)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(key.UserID)
+	if err != nil || !user.IsActive {
+		return nil, invalid
+	}
+
+	permissions, err := s.rbacService.GetUserPermissions(user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve permissions: %w", err)
+	}
+	granted := []string{}
+	for _, p := range permissions {
+		if hasString(key.Scopes, p) {
+			granted = append(granted, p)
+		}
+	}
+
+	return &APIKeyPrincipal{
+		User:        user,
+		Key:         key,
+		Permissions: granted,
+	}, nil
+}
+
+// RevokeRaw revokes the key by its plaintext value. Anyone holding a key may
+// revoke it, so a leaked key can be disabled without its owner's login.
+func (s *apiKeyService) RevokeRaw(rawKey string, meta RequestMeta) error {
+	key, err := s.findKey(rawKey)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.apiKeyRepo.Revoke(key.ID, key.UserID); err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+
+	s.auditLogger.Log(model.AuditActionAPIKeyRevoked, meta, key.UserID, model.JSONMap{"api_key_id": key.ID})
+	return nil
+}
+
+// findKey looks up an active key and checks its secret
+func (s *apiKeyService) findKey(rawKey string) (*model.APIKey, error) {
+	invalid := errors.New("invalid or expired API key")
+
+	if !strings.HasPrefix(rawKey, model.APIKeyPrefix) {
+		return nil, invalid
+	}
+	sep := strings.LastIndex(rawKey, "_")
+	if sep <= len(model.APIKeyPrefix) {
+		return nil, invalid
+	}
+	prefix, secret := rawKey[:sep], rawKey[sep+1:]
+
+	key, err := s.apiKeyRepo.FindByPrefix(prefix)
+	if err != nil || !key.IsActive() {
+		return nil, invalid
+	}
+	if subtle.ConstantTimeCompare([]byte(util.HashToken(secret)), []byte(key.SecretHash)) != 1 {
+		return nil, invalid
+	}
+	return key, nil
+}
+
+func hasString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
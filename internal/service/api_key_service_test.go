@@ -0,0 +1,149 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"yourapp/internal/model"
+)
+
+func newTestAPIKeyService(t *testing.T, users ...*model.User) (APIKeyService, *fakeAPIKeyRepo, *fakeUserRepo, RBACService) {
+	t.Helper()
+	userRepo := newFakeUserRepo(users...)
+	rbac, _ := newTestRBAC(userRepo, nil)
+	for _, user := range users {
+		if err := rbac.AssignDefaultRoles(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keyRepo := newFakeAPIKeyRepo()
+	return NewAPIKeyService(keyRepo, userRepo, rbac, &fakeAuditLogger{}), keyRepo, userRepo, rbac
+}
+
+// sessionScopes is what a first-party login of an admin is granted
+var sessionScopes = append(append([]string{}, model.UserScopes...), model.AllPermissions...)
+
+func TestAPIKeyIsStoredHashedAndAuthenticates(t *testing.T) {
+	user := &model.User{ID: "user-1", Email: "ana@example.com", IsActive: true}
+	s, keyRepo, _, _ := newTestAPIKeyService(t, user)
+
+	created, err := s.Create(user.ID, CreateAPIKeyRequest{Name: "ci", Scopes: []string{model.ScopeProfileRead}}, sessionScopes, RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := created.Key[strings.LastIndex(created.Key, "_")+1:]
+	if !strings.HasPrefix(created.Key, created.APIKey.Prefix+"_") || strings.Contains(created.APIKey.SecretHash, secret) {
+		t.Fatalf("key %q, stored hash %q", created.Key, created.APIKey.SecretHash)
+	}
+
+	principal, err := s.Authenticate(created.Key, "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.User.ID != user.ID || principal.Key.ID != created.APIKey.ID {
+		t.Fatalf("principal = %+v", principal)
+	}
+	// Last-used tracking is throttled
+	s.Authenticate(created.Key, "10.0.0.1")
+	if keyRepo.touches != 1 {
+		t.Fatalf("recorded %d uses, want 1", keyRepo.touches)
+	}
+
+	if _, err := s.Authenticate(created.Key[:len(created.Key)-1]+"x", ""); err == nil {
+		t.Fatal("key with a wrong secret accepted")
+	}
+}
+
+func TestAPIKeyScopesAreLimitedToUserPermissions(t *testing.T) {
+	user := &model.User{ID: "user-1", Email: "ana@example.com", IsActive: true}
+	s, _, _, rbac := newTestAPIKeyService(t, user)
+
+	if _, err := s.Create(user.ID, CreateAPIKeyRequest{Name: "ci", Scopes: []string{model.PermissionUsersRead}}, sessionScopes, RequestMeta{}); err == nil {
+		t.Fatal("member created a key with an admin permission")
+	}
+
+	rbac.SetUserRoles(user.ID, []string{model.RoleAdmin})
+	created, err := s.Create(user.ID, CreateAPIKeyRequest{Name: "ci", Scopes: []string{model.PermissionUsersRead}}, sessionScopes, RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	principal, _ := s.Authenticate(created.Key, "")
+	if len(principal.Permissions) != 1 || principal.Permissions[0] != model.PermissionUsersRead {
+		t.Fatalf("key permissions = %v, want only its scope", principal.Permissions)
+	}
+
+	// Losing the role takes the permission away from existing keys too
+	rbac.SetUserRoles(user.ID, []string{model.RoleMember})
+	principal, _ = s.Authenticate(created.Key, "")
+	if len(principal.Permissions) != 0 {
+		t.Fatalf("key kept %v after the role was removed", principal.Permissions)
+	}
+}
+
+func TestAPIKeyStopsWorking(t *testing.T) {
+	user := &model.User{ID: "user-1", Email: "ana@example.com", IsActive: true}
+	s, keyRepo, userRepo, _ := newTestAPIKeyService(t, user)
+
+	revoked, _ := s.Create(user.ID, CreateAPIKeyRequest{Name: "revoked", Scopes: []string{model.ScopeProfileRead}}, sessionScopes, RequestMeta{})
+	if err := s.Revoke("someone-else", revoked.APIKey.ID, RequestMeta{}); err == nil {
+		t.Fatal("another user revoked the key")
+	}
+	if err := s.Revoke(user.ID, revoked.APIKey.ID, RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authenticate(revoked.Key, ""); err == nil {
+		t.Fatal("revoked key accepted")
+	}
+
+	expired, _ := s.Create(user.ID, CreateAPIKeyRequest{Name: "expired", Scopes: []string{model.ScopeProfileRead}}, sessionScopes, RequestMeta{})
+	keyRepo.keys[expired.APIKey.ID].ExpiresAt = time.Now().Add(-time.Minute)
+	if _, err := s.Authenticate(expired.Key, ""); err == nil {
+		t.Fatal("expired key accepted")
+	}
+
+	leaked, _ := s.Create(user.ID, CreateAPIKeyRequest{Name: "leaked", Scopes: []string{model.ScopeProfileRead}}, sessionScopes, RequestMeta{})
+	userRepo.SetActive(user.ID, false)
+	if _, err := s.Authenticate(leaked.Key, ""); err == nil {
+		t.Fatal("key of a deactivated user accepted")
+	}
+	if err := s.RevokeRaw(leaked.Key, RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if keyRepo.keys[leaked.APIKey.ID].RevokedAt == nil {
+		t.Fatal("leaked key not revoked by its plaintext")
+	}
+}
+
+func TestAPIKeyExpiryBounds(t *testing.T) {
+	user := &model.User{ID: "user-1", Email: "ana@example.com", IsActive: true}
+	s, _, _, _ := newTestAPIKeyService(t, user)
+
+	if _, err := s.Create(user.ID, CreateAPIKeyRequest{Name: "ci", Scopes: []string{model.ScopeProfileRead}, ExpiresInDays: maxAPIKeyTTLDays + 1}, sessionScopes, RequestMeta{}); err == nil {
+		t.Fatal("key accepted with an expiry beyond the maximum")
+	}
+	created, err := s.Create(user.ID, CreateAPIKeyRequest{Name: "ci", Scopes: []string{model.ScopeProfileRead}}, sessionScopes, RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if days := time.Until(created.APIKey.ExpiresAt).Hours() / 24; days < defaultAPIKeyTTLDays-1 || days > defaultAPIKeyTTLDays {
+		t.Fatalf("default expiry in %.1f days", days)
+	}
+}
+
+func TestAPIKeyCannotExceedTheCreatingToken(t *testing.T) {
+	user := &model.User{ID: "user-1", Email: "ana@example.com", IsActive: true}
+	s, _, _, rbac := newTestAPIKeyService(t, user)
+	rbac.SetUserRoles(user.ID, []string{model.RoleAdmin})
+
+	narrowed := []string{model.ScopeProfileRead}
+	if _, err := s.Create(user.ID, CreateAPIKeyRequest{Name: "ci", Scopes: []string{model.PermissionUsersRead}}, narrowed, RequestMeta{}); err == nil {
+		t.Fatal("profile:read token minted a key with users:read")
+	}
+	if _, err := s.Create(user.ID, CreateAPIKeyRequest{Name: "ci", Scopes: []string{model.ScopeProfileWrite}}, narrowed, RequestMeta{}); err == nil {
+		t.Fatal("profile:read token minted a key with profile:write")
+	}
+	if _, err := s.Create(user.ID, CreateAPIKeyRequest{Name: "ci", Scopes: narrowed}, narrowed, RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+}
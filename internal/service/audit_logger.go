@@ -0,0 +1,95 @@
+package service
+
+import (
+	"fmt"
+	"log"
+
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+)
+
+type AuditLogger interface {
+	Log(action string, meta RequestMeta, targetUserID string, metadata model.JSONMap)
+	Search(filter repository.AuditFilter) (*AuditEventListResponse, error)
+	RecentForUser(userID string, limit int) ([]model.AuditEvent, error)
+}
+
+type auditLogger struct {
+	auditRepo repository.AuditRepository
+}
+
+type AuditEventListResponse struct {
+	Events   []model.AuditEvent `json:"events"`
+	Total    int64              `json:"total"`
+	Page     int                `json:"page"`
+	PageSize int                `json:"page_size"`
+}
+
+func NewAuditLogger(auditRepo repository.AuditRepository) AuditLogger {
+	return &auditLogger{
+		auditRepo: auditRepo,
+	}
+}
+
+// Log records an audit event. Failures are logged but never block the action being audited.
+func (l *auditLogger) Log(action string, meta RequestMeta, targetUserID string, metadata model.JSONMap) {
+	event := &model.AuditEvent{
+		Action:    action,
+		IPAddress: meta.IPAddress,
+		UserAgent: meta.UserAgent,
+		RequestID: meta.RequestID,
+		Metadata:  metadata,
+	}
+	if meta.ActorID != "" {
+		event.ActorID = &meta.ActorID
+	}
+	if targetUserID != "" {
+		event.TargetUserID = &targetUserID
+	}
+	if meta.ClientID != "" {
+		if event.Metadata == nil {
+			event.Metadata = model.JSONMap{}
+		}
+		event.Metadata["client_id"] = meta.ClientID
+	}
+	if meta.ImpersonatorID != "" {
+		// Attribute actions taken under impersonation to the real admin as well
+		if event.Metadata == nil {
+			event.Metadata = model.JSONMap{}
+		}
+		event.Metadata["impersonator_id"] = meta.ImpersonatorID
+	}
+
+	if err := l.auditRepo.Create(event); err != nil {
+		log.Printf("Failed to record audit event %s: %v", action, err)
+	}
+}
+
+func (l *auditLogger) Search(filter repository.AuditFilter) (*AuditEventListResponse, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 || filter.PageSize > 100 {
+		filter.PageSize = 50
+	}
+
+	events, total, err := l.auditRepo.List(filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+
+	return &AuditEventListResponse{
+		Events:   events,
+		Total:    total,
+		Page:     filter.Page,
+		PageSize: filter.PageSize,
+	}, nil
+}
+
+// RecentForUser returns the latest security events concerning the user
+func (l *auditLogger) RecentForUser(userID string, limit int) ([]model.AuditEvent, error) {
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	return l.auditRepo.FindByTargetUserID(userID, limit)
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+)
+
+func TestAuditLogRecordsRequestContext(t *testing.T) {
+	repo := &fakeAuditRepo{}
+	logger := NewAuditLogger(repo)
+
+	meta := RequestMeta{ActorID: "user-1", ImpersonatorID: "admin", ClientID: "cli", IPAddress: "10.0.0.1", UserAgent: "curl", RequestID: "req-1"}
+	logger.Log(model.AuditActionTokenRefreshed, meta, "user-1", model.JSONMap{"session_id": "session-1"})
+
+	if len(repo.events) != 1 {
+		t.Fatalf("recorded %d events, want 1", len(repo.events))
+	}
+	event := repo.events[0]
+	if event.Action != model.AuditActionTokenRefreshed || *event.ActorID != "user-1" || *event.TargetUserID != "user-1" {
+		t.Fatalf("event = %+v", event)
+	}
+	if event.IPAddress != "10.0.0.1" || event.UserAgent != "curl" || event.RequestID != "req-1" {
+		t.Fatalf("request context not recorded: %+v", event)
+	}
+	if event.Metadata["impersonator_id"] != "admin" || event.Metadata["client_id"] != "cli" || event.Metadata["session_id"] != "session-1" {
+		t.Fatalf("metadata = %v", event.Metadata)
+	}
+}
+
+func TestAuditLogLeavesAnonymousFieldsEmpty(t *testing.T) {
+	repo := &fakeAuditRepo{}
+	NewAuditLogger(repo).Log(model.AuditActionLoginFailed, RequestMeta{}, "", nil)
+
+	event := repo.events[0]
+	if event.ActorID != nil || event.TargetUserID != nil || event.Metadata != nil {
+		t.Fatalf("anonymous event = %+v", event)
+	}
+}
+
+func TestAuditLogFailureDoesNotBlockTheAction(t *testing.T) {
+	repo := &fakeAuditRepo{err: errors.New("database is down")}
+	// Must return without panicking; the caller has nothing to handle
+	NewAuditLogger(repo).Log(model.AuditActionRegister, RequestMeta{}, "user-1", nil)
+}
+
+func TestAuditSearchClampsPaging(t *testing.T) {
+	repo := &fakeAuditRepo{}
+	logger := NewAuditLogger(repo)
+
+	resp, err := logger.Search(repository.AuditFilter{Page: 0, PageSize: 1000, Action: model.AuditActionLoginFailed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Page != 1 || resp.PageSize != 50 || repo.lastQuery.PageSize != 50 || repo.lastQuery.Action != model.AuditActionLoginFailed {
+		t.Fatalf("paging = %d/%d, query = %+v", resp.Page, resp.PageSize, repo.lastQuery)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
+	"strings"
 	"time"
 
 	"yourapp/internal/config"
@@ -14,24 +15,50 @@ import (
 )
 
 type AuthService interface {
-	Register(req RegisterRequest) (*RegisterResponse, error)
-	Login(req LoginRequest) (*AuthResponse, error)
-	VerifyOTP(email, otpCode string) (*AuthResponse, error)
+	Register(req RegisterRequest, meta RequestMeta) (*RegisterResponse, error)
+	Login(req LoginRequest, meta RequestMeta) (*AuthResponse, error)
+	VerifyOTP(email, otpCode string, meta RequestMeta) (*AuthResponse, error)
 	ResendOTP(email string) error
-	GoogleOAuth(req GoogleOAuthRequest) (*AuthResponse, error)
-	RefreshToken(refreshToken string) (*AuthResponse, error)
-	RequestResetPassword(email string) error
-	VerifyResetPassword(email, otpCode, newPassword string) error
-	ResetPassword(token, newPassword string) (*AuthResponse, error)
-	VerifyEmail(token string) (*AuthResponse, error)
+	GoogleOAuth(req GoogleOAuthRequest, meta RequestMeta) (*AuthResponse, error)
+	RefreshToken(refreshToken, scope string, meta RequestMeta) (*AuthResponse, error)
+	RequestResetPassword(email string, meta RequestMeta) error
+	VerifyResetPassword(email, otpCode, newPassword string, meta RequestMeta) error
+	ResetPassword(token, newPassword string, meta RequestMeta) (*AuthResponse, error)
+	VerifyEmail(token string, meta RequestMeta) (*AuthResponse, error)
 	GetMe(userID string) (*model.User, error)
+	UpdateLocale(userID, locale string) (*model.User, error)
+	IssueImpersonationToken(target *model.User, actor *model.User) (*ImpersonationResponse, error)
+	RegisterInvited(req InvitedRegisterRequest, email string, meta RequestMeta) (*AuthResponse, error)
+	SwitchOrganization(userID, sessionID, orgID string, scopes []string) (*AuthResponse, error)
+	IssueClientTokens(user *model.User, clientID string, scopes []string, meta RequestMeta) (*AuthResponse, error)
+	RefreshClientToken(refreshToken, clientID, scope string, meta RequestMeta) (*AuthResponse, error)
+	SSOLogin(user *model.User, metadata model.JSONMap, meta RequestMeta) (*AuthResponse, error)
+	AuthenticateAccessToken(token string) (*util.JWTClaims, error)
 }
 
+// impersonationTokenTTL keeps impersonation short; no refresh token is issued
+const impersonationTokenTTL = 10 * time.Minute
+
+// otpTTL is how long email verification and password reset codes stay valid;
+// otpTTLMinutes is the same duration as shown in emails
+const (
+	otpTTL        = 10 * time.Minute
+	otpTTLMinutes = int(otpTTL / time.Minute)
+)
+
+// refreshTokenTTL matches the lifetime of refresh tokens issued by util.GenerateRefreshTokenWithClaims
+const refreshTokenTTL = 7 * 24 * time.Hour
+
 type authService struct {
-	userRepo  repository.UserRepository
-	jwtSecret string
-	rabbitMQ  *util.RabbitMQClient
-	config    *config.Config
+	userRepo    repository.UserRepository
+	sessionRepo repository.SessionRepository
+	oauthRepo   repository.OAuthRepository
+	rbacService RBACService
+	auditLogger AuditLogger
+	jwtSecret   string
+	config      *config.Config
+
+	authenticators []Authenticator
 }
 
 type RegisterRequest struct {
@@ -40,9 +67,23 @@ type RegisterRequest struct {
 	Username    *string `json:"username,omitempty"`
 	Phone       *string `json:"phone,omitempty"`
 	Password    string  `json:"password" binding:"required,min=8"`
-	UserType    string  `json:"user_type"`
 	Gender      *string `json:"gender,omitempty"`
 	DateOfBirth *string `json:"date_of_birth,omitempty"`
+	Locale      string  `json:"locale,omitempty" binding:"omitempty,oneof=id en"`
+}
+
+// UpdateLocaleRequest changes the user's preferred email language
+type UpdateLocaleRequest struct {
+	Locale string `json:"locale" binding:"required,oneof=id en"`
+}
+
+// InvitedRegisterRequest creates an account while accepting an organization
+// invitation; the email comes from the invitation itself
+type InvitedRegisterRequest struct {
+	Token    string  `json:"token" binding:"required"`
+	FullName string  `json:"full_name" binding:"required"`
+	Username *string `json:"username,omitempty"`
+	Password string  `json:"password" binding:"required,min=8"`
 }
 
 type LoginRequest struct {
@@ -69,50 +110,65 @@ type AuthResponse struct {
 	AccessToken  string      `json:"access_token"`
 	RefreshToken string      `json:"refresh_token"`
 	ExpiresIn    int         `json:"expires_in"`
+	Scope        string      `json:"scope,omitempty"`
+	SessionID    string      `json:"-"`
+}
+
+// tokenGrant describes what issued tokens are bound to. Nil Scopes means the
+// user's default scopes.
+type tokenGrant struct {
+	SessionID string
+	OrgID     string
+	ClientID  string
+	Scopes    []string
+}
+
+type ImpersonationResponse struct {
+	User        *model.User `json:"user"`
+	AccessToken string      `json:"access_token"`
+	ExpiresIn   int         `json:"expires_in"`
 }
 
-func NewAuthService(userRepo repository.UserRepository, jwtSecret string, rabbitMQ *util.RabbitMQClient) AuthService {
+func NewAuthService(userRepo repository.UserRepository, sessionRepo repository.SessionRepository, oauthRepo repository.OAuthRepository, rbacService RBACService, auditLogger AuditLogger, jwtSecret string) AuthService {
 	return &authService{
-		userRepo:  userRepo,
-		jwtSecret: jwtSecret,
-		rabbitMQ:  rabbitMQ,
-		config:    nil, // Will be set if needed
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		oauthRepo:   oauthRepo,
+		rbacService: rbacService,
+		auditLogger: auditLogger,
+		jwtSecret:   jwtSecret,
+		config:      nil, // Will be set if needed
+
+		authenticators: []Authenticator{newPasswordAuthenticator(userRepo)},
 	}
 }
 
-// NewAuthServiceWithConfig creates auth service with config for RabbitMQ reconnection
-func NewAuthServiceWithConfig(userRepo repository.UserRepository, jwtSecret string, rabbitMQ *util.RabbitMQClient, cfg *config.Config) AuthService {
+// NewAuthServiceWithConfig creates auth service with config for the login directories
+func NewAuthServiceWithConfig(userRepo repository.UserRepository, sessionRepo repository.SessionRepository, oauthRepo repository.OAuthRepository, rbacService RBACService, auditLogger AuditLogger, jwtSecret string, cfg *config.Config) AuthService {
 	return &authService{
-		userRepo:  userRepo,
-		jwtSecret: jwtSecret,
-		rabbitMQ:  rabbitMQ,
-		config:    cfg,
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		oauthRepo:   oauthRepo,
+		rbacService: rbacService,
+		auditLogger: auditLogger,
+		jwtSecret:   jwtSecret,
+		config:      cfg,
+
+		authenticators: newAuthenticators(userRepo, rbacService, auditLogger, cfg),
 	}
 }
 
-// ensureRabbitMQ ensures RabbitMQ connection is available, reconnects if needed
-func (s *authService) ensureRabbitMQ() {
-	if s.rabbitMQ != nil {
-		// Check if connection is still valid
-		if s.rabbitMQ.GetChannel() != nil && !s.rabbitMQ.GetChannel().IsClosed() {
-			return
-		}
-	}
-
-	// Try to reconnect if config is available
-	if s.config != nil {
-		log.Println("Attempting to reconnect RabbitMQ...")
-		newRabbitMQ, err := util.NewRabbitMQClient(s.config)
-		if err == nil {
-			s.rabbitMQ = newRabbitMQ
-			log.Println("RabbitMQ reconnected successfully")
-		} else {
-			log.Printf("Failed to reconnect RabbitMQ: %v", err)
-		}
+// newAuthenticators returns the password authenticator, followed by LDAP when a
+// directory is configured
+func newAuthenticators(userRepo repository.UserRepository, rbacService RBACService, auditLogger AuditLogger, cfg *config.Config) []Authenticator {
+	authenticators := []Authenticator{newPasswordAuthenticator(userRepo)}
+	if cfg != nil && cfg.LDAPURL != "" {
+		authenticators = append(authenticators, newLDAPAuthenticator(userRepo, rbacService, auditLogger, cfg))
 	}
+	return authenticators
 }
 
-func (s *authService) Register(req RegisterRequest) (*RegisterResponse, error) {
+func (s *authService) Register(req RegisterRequest, meta RequestMeta) (*RegisterResponse, error) {
 	// Check if email already exists
 	existingUser, _ := s.userRepo.FindByEmail(req.Email)
 	if existingUser != nil {
@@ -138,7 +194,7 @@ func (s *authService) Register(req RegisterRequest) (*RegisterResponse, error) {
 
 	// Generate OTP
 	otpCode := generateOTP()
-	otpExpiresAt := time.Now().Add(10 * time.Minute)
+	otpExpiresAt := time.Now().Add(otpTTL)
 
 	// Parse date of birth if provided
 	var dob *time.Time
@@ -149,11 +205,6 @@ func (s *authService) Register(req RegisterRequest) (*RegisterResponse, error) {
 		}
 	}
 
-	userType := req.UserType
-	if userType == "" {
-		userType = "member"
-	}
-
 	// Create user
 	user := &model.User{
 		Email:        req.Email,
@@ -161,9 +212,10 @@ func (s *authService) Register(req RegisterRequest) (*RegisterResponse, error) {
 		Phone:        req.Phone,
 		FullName:     req.FullName,
 		PasswordHash: passwordHash,
-		UserType:     userType,
+		UserType:     model.RoleMember, // Roles are granted by AssignDefaultRoles, never by the client
 		Gender:       req.Gender,
 		DateOfBirth:  dob,
+		Locale:       req.Locale,
 		IsActive:     true,
 		IsVerified:   false,
 		LoginType:    "credential",
@@ -171,33 +223,22 @@ func (s *authService) Register(req RegisterRequest) (*RegisterResponse, error) {
 		OTPExpiresAt: &otpExpiresAt,
 	}
 
-	if err := s.userRepo.Create(user); err != nil {
+	// The OTP email is committed with the user and relayed to RabbitMQ by the outbox
+	otpEmail, err := newEmailOutboxMessage(user.Email, user.Locale, util.OTPEmailData{Code: otpCode, ExpiresMinutes: otpTTLMinutes})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.CreateWithOutbox(user, otpEmail); err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
-	// Send OTP email via RabbitMQ asynchronously (non-blocking)
-	// Same logic as reset password - send to queue immediately without waiting
-	go func() {
-		s.ensureRabbitMQ() // Try to reconnect if needed
-		if s.rabbitMQ != nil {
-			emailMsg := util.EmailMessage{
-				To:      req.Email,
-				Subject: "Kode Verifikasi Email",
-				Body:    otpCode,
-				Type:    "otp",
-			}
-			if err := s.rabbitMQ.PublishEmail(emailMsg); err != nil {
-				// Log error but don't fail registration
-				log.Printf("Failed to publish OTP email: %v\n", err)
-			} else {
-				log.Printf("OTP email queued successfully for %s", req.Email)
-			}
-		} else {
-			log.Printf("Warning: RabbitMQ not available, OTP email not sent for %s", req.Email)
-		}
-	}()
+	if err := s.rbacService.AssignDefaultRoles(user); err != nil {
+		return nil, fmt.Errorf("failed to assign roles: %w", err)
+	}
+
+	meta.ActorID = user.ID
+	s.auditLogger.Log(model.AuditActionRegister, meta, user.ID, nil)
 
-	// Return immediately without waiting for email to be sent
 	return &RegisterResponse{
 		Message:              "Registration successful. Please verify your email with OTP.",
 		User:                 user,
@@ -205,59 +246,36 @@ func (s *authService) Register(req RegisterRequest) (*RegisterResponse, error) {
 	}, nil
 }
 
-func (s *authService) Login(req LoginRequest) (*AuthResponse, error) {
-	user, err := s.userRepo.FindByEmail(req.Email)
+func (s *authService) Login(req LoginRequest, meta RequestMeta) (*AuthResponse, error) {
+	user, via, err := s.authenticate(req.Email, req.Password, meta)
 	if err != nil {
-		return nil, errors.New("invalid email or password")
-	}
-
-	// Check if user registered with Google instead of credential
-	if user.LoginType == "google" {
-		return nil, errors.New("email sudah terdaftar dengan Google. Silakan login dengan Google")
-	}
-
-	// Check if user registered with credential
-	if user.LoginType != "credential" {
-		return nil, errors.New("invalid email or password")
-	}
-
-	// Check password
-	if !util.CheckPasswordHash(req.Password, user.PasswordHash) {
-		return nil, errors.New("invalid email or password")
+		return nil, err
 	}
 
 	// Check if user is active
 	if !user.IsActive {
+		s.logLoginFailure(meta, user.ID, req.Email, "account_deactivated")
 		return nil, errors.New("account is deactivated")
 	}
 
+	// Check if an administrator requires a password reset
+	if user.ResetRequired {
+		s.logLoginFailure(meta, user.ID, req.Email, "password_reset_required")
+		return nil, errors.New("password reset required. Please reset your password using forgot password")
+	}
+
 	// Check if email is verified
 	if !user.IsVerified {
 		// Generate new OTP
 		otpCode := generateOTP()
-		otpExpiresAt := time.Now().Add(10 * time.Minute)
-		s.userRepo.UpdateOTP(req.Email, otpCode, otpExpiresAt)
-
-		// Send OTP email via RabbitMQ asynchronously (non-blocking)
-		go func() {
-			s.ensureRabbitMQ() // Try to reconnect if needed
-			if s.rabbitMQ != nil {
-				emailMsg := util.EmailMessage{
-					To:      req.Email,
-					Subject: "Kode Verifikasi Email",
-					Body:    otpCode,
-					Type:    "otp",
-				}
-				if err := s.rabbitMQ.PublishEmail(emailMsg); err != nil {
-					log.Printf("Failed to publish OTP email: %v\n", err)
-				} else {
-					log.Printf("OTP email queued successfully for %s", req.Email)
-				}
-			} else {
-				log.Printf("Warning: RabbitMQ not available, OTP email not sent for %s", req.Email)
-			}
-		}()
+		otpExpiresAt := time.Now().Add(otpTTL)
+		if otpEmail, err := newEmailOutboxMessage(user.Email, user.Locale, util.OTPEmailData{Code: otpCode, ExpiresMinutes: otpTTLMinutes}); err != nil {
+			log.Printf("Failed to build OTP email for %s: %v", req.Email, err)
+		} else if err := s.userRepo.UpdateOTPWithOutbox(user.Email, otpCode, otpExpiresAt, otpEmail); err != nil {
+			log.Printf("Failed to queue OTP email for %s: %v", req.Email, err)
+		}
 
+		s.logLoginFailure(meta, user.ID, req.Email, "email_not_verified")
 		return nil, errors.New("email not verified. Please verify your email first")
 	}
 
@@ -265,108 +283,118 @@ func (s *authService) Login(req LoginRequest) (*AuthResponse, error) {
 	s.userRepo.UpdateLastLogin(user.ID)
 
 	// Generate tokens
-	accessToken, err := util.GenerateAccessToken(user.ID, user.Email, user.UserType, s.jwtSecret)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	var metadata model.JSONMap
+	if via != "password" {
+		metadata = model.JSONMap{"via": via}
 	}
+	return s.completeLogin(user, meta, model.AuditActionLoginSucceeded, metadata)
+}
 
-	refreshToken, err := util.GenerateRefreshToken(user.ID, user.Email, user.UserType, s.jwtSecret)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+// authenticate tries each authenticator until one accepts or rejects the
+// login, and returns the user along with the authenticator's name
+func (s *authService) authenticate(email, password string, meta RequestMeta) (*model.User, string, error) {
+	for _, authenticator := range s.authenticators {
+		user, err := authenticator.Authenticate(email, password)
+		if err == nil {
+			return user, authenticator.Name(), nil
+		}
+		if errors.Is(err, ErrUnknownLogin) {
+			continue
+		}
+
+		var failure *LoginFailure
+		if errors.As(err, &failure) {
+			s.logLoginFailure(meta, failure.UserID, email, failure.Reason)
+			return nil, "", failure.Err
+		}
+
+		log.Printf("%s authentication failed for %s: %v", authenticator.Name(), email, err)
+		s.logLoginFailure(meta, "", email, authenticator.Name()+"_unavailable")
+		return nil, "", errInvalidLogin
 	}
 
-	return &AuthResponse{
-		User:         user,
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		ExpiresIn:    900, // 15 minutes in seconds
-	}, nil
+	// No authenticator handles this account
+	if user, err := s.userRepo.FindByEmail(email); err == nil {
+		s.logLoginFailure(meta, user.ID, email, "unsupported_login_type")
+	} else {
+		s.logLoginFailure(meta, "", email, "unknown_email")
+	}
+	return nil, "", errInvalidLogin
 }
 
-func (s *authService) VerifyOTP(email, otpCode string) (*AuthResponse, error) {
+func (s *authService) VerifyOTP(email, otpCode string, meta RequestMeta) (*AuthResponse, error) {
+	// Read before the OTP is consumed, which marks the user verified
+	wasVerified := false
+	if existing, err := s.userRepo.FindByEmail(email); err == nil {
+		wasVerified = existing.IsVerified
+	}
+
 	user, err := s.userRepo.VerifyOTP(email, otpCode)
 	if err != nil {
 		return nil, err
 	}
 
-	// Update last login
-	s.userRepo.UpdateLastLogin(user.ID)
+	if !user.IsActive {
+		return nil, errors.New("account is deactivated")
+	}
 
-	// Generate tokens
-	accessToken, err := util.GenerateAccessToken(user.ID, user.Email, user.UserType, s.jwtSecret)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	// Same as Login: an administrator-required reset cannot be skipped by
+	// signing in with an OTP
+	if user.ResetRequired {
+		s.logLoginFailure(meta, user.ID, email, "password_reset_required")
+		return nil, errors.New("password reset required. Please reset your password using forgot password")
 	}
 
-	refreshToken, err := util.GenerateRefreshToken(user.ID, user.Email, user.UserType, s.jwtSecret)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	// The first OTP proves the user owns the address. Later ones do not
+	// promote again, so an administrator's demotion sticks.
+	if !wasVerified {
+		if err := s.rbacService.PromoteConfiguredAdmin(user); err != nil {
+			return nil, err
+		}
 	}
 
-	return &AuthResponse{
-		User:         user,
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		ExpiresIn:    900,
-	}, nil
+	// Update last login
+	s.userRepo.UpdateLastLogin(user.ID)
+
+	// Generate tokens
+	return s.completeLogin(user, meta, model.AuditActionOTPVerified, nil)
 }
 
 func (s *authService) ResendOTP(email string) error {
-	_, err := s.userRepo.FindByEmail(email)
+	user, err := s.userRepo.FindByEmail(email)
 	if err != nil {
 		return errors.New("user not found")
 	}
 
 	// Generate new OTP
 	otpCode := generateOTP()
-	otpExpiresAt := time.Now().Add(10 * time.Minute)
+	otpExpiresAt := time.Now().Add(otpTTL)
 
-	if err := s.userRepo.UpdateOTP(email, otpCode, otpExpiresAt); err != nil {
+	otpEmail, err := newEmailOutboxMessage(user.Email, user.Locale, util.OTPEmailData{Code: otpCode, ExpiresMinutes: otpTTLMinutes})
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.UpdateOTPWithOutbox(email, otpCode, otpExpiresAt, otpEmail); err != nil {
 		return fmt.Errorf("failed to update OTP: %w", err)
 	}
 
-	// Send OTP email via RabbitMQ asynchronously (non-blocking)
-	// Same logic as reset password - send to queue immediately without waiting
-	go func() {
-		s.ensureRabbitMQ() // Try to reconnect if needed
-		if s.rabbitMQ != nil {
-			emailMsg := util.EmailMessage{
-				To:      email,
-				Subject: "Kode Verifikasi Email",
-				Body:    otpCode,
-				Type:    "otp",
-			}
-			if err := s.rabbitMQ.PublishEmail(emailMsg); err != nil {
-				log.Printf("Failed to publish OTP email: %v\n", err)
-			} else {
-				log.Printf("OTP email queued successfully for %s", email)
-			}
-		} else {
-			log.Printf("Warning: RabbitMQ not available, OTP email not sent for %s", email)
-		}
-	}()
-
-	// Return immediately without waiting for email to be sent
 	return nil
 }
 
-func (s *authService) GoogleOAuth(req GoogleOAuthRequest) (*AuthResponse, error) {
+func (s *authService) GoogleOAuth(req GoogleOAuthRequest, meta RequestMeta) (*AuthResponse, error) {
 	// Check if user exists by Google ID
 	user, err := s.userRepo.FindByGoogleID(req.GoogleID)
 	if err == nil {
 		// User exists, update and return tokens
+		if !user.IsActive {
+			s.logLoginFailure(meta, user.ID, user.Email, "account_deactivated")
+			return nil, errors.New("account is deactivated")
+		}
+
 		user.LastLogin = &[]time.Time{time.Now()}[0]
 		s.userRepo.UpdateLastLogin(user.ID)
 
-		accessToken, _ := util.GenerateAccessToken(user.ID, user.Email, user.UserType, s.jwtSecret)
-		refreshToken, _ := util.GenerateRefreshToken(user.ID, user.Email, user.UserType, s.jwtSecret)
-
-		return &AuthResponse{
-			User:         user,
-			AccessToken:  accessToken,
-			RefreshToken: refreshToken,
-			ExpiresIn:    900,
-		}, nil
+		return s.completeLogin(user, meta, model.AuditActionGoogleLogin, nil)
 	}
 
 	// Check if email already exists
@@ -386,7 +414,7 @@ func (s *authService) GoogleOAuth(req GoogleOAuthRequest) (*AuthResponse, error)
 		Email:        req.Email,
 		FullName:     req.FullName,
 		ProfilePhoto: &req.ProfilePhoto,
-		UserType:     "member",
+		UserType:     model.RoleMember,
 		IsActive:     true,
 		IsVerified:   true, // Google users are auto-verified
 		LoginType:    "google",
@@ -397,28 +425,95 @@ func (s *authService) GoogleOAuth(req GoogleOAuthRequest) (*AuthResponse, error)
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
+	if err := s.rbacService.AssignDefaultRoles(user); err != nil {
+		return nil, fmt.Errorf("failed to assign roles: %w", err)
+	}
+
 	// Generate tokens
-	accessToken, err := util.GenerateAccessToken(user.ID, user.Email, user.UserType, s.jwtSecret)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	return s.completeLogin(user, meta, model.AuditActionGoogleLogin, model.JSONMap{"new_user": true})
+}
+
+// SSOLogin signs in a user already authenticated by an external identity provider
+func (s *authService) SSOLogin(user *model.User, metadata model.JSONMap, meta RequestMeta) (*AuthResponse, error) {
+	if !user.IsActive {
+		s.logLoginFailure(meta, user.ID, user.Email, "account_deactivated")
+		return nil, errors.New("account is deactivated")
 	}
 
-	refreshToken, err := util.GenerateRefreshToken(user.ID, user.Email, user.UserType, s.jwtSecret)
+	s.userRepo.UpdateLastLogin(user.ID)
+	return s.completeLogin(user, meta, model.AuditActionSSOLogin, metadata)
+}
+
+// RefreshToken rotates the session's tokens. A non-empty scope narrows the
+// new tokens to a subset of the scopes originally granted; it can never widen them.
+func (s *authService) RefreshToken(refreshToken, scope string, meta RequestMeta) (*AuthResponse, error) {
+	return s.refresh(refreshToken, "", scope, meta)
+}
+
+// RefreshClientToken is RefreshToken for sessions granted to an OAuth client;
+// the refresh token must belong to clientID
+func (s *authService) RefreshClientToken(refreshToken, clientID, scope string, meta RequestMeta) (*AuthResponse, error) {
+	return s.refresh(refreshToken, clientID, scope, meta)
+}
+
+// AuthenticateAccessToken validates an access token and checks that it has
+// not been cut off since it was issued: its session must still be active and
+// its user, and any impersonating admin, still active. Refresh and other
+// purpose-specific tokens are rejected.
+func (s *authService) AuthenticateAccessToken(token string) (*util.JWTClaims, error) {
+	claims, err := util.ValidateAccessToken(token, s.jwtSecret)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+		return nil, errors.New("invalid or expired token")
 	}
 
-	return &AuthResponse{
-		User:         user,
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		ExpiresIn:    900,
-	}, nil
+	// Client credentials tokens have no user or session, and die with their client
+	if claims.UserID == "" {
+		if claims.ClientID == "" || s.oauthRepo == nil {
+			return nil, errors.New("invalid or expired token")
+		}
+		if _, err := s.oauthRepo.FindClientByClientID(claims.ClientID); err != nil {
+			return nil, errors.New("client has been deleted")
+		}
+		return claims, nil
+	}
+
+	if claims.SessionID != "" {
+		session, err := s.sessionRepo.FindByID(claims.SessionID)
+		if err != nil || session.UserID != claims.UserID || !session.IsActive() {
+			return nil, errors.New("session has expired or been revoked")
+		}
+	}
+
+	user, err := s.userRepo.FindByID(claims.UserID)
+	if err != nil || !user.IsActive {
+		return nil, errors.New("account is deactivated")
+	}
+
+	if claims.Actor != nil {
+		actor, err := s.userRepo.FindByID(claims.Actor.Subject)
+		if err != nil || !actor.IsActive {
+			return nil, errors.New("impersonating account is deactivated")
+		}
+	}
+
+	return claims, nil
 }
 
-func (s *authService) RefreshToken(refreshToken string) (*AuthResponse, error) {
-	claims, err := util.ValidateToken(refreshToken, s.jwtSecret)
-	if err != nil {
+// refresh rotates the tokens of a session owned by clientID, which is empty
+// for first-party logins
+func (s *authService) refresh(refreshToken, clientID, scope string, meta RequestMeta) (*AuthResponse, error) {
+	claims, err := util.ValidateRefreshToken(refreshToken, s.jwtSecret)
+	if err != nil || claims.SessionID == "" {
+		return nil, errors.New("invalid refresh token")
+	}
+
+	// Refresh tokens are only valid while their session has not been revoked
+	session, err := s.sessionRepo.FindByID(claims.SessionID)
+	if err != nil || session.UserID != claims.UserID || !session.IsActive() {
+		return nil, errors.New("session has expired or been revoked")
+	}
+
+	if sessionClientID(session) != clientID {
 		return nil, errors.New("invalid refresh token")
 	}
 
@@ -427,26 +522,44 @@ func (s *authService) RefreshToken(refreshToken string) (*AuthResponse, error) {
 		return nil, errors.New("user not found")
 	}
 
-	// Generate new tokens
-	accessToken, err := util.GenerateAccessToken(user.ID, user.Email, user.UserType, s.jwtSecret)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	if !user.IsActive {
+		return nil, errors.New("account is deactivated")
 	}
 
-	newRefreshToken, err := util.GenerateRefreshToken(user.ID, user.Email, user.UserType, s.jwtSecret)
+	// Tokens issued before scopes were introduced carry the defaults
+	granted := model.ParseScope(claims.Scope)
+	if len(granted) == 0 {
+		if granted, err = s.rbacService.GetDefaultScopes(user); err != nil {
+			return nil, fmt.Errorf("failed to resolve scopes: %w", err)
+		}
+	}
+
+	scopes := granted
+	if requested := model.ParseScope(scope); len(requested) > 0 {
+		for _, sc := range requested {
+			if !hasString(granted, sc) {
+				return nil, fmt.Errorf("scope %q was not granted to this session", sc)
+			}
+		}
+		scopes = requested
+	}
+
+	if err := s.sessionRepo.Touch(session.ID, time.Now().Add(refreshTokenTTL)); err != nil {
+		return nil, fmt.Errorf("failed to update session: %w", err)
+	}
+
+	// Generate new tokens for the same session
+	resp, err := s.issueTokens(user, tokenGrant{SessionID: session.ID, OrgID: claims.OrgID, ClientID: clientID, Scopes: scopes})
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+		return nil, err
 	}
 
-	return &AuthResponse{
-		User:         user,
-		AccessToken:  accessToken,
-		RefreshToken: newRefreshToken,
-		ExpiresIn:    900,
-	}, nil
+	meta.ActorID = user.ID
+	s.auditLogger.Log(model.AuditActionTokenRefreshed, meta, user.ID, model.JSONMap{"session_id": session.ID})
+	return resp, nil
 }
 
-func (s *authService) RequestResetPassword(email string) error {
+func (s *authService) RequestResetPassword(email string, meta RequestMeta) error {
 	// Check if email exists in database first - must exist before sending email
 	user, err := s.userRepo.FindByEmail(email)
 	if err != nil || user == nil {
@@ -462,38 +575,23 @@ func (s *authService) RequestResetPassword(email string) error {
 	// User exists and has credential login type - proceed with OTP generation
 	// Generate OTP for reset password
 	otpCode := generateOTP()
-	otpExpiresAt := time.Now().Add(10 * time.Minute)
+	otpExpiresAt := time.Now().Add(otpTTL)
 
-	if err := s.userRepo.UpdateOTP(email, otpCode, otpExpiresAt); err != nil {
+	// Only users that exist in the database (checked above) get the email
+	resetEmail, err := newEmailOutboxMessage(user.Email, user.Locale, util.ResetPasswordEmailData{Code: otpCode, ExpiresMinutes: otpTTLMinutes})
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.UpdateOTPWithOutbox(email, otpCode, otpExpiresAt, resetEmail); err != nil {
 		return fmt.Errorf("failed to update OTP: %w", err)
 	}
 
-	// Send OTP email via RabbitMQ asynchronously (non-blocking)
-	// Only send if user exists in database (checked above)
-	go func() {
-		s.ensureRabbitMQ() // Try to reconnect if needed
-		if s.rabbitMQ != nil {
-			emailMsg := util.EmailMessage{
-				To:      email,
-				Subject: "Kode Reset Password",
-				Body:    otpCode,
-				Type:    "reset_password",
-			}
-			if err := s.rabbitMQ.PublishEmail(emailMsg); err != nil {
-				log.Printf("Failed to publish reset password OTP email: %v\n", err)
-			} else {
-				log.Printf("Reset password OTP email queued successfully for %s", email)
-			}
-		} else {
-			log.Printf("Warning: RabbitMQ not available, reset password OTP email not sent for %s", email)
-		}
-	}()
+	s.auditLogger.Log(model.AuditActionPasswordResetRequest, meta, user.ID, nil)
 
-	// Return immediately without waiting for email to be sent
 	return nil
 }
 
-func (s *authService) VerifyResetPassword(email, otpCode, newPassword string) error {
+func (s *authService) VerifyResetPassword(email, otpCode, newPassword string, meta RequestMeta) error {
 	// First, verify that email exists in database and check login type before OTP verification
 	existingUser, err := s.userRepo.FindByEmail(email)
 	if err != nil || existingUser == nil {
@@ -528,10 +626,12 @@ func (s *authService) VerifyResetPassword(email, otpCode, newPassword string) er
 		return fmt.Errorf("failed to update password: %w", err)
 	}
 
+	meta.ActorID = user.ID
+	s.auditLogger.Log(model.AuditActionPasswordResetComplete, meta, user.ID, model.JSONMap{"method": "otp"})
 	return nil
 }
 
-func (s *authService) ResetPassword(token, newPassword string) (*AuthResponse, error) {
+func (s *authService) ResetPassword(token, newPassword string, meta RequestMeta) (*AuthResponse, error) {
 	// Validate JWT token first
 	claims, err := util.ValidateToken(token, s.jwtSecret)
 	if err != nil {
@@ -571,51 +671,262 @@ func (s *authService) ResetPassword(token, newPassword string) (*AuthResponse, e
 	}
 
 	// Generate tokens
-	accessToken, err := util.GenerateAccessToken(user.ID, user.Email, user.UserType, s.jwtSecret)
+	return s.completeLogin(user, meta, model.AuditActionPasswordResetComplete, model.JSONMap{"method": "token"})
+}
+
+func (s *authService) VerifyEmail(token string, meta RequestMeta) (*AuthResponse, error) {
+	// Only a token minted for email verification is accepted: access,
+	// refresh and impersonation tokens say nothing about the mailbox
+	claims, err := util.ValidateEmailVerificationToken(token, s.jwtSecret)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate access token: %w", err)
+		return nil, errors.New("invalid verification token")
 	}
 
-	refreshToken, err := util.GenerateRefreshToken(user.ID, user.Email, user.UserType, s.jwtSecret)
+	user, err := s.userRepo.FindByID(claims.UserID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+		return nil, errors.New("user not found")
 	}
 
-	return &AuthResponse{
-		User:         user,
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		ExpiresIn:    900,
+	// A token sent to a previous address does not verify the current one
+	if !strings.EqualFold(user.Email, claims.Email) {
+		return nil, errors.New("invalid verification token")
+	}
+
+	if !user.IsActive {
+		return nil, errors.New("account is deactivated")
+	}
+
+	// Same as VerifyOTP: verifying an address does not skip a required reset
+	if user.ResetRequired {
+		s.logLoginFailure(meta, user.ID, user.Email, "password_reset_required")
+		return nil, errors.New("password reset required. Please reset your password using forgot password")
+	}
+
+	user.IsVerified = true
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, fmt.Errorf("failed to verify user: %w", err)
+	}
+
+	// Generate tokens
+	return s.completeLogin(user, meta, model.AuditActionEmailVerified, nil)
+}
+
+func (s *authService) GetMe(userID string) (*model.User, error) {
+	return s.userRepo.FindByID(userID)
+}
+
+// UpdateLocale sets the language the user's emails are sent in
+func (s *authService) UpdateLocale(userID, locale string) (*model.User, error) {
+	if err := s.userRepo.SetLocale(userID, locale); err != nil {
+		return nil, fmt.Errorf("failed to update locale: %w", err)
+	}
+	return s.userRepo.FindByID(userID)
+}
+
+// IssueImpersonationToken issues a short-lived access token for the target user
+// carrying an RFC 8693 "act" claim that identifies the admin acting as them
+func (s *authService) IssueImpersonationToken(target *model.User, actor *model.User) (*ImpersonationResponse, error) {
+	permissions, err := s.rbacService.GetUserPermissions(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve permissions: %w", err)
+	}
+
+	scopes, err := s.rbacService.GetDefaultScopes(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve scopes: %w", err)
+	}
+
+	accessToken, err := util.GenerateTokenWithClaims(util.JWTClaims{
+		TokenType:   util.TokenTypeAccess,
+		UserID:      target.ID,
+		Email:       target.Email,
+		UserType:    target.UserType,
+		Permissions: permissions,
+		Scope:       model.FormatScope(scopes),
+		Actor: &util.ActorClaim{
+			Subject: actor.ID,
+			Email:   actor.Email,
+		},
+	}, s.jwtSecret, impersonationTokenTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	}
+
+	return &ImpersonationResponse{
+		User:        target,
+		AccessToken: accessToken,
+		ExpiresIn:   int(impersonationTokenTTL.Seconds()),
 	}, nil
 }
 
-func (s *authService) VerifyEmail(token string) (*AuthResponse, error) {
-	// For now, treat token as OTP code
-	// In production, you might want to use JWT token
-	claims, err := util.ValidateToken(token, s.jwtSecret)
+// RegisterInvited creates an already-verified account for an invitee; holding
+// the emailed invitation token proves ownership of the address
+func (s *authService) RegisterInvited(req InvitedRegisterRequest, email string, meta RequestMeta) (*AuthResponse, error) {
+	if existingUser, _ := s.userRepo.FindByEmail(email); existingUser != nil {
+		return nil, errors.New("email already registered. Please login to accept the invitation")
+	}
+
+	if req.Username != nil && *req.Username != "" {
+		if existingUsername, _ := s.userRepo.FindByUsername(*req.Username); existingUsername != nil {
+			return nil, errors.New("username already taken")
+		}
+	}
+
+	passwordHash, err := util.HashPassword(req.Password)
 	if err != nil {
-		// If token validation fails, try as OTP
-		// This is a simplified approach - in production, use proper email verification tokens
-		return nil, errors.New("invalid verification token")
+		return nil, fmt.Errorf("failed to hash password: %w", err)
 	}
 
-	user, err := s.userRepo.FindByID(claims.UserID)
+	user := &model.User{
+		Email:        email,
+		Username:     req.Username,
+		FullName:     req.FullName,
+		PasswordHash: passwordHash,
+		UserType:     model.RoleMember,
+		IsActive:     true,
+		IsVerified:   true,
+		LoginType:    "credential",
+	}
+
+	if err := s.userRepo.Create(user); err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	if err := s.rbacService.AssignDefaultRoles(user); err != nil {
+		return nil, fmt.Errorf("failed to assign roles: %w", err)
+	}
+	if err := s.rbacService.PromoteConfiguredAdmin(user); err != nil {
+		return nil, err
+	}
+
+	return s.completeLogin(user, meta, model.AuditActionRegister, model.JSONMap{"via": "invitation"})
+}
+
+// SwitchOrganization reissues the session's tokens with orgID as the active
+// organization. The caller must have verified the membership.
+func (s *authService) SwitchOrganization(userID, sessionID, orgID string, scopes []string) (*AuthResponse, error) {
+	session, err := s.sessionRepo.FindByID(sessionID)
+	if err != nil || session.UserID != userID || !session.IsActive() {
+		return nil, errors.New("session has expired or been revoked")
+	}
+
+	user, err := s.userRepo.FindByID(userID)
 	if err != nil {
 		return nil, errors.New("user not found")
 	}
 
-	user.IsVerified = true
-	if err := s.userRepo.Update(user); err != nil {
-		return nil, fmt.Errorf("failed to verify user: %w", err)
+	return s.issueTokens(user, tokenGrant{SessionID: session.ID, OrgID: orgID, ClientID: sessionClientID(session), Scopes: scopes})
+}
+
+// IssueClientTokens starts a session granted to an OAuth client and issues
+// tokens limited to the consented scopes
+func (s *authService) IssueClientTokens(user *model.User, clientID string, scopes []string, meta RequestMeta) (*AuthResponse, error) {
+	if !user.IsActive {
+		return nil, errors.New("account is deactivated")
 	}
 
-	// Generate tokens
-	accessToken, err := util.GenerateAccessToken(user.ID, user.Email, user.UserType, s.jwtSecret)
+	session := &model.Session{
+		UserID:    user.ID,
+		ClientID:  &clientID,
+		IPAddress: meta.IPAddress,
+		UserAgent: meta.UserAgent,
+		ExpiresAt: time.Now().Add(refreshTokenTTL),
+	}
+	if err := s.sessionRepo.Create(session); err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return s.issueTokens(user, tokenGrant{SessionID: session.ID, ClientID: clientID, Scopes: scopes})
+}
+
+func sessionClientID(session *model.Session) string {
+	if session.ClientID == nil {
+		return ""
+	}
+	return *session.ClientID
+}
+
+// completeLogin starts a session for a successfully authenticated user and records the audit event
+func (s *authService) completeLogin(user *model.User, meta RequestMeta, action string, metadata model.JSONMap) (*AuthResponse, error) {
+	resp, err := s.generateAuthResponse(user, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	meta.ActorID = user.ID
+	s.auditLogger.Log(action, meta, user.ID, metadata)
+	return resp, nil
+}
+
+// logLoginFailure records a failed login attempt; userID is empty for unknown emails
+func (s *authService) logLoginFailure(meta RequestMeta, userID, email, reason string) {
+	s.auditLogger.Log(model.AuditActionLoginFailed, meta, userID, model.JSONMap{
+		"email":  email,
+		"reason": reason,
+	})
+}
+
+// generateAuthResponse starts a new session and issues tokens for it
+func (s *authService) generateAuthResponse(user *model.User, meta RequestMeta) (*AuthResponse, error) {
+	session := &model.Session{
+		UserID:    user.ID,
+		IPAddress: meta.IPAddress,
+		UserAgent: meta.UserAgent,
+		ExpiresAt: time.Now().Add(refreshTokenTTL),
+	}
+	if err := s.sessionRepo.Create(session); err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return s.issueTokens(user, tokenGrant{SessionID: session.ID})
+}
+
+// issueTokens issues an access token carrying the user's current permissions,
+// narrowed to the granted scopes, together with a refresh token bound to the
+// session. An empty OrgID means no active organization has been chosen.
+func (s *authService) issueTokens(user *model.User, grant tokenGrant) (*AuthResponse, error) {
+	permissions, err := s.rbacService.GetUserPermissions(user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve permissions: %w", err)
+	}
+
+	scopes := grant.Scopes
+	if scopes == nil {
+		if scopes, err = s.rbacService.GetDefaultScopes(user); err != nil {
+			return nil, fmt.Errorf("failed to resolve scopes: %w", err)
+		}
+	}
+	scoped := []string{}
+	for _, p := range permissions {
+		if hasString(scopes, p) {
+			scoped = append(scoped, p)
+		}
+	}
+	scope := model.FormatScope(scopes)
+
+	accessToken, err := util.GenerateAccessTokenWithClaims(util.JWTClaims{
+		UserID:      user.ID,
+		Email:       user.Email,
+		UserType:    user.UserType,
+		Permissions: scoped,
+		SessionID:   grant.SessionID,
+		OrgID:       grant.OrgID,
+		Scope:       scope,
+		ClientID:    grant.ClientID,
+	}, s.jwtSecret)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
 
-	refreshToken, err := util.GenerateRefreshToken(user.ID, user.Email, user.UserType, s.jwtSecret)
+	refreshToken, err := util.GenerateRefreshTokenWithClaims(util.JWTClaims{
+		UserID:    user.ID,
+		Email:     user.Email,
+		UserType:  user.UserType,
+		SessionID: grant.SessionID,
+		OrgID:     grant.OrgID,
+		Scope:     scope,
+		ClientID:  grant.ClientID,
+	}, s.jwtSecret)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
 	}
@@ -624,14 +935,12 @@ func (s *authService) VerifyEmail(token string) (*AuthResponse, error) {
 		User:         user,
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
-		ExpiresIn:    900,
+		ExpiresIn:    900, // 15 minutes in seconds
+		Scope:        scope,
+		SessionID:    grant.SessionID,
 	}, nil
 }
 
-func (s *authService) GetMe(userID string) (*model.User, error) {
-	return s.userRepo.FindByID(userID)
-}
-
 // generateOTP generates a 6-digit OTP
 func generateOTP() string {
 	rand.Seed(time.Now().UnixNano())
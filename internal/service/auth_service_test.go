@@ -0,0 +1,265 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"yourapp/internal/config"
+	"yourapp/internal/model"
+	"yourapp/internal/util"
+)
+
+const testJWTSecret = "test-secret"
+
+func newTestAuthService(t *testing.T, cfg *config.Config, users ...*model.User) (*authService, *fakeUserRepo, *fakeRoleRepo, *fakeSessionRepo) {
+	t.Helper()
+	userRepo := newFakeUserRepo(users...)
+	rbac, roleRepo := newTestRBAC(userRepo, cfg)
+	sessionRepo := newFakeSessionRepo()
+	s := NewAuthService(userRepo, sessionRepo, newFakeOAuthRepo(), rbac, &fakeAuditLogger{}, testJWTSecret).(*authService)
+	return s, userRepo, roleRepo, sessionRepo
+}
+
+func TestRegisterGrantsConfiguredAdminOnlyAfterOTP(t *testing.T) {
+	s, userRepo, roleRepo, _ := newTestAuthService(t, &config.Config{AdminEmails: []string{"boss@example.com"}})
+
+	resp, err := s.Register(RegisterRequest{Email: "boss@example.com", FullName: "Boss", Password: "Secret123!"}, RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roleRepo.hasRole(resp.User.ID, model.RoleAdmin) {
+		t.Fatal("unverified registration was granted admin")
+	}
+
+	user, _ := userRepo.FindByEmail("boss@example.com")
+	auth, err := s.VerifyOTP(user.Email, *user.OTPCode, RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !roleRepo.hasRole(user.ID, model.RoleAdmin) || auth.User.UserType != model.RoleAdmin {
+		t.Fatal("admin role was not granted after the OTP proved the address")
+	}
+}
+
+func TestConfiguredAdminDemotionSurvivesLaterOTPs(t *testing.T) {
+	s, userRepo, roleRepo, _ := newTestAuthService(t, &config.Config{AdminEmails: []string{"boss@example.com"}})
+	if _, err := s.Register(RegisterRequest{Email: "boss@example.com", FullName: "Boss", Password: "Secret123!"}, RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	user, _ := userRepo.FindByEmail("boss@example.com")
+	if _, err := s.VerifyOTP(user.Email, *user.OTPCode, RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.rbacService.SetUserRoles(user.ID, []string{model.RoleMember}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ResendOTP(user.Email); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.VerifyOTP(user.Email, *user.OTPCode, RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if roleRepo.hasRole(user.ID, model.RoleAdmin) {
+		t.Fatal("signing in with an OTP undid the demotion")
+	}
+}
+
+func TestRegisterCommitsOTPEmailWithTheUser(t *testing.T) {
+	s, userRepo, _, _ := newTestAuthService(t, nil)
+
+	if _, err := s.Register(RegisterRequest{Email: "ana@example.com", FullName: "Ana", Password: "Secret123!"}, RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(userRepo.outbox) != 1 {
+		t.Fatalf("outbox = %d messages, want the OTP email", len(userRepo.outbox))
+	}
+	job, data, err := util.DecodeEmailJob(userRepo.outbox[0].Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, _ := userRepo.FindByEmail("ana@example.com")
+	if job.To != user.Email || data.(*util.OTPEmailData).Code != *user.OTPCode {
+		t.Fatalf("job = %+v, data = %+v", job, data)
+	}
+
+	// A registration that is not committed leaves no email behind
+	if _, err := s.Register(RegisterRequest{Email: "ana@example.com", FullName: "Ana", Password: "Secret123!"}, RequestMeta{}); err == nil {
+		t.Fatal("duplicate registration succeeded")
+	}
+	if len(userRepo.outbox) != 1 {
+		t.Fatalf("outbox = %d messages after a failed registration", len(userRepo.outbox))
+	}
+}
+
+func TestAuthenticateAccessTokenRejectsCutOffTokens(t *testing.T) {
+	user := &model.User{ID: "user-1", Email: "ana@example.com", IsActive: true, IsVerified: true, LoginType: "credential"}
+	s, userRepo, _, sessionRepo := newTestAuthService(t, nil, user)
+
+	auth, err := s.generateAuthResponse(user, RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AuthenticateAccessToken(auth.AccessToken); err != nil {
+		t.Fatalf("fresh access token rejected: %v", err)
+	}
+
+	if _, err := s.AuthenticateAccessToken(auth.RefreshToken); err == nil {
+		t.Fatal("refresh token accepted as a bearer token")
+	}
+
+	sessionRepo.Revoke(auth.SessionID)
+	if _, err := s.AuthenticateAccessToken(auth.AccessToken); err == nil {
+		t.Fatal("access token still accepted after its session was revoked")
+	}
+
+	auth, _ = s.generateAuthResponse(user, RequestMeta{})
+	userRepo.SetActive(user.ID, false)
+	if _, err := s.AuthenticateAccessToken(auth.AccessToken); err == nil {
+		t.Fatal("access token still accepted after the user was deactivated")
+	}
+}
+
+func TestImpersonationTokenDiesWithTheAdmin(t *testing.T) {
+	target := &model.User{ID: "target", Email: "ana@example.com", IsActive: true}
+	admin := &model.User{ID: "admin", Email: "admin@example.com", IsActive: true}
+	s, userRepo, _, _ := newTestAuthService(t, nil, target, admin)
+
+	resp, err := s.IssueImpersonationToken(target, admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := s.AuthenticateAccessToken(resp.AccessToken)
+	if err != nil || claims.Actor == nil || claims.Actor.Subject != admin.ID {
+		t.Fatalf("impersonation token rejected: %v", err)
+	}
+
+	userRepo.SetActive(admin.ID, false)
+	if _, err := s.AuthenticateAccessToken(resp.AccessToken); err == nil {
+		t.Fatal("impersonation token accepted after the admin was deactivated")
+	}
+}
+
+func TestRefreshRejectsAccessTokens(t *testing.T) {
+	user := &model.User{ID: "user-1", Email: "ana@example.com", IsActive: true}
+	s, _, _, _ := newTestAuthService(t, nil, user)
+
+	auth, _ := s.generateAuthResponse(user, RequestMeta{})
+	if _, err := s.RefreshToken(auth.AccessToken, "", RequestMeta{}); err == nil {
+		t.Fatal("access token accepted as a refresh token")
+	}
+	if _, err := s.RefreshToken(auth.RefreshToken, "", RequestMeta{}); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+}
+
+func TestVerifyOTPEnforcesRequiredPasswordReset(t *testing.T) {
+	code := "123456"
+	expires := time.Now().Add(time.Minute)
+	user := &model.User{ID: "user-1", Email: "ana@example.com", IsActive: true, IsVerified: true, LoginType: "credential",
+		ResetRequired: true, OTPCode: &code, OTPExpiresAt: &expires}
+	s, _, _, sessionRepo := newTestAuthService(t, nil, user)
+
+	if _, err := s.VerifyOTP(user.Email, code, RequestMeta{}); err == nil {
+		t.Fatal("OTP login issued tokens although a password reset is required")
+	}
+	if sessions, _ := sessionRepo.FindByUserID(user.ID); len(sessions) != 0 {
+		t.Fatal("OTP login started a session although a password reset is required")
+	}
+}
+
+func TestLoginOutcomesAreAudited(t *testing.T) {
+	s, _, _, _ := newTestAuthService(t, nil)
+	auditLogger := s.auditLogger.(*fakeAuditLogger)
+	meta := RequestMeta{IPAddress: "10.0.0.1", RequestID: "req-1"}
+
+	resp, err := s.Register(RegisterRequest{Email: "ana@example.com", FullName: "Ana", Password: "Secret123!"}, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event, ok := auditLogger.find(model.AuditActionRegister); !ok || event.TargetUserID != resp.User.ID || event.Meta.ActorID != resp.User.ID || event.Meta.IPAddress != "10.0.0.1" {
+		t.Fatalf("register audit = %+v", event)
+	}
+
+	s.Login(LoginRequest{Email: "nobody@example.com", Password: "Secret123!"}, meta)
+	if event, ok := auditLogger.find(model.AuditActionLoginFailed); !ok || event.Metadata["reason"] != "unknown_email" || event.Meta.RequestID != "req-1" {
+		t.Fatalf("unknown email audit = %+v", event)
+	}
+
+	s.Login(LoginRequest{Email: "ana@example.com", Password: "Secret123!"}, meta)
+	if event, _ := auditLogger.find(model.AuditActionLoginFailed); event.Metadata["reason"] != "email_not_verified" || event.TargetUserID != resp.User.ID {
+		t.Fatalf("unverified login audit = %+v", event)
+	}
+}
+
+func TestRefreshCanOnlyNarrowScopes(t *testing.T) {
+	user := &model.User{ID: "user-1", Email: "ana@example.com", IsActive: true}
+	s, _, _, _ := newTestAuthService(t, nil, user)
+
+	auth, _ := s.generateAuthResponse(user, RequestMeta{})
+	narrowed, err := s.RefreshToken(auth.RefreshToken, model.ScopeProfileRead, RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if narrowed.Scope != model.ScopeProfileRead {
+		t.Fatalf("scope = %q, want %q", narrowed.Scope, model.ScopeProfileRead)
+	}
+
+	if _, err := s.RefreshToken(narrowed.RefreshToken, model.ScopeProfileWrite, RequestMeta{}); err == nil {
+		t.Fatal("narrowed session widened its scope on refresh")
+	}
+	if _, err := s.RefreshToken(auth.RefreshToken, model.PermissionUsersRead, RequestMeta{}); err == nil {
+		t.Fatal("member refreshed into an admin permission")
+	}
+}
+
+func TestVerifyEmailOnlyAcceptsVerificationTokens(t *testing.T) {
+	user := &model.User{ID: "user-1", Email: "ana@example.com", IsActive: true, LoginType: "credential"}
+	admin := &model.User{ID: "admin", Email: "admin@example.com", IsActive: true}
+	s, userRepo, _, _ := newTestAuthService(t, nil, user, admin)
+
+	auth, _ := s.generateAuthResponse(user, RequestMeta{})
+	impersonation, _ := s.IssueImpersonationToken(user, admin)
+	for name, token := range map[string]string{
+		"access":        auth.AccessToken,
+		"refresh":       auth.RefreshToken,
+		"impersonation": impersonation.AccessToken,
+	} {
+		if _, err := s.VerifyEmail(token, RequestMeta{}); err == nil {
+			t.Fatalf("%s token accepted as an email verification token", name)
+		}
+	}
+
+	// A token for an address the user no longer has
+	stale, _ := util.GenerateEmailVerificationToken(user.ID, "old@example.com", testJWTSecret)
+	if _, err := s.VerifyEmail(stale, RequestMeta{}); err == nil {
+		t.Fatal("token for a previous address verified the current one")
+	}
+	if got, _ := userRepo.FindByID(user.ID); got.IsVerified {
+		t.Fatal("user verified by a rejected token")
+	}
+
+	token, _ := util.GenerateEmailVerificationToken(user.ID, user.Email, testJWTSecret)
+	if _, err := s.VerifyEmail(token, RequestMeta{}); err != nil {
+		t.Fatalf("verification token rejected: %v", err)
+	}
+	if got, _ := userRepo.FindByID(user.ID); !got.IsVerified {
+		t.Fatal("user not verified")
+	}
+}
+
+func TestVerifyEmailChecksTheAccountState(t *testing.T) {
+	reset := &model.User{ID: "reset", Email: "reset@example.com", IsActive: true, ResetRequired: true}
+	inactive := &model.User{ID: "inactive", Email: "inactive@example.com"}
+	s, _, _, sessionRepo := newTestAuthService(t, nil, reset, inactive)
+
+	for _, user := range []*model.User{reset, inactive} {
+		token, _ := util.GenerateEmailVerificationToken(user.ID, user.Email, testJWTSecret)
+		if _, err := s.VerifyEmail(token, RequestMeta{}); err == nil {
+			t.Fatalf("%s: verification issued tokens", user.ID)
+		}
+		if sessions, _ := sessionRepo.FindByUserID(user.ID); len(sessions) != 0 {
+			t.Fatalf("%s: verification started a session", user.ID)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"yourapp/internal/config"
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+	"yourapp/internal/util"
+)
+
+// Authenticator checks an email and password against one credential store.
+// Login tries each configured authenticator in turn.
+type Authenticator interface {
+	Name() string
+	Authenticate(email, password string) (*model.User, error)
+}
+
+// ErrUnknownLogin tells Login the authenticator does not handle this account,
+// so the next one should be tried
+var ErrUnknownLogin = errors.New("login not handled by this authenticator")
+
+// ldapTimeout bounds each directory round trip so a slow server cannot hang logins
+const ldapTimeout = 10 * time.Second
+
+// LoginFailure is a rejected login. Reason is recorded in the audit log while
+// Err is what the caller sees.
+type LoginFailure struct {
+	UserID string
+	Reason string
+	Err    error
+}
+
+func (f *LoginFailure) Error() string {
+	return f.Err.Error()
+}
+
+var errInvalidLogin = errors.New("invalid email or password")
+
+// passwordAuthenticator checks the bcrypt hash of locally registered users
+type passwordAuthenticator struct {
+	userRepo repository.UserRepository
+}
+
+func newPasswordAuthenticator(userRepo repository.UserRepository) Authenticator {
+	return &passwordAuthenticator{userRepo: userRepo}
+}
+
+func (a *passwordAuthenticator) Name() string {
+	return "password"
+}
+
+func (a *passwordAuthenticator) Authenticate(email, password string) (*model.User, error) {
+	user, err := a.userRepo.FindByEmail(email)
+	if err != nil {
+		return nil, ErrUnknownLogin
+	}
+
+	switch user.LoginType {
+	case "credential":
+	case "google":
+		return nil, &LoginFailure{
+			UserID: user.ID,
+			Reason: "google_account",
+			Err:    errors.New("email sudah terdaftar dengan Google. Silakan login dengan Google"),
+		}
+	default:
+		return nil, ErrUnknownLogin
+	}
+
+	if !util.CheckPasswordHash(password, user.PasswordHash) {
+		return nil, &LoginFailure{UserID: user.ID, Reason: "invalid_password", Err: errInvalidLogin}
+	}
+	return user, nil
+}
+
+// ldapAuthenticator binds against an LDAP or Active Directory server. The
+// user's entry is looked up with the service account, then the password is
+// checked by binding as that entry. Local accounts are created on first login
+// and their roles follow the configured group mapping.
+type ldapAuthenticator struct {
+	userRepo    repository.UserRepository
+	rbacService RBACService
+	auditLogger AuditLogger
+	config      *config.Config
+}
+
+func newLDAPAuthenticator(userRepo repository.UserRepository, rbacService RBACService, auditLogger AuditLogger, cfg *config.Config) Authenticator {
+	return &ldapAuthenticator{
+		userRepo:    userRepo,
+		rbacService: rbacService,
+		auditLogger: auditLogger,
+		config:      cfg,
+	}
+}
+
+func (a *ldapAuthenticator) Name() string {
+	return model.LoginTypeLDAP
+}
+
+func (a *ldapAuthenticator) Authenticate(email, password string) (*model.User, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	// Accounts that belong to another login type are never taken over
+	existing, _ := a.userRepo.FindByEmail(email)
+	if existing != nil && existing.LoginType != model.LoginTypeLDAP {
+		return nil, ErrUnknownLogin
+	}
+
+	entry, err := a.verify(email, password)
+	if err != nil {
+		if existing != nil {
+			if failure, ok := err.(*LoginFailure); ok {
+				failure.UserID = existing.ID
+			}
+		}
+		return nil, err
+	}
+
+	return a.provisionUser(existing, email, entry)
+}
+
+// verify finds the directory entry for the email and binds as it
+func (a *ldapAuthenticator) verify(email, password string) (*util.LDAPEntry, error) {
+	conn, err := util.DialLDAP(a.config.LDAPURL, a.config.LDAPStartTLS, ldapTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if a.config.LDAPBindDN != "" {
+		if err := conn.Bind(a.config.LDAPBindDN, a.config.LDAPBindPassword); err != nil {
+			return nil, fmt.Errorf("LDAP service bind failed: %w", err)
+		}
+	}
+
+	filter := strings.ReplaceAll(a.config.LDAPUserFilter, "{email}", util.EscapeLDAPFilter(email))
+	attributes := []string{a.config.LDAPEmailAttribute, a.config.LDAPNameAttribute, a.config.LDAPGroupAttribute}
+	entries, err := conn.Search(a.config.LDAPBaseDN, filter, attributes, 2)
+	if err != nil {
+		return nil, fmt.Errorf("LDAP search failed: %w", err)
+	}
+
+	switch len(entries) {
+	case 0:
+		return nil, ErrUnknownLogin
+	case 1:
+	default:
+		return nil, &LoginFailure{Reason: "ambiguous_directory_entry", Err: errInvalidLogin}
+	}
+	entry := &entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if errors.Is(err, util.ErrLDAPInvalidCredentials) {
+			return nil, &LoginFailure{Reason: "invalid_password", Err: errInvalidLogin}
+		}
+		return nil, fmt.Errorf("LDAP bind failed: %w", err)
+	}
+	return entry, nil
+}
+
+// provisionUser creates or refreshes the local account for a directory entry
+func (a *ldapAuthenticator) provisionUser(user *model.User, email string, entry *util.LDAPEntry) (*model.User, error) {
+	name := entry.Get(a.config.LDAPNameAttribute)
+	if name == "" {
+		name = email[:strings.Index(email, "@")]
+	}
+
+	if user == nil {
+		user = &model.User{
+			Email:      email,
+			FullName:   name,
+			UserType:   model.RoleMember,
+			IsActive:   true,
+			IsVerified: true, // The directory vouches for the address
+			LoginType:  model.LoginTypeLDAP,
+		}
+		if err := a.userRepo.Create(user); err != nil {
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
+		if err := a.rbacService.AssignDefaultRoles(user); err != nil {
+			return nil, fmt.Errorf("failed to assign roles: %w", err)
+		}
+		a.auditLogger.Log(model.AuditActionRegister, RequestMeta{ActorID: user.ID}, user.ID, model.JSONMap{
+			"via": model.LoginTypeLDAP,
+			"dn":  entry.DN,
+		})
+	} else if user.FullName != name {
+		user.FullName = name
+		if err := a.userRepo.Update(user); err != nil {
+			log.Printf("Failed to update name of directory user %s: %v", user.ID, err)
+		}
+	}
+
+	if err := a.syncRoles(user, entry); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// syncRoles replaces the user's roles with those mapped from their groups on
+// every login, so removing someone from a directory group takes effect on their
+// next sign-in. Without a mapping roles are managed locally.
+func (a *ldapAuthenticator) syncRoles(user *model.User, entry *util.LDAPEntry) error {
+	if len(a.config.LDAPGroupRoles) == 0 {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	var roleNames []string
+	for _, group := range entry.Values(a.config.LDAPGroupAttribute) {
+		role, ok := a.config.LDAPGroupRoles[strings.ToLower(strings.TrimSpace(group))]
+		if ok && !seen[role] {
+			seen[role] = true
+			roleNames = append(roleNames, role)
+		}
+	}
+	if len(roleNames) == 0 {
+		return a.rbacService.AssignDefaultRoles(user)
+	}
+
+	if err := a.rbacService.SetUserRoles(user.ID, roleNames); err != nil {
+		return fmt.Errorf("failed to apply directory roles: %w", err)
+	}
+	user.UserType = primaryRole(roleNames)
+	return nil
+}
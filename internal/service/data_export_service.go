@@ -0,0 +1,250 @@
+package service
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"yourapp/internal/config"
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+	"yourapp/internal/util"
+)
+
+type DataExportService interface {
+	RequestExport(userID string, meta RequestMeta) (*model.DataExport, error)
+	GetDownload(token string) (*model.DataExport, error)
+}
+
+type dataExportService struct {
+	exportRepo   repository.DataExportRepository
+	userRepo     repository.UserRepository
+	sessionRepo  repository.SessionRepository
+	auditRepo    repository.AuditRepository
+	deliveryRepo repository.EmailDeliveryRepository
+	auditLogger  AuditLogger
+	config       *config.Config
+}
+
+// dataExportPendingTimeout is how long an export may stay pending before a
+// new one is allowed; builds normally take seconds, so an older pending
+// export was abandoned by a process that stopped mid-build
+const dataExportPendingTimeout = time.Hour
+
+// exportSection is a single JSON file inside the export archive
+type exportSection struct {
+	Name string
+	Data interface{}
+}
+
+// exportIdentity describes one way the user can sign in
+type exportIdentity struct {
+	Provider string `json:"provider"` // credential, google
+	Subject  string `json:"subject"`
+}
+
+func NewDataExportService(exportRepo repository.DataExportRepository, userRepo repository.UserRepository, sessionRepo repository.SessionRepository, auditRepo repository.AuditRepository, deliveryRepo repository.EmailDeliveryRepository, auditLogger AuditLogger, cfg *config.Config) DataExportService {
+	return &dataExportService{
+		exportRepo:   exportRepo,
+		userRepo:     userRepo,
+		sessionRepo:  sessionRepo,
+		auditRepo:    auditRepo,
+		deliveryRepo: deliveryRepo,
+		auditLogger:  auditLogger,
+		config:       cfg,
+	}
+}
+
+func (s *dataExportService) RequestExport(userID string, meta RequestMeta) (*model.DataExport, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	// Only one export may be in progress at a time
+	if pending, _ := s.exportRepo.FindPendingByUserID(user.ID, time.Now().Add(-dataExportPendingTimeout)); pending != nil {
+		return nil, errors.New("a data export is already in progress")
+	}
+
+	export := &model.DataExport{
+		UserID: user.ID,
+		Status: model.DataExportStatusPending,
+	}
+	if err := s.exportRepo.Create(export); err != nil {
+		return nil, fmt.Errorf("failed to create data export: %w", err)
+	}
+
+	s.auditLogger.Log(model.AuditActionDataExportRequested, meta, user.ID, model.JSONMap{"export_id": export.ID})
+
+	// Build the archive in the background; the link is delivered by email
+	go s.buildExport(user, export)
+
+	return export, nil
+}
+
+func (s *dataExportService) GetDownload(token string) (*model.DataExport, error) {
+	return s.exportRepo.FindByTokenHash(util.HashToken(token))
+}
+
+// buildExport assembles the archive, stores it on disk and emails the download link
+func (s *dataExportService) buildExport(user *model.User, export *model.DataExport) {
+	s.removeExpiredExports()
+
+	sections, err := s.collectSections(user)
+	if err != nil {
+		log.Printf("Failed to collect data for export %s: %v", export.ID, err)
+		s.failExport(export, "")
+		return
+	}
+
+	filePath, err := s.writeArchive(export, sections)
+	if err != nil {
+		log.Printf("Failed to build data export %s: %v", export.ID, err)
+		s.failExport(export, "")
+		return
+	}
+
+	token, err := util.GenerateSecureToken(32)
+	if err != nil {
+		log.Printf("Failed to generate download token for data export %s: %v", export.ID, err)
+		s.failExport(export, filePath)
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(s.config.ExportLinkTTLHours) * time.Hour)
+	tokenHash := util.HashToken(token)
+	export.Status = model.DataExportStatusReady
+	export.FilePath = filePath
+	export.TokenHash = &tokenHash
+	export.ExpiresAt = &expiresAt
+	export.CompletedAt = &now
+
+	downloadLink := fmt.Sprintf("%s/api/v1/exports/%s", s.config.APIURL, token)
+	exportEmail, err := newEmailOutboxMessage(user.Email, user.Locale, util.DataExportEmailData{Link: downloadLink, ExpiresHours: s.config.ExportLinkTTLHours})
+	if err != nil {
+		log.Printf("Failed to build data export email %s: %v", export.ID, err)
+		s.failExport(export, filePath)
+		return
+	}
+
+	if err := s.exportRepo.UpdateWithOutbox(export, exportEmail); err != nil {
+		log.Printf("Failed to update data export %s: %v", export.ID, err)
+		s.failExport(export, filePath)
+		return
+	}
+}
+
+// failExport removes the archive, if one was written, and marks the export
+// failed so the user can request a new one
+func (s *dataExportService) failExport(export *model.DataExport, filePath string) {
+	if filePath != "" {
+		os.Remove(filePath)
+	}
+	export.Status = model.DataExportStatusFailed
+	export.FilePath = ""
+	export.TokenHash = nil
+	export.ExpiresAt = nil
+	export.CompletedAt = nil
+	if err := s.exportRepo.Update(export); err != nil {
+		log.Printf("Failed to mark data export %s failed: %v", export.ID, err)
+	}
+}
+
+// writeArchive writes all export sections as JSON files into a ZIP archive
+func (s *dataExportService) writeArchive(export *model.DataExport, sections []exportSection) (string, error) {
+	if err := os.MkdirAll(s.config.ExportDir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	filePath := filepath.Join(s.config.ExportDir, export.ID+".zip")
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return "", fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer file.Close()
+
+	zw := zip.NewWriter(file)
+	for _, section := range sections {
+		w, err := zw.Create(section.Name + ".json")
+		if err != nil {
+			os.Remove(filePath)
+			return "", fmt.Errorf("failed to add %s to archive: %w", section.Name, err)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(section.Data); err != nil {
+			os.Remove(filePath)
+			return "", fmt.Errorf("failed to encode %s: %w", section.Name, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		os.Remove(filePath)
+		return "", fmt.Errorf("failed to finalize archive: %w", err)
+	}
+
+	return filePath, nil
+}
+
+// collectSections gathers the personal data held about the user
+func (s *dataExportService) collectSections(user *model.User) ([]exportSection, error) {
+	identities := []exportIdentity{}
+	if user.PasswordHash != "" {
+		identities = append(identities, exportIdentity{Provider: "credential", Subject: user.Email})
+	}
+	if user.GoogleID != nil {
+		identities = append(identities, exportIdentity{Provider: "google", Subject: *user.GoogleID})
+	}
+
+	sessions, err := s.sessionRepo.FindByUserID(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+
+	auditEvents, err := s.auditRepo.FindByTargetUserID(user.ID, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit events: %w", err)
+	}
+
+	emails, err := s.deliveryRepo.FindByRecipient(user.Email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get email history: %w", err)
+	}
+
+	return []exportSection{
+		{Name: "export", Data: map[string]interface{}{
+			"user_id":      user.ID,
+			"generated_at": time.Now(),
+		}},
+		{Name: "user", Data: user},
+		{Name: "identities", Data: identities},
+		{Name: "sessions", Data: sessions},
+		{Name: "audit_events", Data: auditEvents},
+		{Name: "emails", Data: emails},
+	}, nil
+}
+
+// removeExpiredExports deletes archives whose download link has expired
+func (s *dataExportService) removeExpiredExports() {
+	expired, err := s.exportRepo.FindExpired(time.Now())
+	if err != nil {
+		log.Printf("Failed to list expired data exports: %v", err)
+		return
+	}
+
+	for _, export := range expired {
+		if export.FilePath != "" {
+			if err := os.Remove(export.FilePath); err != nil && !os.IsNotExist(err) {
+				log.Printf("Failed to remove data export file %s: %v", export.FilePath, err)
+				continue
+			}
+		}
+		s.exportRepo.Delete(export.ID)
+	}
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"yourapp/internal/config"
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+type fakeDataExportRepo struct {
+	repository.DataExportRepository
+	mu              sync.Mutex
+	exports         map[string]*model.DataExport
+	updateOutboxErr error
+	outbox          []*model.OutboxMessage
+}
+
+func newFakeDataExportRepo() *fakeDataExportRepo {
+	return &fakeDataExportRepo{exports: make(map[string]*model.DataExport)}
+}
+
+func (r *fakeDataExportRepo) Create(export *model.DataExport) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if export.ID == "" {
+		export.ID = uuid.New().String()
+	}
+	if export.CreatedAt.IsZero() {
+		export.CreatedAt = time.Now()
+	}
+	stored := *export
+	r.exports[export.ID] = &stored
+	return nil
+}
+
+func (r *fakeDataExportRepo) Update(export *model.DataExport) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *export
+	r.exports[export.ID] = &stored
+	return nil
+}
+
+func (r *fakeDataExportRepo) UpdateWithOutbox(export *model.DataExport, messages ...*model.OutboxMessage) error {
+	r.mu.Lock()
+	if r.updateOutboxErr != nil {
+		r.mu.Unlock()
+		return r.updateOutboxErr
+	}
+	r.outbox = append(r.outbox, messages...)
+	r.mu.Unlock()
+	return r.Update(export)
+}
+
+func (r *fakeDataExportRepo) get(id string) model.DataExport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return *r.exports[id]
+}
+
+// waitBuilt waits for the background build of an export to finish
+func (r *fakeDataExportRepo) waitBuilt(t *testing.T, id string) model.DataExport {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if export := r.get(id); export.Status != model.DataExportStatusPending {
+			return export
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("export %s was not built", id)
+	return model.DataExport{}
+}
+
+func (r *fakeDataExportRepo) FindPendingByUserID(userID string, since time.Time) (*model.DataExport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, export := range r.exports {
+		if export.UserID == userID && export.Status == model.DataExportStatusPending && export.CreatedAt.After(since) {
+			return export, nil
+		}
+	}
+	return nil, errors.New("record not found")
+}
+
+func (r *fakeDataExportRepo) FindExpired(before time.Time) ([]model.DataExport, error) {
+	return nil, nil
+}
+
+func newTestDataExportService(t *testing.T) (*dataExportService, *fakeDataExportRepo, *model.User) {
+	t.Helper()
+	user := &model.User{ID: "user-1", Email: "ana@example.com", FullName: "Ana", PasswordHash: "hash", IsActive: true}
+	deliveries := &fakeEmailDeliveryRepo{}
+	deliveries.Record(&model.EmailDelivery{IdempotencyKey: "k1", Type: "otp", Recipient: "ANA@example.com"})
+	deliveries.Record(&model.EmailDelivery{IdempotencyKey: "k2", Type: "otp", Recipient: "someone@example.com"})
+
+	exportRepo := newFakeDataExportRepo()
+	cfg := &config.Config{ExportDir: t.TempDir(), ExportLinkTTLHours: 24, APIURL: "http://api.test"}
+	s := NewDataExportService(exportRepo, newFakeUserRepo(user), newFakeSessionRepo(), &fakeAuditRepo{}, deliveries, &fakeAuditLogger{}, cfg).(*dataExportService)
+	return s, exportRepo, user
+}
+
+func TestDataExportArchiveIncludesEmailHistory(t *testing.T) {
+	s, exportRepo, user := newTestDataExportService(t)
+	export := &model.DataExport{UserID: user.ID, Status: model.DataExportStatusPending}
+	exportRepo.Create(export)
+
+	s.buildExport(user, export)
+
+	stored := exportRepo.get(export.ID)
+	if stored.Status != model.DataExportStatusReady {
+		t.Fatalf("status = %q, want ready", stored.Status)
+	}
+	if len(exportRepo.outbox) != 1 || exportRepo.outbox[0].Type != "data_export" {
+		t.Fatalf("expected one data_export email in the outbox, got %+v", exportRepo.outbox)
+	}
+
+	archive, err := zip.OpenReader(stored.FilePath)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer archive.Close()
+
+	var emails []model.EmailDelivery
+	for _, f := range archive.File {
+		if f.Name != "emails.json" {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		if err := json.NewDecoder(r).Decode(&emails); err != nil {
+			t.Fatalf("decode emails.json: %v", err)
+		}
+	}
+	if len(emails) != 1 || emails[0].IdempotencyKey != "k1" {
+		t.Fatalf("emails.json = %+v, want only the user's delivery", emails)
+	}
+}
+
+func TestDataExportMarkedFailedWhenOutboxWriteFails(t *testing.T) {
+	s, exportRepo, user := newTestDataExportService(t)
+	exportRepo.updateOutboxErr = errors.New("database is down")
+	export := &model.DataExport{UserID: user.ID, Status: model.DataExportStatusPending}
+	exportRepo.Create(export)
+
+	s.buildExport(user, export)
+
+	stored := exportRepo.get(export.ID)
+	if stored.Status != model.DataExportStatusFailed {
+		t.Fatalf("status = %q, want failed", stored.Status)
+	}
+	if stored.TokenHash != nil {
+		t.Fatal("failed export kept its download token")
+	}
+	if entries, _ := os.ReadDir(s.config.ExportDir); len(entries) != 0 {
+		t.Fatalf("archive was left behind: %v", entries)
+	}
+
+	// A failed export must not block the next request
+	next, err := s.RequestExport(user.ID, RequestMeta{})
+	if err != nil {
+		t.Fatalf("RequestExport after failure: %v", err)
+	}
+	exportRepo.waitBuilt(t, next.ID)
+}
+
+func TestDataExportStalePendingDoesNotBlock(t *testing.T) {
+	s, exportRepo, user := newTestDataExportService(t)
+	exportRepo.Create(&model.DataExport{ID: "recent", UserID: user.ID, Status: model.DataExportStatusPending})
+
+	if _, err := s.RequestExport(user.ID, RequestMeta{}); err == nil {
+		t.Fatal("expected a recent pending export to block a new one")
+	}
+
+	exportRepo.mu.Lock()
+	exportRepo.exports["recent"].CreatedAt = time.Now().Add(-2 * dataExportPendingTimeout)
+	exportRepo.mu.Unlock()
+	export, err := s.RequestExport(user.ID, RequestMeta{})
+	if err != nil {
+		t.Fatalf("stale pending export still blocks: %v", err)
+	}
+	exportRepo.waitBuilt(t, export.ID)
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"errors"
+
+	"yourapp/internal/model"
+	"yourapp/internal/util"
+)
+
+// ErrEmailQueueUnavailable is returned while RabbitMQ is not connected
+var ErrEmailQueueUnavailable = errors.New("email queue is unavailable")
+
+const (
+	defaultDeadLetterLimit = 50
+	maxDeadLetterLimit     = 500
+)
+
+type EmailQueueService interface {
+	ListDeadLetters(limit int) (*DeadLetterListResponse, error)
+	ReplayDeadLetters(messageIDs []string, meta RequestMeta) (int, error)
+}
+
+type emailQueueService struct {
+	rabbitMQ    *util.RabbitMQClient
+	auditLogger AuditLogger
+}
+
+type DeadLetterListResponse struct {
+	Messages []util.DeadLetter `json:"messages"`
+	Total    int               `json:"total"`
+}
+
+type ReplayDeadLettersRequest struct {
+	// MessageIDs selects the messages to replay; empty replays the whole queue
+	MessageIDs []string `json:"message_ids"`
+}
+
+func NewEmailQueueService(rabbitMQ *util.RabbitMQClient, auditLogger AuditLogger) EmailQueueService {
+	return &emailQueueService{
+		rabbitMQ:    rabbitMQ,
+		auditLogger: auditLogger,
+	}
+}
+
+// connected reports whether RabbitMQ is up right now. The client is shared
+// with the worker and reconnects in place, so its state is read per call.
+func (s *emailQueueService) connected() bool {
+	return s.rabbitMQ != nil && s.rabbitMQ.IsConnected()
+}
+
+// ListDeadLetters shows the oldest dead-lettered emails without removing them
+func (s *emailQueueService) ListDeadLetters(limit int) (*DeadLetterListResponse, error) {
+	if !s.connected() {
+		return nil, ErrEmailQueueUnavailable
+	}
+	if limit <= 0 {
+		limit = defaultDeadLetterLimit
+	}
+	if limit > maxDeadLetterLimit {
+		limit = maxDeadLetterLimit
+	}
+
+	letters, total, err := s.rabbitMQ.PeekDeadLetters(limit)
+	if err != nil {
+		return nil, err
+	}
+	return &DeadLetterListResponse{Messages: letters, Total: total}, nil
+}
+
+// ReplayDeadLetters queues dead-lettered emails for a fresh round of attempts
+func (s *emailQueueService) ReplayDeadLetters(messageIDs []string, meta RequestMeta) (int, error) {
+	if !s.connected() {
+		return 0, ErrEmailQueueUnavailable
+	}
+
+	replayed, err := s.rabbitMQ.ReplayDeadLetters(messageIDs)
+	if replayed > 0 {
+		s.auditLogger.Log(model.AuditActionAdminEmailsReplayed, meta, "", model.JSONMap{
+			"replayed":    replayed,
+			"message_ids": messageIDs,
+		})
+	}
+	return replayed, err
+}
@@ -0,0 +1,20 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"yourapp/internal/util"
+)
+
+func TestEmailQueueUnavailableWhileDisconnected(t *testing.T) {
+	// A client that has not connected yet, or is reconnecting
+	s := NewEmailQueueService(&util.RabbitMQClient{}, &fakeAuditLogger{})
+
+	if _, err := s.ListDeadLetters(10); !errors.Is(err, ErrEmailQueueUnavailable) {
+		t.Fatalf("ListDeadLetters = %v, want the queue unavailable", err)
+	}
+	if _, err := s.ReplayDeadLetters(nil, RequestMeta{}); !errors.Is(err, ErrEmailQueueUnavailable) {
+		t.Fatalf("ReplayDeadLetters = %v, want the queue unavailable", err)
+	}
+}
@@ -0,0 +1,333 @@
+package service
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"yourapp/internal/config"
+)
+
+// Email templates live in templates/email: layout.html/layout.txt wrap every
+// email, partials.html holds the shared building blocks, and each email is a
+// <name>.html defining "content" plus a <name>.txt defining "subject" and
+// "content". Copy is never written in the templates themselves; it comes from
+// the per-locale catalogs in locales/<locale>.json through the t function.
+// EMAIL_TEMPLATE_DIR may point to a directory with the same layout whose files
+// replace the embedded ones one by one; its catalogs are merged key by key.
+
+//go:embed templates/email
+var embeddedEmailTemplates embed.FS
+
+const embeddedEmailTemplateRoot = "templates/email"
+
+// ErrUnknownEmailTemplate is returned when no template exists for a name
+var ErrUnknownEmailTemplate = errors.New("unknown email template")
+
+var emailTemplateNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// RenderedEmail is a template rendered for one recipient
+type RenderedEmail struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// emailView is what every email template is executed with
+type emailView struct {
+	Locale  string
+	Subject string
+	Brand   emailBrand
+	Data    interface{}
+}
+
+// emailBrand is shared by the layout partials
+type emailBrand struct {
+	Name         string
+	SupportEmail string
+	ClientURL    string
+	Year         int
+}
+
+type emailTemplateSet struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// emailTemplates parses templates on first use and caches them. Sets are
+// never executed directly; each render clones one and binds t to the locale.
+type emailTemplates struct {
+	dir           string
+	defaultLocale string
+
+	mu   sync.Mutex
+	sets map[string]*emailTemplateSet
+
+	catalogOnce sync.Once
+	catalogs    map[string]map[string]string
+	catalogErr  error
+}
+
+func newEmailTemplates(cfg *config.Config) *emailTemplates {
+	defaultLocale := normalizeLocale(cfg.EmailDefaultLocale)
+	if defaultLocale == "" {
+		defaultLocale = "id"
+	}
+	return &emailTemplates{
+		dir:           cfg.EmailTemplateDir,
+		defaultLocale: defaultLocale,
+		sets:          make(map[string]*emailTemplateSet),
+	}
+}
+
+// normalizeLocale reduces a locale such as "en-US" to its language
+func normalizeLocale(locale string) string {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if i := strings.IndexAny(locale, "-_"); i >= 0 {
+		locale = locale[:i]
+	}
+	return locale
+}
+
+// render renders the named email in the requested locale, falling back to
+// the default locale when there is no catalog for it
+func (e *emailTemplates) render(name, locale string, view emailView) (*RenderedEmail, error) {
+	set, err := e.load(name)
+	if err != nil {
+		return nil, err
+	}
+	catalogs, err := e.loadCatalogs()
+	if err != nil {
+		return nil, err
+	}
+
+	view.Locale = normalizeLocale(locale)
+	if _, ok := catalogs[view.Locale]; !ok {
+		view.Locale = e.defaultLocale
+	}
+	if view.Data == nil {
+		view.Data = map[string]interface{}{}
+	}
+	t := e.translator(catalogs, view.Locale)
+
+	text, err := set.text.Clone()
+	if err != nil {
+		return nil, err
+	}
+	text.Funcs(texttemplate.FuncMap{"t": t})
+
+	var subject, textBody, htmlBody bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", view); err != nil {
+		return nil, fmt.Errorf("failed to render %s subject: %w", name, err)
+	}
+	if err := text.ExecuteTemplate(&textBody, "layout", view); err != nil {
+		return nil, fmt.Errorf("failed to render %s text body: %w", name, err)
+	}
+	view.Subject = strings.TrimSpace(subject.String())
+
+	html, err := set.html.Clone()
+	if err != nil {
+		return nil, err
+	}
+	html.Funcs(htmltemplate.FuncMap{"t": t})
+	if err := html.ExecuteTemplate(&htmlBody, "layout", view); err != nil {
+		return nil, fmt.Errorf("failed to render %s HTML body: %w", name, err)
+	}
+
+	return &RenderedEmail{
+		Subject: view.Subject,
+		HTML:    htmlBody.String(),
+		Text:    strings.TrimSpace(textBody.String()) + "\n",
+	}, nil
+}
+
+// translator looks a key up in the locale's catalog, then the default
+// locale's, and falls back to the key itself so a missing translation is
+// visible instead of blank
+func (e *emailTemplates) translator(catalogs map[string]map[string]string, locale string) func(string, ...interface{}) string {
+	return func(key string, args ...interface{}) string {
+		message, ok := catalogs[locale][key]
+		if !ok {
+			if message, ok = catalogs[e.defaultLocale][key]; !ok {
+				return key
+			}
+		}
+		if len(args) == 0 {
+			return message
+		}
+		return fmt.Sprintf(message, args...)
+	}
+}
+
+func (e *emailTemplates) load(name string) (*emailTemplateSet, error) {
+	if !emailTemplateNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownEmailTemplate, name)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if set, ok := e.sets[name]; ok {
+		return set, nil
+	}
+
+	html := htmltemplate.New(name).Funcs(htmltemplate.FuncMap(emailTemplateFuncs))
+	for _, file := range []string{"layout.html", "partials.html", name + ".html"} {
+		src, err := e.readFile(file)
+		if err != nil {
+			return nil, e.missing(name, file, err)
+		}
+		if _, err := html.New(file).Parse(string(src)); err != nil {
+			return nil, fmt.Errorf("failed to parse email template %s: %w", file, err)
+		}
+	}
+
+	text := texttemplate.New(name).Funcs(texttemplate.FuncMap(emailTemplateFuncs))
+	for _, file := range []string{"layout.txt", name + ".txt"} {
+		src, err := e.readFile(file)
+		if err != nil {
+			return nil, e.missing(name, file, err)
+		}
+		if _, err := text.New(file).Parse(string(src)); err != nil {
+			return nil, fmt.Errorf("failed to parse email template %s: %w", file, err)
+		}
+	}
+
+	set := &emailTemplateSet{html: html, text: text}
+	e.sets[name] = set
+	return set, nil
+}
+
+func (e *emailTemplates) missing(name, file string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) && strings.HasPrefix(file, name+".") {
+		return fmt.Errorf("%w: %q", ErrUnknownEmailTemplate, name)
+	}
+	return fmt.Errorf("failed to read email template %s: %w", file, err)
+}
+
+// readFile reads a template file from the override directory, falling back
+// to the embedded copy
+func (e *emailTemplates) readFile(name string) ([]byte, error) {
+	if e.dir != "" {
+		data, err := os.ReadFile(filepath.Join(e.dir, filepath.FromSlash(name)))
+		if err == nil || !errors.Is(err, fs.ErrNotExist) {
+			return data, err
+		}
+	}
+	return embeddedEmailTemplates.ReadFile(path.Join(embeddedEmailTemplateRoot, name))
+}
+
+// loadCatalogs reads the embedded catalogs once and merges the override
+// directory's on top; an override may also add locales
+func (e *emailTemplates) loadCatalogs() (map[string]map[string]string, error) {
+	e.catalogOnce.Do(func() {
+		catalogs := make(map[string]map[string]string)
+		e.catalogErr = mergeEmailCatalogs(catalogs, embeddedEmailTemplates, path.Join(embeddedEmailTemplateRoot, "locales"))
+		if e.catalogErr == nil && e.dir != "" {
+			e.catalogErr = mergeEmailCatalogs(catalogs, os.DirFS(e.dir), "locales")
+		}
+		if e.catalogErr == nil && catalogs[e.defaultLocale] == nil {
+			e.catalogErr = fmt.Errorf("no email catalog for default locale %q", e.defaultLocale)
+		}
+		e.catalogs = catalogs
+	})
+	return e.catalogs, e.catalogErr
+}
+
+func mergeEmailCatalogs(catalogs map[string]map[string]string, fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read email catalogs: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read email catalog %s: %w", entry.Name(), err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return fmt.Errorf("invalid email catalog %s: %w", entry.Name(), err)
+		}
+
+		locale := normalizeLocale(strings.TrimSuffix(entry.Name(), ".json"))
+		if catalogs[locale] == nil {
+			catalogs[locale] = make(map[string]string, len(messages))
+		}
+		for key, message := range messages {
+			catalogs[locale][key] = message
+		}
+	}
+	return nil
+}
+
+// emailTemplateFuncs are available to every template. t is a placeholder
+// until a render binds it to the recipient's locale.
+var emailTemplateFuncs = map[string]interface{}{
+	"t": func(key string, args ...interface{}) string { return key },
+	"dict": func(pairs ...interface{}) (map[string]interface{}, error) {
+		if len(pairs)%2 != 0 {
+			return nil, errors.New("dict expects key/value pairs")
+		}
+		dict := make(map[string]interface{}, len(pairs)/2)
+		for i := 0; i < len(pairs); i += 2 {
+			key, ok := pairs[i].(string)
+			if !ok {
+				return nil, errors.New("dict keys must be strings")
+			}
+			dict[key] = pairs[i+1]
+		}
+		return dict, nil
+	},
+	"list": func(items ...string) []string { return items },
+	"inc":  func(i int) int { return i + 1 },
+	// link joins a base URL and path and appends query parameters given as
+	// name/value pairs, escaping the values
+	"link": func(base, p string, query ...string) string {
+		link := strings.TrimRight(base, "/") + p
+		if len(query) > 1 {
+			values := url.Values{}
+			for i := 0; i+1 < len(query); i += 2 {
+				values.Set(query[i], query[i+1])
+			}
+			link += "?" + values.Encode()
+		}
+		return link
+	},
+}
+
+// newEmailBrand derives the branding shared by every email from the config
+func newEmailBrand(cfg *config.Config) emailBrand {
+	name := cfg.EmailName
+	if name == "" {
+		name = "Zacode"
+	}
+	supportEmail := "support@" + name
+	if i := strings.Index(cfg.EmailFrom, "@"); i != -1 {
+		supportEmail = "support@" + cfg.EmailFrom[i+1:]
+	}
+	return emailBrand{
+		Name:         name,
+		SupportEmail: supportEmail,
+		ClientURL:    cfg.ClientURL,
+		Year:         time.Now().Year(),
+	}
+}
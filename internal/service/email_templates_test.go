@@ -0,0 +1,210 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"yourapp/internal/config"
+	"yourapp/internal/util"
+)
+
+func newTestEmailService(cfg *config.Config) (EmailService, *CaptureTransport) {
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	if cfg.ClientURL == "" {
+		cfg.ClientURL = "https://app.example.com"
+	}
+	if cfg.EmailFrom == "" {
+		cfg.EmailFrom = "no-reply@example.com"
+	}
+	capture := NewCaptureTransport()
+	return NewEmailServiceWithTransport(cfg, capture), capture
+}
+
+// testEmailData has valid data for every email type
+var testEmailData = map[string]util.EmailData{
+	util.EmailTypeOTP:           util.OTPEmailData{Code: "123456", ExpiresMinutes: 10},
+	util.EmailTypeResetPassword: util.ResetPasswordEmailData{Code: "654321", ExpiresMinutes: 15},
+	util.EmailTypeVerification:  util.VerificationEmailData{Token: "verify-token"},
+	util.EmailTypeWelcome:       util.WelcomeEmailData{Name: "Ana"},
+	util.EmailTypeDataExport:    util.DataExportEmailData{Link: "https://app.example.com/export/1", ExpiresHours: 24},
+	util.EmailTypeOrgInvite:     util.OrgInviteEmailData{OrgName: "Acme", Link: "https://app.example.com/invite?token=x", ExpiresDays: 7},
+}
+
+func TestEveryEmailRendersInEveryLocale(t *testing.T) {
+	s, _ := newTestEmailService(nil)
+	keys := loadEmailCatalog(t, "en")
+
+	for name, data := range testEmailData {
+		subjects := map[string]bool{}
+		for _, locale := range []string{"id", "en"} {
+			rendered, err := s.Render(name, locale, data)
+			if err != nil {
+				t.Fatalf("%s/%s: %v", name, locale, err)
+			}
+			subjects[rendered.Subject] = true
+			for part, body := range map[string]string{"subject": rendered.Subject, "html": rendered.HTML, "text": rendered.Text} {
+				if body == "" {
+					t.Errorf("%s/%s %s is empty", name, locale, part)
+				}
+				// A catalog key in the output means a translation is missing
+				for key := range keys {
+					if strings.Contains(body, key) {
+						t.Errorf("%s/%s %s has the untranslated key %s", name, locale, part, key)
+					}
+				}
+			}
+		}
+		if len(subjects) != 2 {
+			t.Errorf("%s: subject is not localized: %v", name, subjects)
+		}
+	}
+}
+
+func loadEmailCatalog(t *testing.T, locale string) map[string]string {
+	t.Helper()
+	data, err := embeddedEmailTemplates.ReadFile(embeddedEmailTemplateRoot + "/locales/" + locale + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages map[string]string
+	if err := json.Unmarshal(data, &messages); err != nil {
+		t.Fatal(err)
+	}
+	return messages
+}
+
+func TestEmailCatalogsHaveTheSameKeys(t *testing.T) {
+	catalogs := map[string]map[string]string{"id": loadEmailCatalog(t, "id"), "en": loadEmailCatalog(t, "en")}
+	for key := range catalogs["en"] {
+		if _, ok := catalogs["id"][key]; !ok {
+			t.Errorf("id catalog is missing %s", key)
+		}
+	}
+	for key := range catalogs["id"] {
+		if _, ok := catalogs["en"][key]; !ok {
+			t.Errorf("en catalog is missing %s", key)
+		}
+	}
+}
+
+func TestEmailDataIsEscaped(t *testing.T) {
+	s, _ := newTestEmailService(nil)
+
+	rendered, err := s.Render(util.EmailTypeWelcome, "en", util.WelcomeEmailData{Name: `<script>alert("x")</script>`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(rendered.HTML, "<script>") || !strings.Contains(rendered.HTML, "&lt;script&gt;") {
+		t.Fatalf("name was not escaped in the HTML body:\n%s", rendered.HTML)
+	}
+
+	// Link parameters are query-escaped, not spliced into the URL
+	rendered, err = s.Render(util.EmailTypeVerification, "en", util.VerificationEmailData{Token: `a&b="c"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(rendered.Text, "/auth/verify-email?token=a%26b%3D%22c%22") {
+		t.Fatalf("verification link not escaped:\n%s", rendered.Text)
+	}
+}
+
+func TestEmailLocaleSelection(t *testing.T) {
+	s, _ := newTestEmailService(nil)
+	subject := func(locale string) string {
+		rendered, err := s.Render(util.EmailTypeOTP, locale, testEmailData[util.EmailTypeOTP])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rendered.Subject
+	}
+
+	if subject("en-US") != subject("en") || subject("EN_gb") != subject("en") {
+		t.Fatal("regional locale did not use its language's catalog")
+	}
+	// Unknown and empty locales use the default, Indonesian unless configured
+	if subject("fr") != subject("id") || subject("") != subject("id") {
+		t.Fatal("unknown locale did not fall back to the default")
+	}
+
+	s, _ = newTestEmailService(&config.Config{EmailDefaultLocale: "en"})
+	if subject("fr") != subject("en") {
+		t.Fatal("configured default locale ignored")
+	}
+}
+
+func TestUnknownEmailTemplate(t *testing.T) {
+	s, _ := newTestEmailService(nil)
+	for _, name := range []string{"missing", "../layout", "Layout", ""} {
+		if _, err := s.Render(name, "en", nil); !errors.Is(err, ErrUnknownEmailTemplate) {
+			t.Errorf("%q: err = %v, want ErrUnknownEmailTemplate", name, err)
+		}
+	}
+}
+
+func TestEmailTemplateOverrides(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "locales"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// Catalogs merge key by key, so one changed string keeps the rest
+	if err := os.WriteFile(filepath.Join(dir, "locales", "en.json"), []byte(`{"otp.subject": "Your Acme code"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "locales", "de.json"), []byte(`{"otp.subject": "Ihr Code"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Template files replace the embedded ones one by one
+	if err := os.WriteFile(filepath.Join(dir, "welcome.txt"), []byte(`{{define "subject"}}Hi {{.Data.Name}}{{end}}{{define "content"}}Custom welcome{{end}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, _ := newTestEmailService(&config.Config{EmailTemplateDir: dir})
+	rendered, err := s.Render(util.EmailTypeOTP, "en", testEmailData[util.EmailTypeOTP])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered.Subject != "Your Acme code" || !strings.Contains(rendered.Text, "123456") || strings.Contains(rendered.Text, "otp.") {
+		t.Fatalf("overridden otp email = %+v", rendered)
+	}
+
+	// A locale added by the override falls back to the default for missing keys
+	rendered, err = s.Render(util.EmailTypeOTP, "de", testEmailData[util.EmailTypeOTP])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered.Subject != "Ihr Code" || strings.Contains(rendered.Text, "otp.") {
+		t.Fatalf("added locale = %+v", rendered)
+	}
+
+	rendered, err = s.Render(util.EmailTypeWelcome, "en", util.WelcomeEmailData{Name: "Ana"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered.Subject != "Hi Ana" || !strings.Contains(rendered.Text, "Custom welcome") || !strings.Contains(rendered.HTML, "Ana") {
+		t.Fatalf("overridden welcome email = %+v", rendered)
+	}
+}
+
+func TestSendDeliversRenderedEmail(t *testing.T) {
+	s, capture := newTestEmailService(&config.Config{EmailName: "Acme"})
+
+	if err := s.Send("ana@example.com", util.EmailTypeOTP, "en", testEmailData[util.EmailTypeOTP]); err != nil {
+		t.Fatal(err)
+	}
+	email, ok := capture.Last()
+	if !ok {
+		t.Fatal("nothing sent")
+	}
+	if email.From != "no-reply@example.com" || email.FromName != "Acme" || len(email.To) != 1 || email.To[0] != "ana@example.com" {
+		t.Fatalf("envelope = %+v", email)
+	}
+	if !strings.HasSuffix(email.MessageID, "@example.com") || !strings.Contains(email.HTML, "123456") || !strings.Contains(email.Text, "123456") {
+		t.Fatalf("email = %+v", email)
+	}
+}
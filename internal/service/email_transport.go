@@ -0,0 +1,480 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"yourapp/internal/config"
+)
+
+// Email transports
+const (
+	EmailTransportSMTP    = "smtp"
+	EmailTransportFile    = "file"
+	EmailTransportCapture = "capture"
+	EmailTransportLog     = "log"
+)
+
+// SMTP connection security
+const (
+	SMTPSecuritySTARTTLS = "starttls"
+	SMTPSecurityTLS      = "tls" // implicit TLS, usually port 465
+	SMTPSecurityNone     = "none"
+)
+
+// SMTP auth mechanisms
+const (
+	SMTPAuthPlain   = "plain"
+	SMTPAuthLogin   = "login"
+	SMTPAuthCRAMMD5 = "cram-md5"
+	SMTPAuthNone    = "none"
+)
+
+// File transport formats
+const (
+	EmailFileFormatMaildir = "maildir"
+	EmailFileFormatEML     = "eml"
+)
+
+// Email is a rendered message handed to a transport
+type Email struct {
+	MessageID string
+	Date      time.Time
+	FromName  string
+	From      string
+	To        []string
+	Subject   string
+	HTML      string
+	Text      string
+}
+
+// Transport delivers rendered emails
+type Transport interface {
+	Send(email *Email) error
+}
+
+// NewTransport returns the transport selected by EMAIL_TRANSPORT
+func NewTransport(cfg *config.Config) Transport {
+	switch cfg.EmailTransport {
+	case EmailTransportSMTP:
+		return &SMTPTransport{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			Security: cfg.SMTPSecurity,
+			Auth:     cfg.SMTPAuth,
+			Timeout:  time.Duration(cfg.SMTPTimeoutSeconds) * time.Second,
+		}
+	case EmailTransportFile:
+		return &FileTransport{Dir: cfg.EmailFileDir, Format: cfg.EmailFileFormat}
+	case EmailTransportCapture:
+		return NewCaptureTransport()
+	default:
+		return LogTransport{}
+	}
+}
+
+// Bytes encodes the email as a multipart/alternative RFC 5322 message with
+// quoted-printable text and HTML parts
+func (e *Email) Bytes() ([]byte, error) {
+	from, err := mail.ParseAddress(e.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender %q: %w", e.From, err)
+	}
+	from.Name = e.FromName
+
+	to := make([]string, 0, len(e.To))
+	for _, recipient := range e.To {
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient %q: %w", recipient, err)
+		}
+		to = append(to, address.String())
+	}
+	if len(to) == 0 {
+		return nil, errors.New("email has no recipients")
+	}
+
+	var buf bytes.Buffer
+	body := multipart.NewWriter(&buf)
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+	header("From", from.String())
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", e.Subject))
+	header("Date", e.Date.Format(time.RFC1123Z))
+	if e.MessageID != "" {
+		header("Message-ID", "<"+e.MessageID+">")
+	}
+	header("MIME-Version", "1.0")
+	header("Content-Type", `multipart/alternative; boundary="`+body.Boundary()+`"`)
+	buf.WriteString("\r\n")
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", e.Text},
+		{"text/html; charset=UTF-8", e.HTML},
+	} {
+		w, err := body.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// newMessageID returns a unique Message-ID for the sender's domain
+func newMessageID(from string) string {
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i != -1 {
+		domain = from[i+1:]
+	}
+	b := make([]byte, 12)
+	rand.Read(b)
+	return fmt.Sprintf("%d.%s@%s", time.Now().UnixNano(), hex.EncodeToString(b), domain)
+}
+
+// SMTPTransport sends through an SMTP server. Timeout bounds both the dial and
+// the whole conversation.
+type SMTPTransport struct {
+	Host      string
+	Port      string
+	Username  string
+	Password  string
+	Security  string // starttls, tls or none
+	Auth      string // plain, login, cram-md5 or none
+	Timeout   time.Duration
+	LocalName string // HELO name, "localhost" when empty
+}
+
+func (t *SMTPTransport) Send(email *Email) error {
+	msg, err := email.Bytes()
+	if err != nil {
+		return err
+	}
+
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	addr := net.JoinHostPort(t.Host, t.Port)
+	dialer := &net.Dialer{Timeout: timeout}
+	tlsConfig := &tls.Config{ServerName: t.Host}
+
+	var conn net.Conn
+	if t.Security == SMTPSecurityTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	client, err := smtp.NewClient(conn, t.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if t.LocalName != "" {
+		if err := client.Hello(t.LocalName); err != nil {
+			return fmt.Errorf("SMTP HELO failed: %w", err)
+		}
+	}
+
+	if t.Security == SMTPSecuritySTARTTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("SMTP STARTTLS failed: %w", err)
+		}
+	}
+
+	if auth := t.auth(); auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("SMTP server does not support AUTH")
+		}
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(email.From); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM failed: %w", err)
+	}
+	for _, recipient := range email.To {
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("SMTP RCPT TO %s failed: %w", recipient, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected message: %w", err)
+	}
+	return client.Quit()
+}
+
+func (t *SMTPTransport) auth() smtp.Auth {
+	if t.Username == "" {
+		return nil
+	}
+	switch t.Auth {
+	case SMTPAuthNone:
+		return nil
+	case SMTPAuthLogin:
+		return &loginAuth{host: t.Host, username: t.Username, password: t.Password}
+	case SMTPAuthCRAMMD5:
+		return smtp.CRAMMD5Auth(t.Username, t.Password)
+	default:
+		return smtp.PlainAuth("", t.Username, t.Password, t.Host)
+	}
+}
+
+// loginAuth implements the LOGIN mechanism still required by some servers.
+// Like smtp.PlainAuth it refuses to send credentials without TLS, except to
+// localhost.
+type loginAuth struct {
+	host     string
+	username string
+	password string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	local := server.Name == "localhost" || server.Name == "127.0.0.1" || server.Name == "::1"
+	if !server.TLS && !local {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch prompt := strings.ToLower(strings.TrimSpace(string(fromServer))); {
+	case strings.HasPrefix(prompt, "username"):
+		return []byte(a.username), nil
+	case strings.HasPrefix(prompt, "password"):
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected LOGIN prompt %q", fromServer)
+	}
+}
+
+// FileTransport writes emails to a directory for development, either as a
+// Maildir (readable by mail clients) or as individual .eml files
+type FileTransport struct {
+	Dir    string
+	Format string // maildir or eml
+}
+
+var fileTransportSeq atomic.Uint64
+
+func (t *FileTransport) Send(email *Email) error {
+	msg, err := email.Bytes()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	seq := fileTransportSeq.Add(1)
+	if t.Format == EmailFileFormatEML {
+		if err := os.MkdirAll(t.Dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create mail directory: %w", err)
+		}
+		name := fmt.Sprintf("%s-%d.eml", now.Format("20060102T150405.000000"), seq)
+		return os.WriteFile(filepath.Join(t.Dir, name), msg, 0o644)
+	}
+
+	// Maildir delivery: write to tmp, then move into new
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(t.Dir, sub), 0o755); err != nil {
+			return fmt.Errorf("failed to create maildir: %w", err)
+		}
+	}
+	host, _ := os.Hostname()
+	host = strings.NewReplacer("/", "_", ":", "_").Replace(host)
+	name := fmt.Sprintf("%d.M%dP%dQ%d.%s", now.Unix(), now.Nanosecond()/1000, os.Getpid(), seq, host)
+	tmp := filepath.Join(t.Dir, "tmp", name)
+	if err := os.WriteFile(tmp, msg, 0o644); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	return os.Rename(tmp, filepath.Join(t.Dir, "new", name))
+}
+
+// CaptureTransport keeps sent emails in memory so tests and development
+// tools can inspect them
+type CaptureTransport struct {
+	mu     sync.Mutex
+	emails []Email
+}
+
+func NewCaptureTransport() *CaptureTransport {
+	return &CaptureTransport{}
+}
+
+func (t *CaptureTransport) Send(email *Email) error {
+	if _, err := email.Bytes(); err != nil {
+		return err
+	}
+	captured := *email
+	captured.To = append([]string(nil), email.To...)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.emails = append(t.emails, captured)
+	return nil
+}
+
+// Emails returns the captured emails, oldest first
+func (t *CaptureTransport) Emails() []Email {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Email(nil), t.emails...)
+}
+
+// Last returns the most recently captured email
+func (t *CaptureTransport) Last() (Email, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.emails) == 0 {
+		return Email{}, false
+	}
+	return t.emails[len(t.emails)-1], true
+}
+
+// Reset discards the captured emails
+func (t *CaptureTransport) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.emails = nil
+}
+
+// LogTransport prints emails to the log instead of sending them
+type LogTransport struct{}
+
+func (LogTransport) Send(email *Email) error {
+	log.Printf("[EMAIL] To: %s, Subject: %s\nBody: %s", strings.Join(email.To, ", "), email.Subject, email.Text)
+	return nil
+}
+
+// DevMail is an email kept by the development inbox
+type DevMail struct {
+	ID         int
+	ReceivedAt time.Time
+	Email      Email
+}
+
+// DevInbox keeps the most recent emails in memory for the /_dev/mail catcher
+// and passes every email on to the next transport, if any
+type DevInbox struct {
+	next  Transport
+	limit int
+
+	mu     sync.RWMutex
+	lastID int
+	mails  []DevMail
+}
+
+func NewDevInbox(next Transport, limit int) *DevInbox {
+	if limit <= 0 {
+		limit = 200
+	}
+	return &DevInbox{next: next, limit: limit}
+}
+
+func (i *DevInbox) Send(email *Email) error {
+	if _, err := email.Bytes(); err != nil {
+		return err
+	}
+	kept := *email
+	kept.To = append([]string(nil), email.To...)
+
+	i.mu.Lock()
+	i.lastID++
+	i.mails = append(i.mails, DevMail{ID: i.lastID, ReceivedAt: time.Now(), Email: kept})
+	if len(i.mails) > i.limit {
+		i.mails = append([]DevMail(nil), i.mails[len(i.mails)-i.limit:]...)
+	}
+	i.mu.Unlock()
+
+	if i.next != nil {
+		return i.next.Send(email)
+	}
+	return nil
+}
+
+// List returns the kept emails, newest first
+func (i *DevInbox) List() []DevMail {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	mails := make([]DevMail, len(i.mails))
+	for n, mail := range i.mails {
+		mails[len(i.mails)-1-n] = mail
+	}
+	return mails
+}
+
+// Get returns a kept email by ID
+func (i *DevInbox) Get(id int) (DevMail, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	for _, mail := range i.mails {
+		if mail.ID == id {
+			return mail, true
+		}
+	}
+	return DevMail{}, false
+}
+
+// Clear discards the kept emails
+func (i *DevInbox) Clear() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.mails = nil
+}
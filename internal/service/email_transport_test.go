@@ -0,0 +1,377 @@
+package service
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSMTPServer speaks just enough SMTP to accept one message per
+// connection and records the commands it receives. STARTTLS is advertised
+// when startTLS is set, but the handshake is left to fail since the client
+// only trusts real certificates.
+type testSMTPServer struct {
+	listener net.Listener
+	startTLS bool
+
+	mu       sync.Mutex
+	commands []string
+	data     []string
+	// firstBytes is what the client sent before the greeting was read, which
+	// for implicit TLS is a ClientHello
+	firstBytes []byte
+	greet      bool
+}
+
+// newTestSMTPServer starts a server; configure runs before it accepts
+// connections
+func newTestSMTPServer(t *testing.T, configure ...func(*testSMTPServer)) *testSMTPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testSMTPServer{listener: listener, greet: true}
+	for _, f := range configure {
+		f(s)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *testSMTPServer) port() string {
+	_, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return port
+}
+
+func (s *testSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if !s.greet {
+		// Never answer, so the client has to give up on its own
+		io.Copy(io.Discard, conn)
+		return
+	}
+
+	// A TLS client speaks first; an SMTP client waits for the greeting
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	first := make([]byte, 5)
+	if n, _ := conn.Read(first); n > 0 {
+		s.mu.Lock()
+		s.firstBytes = first[:n]
+		s.mu.Unlock()
+		return
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+	reply("220 test ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		s.mu.Lock()
+		s.commands = append(s.commands, line)
+		s.mu.Unlock()
+
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO":
+			if s.startTLS {
+				reply("250-test")
+				reply("250-STARTTLS")
+			} else {
+				reply("250-test")
+			}
+			reply("250 AUTH PLAIN LOGIN")
+		case "STARTTLS":
+			reply("220 go ahead")
+			return
+		case "AUTH":
+			if strings.HasPrefix(strings.ToUpper(line), "AUTH LOGIN") {
+				reply("334 VXNlcm5hbWU6") // Username:
+				user, _ := r.ReadString('\n')
+				reply("334 UGFzc3dvcmQ6") // Password:
+				pass, _ := r.ReadString('\n')
+				s.mu.Lock()
+				s.commands = append(s.commands, strings.TrimSpace(user), strings.TrimSpace(pass))
+				s.mu.Unlock()
+			}
+			reply("235 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var body strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				body.WriteString(l)
+			}
+			s.mu.Lock()
+			s.data = append(s.data, body.String())
+			s.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func (s *testSMTPServer) sawCommand(prefix string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.commands {
+		if strings.HasPrefix(c, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func testEmail() *Email {
+	return &Email{
+		MessageID: "1.abc@example.com",
+		Date:      time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC),
+		FromName:  "Acme",
+		From:      "no-reply@example.com",
+		To:        []string{"ana@example.com"},
+		Subject:   "Your code",
+		HTML:      "<p>123456</p>",
+		Text:      "123456",
+	}
+}
+
+func TestSMTPTransportPlainSession(t *testing.T) {
+	server := newTestSMTPServer(t)
+	transport := &SMTPTransport{Host: "127.0.0.1", Port: server.port(), Security: SMTPSecurityNone, Username: "mailer", Password: "secret", Timeout: time.Second}
+
+	if err := transport.Send(testEmail()); err != nil {
+		t.Fatal(err)
+	}
+	// PLAIN is the default mechanism; credentials may go unencrypted to localhost only
+	for _, command := range []string{"AUTH PLAIN", "MAIL FROM:<no-reply@example.com>", "RCPT TO:<ana@example.com>", "QUIT"} {
+		if !server.sawCommand(command) {
+			t.Errorf("server did not see %q", command)
+		}
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.data) != 1 || !strings.Contains(server.data[0], "Subject: Your code") {
+		t.Fatalf("data = %v", server.data)
+	}
+}
+
+func TestSMTPTransportLoginAuth(t *testing.T) {
+	server := newTestSMTPServer(t)
+	transport := &SMTPTransport{Host: "127.0.0.1", Port: server.port(), Security: SMTPSecurityNone, Auth: SMTPAuthLogin, Username: "mailer", Password: "secret", Timeout: time.Second}
+
+	if err := transport.Send(testEmail()); err != nil {
+		t.Fatal(err)
+	}
+	if !server.sawCommand("AUTH LOGIN") || !server.sawCommand("bWFpbGVy") || !server.sawCommand("c2VjcmV0") {
+		t.Fatal("LOGIN exchange missing")
+	}
+
+	// LOGIN refuses to send a password in the clear to anything but localhost
+	auth := &loginAuth{host: "mail.example.com", username: "mailer", password: "secret"}
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: "mail.example.com"}); err == nil {
+		t.Fatal("LOGIN started without TLS")
+	}
+}
+
+func TestSMTPTransportSecuritySelection(t *testing.T) {
+	t.Run("starttls upgrades before anything else", func(t *testing.T) {
+		server := newTestSMTPServer(t, func(s *testSMTPServer) { s.startTLS = true })
+		transport := &SMTPTransport{Host: "127.0.0.1", Port: server.port(), Security: SMTPSecuritySTARTTLS, Username: "mailer", Password: "secret", Timeout: time.Second}
+
+		// The test server's handshake fails, which must abort the send
+		if err := transport.Send(testEmail()); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+			t.Fatalf("err = %v, want a STARTTLS failure", err)
+		}
+		if !server.sawCommand("STARTTLS") || server.sawCommand("AUTH") || server.sawCommand("MAIL") {
+			t.Fatal("server did not see STARTTLS before anything else")
+		}
+	})
+
+	t.Run("starttls is never downgraded", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		transport := &SMTPTransport{Host: "127.0.0.1", Port: server.port(), Security: SMTPSecuritySTARTTLS, Timeout: time.Second}
+
+		if err := transport.Send(testEmail()); err == nil || !strings.Contains(err.Error(), "does not support STARTTLS") {
+			t.Fatalf("err = %v, want STARTTLS to be required", err)
+		}
+		if server.sawCommand("MAIL") {
+			t.Fatal("message sent in the clear")
+		}
+	})
+
+	t.Run("implicit tls handshakes first", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		transport := &SMTPTransport{Host: "127.0.0.1", Port: server.port(), Security: SMTPSecurityTLS, Timeout: time.Second}
+
+		if err := transport.Send(testEmail()); err == nil {
+			t.Fatal("send succeeded without a TLS server")
+		}
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		// 0x16 is the TLS handshake record type
+		if len(server.firstBytes) == 0 || server.firstBytes[0] != 0x16 || len(server.commands) != 0 {
+			t.Fatalf("first bytes %x, commands %v; want a TLS ClientHello", server.firstBytes, server.commands)
+		}
+	})
+}
+
+func TestSMTPTransportTimeout(t *testing.T) {
+	server := newTestSMTPServer(t, func(s *testSMTPServer) { s.greet = false })
+	transport := &SMTPTransport{Host: "127.0.0.1", Port: server.port(), Security: SMTPSecurityNone, Timeout: 200 * time.Millisecond}
+
+	start := time.Now()
+	if err := transport.Send(testEmail()); err == nil {
+		t.Fatal("send to a silent server succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("send took %v, want it bounded by the timeout", elapsed)
+	}
+}
+
+func TestEmailBytes(t *testing.T) {
+	email := testEmail()
+	email.Subject = "Kode verifikasi – Acme\r\nBcc: victim@example.com"
+
+	raw, err := email.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.Get("Bcc") != "" {
+		t.Fatal("subject injected a header")
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != email.Subject {
+		t.Fatalf("subject = %q, %v", subject, err)
+	}
+	if msg.Header.Get("From") != `"Acme" <no-reply@example.com>` || msg.Header.Get("Message-Id") != "<1.abc@example.com>" {
+		t.Fatalf("headers = %v", msg.Header)
+	}
+	if !strings.HasPrefix(msg.Header.Get("Content-Type"), "multipart/alternative") {
+		t.Fatalf("content type = %s", msg.Header.Get("Content-Type"))
+	}
+
+	email.To = []string{"not an address"}
+	if _, err := email.Bytes(); err == nil {
+		t.Fatal("invalid recipient accepted")
+	}
+}
+
+func TestFileTransport(t *testing.T) {
+	dir := t.TempDir()
+	if err := (&FileTransport{Dir: dir, Format: EmailFileFormatMaildir}).Send(testEmail()); err != nil {
+		t.Fatal(err)
+	}
+	delivered, _ := os.ReadDir(filepath.Join(dir, "new"))
+	pending, _ := os.ReadDir(filepath.Join(dir, "tmp"))
+	if len(delivered) != 1 || len(pending) != 0 {
+		t.Fatalf("maildir new %d, tmp %d", len(delivered), len(pending))
+	}
+
+	emlDir := filepath.Join(t.TempDir(), "eml")
+	transport := &FileTransport{Dir: emlDir, Format: EmailFileFormatEML}
+	for i := 0; i < 2; i++ {
+		if err := transport.Send(testEmail()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, _ := filepath.Glob(filepath.Join(emlDir, "*.eml"))
+	if len(files) != 2 {
+		t.Fatalf("eml files = %v", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	if !strings.Contains(string(data), "Subject: Your code") {
+		t.Fatalf("eml file = %s", data)
+	}
+}
+
+func TestCaptureTransport(t *testing.T) {
+	capture := NewCaptureTransport()
+	email := testEmail()
+	if err := capture.Send(email); err != nil {
+		t.Fatal(err)
+	}
+	// Captured emails are copies
+	email.To[0] = "changed@example.com"
+	last, ok := capture.Last()
+	if !ok || last.To[0] != "ana@example.com" {
+		t.Fatalf("captured = %+v", last)
+	}
+
+	bad := testEmail()
+	bad.From = "not an address"
+	if err := capture.Send(bad); err == nil {
+		t.Fatal("capture accepted an email the SMTP transport would reject")
+	}
+	if len(capture.Emails()) != 1 {
+		t.Fatalf("captured %d emails", len(capture.Emails()))
+	}
+
+	capture.Reset()
+	if _, ok := capture.Last(); ok {
+		t.Fatal("reset kept emails")
+	}
+}
+
+func TestDevInboxKeepsTheMostRecentEmails(t *testing.T) {
+	next := NewCaptureTransport()
+	inbox := NewDevInbox(next, 2)
+	for _, to := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		email := testEmail()
+		email.To = []string{to}
+		if err := inbox.Send(email); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mails := inbox.List()
+	if len(mails) != 2 || mails[0].Email.To[0] != "c@example.com" || mails[1].Email.To[0] != "b@example.com" {
+		t.Fatalf("kept = %+v", mails)
+	}
+	if _, ok := inbox.Get(1); ok {
+		t.Fatal("oldest email was kept past the limit")
+	}
+	if mail, ok := inbox.Get(3); !ok || mail.Email.To[0] != "c@example.com" {
+		t.Fatalf("Get(3) = %+v, %v", mail, ok)
+	}
+	if len(next.Emails()) != 3 {
+		t.Fatalf("next transport got %d emails", len(next.Emails()))
+	}
+}
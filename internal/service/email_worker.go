@@ -1,89 +1,224 @@
 package service
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"yourapp/internal/config"
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
 	"yourapp/internal/util"
 
 	amqp "github.com/rabbitmq/amqp091-go"
+	"golang.org/x/time/rate"
 )
 
+// emailQueue is the part of util.RabbitMQClient the worker uses
+type emailQueue interface {
+	Consume(queue string, opts util.ConsumeOptions, handle func(amqp.Delivery)) (*util.Consumer, error)
+	PublishRetry(msg amqp.Delivery, retry int, reason string) (time.Duration, error)
+	PublishDeadLetter(msg amqp.Delivery, reason string) error
+}
+
 type EmailWorker struct {
 	emailService EmailService
-	rabbitMQ     *util.RabbitMQClient
+	deliveryRepo repository.EmailDeliveryRepository
+	rabbitMQ     emailQueue
+	maxAttempts  int
+	options      util.ConsumeOptions
+	stopTimeout  time.Duration
+
+	// Sends per recipient domain are limited so one provider's throttling
+	// does not get the sender blocked; a zero limit disables it
+	domainRate     rate.Limit
+	domainBurst    int
+	domainMu       sync.Mutex
+	domainLimiters map[string]*rate.Limiter
+
+	metrics  *WorkerMetrics
+	consumer *util.Consumer
+	ctx      context.Context
+	cancel   context.CancelFunc
 }
 
-func NewEmailWorker(emailService EmailService, rabbitMQ *util.RabbitMQClient) *EmailWorker {
+func NewEmailWorker(emailService EmailService, deliveryRepo repository.EmailDeliveryRepository, rabbitMQ *util.RabbitMQClient, metrics *WorkerMetrics, cfg *config.Config) *EmailWorker {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &EmailWorker{
 		emailService: emailService,
+		deliveryRepo: deliveryRepo,
 		rabbitMQ:     rabbitMQ,
+		maxAttempts:  cfg.EmailMaxAttempts,
+		options: util.ConsumeOptions{
+			Prefetch:    cfg.EmailWorkerPrefetch,
+			Concurrency: cfg.EmailWorkerConcurrency,
+		},
+		stopTimeout:    time.Duration(cfg.EmailWorkerStopTimeoutSeconds) * time.Second,
+		domainRate:     rate.Limit(float64(cfg.EmailDomainRatePerMinute) / 60),
+		domainBurst:    max(1, cfg.EmailDomainRatePerMinute/6), // Ten seconds' worth
+		domainLimiters: make(map[string]*rate.Limiter),
+		metrics:        metrics,
+		ctx:            ctx,
+		cancel:         cancel,
 	}
 }
 
+var (
+	// errRejectedEmailJob wraps failures that no retry can fix; such jobs are
+	// moved to the dead-letter queue instead of being requeued
+	errRejectedEmailJob = errors.New("email job rejected")
+	// errEmailWorkerStopping is returned for jobs interrupted by Stop before
+	// sending; they are requeued without counting an attempt
+	errEmailWorkerStopping = errors.New("email worker is stopping")
+)
+
 // Start starts the email worker to consume messages from RabbitMQ
 func (w *EmailWorker) Start() error {
-	channel := w.rabbitMQ.GetChannel()
-	queueName := w.rabbitMQ.GetQueueName()
-
-	msgs, err := channel.Consume(
-		queueName, // queue
-		"",        // consumer
-		false,     // auto-ack (set to false for manual ack)
-		false,     // exclusive
-		false,     // no-local
-		false,     // no-wait
-		nil,       // args
-	)
+	// The client restarts the consumer whenever it reconnects
+	consumer, err := w.rabbitMQ.Consume(util.EmailQueueName, w.options, w.handleMessage)
 	if err != nil {
 		return err
 	}
+	w.consumer = consumer
+
+	log.Printf("Email worker started with %d handlers (prefetch %d), waiting for messages...", w.options.Concurrency, w.options.Prefetch)
+
+	return nil
+}
 
-	log.Println("Email worker started, waiting for messages...")
+// handleMessage acks a processed message. Failed jobs are retried with
+// backoff through the retry queues until they run out of attempts, then
+// dead-lettered along with jobs that can never be sent.
+func (w *EmailWorker) handleMessage(msg amqp.Delivery) {
+	w.metrics.emailStarted()
+	defer w.metrics.emailFinished()
 
-	// Process messages in a goroutine
-	go func() {
-		for msg := range msgs {
-			if err := w.processEmailMessage(msg); err != nil {
-				log.Printf("Error processing email message: %v", err)
-				// Reject and requeue on error
-				msg.Nack(false, true)
-			} else {
-				// Acknowledge message on success
-				msg.Ack(false)
-			}
+	err := w.processEmailMessage(msg)
+	if err == nil {
+		msg.Ack(false)
+		return
+	}
+	if errors.Is(err, errEmailWorkerStopping) {
+		w.metrics.recordEmail("requeued")
+		msg.Nack(false, true)
+		return
+	}
+
+	attempts := util.EmailRetryCount(msg) + 1
+	if !errors.Is(err, errRejectedEmailJob) && attempts < w.maxAttempts {
+		delay, retryErr := w.rabbitMQ.PublishRetry(msg, attempts, err.Error())
+		if retryErr == nil {
+			log.Printf("Email message %s failed (attempt %d/%d), retrying in %v: %v", msg.MessageId, attempts, w.maxAttempts, delay, err)
+			w.metrics.recordEmail("retried")
+			msg.Ack(false)
+			return
 		}
-	}()
+		log.Printf("Failed to schedule retry of email message %s: %v", msg.MessageId, retryErr)
+		w.metrics.recordEmail("requeued")
+		msg.Nack(false, true)
+		return
+	}
 
-	return nil
+	reason := err.Error()
+	if !errors.Is(err, errRejectedEmailJob) {
+		reason = fmt.Sprintf("gave up after %d attempts: %v", attempts, err)
+	}
+	log.Printf("Dead-lettering email message %s: %s", msg.MessageId, reason)
+	if dlqErr := w.rabbitMQ.PublishDeadLetter(msg, reason); dlqErr != nil {
+		log.Printf("Failed to dead-letter email message: %v", dlqErr)
+		w.metrics.recordEmail("requeued")
+		msg.Nack(false, true)
+		return
+	}
+	w.metrics.recordEmail("dead_lettered")
+	msg.Ack(false)
 }
 
 func (w *EmailWorker) processEmailMessage(msg amqp.Delivery) error {
-	var emailMsg util.EmailMessage
-	if err := json.Unmarshal(msg.Body, &emailMsg); err != nil {
+	job, data, err := util.DecodeEmailJob(msg.Body)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errRejectedEmailJob, err)
+	}
+
+	log.Printf("Processing email: Type=%s, To=%s, Key=%s", job.Type, job.To, job.IdempotencyKey)
+
+	sent, err := w.deliveryRepo.Exists(job.IdempotencyKey)
+	if err != nil {
+		return err
+	}
+	if sent {
+		log.Printf("Email %s was already sent, skipping redelivery", job.IdempotencyKey)
+		w.metrics.recordEmail("skipped")
+		return nil
+	}
+
+	if err := w.waitForDomain(job.To); err != nil {
 		return err
 	}
 
-	log.Printf("Processing email: Type=%s, To=%s", emailMsg.Type, emailMsg.To)
+	started := time.Now()
+	err = w.emailService.Send(job.To, job.Type, job.Locale, data)
+	w.metrics.observeSend(time.Since(started))
+	if err != nil {
+		if errors.Is(err, ErrUnknownEmailTemplate) {
+			return fmt.Errorf("%w: %w", errRejectedEmailJob, err)
+		}
+		return err
+	}
+	w.metrics.recordEmail("sent")
 
-	switch emailMsg.Type {
-	case "otp":
-		// Extract OTP from body (simplified - in production, use structured data)
-		return w.emailService.SendOTPEmail(emailMsg.To, emailMsg.Body)
-	case "reset_password":
-		// Body contains the reset password link
-		return w.emailService.SendResetPasswordEmail(emailMsg.To, emailMsg.Body)
-	case "verification":
-		return w.emailService.SendVerificationEmail(emailMsg.To, emailMsg.Body)
-	case "welcome":
-		return w.emailService.SendWelcomeEmail(emailMsg.To, emailMsg.Subject) // Using Subject as name
-	default:
-		// Generic email
-		return w.emailService.SendOTPEmail(emailMsg.To, emailMsg.Body)
+	// A failure here only risks a duplicate if the job is redelivered
+	if err := w.deliveryRepo.Record(&model.EmailDelivery{
+		IdempotencyKey: job.IdempotencyKey,
+		Type:           job.Type,
+		Recipient:      job.To,
+	}); err != nil {
+		log.Printf("Failed to record email delivery %s: %v", job.IdempotencyKey, err)
 	}
+	return nil
 }
 
-// Stop stops the email worker
-func (w *EmailWorker) Stop() {
+// waitForDomain blocks until the recipient's domain may receive another
+// email, or the worker stops
+func (w *EmailWorker) waitForDomain(to string) error {
+	if w.domainRate <= 0 {
+		return nil
+	}
+
+	domain := strings.ToLower(to[strings.LastIndex(to, "@")+1:])
+	w.domainMu.Lock()
+	limiter, ok := w.domainLimiters[domain]
+	if !ok {
+		limiter = rate.NewLimiter(w.domainRate, w.domainBurst)
+		w.domainLimiters[domain] = limiter
+	}
+	w.domainMu.Unlock()
+
+	if err := limiter.Wait(w.ctx); err != nil {
+		return errEmailWorkerStopping
+	}
+	return nil
+}
+
+// Stop stops consuming and waits up to the stop timeout for the emails being
+// sent. Jobs still waiting on a rate limit are requeued right away.
+func (w *EmailWorker) Stop() error {
 	log.Println("Stopping email worker...")
-	// Channel and connection will be closed by RabbitMQ client
+	w.cancel()
+	if w.consumer == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.stopTimeout)
+	defer cancel()
+	if err := w.consumer.Stop(ctx); err != nil {
+		return err
+	}
+
+	log.Println("Email worker stopped")
+	return nil
 }
@@ -0,0 +1,326 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"yourapp/internal/config"
+	"yourapp/internal/util"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// failingTransport fails every send, like an SMTP outage
+type failingTransport struct{}
+
+func (failingTransport) Send(*Email) error { return errors.New("connection refused") }
+
+func newTestEmailWorker(transport Transport) (*EmailWorker, *fakeEmailDeliveryRepo) {
+	cfg := &config.Config{ClientURL: "https://app.example.com", EmailFrom: "no-reply@example.com", EmailMaxAttempts: 3}
+	deliveries := &fakeEmailDeliveryRepo{}
+	w := NewEmailWorker(NewEmailServiceWithTransport(cfg, transport), deliveries, nil, NewWorkerMetrics(), cfg)
+	return w, deliveries
+}
+
+func emailDelivery(t *testing.T, job interface{}) amqp.Delivery {
+	t.Helper()
+	body, err := json.Marshal(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return amqp.Delivery{Body: body}
+}
+
+func TestEmailWorkerSendsJobOnce(t *testing.T) {
+	capture := NewCaptureTransport()
+	w, deliveries := newTestEmailWorker(capture)
+	job, err := util.NewEmailJob("ana@example.com", "en", util.OTPEmailData{Code: "123456", ExpiresMinutes: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := emailDelivery(t, job)
+
+	if err := w.processEmailMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+	// A redelivery of the same job is acknowledged without sending again
+	if err := w.processEmailMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+	if sent := capture.Emails(); len(sent) != 1 || sent[0].To[0] != "ana@example.com" {
+		t.Fatalf("sent = %+v", sent)
+	}
+	if len(deliveries.deliveries) != 1 || deliveries.deliveries[0].IdempotencyKey != job.IdempotencyKey {
+		t.Fatalf("deliveries = %+v", deliveries.deliveries)
+	}
+	if w.metrics.emailsSent.Load() != 1 || w.metrics.emailsSkipped.Load() != 1 {
+		t.Fatalf("sent %d, skipped %d", w.metrics.emailsSent.Load(), w.metrics.emailsSkipped.Load())
+	}
+}
+
+func TestEmailWorkerRejectsJobsItCannotSend(t *testing.T) {
+	capture := NewCaptureTransport()
+	w, _ := newTestEmailWorker(capture)
+
+	valid, _ := util.NewEmailJob("ana@example.com", "en", util.OTPEmailData{Code: "123456"})
+	unknown := *valid
+	unknown.Type = "newsletter"
+	future := *valid
+	future.Version = util.EmailJobVersion + 1
+
+	for name, job := range map[string]interface{}{
+		"unknown type":   unknown,
+		"future version": future,
+		// What the worker queued before jobs were versioned
+		"legacy message": map[string]string{"to": "ana@example.com", "subject": "Ana", "body": "123456", "type": "welcome"},
+	} {
+		// Rejected jobs go to the dead-letter queue instead of being retried
+		if err := w.processEmailMessage(emailDelivery(t, job)); !errors.Is(err, errRejectedEmailJob) {
+			t.Errorf("%s: err = %v, want a rejection", name, err)
+		}
+	}
+	if sent := capture.Emails(); len(sent) != 0 {
+		t.Fatalf("rejected jobs were sent: %+v", sent)
+	}
+}
+
+func TestEmailWorkerTransportFailureIsRetriable(t *testing.T) {
+	w, deliveries := newTestEmailWorker(failingTransport{})
+	job, _ := util.NewEmailJob("ana@example.com", "en", util.WelcomeEmailData{Name: "Ana"})
+
+	err := w.processEmailMessage(emailDelivery(t, job))
+	if err == nil || errors.Is(err, errRejectedEmailJob) {
+		t.Fatalf("err = %v, want a retriable failure", err)
+	}
+	if len(deliveries.deliveries) != 0 {
+		t.Fatal("failed send was recorded as delivered")
+	}
+}
+
+// fakeEmailQueue records the subscription, retries and dead letters of the worker
+type fakeEmailQueue struct {
+	emailQueue
+	publishErr  error
+	consumed    map[string]util.ConsumeOptions
+	retries     []int
+	deadLetters []string
+}
+
+func (q *fakeEmailQueue) Consume(queue string, opts util.ConsumeOptions, handle func(amqp.Delivery)) (*util.Consumer, error) {
+	if q.consumed == nil {
+		q.consumed = map[string]util.ConsumeOptions{}
+	}
+	q.consumed[queue] = opts
+	return nil, nil
+}
+
+func (q *fakeEmailQueue) PublishRetry(msg amqp.Delivery, retry int, reason string) (time.Duration, error) {
+	if q.publishErr != nil {
+		return 0, q.publishErr
+	}
+	q.retries = append(q.retries, retry)
+	return util.EmailRetryDelay(retry), nil
+}
+
+func (q *fakeEmailQueue) PublishDeadLetter(msg amqp.Delivery, reason string) error {
+	if q.publishErr != nil {
+		return q.publishErr
+	}
+	q.deadLetters = append(q.deadLetters, reason)
+	return nil
+}
+
+// fakeAcknowledger records how the worker settled a delivery
+type fakeAcknowledger struct {
+	acked, requeued bool
+}
+
+func (a *fakeAcknowledger) Ack(uint64, bool) error { a.acked = true; return nil }
+
+func (a *fakeAcknowledger) Nack(_ uint64, _ bool, requeue bool) error {
+	a.requeued = requeue
+	return nil
+}
+
+func (a *fakeAcknowledger) Reject(_ uint64, requeue bool) error {
+	a.requeued = requeue
+	return nil
+}
+
+// handle runs a delivery of job through the worker, after it has already
+// been retried the given number of times
+func handle(t *testing.T, w *EmailWorker, job interface{}, retried int) *fakeAcknowledger {
+	t.Helper()
+	ack := &fakeAcknowledger{}
+	msg := emailDelivery(t, job)
+	msg.Acknowledger = ack
+	if retried > 0 {
+		msg.Headers = amqp.Table{util.EmailRetryCountHeader: int32(retried)}
+	}
+	w.handleMessage(msg)
+	return ack
+}
+
+func TestEmailWorkerRetriesThenDeadLetters(t *testing.T) {
+	w, _ := newTestEmailWorker(failingTransport{})
+	queue := &fakeEmailQueue{}
+	w.rabbitMQ = queue
+	job, _ := util.NewEmailJob("ana@example.com", "en", util.WelcomeEmailData{Name: "Ana"})
+
+	// EmailMaxAttempts is 3: two retries, then the third failure gives up
+	for retried := 0; retried < 3; retried++ {
+		if ack := handle(t, w, job, retried); !ack.acked {
+			t.Fatalf("attempt %d was not acked", retried+1)
+		}
+	}
+	if len(queue.retries) != 2 || queue.retries[0] != 1 || queue.retries[1] != 2 {
+		t.Fatalf("retries = %v, want [1 2]", queue.retries)
+	}
+	if len(queue.deadLetters) != 1 || !strings.HasPrefix(queue.deadLetters[0], "gave up after 3 attempts: ") {
+		t.Fatalf("dead letters = %q", queue.deadLetters)
+	}
+	if w.metrics.emailsRetried.Load() != 2 || w.metrics.emailsDeadLettered.Load() != 1 {
+		t.Fatalf("retried %d, dead-lettered %d", w.metrics.emailsRetried.Load(), w.metrics.emailsDeadLettered.Load())
+	}
+}
+
+func TestEmailWorkerDeadLettersRejectedJobsRightAway(t *testing.T) {
+	w, _ := newTestEmailWorker(NewCaptureTransport())
+	queue := &fakeEmailQueue{}
+	w.rabbitMQ = queue
+	job, _ := util.NewEmailJob("ana@example.com", "en", util.OTPEmailData{Code: "123456"})
+	job.Type = "newsletter"
+
+	if ack := handle(t, w, job, 0); !ack.acked {
+		t.Fatal("rejected job was not acked")
+	}
+	if len(queue.retries) != 0 || len(queue.deadLetters) != 1 || !strings.HasPrefix(queue.deadLetters[0], errRejectedEmailJob.Error()) {
+		t.Fatalf("retries = %v, dead letters = %q", queue.retries, queue.deadLetters)
+	}
+}
+
+func TestEmailWorkerRequeuesWhenTheBrokerRefuses(t *testing.T) {
+	w, _ := newTestEmailWorker(failingTransport{})
+	w.rabbitMQ = &fakeEmailQueue{publishErr: errors.New("channel closed")}
+	job, _ := util.NewEmailJob("ana@example.com", "en", util.WelcomeEmailData{Name: "Ana"})
+
+	// Neither a retry nor a dead letter may be lost by acking the original
+	for _, retried := range []int{0, 2} {
+		if ack := handle(t, w, job, retried); ack.acked || !ack.requeued {
+			t.Fatalf("after %d retries: acked %v, requeued %v", retried, ack.acked, ack.requeued)
+		}
+	}
+	if w.metrics.emailsRequeued.Load() != 2 {
+		t.Fatalf("requeued %d", w.metrics.emailsRequeued.Load())
+	}
+}
+
+func TestEmailWorkerAcksSentJobs(t *testing.T) {
+	w, _ := newTestEmailWorker(NewCaptureTransport())
+	queue := &fakeEmailQueue{}
+	w.rabbitMQ = queue
+	job, _ := util.NewEmailJob("ana@example.com", "en", util.WelcomeEmailData{Name: "Ana"})
+
+	if ack := handle(t, w, job, 0); !ack.acked || len(queue.retries) != 0 || len(queue.deadLetters) != 0 {
+		t.Fatalf("acked %v, retries %v, dead letters %q", ack.acked, queue.retries, queue.deadLetters)
+	}
+}
+
+func TestEmailWorkerStartsHandlerPool(t *testing.T) {
+	cfg := &config.Config{EmailWorkerPrefetch: 20, EmailWorkerConcurrency: 5, EmailWorkerStopTimeoutSeconds: 1}
+	w := NewEmailWorker(NewEmailServiceWithTransport(cfg, NewCaptureTransport()), &fakeEmailDeliveryRepo{}, nil, nil, cfg)
+	queue := &fakeEmailQueue{}
+	w.rabbitMQ = queue
+
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if opts := queue.consumed[util.EmailQueueName]; opts.Prefetch != 20 || opts.Concurrency != 5 {
+		t.Fatalf("consumed %v", queue.consumed)
+	}
+	if err := w.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEmailWorkerLimitsSendsPerDomain(t *testing.T) {
+	// Six a minute allows a burst of one
+	cfg := &config.Config{EmailDomainRatePerMinute: 6}
+	w := NewEmailWorker(NewEmailServiceWithTransport(cfg, NewCaptureTransport()), &fakeEmailDeliveryRepo{}, nil, nil, cfg)
+
+	for _, to := range []string{"ana@example.com", "bob@other.example"} {
+		if err := w.waitForDomain(to); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The domain is matched case-insensitively
+	waited := make(chan error, 1)
+	go func() { waited <- w.waitForDomain("cy@EXAMPLE.com") }()
+	select {
+	case err := <-waited:
+		t.Fatalf("second send to the domain was not limited: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Stop releases the waiting send
+	w.Stop()
+	select {
+	case err := <-waited:
+		if !errors.Is(err, errEmailWorkerStopping) {
+			t.Fatalf("err = %v, want errEmailWorkerStopping", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Stop did not release the rate-limited send")
+	}
+}
+
+func TestEmailWorkerWithoutDomainLimit(t *testing.T) {
+	cfg := &config.Config{}
+	w := NewEmailWorker(NewEmailServiceWithTransport(cfg, NewCaptureTransport()), &fakeEmailDeliveryRepo{}, nil, nil, cfg)
+	for i := 0; i < 100; i++ {
+		if err := w.waitForDomain("ana@example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestEmailWorkerRequeuesJobsInterruptedByStop(t *testing.T) {
+	capture := NewCaptureTransport()
+	cfg := &config.Config{ClientURL: "https://app.example.com", EmailFrom: "no-reply@example.com", EmailMaxAttempts: 3, EmailDomainRatePerMinute: 6}
+	w := NewEmailWorker(NewEmailServiceWithTransport(cfg, capture), &fakeEmailDeliveryRepo{}, nil, NewWorkerMetrics(), cfg)
+	queue := &fakeEmailQueue{}
+	w.rabbitMQ = queue
+
+	first, _ := util.NewEmailJob("ana@example.com", "en", util.WelcomeEmailData{Name: "Ana"})
+	if ack := handle(t, w, first, 0); !ack.acked {
+		t.Fatal("first email was not acked")
+	}
+
+	second, _ := util.NewEmailJob("bob@example.com", "en", util.WelcomeEmailData{Name: "Bob"})
+	settled := make(chan *fakeAcknowledger, 1)
+	go func() { settled <- handle(t, w, second, 0) }()
+	deadline := time.Now().Add(time.Second)
+	for w.metrics.emailsInFlight.Load() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("second email is not in flight")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	w.Stop()
+	ack := <-settled
+	// Requeued as is: the interruption does not count as a failed attempt
+	if ack.acked || !ack.requeued || len(queue.retries) != 0 || len(queue.deadLetters) != 0 {
+		t.Fatalf("acked %v, requeued %v, retries %v, dead letters %q", ack.acked, ack.requeued, queue.retries, queue.deadLetters)
+	}
+	if len(capture.Emails()) != 1 {
+		t.Fatalf("sent %d emails, want only the first", len(capture.Emails()))
+	}
+	if w.metrics.emailsInFlight.Load() != 0 || w.metrics.emailsRequeued.Load() != 1 {
+		t.Fatalf("in flight %d, requeued %d", w.metrics.emailsInFlight.Load(), w.metrics.emailsRequeued.Load())
+	}
+}
@@ -0,0 +1,984 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"yourapp/internal/config"
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// In-memory repositories for service tests. Each fake embeds its interface so
+// a test only implements the methods the code under test calls; anything
+// else panics on the nil embedded value.
+
+type fakeUserRepo struct {
+	repository.UserRepository
+	mu     sync.Mutex
+	users  map[string]*model.User
+	outbox []*model.OutboxMessage // Messages committed along with a user change
+}
+
+func newFakeUserRepo(users ...*model.User) *fakeUserRepo {
+	r := &fakeUserRepo{users: make(map[string]*model.User)}
+	for _, user := range users {
+		r.Create(user)
+	}
+	return r
+}
+
+func (r *fakeUserRepo) Create(user *model.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if user.ID == "" {
+		user.ID = uuid.New().String()
+	}
+	for _, existing := range r.users {
+		if strings.EqualFold(existing.Email, user.Email) {
+			return errors.New("duplicate email")
+		}
+	}
+	r.users[user.ID] = user
+	return nil
+}
+
+func (r *fakeUserRepo) CreateWithOutbox(user *model.User, messages ...*model.OutboxMessage) error {
+	if err := r.Create(user); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.outbox = append(r.outbox, messages...)
+	return nil
+}
+
+func (r *fakeUserRepo) FindByID(id string) (*model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if user, ok := r.users[id]; ok {
+		return user, nil
+	}
+	return nil, errors.New("user not found")
+}
+
+func (r *fakeUserRepo) FindByEmail(email string) (*model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.users {
+		if strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return nil, errors.New("user not found")
+}
+
+func (r *fakeUserRepo) FindByUsername(username string) (*model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.users {
+		if user.Username != nil && *user.Username == username {
+			return user, nil
+		}
+	}
+	return nil, errors.New("user not found")
+}
+
+func (r *fakeUserRepo) Update(user *model.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.users[user.ID] = user
+	return nil
+}
+
+func (r *fakeUserRepo) UpdateLastLogin(userID string) error {
+	return nil
+}
+
+func (r *fakeUserRepo) SetActive(userID string, active bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[userID]
+	if !ok {
+		return errors.New("user not found")
+	}
+	user.IsActive = active
+	return nil
+}
+
+type fakeSessionRepo struct {
+	repository.SessionRepository
+	mu       sync.Mutex
+	sessions map[string]*model.Session
+}
+
+func newFakeSessionRepo() *fakeSessionRepo {
+	return &fakeSessionRepo{sessions: make(map[string]*model.Session)}
+}
+
+func (r *fakeSessionRepo) Create(session *model.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if session.ID == "" {
+		session.ID = uuid.New().String()
+	}
+	r.sessions[session.ID] = session
+	return nil
+}
+
+func (r *fakeSessionRepo) FindByID(id string) (*model.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if session, ok := r.sessions[id]; ok {
+		return session, nil
+	}
+	return nil, errors.New("session not found")
+}
+
+func (r *fakeSessionRepo) FindByUserID(userID string) ([]model.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sessions := []model.Session{}
+	for _, session := range r.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, *session)
+		}
+	}
+	return sessions, nil
+}
+
+func (r *fakeSessionRepo) Touch(id string, expiresAt time.Time) error {
+	return nil
+}
+
+func (r *fakeSessionRepo) Revoke(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if session, ok := r.sessions[id]; ok && session.RevokedAt == nil {
+		now := time.Now()
+		session.RevokedAt = &now
+	}
+	return nil
+}
+
+func (r *fakeSessionRepo) RevokeAllByUserID(userID string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var revoked int64
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			now := time.Now()
+			session.RevokedAt = &now
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+type fakeAuditRepo struct {
+	repository.AuditRepository
+	events    []model.AuditEvent
+	err       error
+	lastQuery repository.AuditFilter
+}
+
+func (r *fakeAuditRepo) Create(event *model.AuditEvent) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.events = append(r.events, *event)
+	return nil
+}
+
+func (r *fakeAuditRepo) List(filter repository.AuditFilter) ([]model.AuditEvent, int64, error) {
+	r.lastQuery = filter
+	return r.events, int64(len(r.events)), nil
+}
+
+func (r *fakeAuditRepo) FindByTargetUserID(userID string, limit int) ([]model.AuditEvent, error) {
+	events := []model.AuditEvent{}
+	for _, event := range r.events {
+		if event.TargetUserID != nil && *event.TargetUserID == userID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// fakeAuditLogger keeps logged events so tests can assert on them
+type fakeAuditLogger struct {
+	AuditLogger
+	mu     sync.Mutex
+	events []loggedAuditEvent
+}
+
+type loggedAuditEvent struct {
+	Action       string
+	Meta         RequestMeta
+	TargetUserID string
+	Metadata     model.JSONMap
+}
+
+func (l *fakeAuditLogger) Log(action string, meta RequestMeta, targetUserID string, metadata model.JSONMap) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, loggedAuditEvent{Action: action, Meta: meta, TargetUserID: targetUserID, Metadata: metadata})
+}
+
+// find returns the last event logged with the action
+func (l *fakeAuditLogger) find(action string) (loggedAuditEvent, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := len(l.events) - 1; i >= 0; i-- {
+		if l.events[i].Action == action {
+			return l.events[i], true
+		}
+	}
+	return loggedAuditEvent{}, false
+}
+
+type fakeEmailDeliveryRepo struct {
+	mu         sync.Mutex
+	deliveries []model.EmailDelivery
+}
+
+func (r *fakeEmailDeliveryRepo) Exists(idempotencyKey string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, delivery := range r.deliveries {
+		if delivery.IdempotencyKey == idempotencyKey {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *fakeEmailDeliveryRepo) Record(delivery *model.EmailDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deliveries = append(r.deliveries, *delivery)
+	return nil
+}
+
+func (r *fakeEmailDeliveryRepo) FindByRecipient(recipient string) ([]model.EmailDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	deliveries := []model.EmailDelivery{}
+	for _, delivery := range r.deliveries {
+		if strings.EqualFold(delivery.Recipient, recipient) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+func (r *fakeUserRepo) FindByGoogleID(googleID string) (*model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.users {
+		if user.GoogleID != nil && *user.GoogleID == googleID {
+			return user, nil
+		}
+	}
+	return nil, errors.New("user not found")
+}
+
+func (r *fakeUserRepo) UpdateUserType(userID string, userType string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if user, ok := r.users[userID]; ok {
+		user.UserType = userType
+	}
+	return nil
+}
+
+func (r *fakeUserRepo) UpdateOTPWithOutbox(email string, otpCode string, expiresAt time.Time, messages ...*model.OutboxMessage) error {
+	user, err := r.FindByEmail(email)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user.OTPCode = &otpCode
+	user.OTPExpiresAt = &expiresAt
+	r.outbox = append(r.outbox, messages...)
+	return nil
+}
+
+func (r *fakeUserRepo) VerifyOTP(email string, otpCode string) (*model.User, error) {
+	user, err := r.FindByEmail(email)
+	if err != nil {
+		return nil, errors.New("invalid or expired OTP")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if user.OTPCode == nil || *user.OTPCode != otpCode || user.OTPExpiresAt.Before(time.Now()) {
+		return nil, errors.New("invalid or expired OTP")
+	}
+	user.OTPCode = nil
+	user.OTPExpiresAt = nil
+	user.IsVerified = true
+	return user, nil
+}
+
+// fakeRoleRepo keeps roles and user-role grants in memory
+type fakeRoleRepo struct {
+	mu        sync.Mutex
+	roles     map[string]*model.Role // by name
+	userRoles map[string][]string    // user ID to role names
+}
+
+func newFakeRoleRepo() *fakeRoleRepo {
+	return &fakeRoleRepo{roles: make(map[string]*model.Role), userRoles: make(map[string][]string)}
+}
+
+func (r *fakeRoleRepo) FindAll() ([]model.Role, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	roles := []model.Role{}
+	for _, role := range r.roles {
+		roles = append(roles, *role)
+	}
+	return roles, nil
+}
+
+func (r *fakeRoleRepo) FindByName(name string) (*model.Role, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if role, ok := r.roles[name]; ok {
+		return role, nil
+	}
+	return nil, errors.New("record not found")
+}
+
+func (r *fakeRoleRepo) FindByUserID(userID string) ([]model.Role, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	roles := []model.Role{}
+	for _, name := range r.userRoles[userID] {
+		roles = append(roles, *r.roles[name])
+	}
+	return roles, nil
+}
+
+func (r *fakeRoleRepo) FindPermissionNamesByRoleNames(roleNames []string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seen := map[string]bool{}
+	names := []string{}
+	for _, roleName := range roleNames {
+		role, ok := r.roles[roleName]
+		if !ok {
+			continue
+		}
+		for _, perm := range role.Permissions {
+			if !seen[perm.Name] {
+				seen[perm.Name] = true
+				names = append(names, perm.Name)
+			}
+		}
+	}
+	return names, nil
+}
+
+func (r *fakeRoleRepo) EnsureRole(name, description string, permissions []string) (*model.Role, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	role, ok := r.roles[name]
+	if !ok {
+		role = &model.Role{ID: "role-" + name, Name: name, Description: description}
+		r.roles[name] = role
+	}
+	for _, perm := range permissions {
+		role.Permissions = append(role.Permissions, model.Permission{Name: perm})
+	}
+	return role, nil
+}
+
+func (r *fakeRoleRepo) roleName(roleID string) string {
+	for name, role := range r.roles {
+		if role.ID == roleID {
+			return name
+		}
+	}
+	return ""
+}
+
+func (r *fakeRoleRepo) SetUserRoles(userID string, roleIDs []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := []string{}
+	for _, id := range roleIDs {
+		name := r.roleName(id)
+		// user_roles is keyed by user and role
+		for _, existing := range names {
+			if existing == name {
+				return errors.New("duplicate key value violates unique constraint")
+			}
+		}
+		names = append(names, name)
+	}
+	r.userRoles[userID] = names
+	return nil
+}
+
+func (r *fakeRoleRepo) AddUserRole(userID, roleID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	name := r.roleName(roleID)
+	for _, existing := range r.userRoles[userID] {
+		if existing == name {
+			return nil
+		}
+	}
+	r.userRoles[userID] = append(r.userRoles[userID], name)
+	return nil
+}
+
+func (r *fakeRoleRepo) ResetLegacyUserTypes() (int64, error) {
+	return 0, nil
+}
+
+// hasRole reports whether the user was granted the role
+func (r *fakeRoleRepo) hasRole(userID, name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.userRoles[userID] {
+		if existing == name {
+			return true
+		}
+	}
+	return false
+}
+
+// newTestRBAC returns an RBAC service with the built-in roles seeded
+func newTestRBAC(userRepo repository.UserRepository, cfg *config.Config) (RBACService, *fakeRoleRepo) {
+	roleRepo := newFakeRoleRepo()
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	rbac := NewRBACService(roleRepo, userRepo, cfg)
+	if err := rbac.SeedDefaults(); err != nil {
+		panic(err)
+	}
+	return rbac, roleRepo
+}
+
+// fakeOrgRepo keeps organizations, memberships and invitations in memory and
+// remembers the outbox messages written with invitations
+type fakeOrgRepo struct {
+	repository.OrganizationRepository
+	mu          sync.Mutex
+	orgs        map[string]*model.Organization
+	memberships []*model.Membership
+	invitations map[string]*model.Invitation
+	domains     []*model.OrganizationDomain
+	outbox      []*model.OutboxMessage
+}
+
+func newFakeOrgRepo() *fakeOrgRepo {
+	return &fakeOrgRepo{orgs: make(map[string]*model.Organization), invitations: make(map[string]*model.Invitation)}
+}
+
+func (r *fakeOrgRepo) CreateWithOwner(org *model.Organization, ownerID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if org.ID == "" {
+		org.ID = uuid.New().String()
+	}
+	r.orgs[org.ID] = org
+	r.memberships = append(r.memberships, &model.Membership{ID: uuid.New().String(), OrganizationID: org.ID, UserID: ownerID, Role: model.OrgRoleOwner})
+	return nil
+}
+
+func (r *fakeOrgRepo) FindByID(id string) (*model.Organization, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if org, ok := r.orgs[id]; ok {
+		return org, nil
+	}
+	return nil, errors.New("record not found")
+}
+
+func (r *fakeOrgRepo) FindBySlug(slug string) (*model.Organization, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, org := range r.orgs {
+		if org.Slug == slug {
+			return org, nil
+		}
+	}
+	return nil, errors.New("record not found")
+}
+
+func (r *fakeOrgRepo) FindMembership(orgID, userID string) (*model.Membership, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, membership := range r.memberships {
+		if membership.OrganizationID == orgID && membership.UserID == userID {
+			copied := *membership
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("record not found")
+}
+
+func (r *fakeOrgRepo) FindMembershipsByUserID(userID string) ([]model.Membership, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var memberships []model.Membership
+	for _, membership := range r.memberships {
+		if membership.UserID == userID {
+			memberships = append(memberships, *membership)
+		}
+	}
+	return memberships, nil
+}
+
+func (r *fakeOrgRepo) UpdateMembershipRole(orgID, userID, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, membership := range r.memberships {
+		if membership.OrganizationID == orgID && membership.UserID == userID {
+			membership.Role = role
+		}
+	}
+	return nil
+}
+
+func (r *fakeOrgRepo) CreateMembership(membership *model.Membership) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if membership.ID == "" {
+		membership.ID = uuid.New().String()
+	}
+	r.memberships = append(r.memberships, membership)
+	return nil
+}
+
+func (r *fakeOrgRepo) DeleteMembership(orgID, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, membership := range r.memberships {
+		if membership.OrganizationID == orgID && membership.UserID == userID {
+			r.memberships = append(r.memberships[:i], r.memberships[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *fakeOrgRepo) CreateInvitationWithOutbox(invitation *model.Invitation, messages ...*model.OutboxMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.invitations[invitation.ID] = invitation
+	r.outbox = append(r.outbox, messages...)
+	return nil
+}
+
+func (r *fakeOrgRepo) FindInvitationByID(id string) (*model.Invitation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	invitation, ok := r.invitations[id]
+	if !ok {
+		return nil, errors.New("record not found")
+	}
+	copied := *invitation
+	copied.Organization = r.orgs[invitation.OrganizationID]
+	return &copied, nil
+}
+
+func (r *fakeOrgRepo) DeletePendingInvitations(orgID, email string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, invitation := range r.invitations {
+		if invitation.OrganizationID == orgID && strings.EqualFold(invitation.Email, email) && invitation.AcceptedAt == nil {
+			delete(r.invitations, id)
+		}
+	}
+	return nil
+}
+
+func (r *fakeOrgRepo) AcceptInvitation(invitation *model.Invitation, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.invitations[invitation.ID]
+	if !ok || stored.AcceptedAt != nil {
+		return errors.New("record not found")
+	}
+	now := time.Now()
+	stored.AcceptedAt = &now
+	r.memberships = append(r.memberships, &model.Membership{ID: uuid.New().String(), OrganizationID: invitation.OrganizationID, UserID: userID, Role: invitation.Role})
+	return nil
+}
+
+func (r *fakeOrgRepo) CreateDomain(domain *model.OrganizationDomain) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if domain.ID == "" {
+		domain.ID = uuid.New().String()
+	}
+	r.domains = append(r.domains, domain)
+	return nil
+}
+
+func (r *fakeOrgRepo) FindDomain(orgID, domain string) (*model.OrganizationDomain, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range r.domains {
+		if d.OrganizationID == orgID && d.Domain == domain {
+			copied := *d
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("record not found")
+}
+
+func (r *fakeOrgRepo) FindDomainsByOrgID(orgID string) ([]model.OrganizationDomain, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	domains := []model.OrganizationDomain{}
+	for _, d := range r.domains {
+		if d.OrganizationID == orgID {
+			domains = append(domains, *d)
+		}
+	}
+	return domains, nil
+}
+
+func (r *fakeOrgRepo) FindVerifiedDomain(domain string) (*model.OrganizationDomain, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range r.domains {
+		if d.Domain == domain && d.VerifiedAt != nil {
+			copied := *d
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("record not found")
+}
+
+func (r *fakeOrgRepo) MarkDomainVerified(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for _, d := range r.domains {
+		if d.ID == id {
+			d.VerifiedAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *fakeOrgRepo) DeleteDomain(orgID, domain string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, d := range r.domains {
+		if d.OrganizationID == orgID && d.Domain == domain {
+			r.domains = append(r.domains[:i], r.domains[i+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// verifyDomain records the domain as verified by the organization
+func (r *fakeOrgRepo) verifyDomain(orgID, domain string) {
+	now := time.Now()
+	r.CreateDomain(&model.OrganizationDomain{OrganizationID: orgID, Domain: domain, VerificationToken: "token", VerifiedAt: &now})
+}
+
+// fakeSCIMRepo answers member queries from the org and user fakes. Users are
+// copied like a fresh database load, so unsaved changes do not leak.
+type fakeSCIMRepo struct {
+	repository.SCIMRepository
+	orgRepo  *fakeOrgRepo
+	userRepo *fakeUserRepo
+}
+
+func (r *fakeSCIMRepo) FindMember(orgID, userID string) (*model.Membership, error) {
+	membership, err := r.orgRepo.FindMembership(orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := r.userRepo.FindByID(userID)
+	if err != nil || user.LoginType != model.LoginTypeSAML {
+		return nil, errors.New("record not found")
+	}
+	copied := *user
+	membership.User = &copied
+	return membership, nil
+}
+
+func (r *fakeSCIMRepo) FindMembersByRole(orgID, role string) ([]model.Membership, error) {
+	r.orgRepo.mu.Lock()
+	var ids []string
+	for _, membership := range r.orgRepo.memberships {
+		if membership.OrganizationID == orgID && membership.Role == role {
+			ids = append(ids, membership.UserID)
+		}
+	}
+	r.orgRepo.mu.Unlock()
+
+	var memberships []model.Membership
+	for _, id := range ids {
+		if membership, err := r.FindMember(orgID, id); err == nil {
+			memberships = append(memberships, *membership)
+		}
+	}
+	return memberships, nil
+}
+
+type fakeAPIKeyRepo struct {
+	repository.APIKeyRepository
+	mu      sync.Mutex
+	keys    map[string]*model.APIKey // by ID
+	touches int
+}
+
+func newFakeAPIKeyRepo() *fakeAPIKeyRepo {
+	return &fakeAPIKeyRepo{keys: make(map[string]*model.APIKey)}
+}
+
+func (r *fakeAPIKeyRepo) Create(key *model.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if key.ID == "" {
+		key.ID = uuid.New().String()
+	}
+	r.keys[key.ID] = key
+	return nil
+}
+
+func (r *fakeAPIKeyRepo) FindByPrefix(prefix string) (*model.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range r.keys {
+		if key.Prefix == prefix {
+			copied := *key
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("record not found")
+}
+
+func (r *fakeAPIKeyRepo) CountActiveByUserID(userID string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var active int64
+	for _, key := range r.keys {
+		if key.UserID == userID && key.IsActive() {
+			active++
+		}
+	}
+	return active, nil
+}
+
+func (r *fakeAPIKeyRepo) Touch(id, ipAddress string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.keys[id].LastUsedAt = &now
+	r.touches++
+	return nil
+}
+
+func (r *fakeAPIKeyRepo) Revoke(id, userID string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key, ok := r.keys[id]
+	if !ok || key.UserID != userID || key.RevokedAt != nil {
+		return 0, nil
+	}
+	now := time.Now()
+	key.RevokedAt = &now
+	return 1, nil
+}
+
+// fakeOAuthRepo keeps clients, codes and consents in memory
+type fakeOAuthRepo struct {
+	mu          sync.Mutex
+	clients     map[string]*model.OAuthClient // by client ID
+	codes       map[string]*model.OAuthAuthorizationCode
+	deviceCodes map[string]*model.OAuthDeviceCode
+	consents    map[string]*model.OAuthConsent // by user and client ID
+}
+
+func newFakeOAuthRepo() *fakeOAuthRepo {
+	return &fakeOAuthRepo{
+		clients:     make(map[string]*model.OAuthClient),
+		codes:       make(map[string]*model.OAuthAuthorizationCode),
+		deviceCodes: make(map[string]*model.OAuthDeviceCode),
+		consents:    make(map[string]*model.OAuthConsent),
+	}
+}
+
+func (r *fakeOAuthRepo) CreateClient(client *model.OAuthClient) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if client.ID == "" {
+		client.ID = uuid.New().String()
+	}
+	r.clients[client.ClientID] = client
+	return nil
+}
+
+func (r *fakeOAuthRepo) FindClientByClientID(clientID string) (*model.OAuthClient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if client, ok := r.clients[clientID]; ok {
+		return client, nil
+	}
+	return nil, errors.New("record not found")
+}
+
+func (r *fakeOAuthRepo) ListClients() ([]model.OAuthClient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	clients := []model.OAuthClient{}
+	for _, client := range r.clients {
+		clients = append(clients, *client)
+	}
+	return clients, nil
+}
+
+func (r *fakeOAuthRepo) DeleteClient(clientID string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.clients[clientID]; !ok {
+		return 0, nil
+	}
+	delete(r.clients, clientID)
+	return 1, nil
+}
+
+func (r *fakeOAuthRepo) CreateCode(code *model.OAuthAuthorizationCode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if code.ID == "" {
+		code.ID = uuid.New().String()
+	}
+	code.CreatedAt = time.Now()
+	r.codes[code.ID] = code
+	return nil
+}
+
+func (r *fakeOAuthRepo) FindCodeByHash(codeHash string) (*model.OAuthAuthorizationCode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, code := range r.codes {
+		if code.CodeHash == codeHash {
+			copied := *code
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("record not found")
+}
+
+func (r *fakeOAuthRepo) MarkCodeUsed(id string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	code, ok := r.codes[id]
+	if !ok || code.UsedAt != nil {
+		return 0, nil
+	}
+	now := time.Now()
+	code.UsedAt = &now
+	return 1, nil
+}
+
+func (r *fakeOAuthRepo) SetCodeSession(id, sessionID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.codes[id].SessionID = &sessionID
+	return nil
+}
+
+func (r *fakeOAuthRepo) CreateDeviceCode(code *model.OAuthDeviceCode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if code.ID == "" {
+		code.ID = uuid.New().String()
+	}
+	r.deviceCodes[code.ID] = code
+	return nil
+}
+
+func (r *fakeOAuthRepo) FindDeviceCodeByHash(deviceCodeHash string) (*model.OAuthDeviceCode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, code := range r.deviceCodes {
+		if code.DeviceCodeHash == deviceCodeHash {
+			copied := *code
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("record not found")
+}
+
+func (r *fakeOAuthRepo) FindDeviceCodeByUserCode(userCode string) (*model.OAuthDeviceCode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, code := range r.deviceCodes {
+		if code.UserCode == userCode {
+			copied := *code
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("record not found")
+}
+
+func (r *fakeOAuthRepo) DecideDeviceCode(code *model.OAuthDeviceCode) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.deviceCodes[code.ID]
+	if !ok || stored.Status != model.DeviceCodePending {
+		return 0, nil
+	}
+	stored.Status = code.Status
+	stored.UserID = code.UserID
+	stored.Scopes = code.Scopes
+	stored.DecidedAt = code.DecidedAt
+	return 1, nil
+}
+
+func (r *fakeOAuthRepo) RecordDevicePoll(id string, interval int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.deviceCodes[id].LastPolledAt = &now
+	r.deviceCodes[id].Interval = interval
+	return nil
+}
+
+func (r *fakeOAuthRepo) ConsumeDeviceCode(id string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	code, ok := r.deviceCodes[id]
+	if !ok || code.ConsumedAt != nil {
+		return 0, nil
+	}
+	now := time.Now()
+	code.ConsumedAt = &now
+	return 1, nil
+}
+
+func (r *fakeOAuthRepo) FindConsent(userID, clientID string) (*model.OAuthConsent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if consent, ok := r.consents[userID+"/"+clientID]; ok {
+		return consent, nil
+	}
+	return nil, errors.New("record not found")
+}
+
+func (r *fakeOAuthRepo) SaveConsent(consent *model.OAuthConsent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.consents[consent.UserID+"/"+consent.ClientID] = consent
+	return nil
+}
@@ -0,0 +1,1219 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"yourapp/internal/config"
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+	"yourapp/internal/util"
+)
+
+type OIDCService interface {
+	Discovery() map[string]interface{}
+	JWKS() map[string]interface{}
+	StartAuthorization(req AuthorizeRequest, rawQuery string) (string, error)
+	GetConsent(userID string, req AuthorizeRequest) (*ConsentDetails, error)
+	Authorize(userID string, req AuthorizeRequest, approved bool, meta RequestMeta) (string, error)
+	Token(req TokenRequest, meta RequestMeta) (*TokenResponse, error)
+	UserInfo(userID string, scopes []string) (map[string]interface{}, error)
+	DeviceAuthorization(req DeviceAuthorizationRequest) (*DeviceAuthorizationResponse, error)
+	GetDeviceConsent(userID, userCode string) (*ConsentDetails, error)
+	DecideDevice(userID, userCode string, approved bool, meta RequestMeta) error
+	Introspect(req TokenActionRequest) (*IntrospectionResponse, error)
+	Revoke(req TokenActionRequest, meta RequestMeta) error
+	CreateClient(req CreateOAuthClientRequest, grantedPermissions []string, meta RequestMeta) (*CreateOAuthClientResponse, error)
+	ListClients() ([]model.OAuthClient, error)
+	DeleteClient(clientID string, meta RequestMeta) error
+}
+
+const (
+	// authorizationCodeTTL keeps codes short-lived as recommended by RFC 6749
+	authorizationCodeTTL = 5 * time.Minute
+	// idTokenTTL matches the access token lifetime
+	idTokenTTL = 15 * time.Minute
+	// defaultClientTokenTTL applies to client credentials tokens unless the client sets its own
+	defaultClientTokenTTL = 15 * time.Minute
+	maxClientTokenTTL     = 24 * time.Hour
+	// deviceCodeTTL is how long the user has to enter a device's user code
+	deviceCodeTTL = 10 * time.Minute
+	// deviceCodeInterval is the initial polling interval in seconds; each
+	// slow_down adds deviceCodeSlowDown to it (RFC 8628 section 3.5)
+	deviceCodeInterval = 5
+	deviceCodeSlowDown = 5
+	// userCodeAlphabet avoids vowels and look-alike characters
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+)
+
+// supportedGrantTypes are the grant types the token endpoint implements
+var supportedGrantTypes = []string{
+	model.GrantTypeAuthorizationCode,
+	model.GrantTypeRefreshToken,
+	model.GrantTypeClientCredentials,
+	model.GrantTypeDeviceCode,
+}
+
+// OAuthError is an OAuth 2.0 error response (RFC 6749 section 5.2)
+type OAuthError struct {
+	Status      int    `json:"-"`
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func newOAuthError(status int, code, description string) *OAuthError {
+	return &OAuthError{Status: status, Code: code, Description: description}
+}
+
+// AuthorizeRequest holds the authorization request parameters; the consent
+// page posts them back unchanged
+type AuthorizeRequest struct {
+	ResponseType        string `form:"response_type" json:"response_type"`
+	ClientID            string `form:"client_id" json:"client_id"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	Nonce               string `form:"nonce" json:"nonce"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+}
+
+// ConsentDetails is what the consent page shows the user
+type ConsentDetails struct {
+	ClientID        string   `json:"client_id"`
+	ClientName      string   `json:"client_name"`
+	Scopes          []string `json:"scopes"`
+	ConsentRequired bool     `json:"consent_required"`
+}
+
+type TokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	DeviceCode   string `form:"device_code"`
+	Scope        string `form:"scope"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+type DeviceAuthorizationRequest struct {
+	Scope        string `form:"scope"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+// DeviceAuthorizationResponse tells the device what to show the user (RFC 8628 section 3.2)
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// TokenActionRequest is the body of the introspection and revocation endpoints
+type TokenActionRequest struct {
+	Token         string `form:"token"`
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+// IntrospectionResponse describes a token (RFC 7662 section 2.2). Inactive
+// tokens only carry Active.
+type IntrospectionResponse struct {
+	Active      bool     `json:"active"`
+	Scope       string   `json:"scope,omitempty"`
+	ClientID    string   `json:"client_id,omitempty"`
+	Username    string   `json:"username,omitempty"`
+	TokenType   string   `json:"token_type,omitempty"`
+	ExpiresAt   int64    `json:"exp,omitempty"`
+	IssuedAt    int64    `json:"iat,omitempty"`
+	Subject     string   `json:"sub,omitempty"`
+	Issuer      string   `json:"iss,omitempty"`
+	SessionID   string   `json:"sid,omitempty"`
+	OrgID       string   `json:"org_id,omitempty"`
+	UserType    string   `json:"role,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	Actor       string   `json:"act,omitempty"`
+}
+
+type CreateOAuthClientRequest struct {
+	Name          string   `json:"name" binding:"required,max=255"`
+	RedirectURIs  []string `json:"redirect_uris,omitempty"`
+	AllowedScopes []string `json:"allowed_scopes,omitempty"`
+	GrantTypes    []string `json:"grant_types,omitempty"`
+	IsPublic      bool     `json:"is_public"`
+	TokenTTL      int      `json:"token_ttl,omitempty"` // seconds, client credentials only
+}
+
+// CreateOAuthClientResponse carries the client secret, which is only shown once
+type CreateOAuthClientResponse struct {
+	Client       *model.OAuthClient `json:"client"`
+	ClientSecret string             `json:"client_secret,omitempty"`
+}
+
+type oidcService struct {
+	oauthRepo     repository.OAuthRepository
+	userRepo      repository.UserRepository
+	sessionRepo   repository.SessionRepository
+	authService   AuthService
+	apiKeyService APIKeyService
+	rbacService   RBACService
+	auditLogger   AuditLogger
+	signingKey    *util.SigningKey
+	config        *config.Config
+}
+
+func NewOIDCService(oauthRepo repository.OAuthRepository, userRepo repository.UserRepository, sessionRepo repository.SessionRepository, authService AuthService, apiKeyService APIKeyService, rbacService RBACService, auditLogger AuditLogger, signingKey *util.SigningKey, cfg *config.Config) OIDCService {
+	return &oidcService{
+		oauthRepo:     oauthRepo,
+		userRepo:      userRepo,
+		sessionRepo:   sessionRepo,
+		authService:   authService,
+		apiKeyService: apiKeyService,
+		rbacService:   rbacService,
+		auditLogger:   auditLogger,
+		signingKey:    signingKey,
+		config:        cfg,
+	}
+}
+
+func (s *oidcService) Discovery() map[string]interface{} {
+	issuer := s.config.OIDCIssuer
+	return map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/oauth/authorize",
+		"token_endpoint":                        issuer + "/oauth/token",
+		"userinfo_endpoint":                     issuer + "/oauth/userinfo",
+		"jwks_uri":                              issuer + "/oauth/jwks",
+		"introspection_endpoint":                issuer + "/oauth/introspect",
+		"revocation_endpoint":                   issuer + "/oauth/revoke",
+		"device_authorization_endpoint":         issuer + "/oauth/device/code",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      append(append([]string{}, model.OIDCScopes...), model.UserScopes...),
+		"grant_types_supported":                 supportedGrantTypes,
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256", "plain"},
+		"claims_supported":                      []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "email", "email_verified", "name", "picture"},
+	}
+}
+
+func (s *oidcService) JWKS() map[string]interface{} {
+	return map[string]interface{}{
+		"keys": []util.JWK{s.signingKey.PublicJWK()},
+	}
+}
+
+// validateClientRedirect checks the parts of an authorization request that
+// must be valid before we may redirect back to the client
+func (s *oidcService) validateClientRedirect(req AuthorizeRequest) (*model.OAuthClient, error) {
+	if req.ClientID == "" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "client_id is required")
+	}
+
+	client, err := s.oauthRepo.FindClientByClientID(req.ClientID)
+	if err != nil {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_client", "unknown client")
+	}
+
+	if req.RedirectURI == "" || !client.AllowsRedirectURI(req.RedirectURI) {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "redirect_uri is not registered for this client")
+	}
+
+	return client, nil
+}
+
+// validateAuthorizeRequest checks the remaining parameters; its errors can be
+// reported to the client through the redirect URI
+func (s *oidcService) validateAuthorizeRequest(client *model.OAuthClient, req AuthorizeRequest) ([]string, *OAuthError) {
+	if req.ResponseType != "code" {
+		return nil, newOAuthError(http.StatusBadRequest, "unsupported_response_type", "only the code response type is supported")
+	}
+
+	if !client.AllowsGrant(model.GrantTypeAuthorizationCode) {
+		return nil, newOAuthError(http.StatusBadRequest, "unauthorized_client", "client may not use the authorization code grant")
+	}
+
+	scopes := model.ParseScope(req.Scope)
+	if len(scopes) == 0 {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_scope", "scope is required")
+	}
+	for _, scope := range scopes {
+		if !hasString(client.AllowedScopes, scope) {
+			return nil, newOAuthError(http.StatusBadRequest, "invalid_scope", fmt.Sprintf("scope %q is not allowed for this client", scope))
+		}
+	}
+
+	if req.CodeChallenge == "" {
+		if client.IsPublic {
+			return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "public clients must use PKCE")
+		}
+	} else if req.CodeChallengeMethod != "" && req.CodeChallengeMethod != "S256" && req.CodeChallengeMethod != "plain" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "code_challenge_method must be S256 or plain")
+	}
+
+	return scopes, nil
+}
+
+// StartAuthorization returns where to send the browser: the consent page, or
+// back to the client with an error. An error is returned only when the
+// client or redirect URI cannot be trusted.
+func (s *oidcService) StartAuthorization(req AuthorizeRequest, rawQuery string) (string, error) {
+	client, err := s.validateClientRedirect(req)
+	if err != nil {
+		return "", err
+	}
+
+	if _, oauthErr := s.validateAuthorizeRequest(client, req); oauthErr != nil {
+		return errorRedirect(req, oauthErr), nil
+	}
+
+	// The frontend signs the user in with the regular login API, then
+	// shows the consent screen and posts the decision to /oauth/consent
+	return fmt.Sprintf("%s/oauth/consent?%s", s.config.ClientURL, rawQuery), nil
+}
+
+func (s *oidcService) GetConsent(userID string, req AuthorizeRequest) (*ConsentDetails, error) {
+	client, err := s.validateClientRedirect(req)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes, oauthErr := s.validateAuthorizeRequest(client, req)
+	if oauthErr != nil {
+		return nil, oauthErr
+	}
+
+	return s.consentDetails(userID, client, scopes)
+}
+
+func (s *oidcService) consentDetails(userID string, client *model.OAuthClient, requested []string) (*ConsentDetails, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	scopes, err := s.grantableScopes(user, requested)
+	if err != nil {
+		return nil, err
+	}
+
+	consentRequired := true
+	if consent, err := s.oauthRepo.FindConsent(user.ID, client.ClientID); err == nil {
+		consentRequired = false
+		for _, scope := range scopes {
+			if !hasString(consent.Scopes, scope) {
+				consentRequired = true
+				break
+			}
+		}
+	}
+
+	return &ConsentDetails{
+		ClientID:        client.ClientID,
+		ClientName:      client.Name,
+		Scopes:          scopes,
+		ConsentRequired: consentRequired,
+	}, nil
+}
+
+// grantableScopes drops requested permission scopes the user does not hold
+func (s *oidcService) grantableScopes(user *model.User, requested []string) ([]string, error) {
+	permissions, err := s.rbacService.GetUserPermissions(user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve permissions: %w", err)
+	}
+
+	scopes := []string{}
+	for _, scope := range requested {
+		if hasString(model.OIDCScopes, scope) || model.IsUserScope(scope) || hasString(permissions, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// Authorize records the user's decision and returns the client redirect URL
+// carrying either an authorization code or an access_denied error
+func (s *oidcService) Authorize(userID string, req AuthorizeRequest, approved bool, meta RequestMeta) (string, error) {
+	client, err := s.validateClientRedirect(req)
+	if err != nil {
+		return "", err
+	}
+
+	requested, oauthErr := s.validateAuthorizeRequest(client, req)
+	if oauthErr != nil {
+		return errorRedirect(req, oauthErr), nil
+	}
+
+	if !approved {
+		return errorRedirect(req, newOAuthError(http.StatusForbidden, "access_denied", "the user denied the request")), nil
+	}
+
+	details, err := s.consentDetails(userID, client, requested)
+	if err != nil {
+		return "", err
+	}
+
+	if details.ConsentRequired {
+		if err := s.oauthRepo.SaveConsent(&model.OAuthConsent{
+			UserID:   userID,
+			ClientID: details.ClientID,
+			Scopes:   details.Scopes,
+		}); err != nil {
+			return "", fmt.Errorf("failed to save consent: %w", err)
+		}
+		s.auditLogger.Log(model.AuditActionOAuthConsentGranted, meta, userID, model.JSONMap{
+			"client_id": details.ClientID,
+			"scopes":    details.Scopes,
+		})
+	}
+
+	code, err := util.GenerateSecureToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate authorization code: %w", err)
+	}
+
+	method := req.CodeChallengeMethod
+	if req.CodeChallenge != "" && method == "" {
+		method = "plain"
+	}
+
+	if err := s.oauthRepo.CreateCode(&model.OAuthAuthorizationCode{
+		CodeHash:            util.HashToken(code),
+		ClientID:            details.ClientID,
+		UserID:              userID,
+		RedirectURI:         req.RedirectURI,
+		Scopes:              details.Scopes,
+		Nonce:               req.Nonce,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: method,
+		ExpiresAt:           time.Now().Add(authorizationCodeTTL),
+	}); err != nil {
+		return "", fmt.Errorf("failed to create authorization code: %w", err)
+	}
+
+	params := url.Values{}
+	params.Set("code", code)
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return appendQuery(req.RedirectURI, params), nil
+}
+
+// Token implements the token endpoint. Errors are always *OAuthError.
+func (s *oidcService) Token(req TokenRequest, meta RequestMeta) (*TokenResponse, error) {
+	client, err := s.authenticateClient(req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GrantType == "" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "grant_type is required")
+	}
+	if !client.AllowsGrant(req.GrantType) {
+		if !hasString(supportedGrantTypes, req.GrantType) {
+			return nil, newOAuthError(http.StatusBadRequest, "unsupported_grant_type", "")
+		}
+		return nil, newOAuthError(http.StatusBadRequest, "unauthorized_client", "client may not use this grant type")
+	}
+
+	switch req.GrantType {
+	case model.GrantTypeAuthorizationCode:
+		return s.exchangeCode(client, req, meta)
+	case model.GrantTypeRefreshToken:
+		return s.refreshToken(client, req, meta)
+	case model.GrantTypeClientCredentials:
+		return s.clientCredentials(client, req, meta)
+	case model.GrantTypeDeviceCode:
+		return s.deviceCode(client, req, meta)
+	default:
+		return nil, newOAuthError(http.StatusBadRequest, "unsupported_grant_type", "")
+	}
+}
+
+// authenticateClient verifies the client secret; public clients send none
+func (s *oidcService) authenticateClient(clientID, clientSecret string) (*model.OAuthClient, error) {
+	invalid := newOAuthError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+
+	if clientID == "" {
+		return nil, invalid
+	}
+
+	client, err := s.oauthRepo.FindClientByClientID(clientID)
+	if err != nil {
+		return nil, invalid
+	}
+
+	if client.IsPublic {
+		if clientSecret != "" {
+			return nil, invalid
+		}
+		return client, nil
+	}
+
+	if clientSecret == "" || subtle.ConstantTimeCompare([]byte(util.HashToken(clientSecret)), []byte(client.SecretHash)) != 1 {
+		return nil, invalid
+	}
+	return client, nil
+}
+
+func (s *oidcService) exchangeCode(client *model.OAuthClient, req TokenRequest, meta RequestMeta) (*TokenResponse, error) {
+	invalidGrant := newOAuthError(http.StatusBadRequest, "invalid_grant", "authorization code is invalid or expired")
+
+	code, err := s.oauthRepo.FindCodeByHash(util.HashToken(req.Code))
+	if err != nil || code.ClientID != client.ClientID || code.RedirectURI != req.RedirectURI {
+		return nil, invalidGrant
+	}
+
+	if code.UsedAt != nil {
+		// A replayed code may have been stolen: revoke what it was exchanged for
+		if code.SessionID != nil {
+			if err := s.sessionRepo.Revoke(*code.SessionID); err != nil {
+				log.Printf("Failed to revoke session for replayed code %s: %v", code.ID, err)
+			}
+		}
+		return nil, invalidGrant
+	}
+
+	if code.ExpiresAt.Before(time.Now()) {
+		return nil, invalidGrant
+	}
+
+	if !verifyCodeChallenge(code.CodeChallenge, code.CodeChallengeMethod, req.CodeVerifier) {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "code_verifier does not match the code challenge")
+	}
+
+	if used, err := s.oauthRepo.MarkCodeUsed(code.ID); err != nil || used == 0 {
+		return nil, invalidGrant
+	}
+
+	user, err := s.userRepo.FindByID(code.UserID)
+	if err != nil || !user.IsActive {
+		return nil, invalidGrant
+	}
+
+	resp, err := s.authService.IssueClientTokens(user, client.ClientID, code.Scopes, meta)
+	if err != nil {
+		return nil, newOAuthError(http.StatusInternalServerError, "server_error", "")
+	}
+
+	if err := s.oauthRepo.SetCodeSession(code.ID, resp.SessionID); err != nil {
+		log.Printf("Failed to link authorization code %s to its session: %v", code.ID, err)
+	}
+
+	meta.ActorID = user.ID
+	s.auditLogger.Log(model.AuditActionOAuthTokenIssued, meta, user.ID, model.JSONMap{
+		"client_id":  client.ClientID,
+		"grant_type": model.GrantTypeAuthorizationCode,
+		"scopes":     []string(code.Scopes),
+	})
+
+	return s.tokenResponse(client, resp, code.Nonce, code.CreatedAt)
+}
+
+func (s *oidcService) refreshToken(client *model.OAuthClient, req TokenRequest, meta RequestMeta) (*TokenResponse, error) {
+	if req.RefreshToken == "" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "refresh_token is required")
+	}
+
+	resp, err := s.authService.RefreshClientToken(req.RefreshToken, client.ClientID, req.Scope, meta)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "scope") {
+			return nil, newOAuthError(http.StatusBadRequest, "invalid_scope", err.Error())
+		}
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", err.Error())
+	}
+
+	return s.tokenResponse(client, resp, "", time.Time{})
+}
+
+// clientCredentials issues an access token to the client itself, with no
+// user, limited to the requested subset of the client's allowed scopes
+func (s *oidcService) clientCredentials(client *model.OAuthClient, req TokenRequest, meta RequestMeta) (*TokenResponse, error) {
+	if client.IsPublic {
+		return nil, newOAuthError(http.StatusBadRequest, "unauthorized_client", "public clients may not use client credentials")
+	}
+
+	scopes := []string(client.AllowedScopes)
+	if requested := model.ParseScope(req.Scope); len(requested) > 0 {
+		for _, scope := range requested {
+			if !hasString(client.AllowedScopes, scope) {
+				return nil, newOAuthError(http.StatusBadRequest, "invalid_scope", fmt.Sprintf("scope %q is not allowed for this client", scope))
+			}
+		}
+		scopes = requested
+	}
+
+	ttl := defaultClientTokenTTL
+	if client.TokenTTL > 0 {
+		ttl = time.Duration(client.TokenTTL) * time.Second
+	}
+
+	scope := model.FormatScope(scopes)
+	accessToken, err := util.GenerateTokenWithClaims(util.JWTClaims{
+		TokenType: util.TokenTypeAccess,
+		ClientID:  client.ClientID,
+		Scope:     scope,
+	}, s.config.JWTSecret, ttl)
+	if err != nil {
+		return nil, newOAuthError(http.StatusInternalServerError, "server_error", "")
+	}
+
+	meta.ClientID = client.ClientID
+	s.auditLogger.Log(model.AuditActionOAuthTokenIssued, meta, "", model.JSONMap{
+		"grant_type": model.GrantTypeClientCredentials,
+		"scopes":     scopes,
+	})
+
+	return &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(ttl.Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+// deviceCode answers a device's poll: pending and slow_down errors until the
+// user decides, then tokens exactly once
+func (s *oidcService) deviceCode(client *model.OAuthClient, req TokenRequest, meta RequestMeta) (*TokenResponse, error) {
+	if req.DeviceCode == "" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "device_code is required")
+	}
+
+	invalidGrant := newOAuthError(http.StatusBadRequest, "invalid_grant", "device code is invalid")
+	code, err := s.oauthRepo.FindDeviceCodeByHash(util.HashToken(req.DeviceCode))
+	if err != nil || code.ClientID != client.ClientID || code.ConsumedAt != nil {
+		return nil, invalidGrant
+	}
+
+	if code.ExpiresAt.Before(time.Now()) {
+		return nil, newOAuthError(http.StatusBadRequest, "expired_token", "the device code has expired")
+	}
+
+	switch code.Status {
+	case model.DeviceCodeDenied:
+		return nil, newOAuthError(http.StatusBadRequest, "access_denied", "the user denied the request")
+	case model.DeviceCodePending:
+		interval := code.Interval
+		tooSoon := code.LastPolledAt != nil && time.Since(*code.LastPolledAt) < time.Duration(interval)*time.Second
+		if tooSoon {
+			interval += deviceCodeSlowDown
+		}
+		if err := s.oauthRepo.RecordDevicePoll(code.ID, interval); err != nil {
+			log.Printf("Failed to record poll for device code %s: %v", code.ID, err)
+		}
+		if tooSoon {
+			return nil, newOAuthError(http.StatusBadRequest, "slow_down", "")
+		}
+		return nil, newOAuthError(http.StatusBadRequest, "authorization_pending", "")
+	}
+
+	if consumed, err := s.oauthRepo.ConsumeDeviceCode(code.ID); err != nil || consumed == 0 {
+		return nil, invalidGrant
+	}
+
+	user, err := s.userRepo.FindByID(*code.UserID)
+	if err != nil || !user.IsActive {
+		return nil, invalidGrant
+	}
+
+	resp, err := s.authService.IssueClientTokens(user, client.ClientID, code.Scopes, meta)
+	if err != nil {
+		return nil, newOAuthError(http.StatusInternalServerError, "server_error", "")
+	}
+
+	meta.ActorID = user.ID
+	s.auditLogger.Log(model.AuditActionOAuthTokenIssued, meta, user.ID, model.JSONMap{
+		"client_id":  client.ClientID,
+		"grant_type": model.GrantTypeDeviceCode,
+		"scopes":     []string(code.Scopes),
+	})
+
+	return s.tokenResponse(client, resp, "", *code.DecidedAt)
+}
+
+// tokenResponse converts issued tokens into the OAuth response, adding an
+// ID token when the openid scope was granted
+func (s *oidcService) tokenResponse(client *model.OAuthClient, resp *AuthResponse, nonce string, authTime time.Time) (*TokenResponse, error) {
+	tokenResp := &TokenResponse{
+		AccessToken: resp.AccessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   resp.ExpiresIn,
+		Scope:       resp.Scope,
+	}
+	if client.AllowsGrant(model.GrantTypeRefreshToken) {
+		tokenResp.RefreshToken = resp.RefreshToken
+	}
+
+	scopes := model.ParseScope(resp.Scope)
+	if hasString(scopes, model.ScopeOpenID) {
+		claims := util.IDTokenClaims{Nonce: nonce}
+		if !authTime.IsZero() {
+			claims.AuthTime = authTime.Unix()
+		}
+		if hasString(scopes, model.ScopeEmail) {
+			verified := resp.User.IsVerified
+			claims.Email = resp.User.Email
+			claims.EmailVerified = &verified
+		}
+		if hasString(scopes, model.ScopeProfile) {
+			claims.Name = resp.User.FullName
+			if resp.User.ProfilePhoto != nil {
+				claims.Picture = *resp.User.ProfilePhoto
+			}
+		}
+
+		idToken, err := s.signingKey.SignIDToken(claims, s.config.OIDCIssuer, resp.User.ID, client.ClientID, idTokenTTL)
+		if err != nil {
+			return nil, newOAuthError(http.StatusInternalServerError, "server_error", "")
+		}
+		tokenResp.IDToken = idToken
+	}
+
+	return tokenResp, nil
+}
+
+func (s *oidcService) UserInfo(userID string, scopes []string) (map[string]interface{}, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	info := map[string]interface{}{"sub": user.ID}
+	if hasString(scopes, model.ScopeEmail) {
+		info["email"] = user.Email
+		info["email_verified"] = user.IsVerified
+	}
+	if hasString(scopes, model.ScopeProfile) {
+		info["name"] = user.FullName
+		if user.Username != nil {
+			info["preferred_username"] = *user.Username
+		}
+		if user.ProfilePhoto != nil {
+			info["picture"] = *user.ProfilePhoto
+		}
+	}
+	return info, nil
+}
+
+// DeviceAuthorization starts the device flow for a client that cannot host
+// a browser (RFC 8628 section 3.1)
+func (s *oidcService) DeviceAuthorization(req DeviceAuthorizationRequest) (*DeviceAuthorizationResponse, error) {
+	client, err := s.authenticateClient(req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if !client.AllowsGrant(model.GrantTypeDeviceCode) {
+		return nil, newOAuthError(http.StatusBadRequest, "unauthorized_client", "client may not use the device authorization grant")
+	}
+
+	scopes := model.ParseScope(req.Scope)
+	if len(scopes) == 0 {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_scope", "scope is required")
+	}
+	for _, scope := range scopes {
+		if !hasString(client.AllowedScopes, scope) {
+			return nil, newOAuthError(http.StatusBadRequest, "invalid_scope", fmt.Sprintf("scope %q is not allowed for this client", scope))
+		}
+	}
+
+	deviceCode, err := util.GenerateSecureToken(32)
+	if err != nil {
+		return nil, newOAuthError(http.StatusInternalServerError, "server_error", "")
+	}
+	userCode, err := generateUserCode()
+	if err != nil {
+		return nil, newOAuthError(http.StatusInternalServerError, "server_error", "")
+	}
+
+	if err := s.oauthRepo.CreateDeviceCode(&model.OAuthDeviceCode{
+		DeviceCodeHash: util.HashToken(deviceCode),
+		UserCode:       userCode,
+		ClientID:       client.ClientID,
+		Scopes:         scopes,
+		Status:         model.DeviceCodePending,
+		Interval:       deviceCodeInterval,
+		ExpiresAt:      time.Now().Add(deviceCodeTTL),
+	}); err != nil {
+		return nil, newOAuthError(http.StatusInternalServerError, "server_error", "")
+	}
+
+	// The frontend page signs the user in and posts the decision to /oauth/device
+	verificationURI := s.config.ClientURL + "/device"
+	return &DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + url.QueryEscape(userCode),
+		ExpiresIn:               int(deviceCodeTTL.Seconds()),
+		Interval:                deviceCodeInterval,
+	}, nil
+}
+
+// findPendingDeviceCode looks up a user code that still awaits a decision
+func (s *oidcService) findPendingDeviceCode(userCode string) (*model.OAuthDeviceCode, *model.OAuthClient, error) {
+	invalid := errors.New("invalid or expired code")
+
+	code, err := s.oauthRepo.FindDeviceCodeByUserCode(normalizeUserCode(userCode))
+	if err != nil || code.Status != model.DeviceCodePending || code.ExpiresAt.Before(time.Now()) {
+		return nil, nil, invalid
+	}
+
+	client, err := s.oauthRepo.FindClientByClientID(code.ClientID)
+	if err != nil {
+		return nil, nil, invalid
+	}
+	return code, client, nil
+}
+
+func (s *oidcService) GetDeviceConsent(userID, userCode string) (*ConsentDetails, error) {
+	code, client, err := s.findPendingDeviceCode(userCode)
+	if err != nil {
+		return nil, err
+	}
+
+	details, err := s.consentDetails(userID, client, code.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	// A device is only identified by a code the user typed, so always ask
+	details.ConsentRequired = true
+	return details, nil
+}
+
+// DecideDevice records the user's approval or denial of a device
+func (s *oidcService) DecideDevice(userID, userCode string, approved bool, meta RequestMeta) error {
+	code, client, err := s.findPendingDeviceCode(userCode)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	code.UserID = &userID
+	code.DecidedAt = &now
+	code.Status = model.DeviceCodeDenied
+
+	if approved {
+		details, err := s.consentDetails(userID, client, code.Scopes)
+		if err != nil {
+			return err
+		}
+		code.Status = model.DeviceCodeApproved
+		code.Scopes = details.Scopes
+
+		if err := s.oauthRepo.SaveConsent(&model.OAuthConsent{
+			UserID:   userID,
+			ClientID: client.ClientID,
+			Scopes:   details.Scopes,
+		}); err != nil {
+			return fmt.Errorf("failed to save consent: %w", err)
+		}
+	}
+
+	if decided, err := s.oauthRepo.DecideDeviceCode(code); err != nil {
+		return fmt.Errorf("failed to record decision: %w", err)
+	} else if decided == 0 {
+		return errors.New("invalid or expired code")
+	}
+
+	if approved {
+		s.auditLogger.Log(model.AuditActionOAuthConsentGranted, meta, userID, model.JSONMap{
+			"client_id": client.ClientID,
+			"scopes":    []string(code.Scopes),
+			"via":       "device",
+		})
+	}
+	return nil
+}
+
+// Introspect reports whether a token is currently usable. Only confidential
+// clients (typically resource servers) may introspect.
+func (s *oidcService) Introspect(req TokenActionRequest) (*IntrospectionResponse, error) {
+	client, err := s.authenticateClient(req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if client.IsPublic {
+		return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", "public clients may not introspect tokens")
+	}
+
+	if req.Token == "" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "token is required")
+	}
+
+	inactive := &IntrospectionResponse{Active: false}
+
+	if strings.HasPrefix(req.Token, model.APIKeyPrefix) {
+		principal, err := s.apiKeyService.Inspect(req.Token)
+		if err != nil {
+			return inactive, nil
+		}
+		return &IntrospectionResponse{
+			Active:      true,
+			Scope:       model.FormatScope(principal.Key.Scopes),
+			Username:    principal.User.Email,
+			TokenType:   "api_key",
+			ExpiresAt:   principal.Key.ExpiresAt.Unix(),
+			IssuedAt:    principal.Key.CreatedAt.Unix(),
+			Subject:     principal.User.ID,
+			UserType:    principal.User.UserType,
+			Permissions: principal.Permissions,
+		}, nil
+	}
+
+	claims, err := s.validateHintedToken(req.Token, req.TokenTypeHint)
+	if err != nil {
+		return inactive, nil
+	}
+
+	// Unlike local JWT validation, introspection sees revoked sessions and
+	// deactivated users
+	if claims.SessionID != "" {
+		session, err := s.sessionRepo.FindByID(claims.SessionID)
+		if err != nil || session.UserID != claims.UserID || !session.IsActive() {
+			return inactive, nil
+		}
+	}
+	if claims.UserID != "" {
+		user, err := s.userRepo.FindByID(claims.UserID)
+		if err != nil || !user.IsActive {
+			return inactive, nil
+		}
+	} else if _, err := s.oauthRepo.FindClientByClientID(claims.ClientID); err != nil {
+		// Client credentials tokens die with their client
+		return inactive, nil
+	}
+
+	resp := &IntrospectionResponse{
+		Active:      true,
+		Scope:       claims.Scope,
+		ClientID:    claims.ClientID,
+		Username:    claims.Email,
+		TokenType:   "Bearer",
+		Subject:     claims.Subject,
+		Issuer:      claims.Issuer,
+		SessionID:   claims.SessionID,
+		OrgID:       claims.OrgID,
+		UserType:    claims.UserType,
+		Permissions: claims.Permissions,
+	}
+	if claims.ExpiresAt != nil {
+		resp.ExpiresAt = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		resp.IssuedAt = claims.IssuedAt.Unix()
+	}
+	if claims.Actor != nil {
+		resp.Actor = claims.Actor.Subject
+	}
+	return resp, nil
+}
+
+// validateHintedToken accepts only access and refresh tokens, trying the type
+// named by token_type_hint first. The hint is not binding (RFC 7009 section
+// 2.1), so the other type is tried as well.
+func (s *oidcService) validateHintedToken(token, hint string) (*util.JWTClaims, error) {
+	validators := []func(string, string) (*util.JWTClaims, error){util.ValidateAccessToken, util.ValidateRefreshToken}
+	if hint == "refresh_token" {
+		validators[0], validators[1] = validators[1], validators[0]
+	}
+
+	var err error
+	for _, validate := range validators {
+		var claims *util.JWTClaims
+		if claims, err = validate(token, s.config.JWTSecret); err == nil {
+			return claims, nil
+		}
+	}
+	return nil, err
+}
+
+// Revoke invalidates a refresh token (RFC 7009) by revoking its session, which
+// also stops further refreshes of its access tokens, or an API key. Unknown
+// and already invalid tokens are not an error.
+func (s *oidcService) Revoke(req TokenActionRequest, meta RequestMeta) error {
+	client, err := s.authenticateClient(req.ClientID, req.ClientSecret)
+	if err != nil {
+		return err
+	}
+	if req.Token == "" {
+		return newOAuthError(http.StatusBadRequest, "invalid_request", "token is required")
+	}
+
+	meta.ClientID = client.ClientID
+
+	if strings.HasPrefix(req.Token, model.APIKeyPrefix) {
+		if err := s.apiKeyService.RevokeRaw(req.Token, meta); err != nil {
+			log.Printf("API key revocation by client %s ignored: %v", client.ClientID, err)
+		}
+		return nil
+	}
+
+	claims, err := s.validateHintedToken(req.Token, req.TokenTypeHint)
+	if err != nil || claims.SessionID == "" {
+		// Client credentials tokens are short-lived and have no session to revoke
+		return nil
+	}
+
+	session, err := s.sessionRepo.FindByID(claims.SessionID)
+	if err != nil || session.UserID != claims.UserID || !session.IsActive() {
+		return nil
+	}
+	if sessionClientID(session) != client.ClientID {
+		return newOAuthError(http.StatusBadRequest, "unauthorized_client", "token was not issued to this client")
+	}
+
+	if err := s.sessionRepo.Revoke(session.ID); err != nil {
+		return newOAuthError(http.StatusServiceUnavailable, "temporarily_unavailable", "")
+	}
+
+	s.auditLogger.Log(model.AuditActionOAuthTokenRevoked, meta, session.UserID, model.JSONMap{"session_id": session.ID})
+	return nil
+}
+
+// CreateClient registers an OAuth client. grantedPermissions are the
+// creator's effective permissions, which bound a machine client's scopes.
+func (s *oidcService) CreateClient(req CreateOAuthClientRequest, grantedPermissions []string, meta RequestMeta) (*CreateOAuthClientResponse, error) {
+	if hasString(req.GrantTypes, model.GrantTypeClientCredentials) {
+		return s.createMachineClient(req, grantedPermissions, meta)
+	}
+
+	if req.TokenTTL != 0 {
+		return nil, errors.New("token_ttl only applies to client credentials clients")
+	}
+	for _, uri := range req.RedirectURIs {
+		parsed, err := url.Parse(uri)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" || parsed.Fragment != "" {
+			return nil, fmt.Errorf("invalid redirect URI: %s", uri)
+		}
+	}
+
+	scopes := req.AllowedScopes
+	if len(scopes) == 0 {
+		scopes = model.OIDCScopes
+	}
+	for _, scope := range scopes {
+		if !hasString(model.OIDCScopes, scope) && !model.IsUserScope(scope) {
+			return nil, fmt.Errorf("invalid scope: %s", scope)
+		}
+	}
+
+	grantTypes := req.GrantTypes
+	if len(grantTypes) == 0 {
+		grantTypes = []string{model.GrantTypeAuthorizationCode, model.GrantTypeRefreshToken}
+	}
+	for _, grantType := range grantTypes {
+		if grantType != model.GrantTypeAuthorizationCode && grantType != model.GrantTypeRefreshToken && grantType != model.GrantTypeDeviceCode {
+			return nil, fmt.Errorf("unsupported grant type: %s", grantType)
+		}
+	}
+	// Device clients never receive redirects
+	if hasString(grantTypes, model.GrantTypeAuthorizationCode) && len(req.RedirectURIs) == 0 {
+		return nil, errors.New("at least one redirect URI is required")
+	}
+
+	return s.registerClient(&model.OAuthClient{
+		Name:          req.Name,
+		IsPublic:      req.IsPublic,
+		RedirectURIs:  req.RedirectURIs,
+		AllowedScopes: scopes,
+		GrantTypes:    grantTypes,
+		CreatedByID:   meta.ActorID,
+	}, meta)
+}
+
+// createMachineClient registers a confidential client for service-to-service
+// calls. Its scopes are permissions, since there is no user to narrow them,
+// and the creator can only hand out permissions they hold themselves.
+func (s *oidcService) createMachineClient(req CreateOAuthClientRequest, grantedPermissions []string, meta RequestMeta) (*CreateOAuthClientResponse, error) {
+	if len(req.GrantTypes) != 1 {
+		return nil, errors.New("client credentials cannot be combined with other grant types")
+	}
+	if req.IsPublic {
+		return nil, errors.New("client credentials clients must be confidential")
+	}
+	if len(req.RedirectURIs) > 0 {
+		return nil, errors.New("client credentials clients do not use redirect URIs")
+	}
+	if len(req.AllowedScopes) == 0 {
+		return nil, errors.New("allowed_scopes is required for client credentials clients")
+	}
+	for _, scope := range req.AllowedScopes {
+		if !hasString(model.AllPermissions, scope) {
+			return nil, fmt.Errorf("invalid scope: %s", scope)
+		}
+		if !hasString(grantedPermissions, scope) {
+			return nil, fmt.Errorf("you cannot grant a permission you do not hold: %s", scope)
+		}
+	}
+
+	ttl := time.Duration(req.TokenTTL) * time.Second
+	if req.TokenTTL != 0 && (ttl < time.Minute || ttl > maxClientTokenTTL) {
+		return nil, fmt.Errorf("token_ttl must be between 60 and %d seconds", int(maxClientTokenTTL.Seconds()))
+	}
+
+	return s.registerClient(&model.OAuthClient{
+		Name:          req.Name,
+		AllowedScopes: req.AllowedScopes,
+		GrantTypes:    req.GrantTypes,
+		TokenTTL:      req.TokenTTL,
+		CreatedByID:   meta.ActorID,
+	}, meta)
+}
+
+// registerClient assigns credentials to a validated client and stores it
+func (s *oidcService) registerClient(client *model.OAuthClient, meta RequestMeta) (*CreateOAuthClientResponse, error) {
+	clientID, err := util.GenerateSecureToken(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate client ID: %w", err)
+	}
+
+	client.ClientID = clientID
+
+	var secret string
+	if !client.IsPublic {
+		if secret, err = util.GenerateSecureToken(32); err != nil {
+			return nil, fmt.Errorf("failed to generate client secret: %w", err)
+		}
+		client.SecretHash = util.HashToken(secret)
+	}
+
+	if err := s.oauthRepo.CreateClient(client); err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+
+	s.auditLogger.Log(model.AuditActionOAuthClientCreated, meta, "", model.JSONMap{
+		"client_id": client.ClientID,
+		"name":      client.Name,
+	})
+
+	return &CreateOAuthClientResponse{
+		Client:       client,
+		ClientSecret: secret,
+	}, nil
+}
+
+func (s *oidcService) ListClients() ([]model.OAuthClient, error) {
+	return s.oauthRepo.ListClients()
+}
+
+func (s *oidcService) DeleteClient(clientID string, meta RequestMeta) error {
+	deleted, err := s.oauthRepo.DeleteClient(clientID)
+	if err != nil {
+		return fmt.Errorf("failed to delete client: %w", err)
+	}
+	if deleted == 0 {
+		return errors.New("client not found")
+	}
+
+	s.auditLogger.Log(model.AuditActionOAuthClientDeleted, meta, "", model.JSONMap{"client_id": clientID})
+	return nil
+}
+
+// generateUserCode returns a random "XXXX-XXXX" code that is easy to type
+func generateUserCode() (string, error) {
+	// Bytes at or above limit are skipped so every letter is equally likely
+	limit := byte(256 - 256%len(userCodeAlphabet))
+	code := make([]byte, 0, 9)
+	buf := make([]byte, 16)
+	for len(code) < 9 {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if b >= limit || len(code) == 9 {
+				continue
+			}
+			if len(code) == 4 {
+				code = append(code, '-')
+			}
+			code = append(code, userCodeAlphabet[int(b)%len(userCodeAlphabet)])
+		}
+	}
+	return string(code), nil
+}
+
+// normalizeUserCode accepts user codes typed in lower case, without the dash
+// or with extra spaces
+func normalizeUserCode(input string) string {
+	var letters []rune
+	for _, r := range strings.ToUpper(input) {
+		if r >= 'A' && r <= 'Z' {
+			letters = append(letters, r)
+		}
+	}
+	if len(letters) != 8 {
+		return string(letters)
+	}
+	return string(letters[:4]) + "-" + string(letters[4:])
+}
+
+// verifyCodeChallenge checks a PKCE code_verifier (RFC 7636)
+func verifyCodeChallenge(challenge, method, verifier string) bool {
+	if challenge == "" {
+		return verifier == ""
+	}
+	if verifier == "" {
+		return false
+	}
+
+	expected := verifier
+	if method == "S256" {
+		sum := sha256.Sum256([]byte(verifier))
+		expected = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// errorRedirect builds the client redirect carrying an OAuth error
+func errorRedirect(req AuthorizeRequest, oauthErr *OAuthError) string {
+	params := url.Values{}
+	params.Set("error", oauthErr.Code)
+	if oauthErr.Description != "" {
+		params.Set("error_description", oauthErr.Description)
+	}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return appendQuery(req.RedirectURI, params)
+}
+
+func appendQuery(uri string, params url.Values) string {
+	if strings.Contains(uri, "?") {
+		return uri + "&" + params.Encode()
+	}
+	return uri + "?" + params.Encode()
+}
@@ -0,0 +1,544 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"yourapp/internal/config"
+	"yourapp/internal/model"
+	"yourapp/internal/util"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testIssuer = "https://auth.example.com"
+
+type testOIDC struct {
+	*oidcService
+	auth      *authService
+	oauthRepo *fakeOAuthRepo
+	userRepo  *fakeUserRepo
+	sessions  *fakeSessionRepo
+	rbac      RBACService
+}
+
+func newTestOIDCService(t *testing.T, users ...*model.User) *testOIDC {
+	t.Helper()
+	auth, userRepo, _, sessionRepo := newTestAuthService(t, nil, users...)
+	for _, user := range users {
+		if err := auth.rbacService.AssignDefaultRoles(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	signingKey, err := util.LoadSigningKey("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oauthRepo := auth.oauthRepo.(*fakeOAuthRepo)
+	apiKeys := NewAPIKeyService(newFakeAPIKeyRepo(), userRepo, auth.rbacService, &fakeAuditLogger{})
+	cfg := &config.Config{JWTSecret: testJWTSecret, OIDCIssuer: testIssuer, ClientURL: "https://app.example.com"}
+	s := NewOIDCService(oauthRepo, userRepo, sessionRepo, auth, apiKeys, auth.rbacService, &fakeAuditLogger{}, signingKey, cfg).(*oidcService)
+	return &testOIDC{oidcService: s, auth: auth, oauthRepo: oauthRepo, userRepo: userRepo, sessions: sessionRepo, rbac: auth.rbacService}
+}
+
+// createWebClient registers a client for the authorization code flow
+func (o *testOIDC) createWebClient(t *testing.T, public bool) *CreateOAuthClientResponse {
+	t.Helper()
+	resp, err := o.CreateClient(CreateOAuthClientRequest{
+		Name:          "web",
+		RedirectURIs:  []string{"https://client.example.com/callback"},
+		AllowedScopes: []string{model.ScopeOpenID, model.ScopeEmail, model.ScopeProfile, model.ScopeProfileRead},
+		IsPublic:      public,
+	}, nil, RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// queryOf returns the query parameters of a redirect URL
+func queryOf(t *testing.T, redirect string) url.Values {
+	t.Helper()
+	parsed, err := url.Parse(redirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Query()
+}
+
+func s256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestAuthorizationCodeFlowWithPKCE(t *testing.T) {
+	user := &model.User{ID: "user-1", Email: "ana@example.com", FullName: "Ana", IsActive: true, IsVerified: true}
+	o := newTestOIDCService(t, user)
+	client := o.createWebClient(t, true)
+
+	const verifier = "a-verifier-long-enough-to-be-realistic-0123456789"
+	req := AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            client.Client.ClientID,
+		RedirectURI:         "https://client.example.com/callback",
+		Scope:               "openid email profile:read",
+		State:               "xyz",
+		Nonce:               "n-0S6",
+		CodeChallenge:       s256(verifier),
+		CodeChallengeMethod: "S256",
+	}
+	redirect, err := o.Authorize(user.ID, req, true, RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := queryOf(t, redirect)
+	if params.Get("state") != "xyz" || params.Get("code") == "" {
+		t.Fatalf("redirect = %s", redirect)
+	}
+
+	exchange := TokenRequest{GrantType: model.GrantTypeAuthorizationCode, Code: params.Get("code"), RedirectURI: req.RedirectURI, ClientID: client.Client.ClientID}
+	exchange.CodeVerifier = "wrong-verifier"
+	if _, err := o.Token(exchange, RequestMeta{}); err == nil {
+		t.Fatal("code exchanged with a wrong verifier")
+	}
+	// The failed attempt does not burn the code
+	exchange.CodeVerifier = verifier
+	tokens, err := o.Token(exchange, RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens.Scope != "openid email profile:read" || tokens.IDToken == "" {
+		t.Fatalf("token response = %+v", tokens)
+	}
+
+	var claims util.IDTokenClaims
+	_, err = jwt.ParseWithClaims(tokens.IDToken, &claims, func(*jwt.Token) (interface{}, error) {
+		return &o.signingKey.PrivateKey.PublicKey, nil
+	}, jwt.WithIssuer(testIssuer), jwt.WithAudience(client.Client.ClientID), jwt.WithValidMethods([]string{"RS256"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != user.ID || claims.Nonce != "n-0S6" || claims.Email != user.Email || claims.Name != "" {
+		t.Fatalf("ID token claims = %+v", claims)
+	}
+
+	access, err := o.auth.AuthenticateAccessToken(tokens.AccessToken)
+	if err != nil || access.ClientID != client.Client.ClientID {
+		t.Fatalf("access token = %+v, %v", access, err)
+	}
+}
+
+func TestAuthorizationCodeReplayRevokesTheSession(t *testing.T) {
+	user := &model.User{ID: "user-1", Email: "ana@example.com", IsActive: true}
+	o := newTestOIDCService(t, user)
+	client := o.createWebClient(t, false)
+
+	req := AuthorizeRequest{ResponseType: "code", ClientID: client.Client.ClientID, RedirectURI: "https://client.example.com/callback", Scope: "openid"}
+	redirect, _ := o.Authorize(user.ID, req, true, RequestMeta{})
+	exchange := TokenRequest{
+		GrantType:    model.GrantTypeAuthorizationCode,
+		Code:         queryOf(t, redirect).Get("code"),
+		RedirectURI:  req.RedirectURI,
+		ClientID:     client.Client.ClientID,
+		ClientSecret: client.ClientSecret,
+	}
+
+	tokens, err := o.Token(exchange, RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Token(exchange, RequestMeta{}); err == nil {
+		t.Fatal("authorization code exchanged twice")
+	}
+	if _, err := o.auth.AuthenticateAccessToken(tokens.AccessToken); err == nil {
+		t.Fatal("tokens from a replayed code still work")
+	}
+}
+
+func TestAuthorizeRejectsUntrustedRequests(t *testing.T) {
+	user := &model.User{ID: "user-1", Email: "ana@example.com", IsActive: true}
+	o := newTestOIDCService(t, user)
+	client := o.createWebClient(t, true)
+	base := AuthorizeRequest{ResponseType: "code", ClientID: client.Client.ClientID, RedirectURI: "https://client.example.com/callback", Scope: "openid", State: "s"}
+
+	// Never redirect to an unregistered URI
+	evil := base
+	evil.RedirectURI = "https://evil.example.com/callback"
+	if _, err := o.StartAuthorization(evil, ""); err == nil {
+		t.Fatal("authorization started for an unregistered redirect URI")
+	}
+
+	// Public clients must use PKCE
+	redirect, err := o.Authorize(user.ID, base, true, RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params := queryOf(t, redirect); params.Get("error") != "invalid_request" || params.Get("code") != "" {
+		t.Fatalf("public client without PKCE: %s", redirect)
+	}
+
+	withPKCE := base
+	withPKCE.CodeChallenge = s256("verifier")
+	withPKCE.CodeChallengeMethod = "S256"
+	withPKCE.Scope = "openid users:read"
+	redirect, _ = o.Authorize(user.ID, withPKCE, true, RequestMeta{})
+	if params := queryOf(t, redirect); params.Get("error") != "invalid_scope" {
+		t.Fatalf("scope outside the client's allowed scopes: %s", redirect)
+	}
+
+	withPKCE.Scope = "openid"
+	redirect, _ = o.Authorize(user.ID, withPKCE, false, RequestMeta{})
+	if params := queryOf(t, redirect); params.Get("error") != "access_denied" || params.Get("state") != "s" {
+		t.Fatalf("denied consent: %s", redirect)
+	}
+}
+
+func TestConsentIsRememberedPerScope(t *testing.T) {
+	user := &model.User{ID: "user-1", Email: "ana@example.com", IsActive: true}
+	o := newTestOIDCService(t, user)
+	client := o.createWebClient(t, false)
+	req := AuthorizeRequest{ResponseType: "code", ClientID: client.Client.ClientID, RedirectURI: "https://client.example.com/callback", Scope: "openid"}
+
+	details, err := o.GetConsent(user.ID, req)
+	if err != nil || !details.ConsentRequired {
+		t.Fatalf("first consent = %+v, %v", details, err)
+	}
+	o.Authorize(user.ID, req, true, RequestMeta{})
+	if details, _ := o.GetConsent(user.ID, req); details.ConsentRequired {
+		t.Fatal("consent asked again for the same scopes")
+	}
+	req.Scope = "openid email"
+	if details, _ := o.GetConsent(user.ID, req); !details.ConsentRequired {
+		t.Fatal("consent not asked for a new scope")
+	}
+}
+
+func TestMachineClientScopesAreBoundedByTheCreator(t *testing.T) {
+	o := newTestOIDCService(t)
+	granted := []string{model.PermissionClientsWrite, model.PermissionUsersRead}
+
+	req := CreateOAuthClientRequest{Name: "svc", GrantTypes: []string{model.GrantTypeClientCredentials}, AllowedScopes: []string{model.PermissionUsersRead, model.PermissionRolesWrite}}
+	if _, err := o.CreateClient(req, granted, RequestMeta{ActorID: "admin"}); err == nil {
+		t.Fatal("machine client created with a permission its creator lacks")
+	}
+
+	req.AllowedScopes = []string{model.PermissionUsersRead}
+	created, err := o.CreateClient(req, granted, RequestMeta{ActorID: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := o.Token(TokenRequest{GrantType: model.GrantTypeClientCredentials, ClientID: created.Client.ClientID, ClientSecret: created.ClientSecret}, RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := o.auth.AuthenticateAccessToken(tokens.AccessToken)
+	if err != nil || claims.ClientID != created.Client.ClientID || claims.Scope != model.PermissionUsersRead || claims.UserID != "" {
+		t.Fatalf("client credentials token = %+v, %v", claims, err)
+	}
+
+	if _, err := o.Token(TokenRequest{GrantType: model.GrantTypeClientCredentials, ClientID: created.Client.ClientID, ClientSecret: "wrong"}, RequestMeta{}); err == nil {
+		t.Fatal("client authenticated with a wrong secret")
+	}
+	if _, err := o.Token(TokenRequest{GrantType: model.GrantTypeClientCredentials, Scope: model.PermissionClientsWrite, ClientID: created.Client.ClientID, ClientSecret: created.ClientSecret}, RequestMeta{}); err == nil {
+		t.Fatal("client credentials token issued beyond the client's scopes")
+	}
+}
+
+func TestMachineClientShape(t *testing.T) {
+	o := newTestOIDCService(t)
+	granted := model.AllPermissions
+
+	for name, req := range map[string]CreateOAuthClientRequest{
+		"mixed grants": {Name: "svc", GrantTypes: []string{model.GrantTypeClientCredentials, model.GrantTypeAuthorizationCode}, AllowedScopes: []string{model.PermissionUsersRead}},
+		"public":       {Name: "svc", GrantTypes: []string{model.GrantTypeClientCredentials}, AllowedScopes: []string{model.PermissionUsersRead}, IsPublic: true},
+		"no scopes":    {Name: "svc", GrantTypes: []string{model.GrantTypeClientCredentials}},
+		"user scope":   {Name: "svc", GrantTypes: []string{model.GrantTypeClientCredentials}, AllowedScopes: []string{model.ScopeProfileRead}},
+		"long ttl":     {Name: "svc", GrantTypes: []string{model.GrantTypeClientCredentials}, AllowedScopes: []string{model.PermissionUsersRead}, TokenTTL: 7 * 24 * 3600},
+	} {
+		if _, err := o.CreateClient(req, granted, RequestMeta{}); err == nil {
+			t.Errorf("%s: machine client accepted", name)
+		}
+	}
+}
+
+// issueCodeTokens runs the authorization code flow for a confidential client
+func (o *testOIDC) issueCodeTokens(t *testing.T, client *CreateOAuthClientResponse, userID string) *TokenResponse {
+	t.Helper()
+	req := AuthorizeRequest{ResponseType: "code", ClientID: client.Client.ClientID, RedirectURI: "https://client.example.com/callback", Scope: "openid profile:read"}
+	redirect, err := o.Authorize(userID, req, true, RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := o.Token(TokenRequest{
+		GrantType:    model.GrantTypeAuthorizationCode,
+		Code:         queryOf(t, redirect).Get("code"),
+		RedirectURI:  req.RedirectURI,
+		ClientID:     client.Client.ClientID,
+		ClientSecret: client.ClientSecret,
+	}, RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+func TestIntrospection(t *testing.T) {
+	user := &model.User{ID: "user-1", Email: "ana@example.com", IsActive: true}
+	o := newTestOIDCService(t, user)
+	resourceServer := o.createWebClient(t, false)
+	publicClient := o.createWebClient(t, true)
+	tokens := o.issueCodeTokens(t, resourceServer, user.ID)
+
+	introspect := func(token string) *IntrospectionResponse {
+		t.Helper()
+		resp, err := o.Introspect(TokenActionRequest{Token: token, ClientID: resourceServer.Client.ClientID, ClientSecret: resourceServer.ClientSecret})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if _, err := o.Introspect(TokenActionRequest{Token: tokens.AccessToken, ClientID: publicClient.Client.ClientID}); err == nil {
+		t.Fatal("public client introspected a token")
+	}
+
+	resp := introspect(tokens.AccessToken)
+	if !resp.Active || resp.Subject != user.ID || resp.ClientID != resourceServer.Client.ClientID || resp.Scope != "openid profile:read" || resp.ExpiresAt == 0 {
+		t.Fatalf("active token = %+v", resp)
+	}
+	if resp := introspect("not-a-token"); resp.Active || resp.Subject != "" {
+		t.Fatalf("garbage token = %+v", resp)
+	}
+
+	// A wrong hint only changes the order in which the types are tried
+	wrongHint, err := o.Introspect(TokenActionRequest{Token: tokens.AccessToken, TokenTypeHint: "refresh_token", ClientID: resourceServer.Client.ClientID, ClientSecret: resourceServer.ClientSecret})
+	if err != nil || !wrongHint.Active {
+		t.Fatalf("access token with a refresh_token hint = %+v: %v", wrongHint, err)
+	}
+
+	// Only access and refresh tokens are introspected
+	reset, _ := util.GenerateResetPasswordToken(user.ID, user.Email, testJWTSecret)
+	if introspect(reset).Active {
+		t.Fatal("password reset token is active")
+	}
+	untyped, _ := util.GenerateTokenWithClaims(util.JWTClaims{UserID: user.ID, SessionID: "session-1"}, testJWTSecret, time.Minute)
+	if introspect(untyped).Active {
+		t.Fatal("token without a type is active")
+	}
+
+	o.userRepo.SetActive(user.ID, false)
+	if introspect(tokens.AccessToken).Active {
+		t.Fatal("token of a deactivated user is active")
+	}
+	o.userRepo.SetActive(user.ID, true)
+
+	claims, _ := util.ValidateToken(tokens.AccessToken, testJWTSecret)
+	o.sessions.Revoke(claims.SessionID)
+	if introspect(tokens.AccessToken).Active {
+		t.Fatal("token of a revoked session is active")
+	}
+}
+
+func TestIntrospectionOfMachineTokensAndAPIKeys(t *testing.T) {
+	user := &model.User{ID: "user-1", Email: "ana@example.com", IsActive: true}
+	o := newTestOIDCService(t, user)
+	resourceServer := o.createWebClient(t, false)
+	introspect := func(token string) *IntrospectionResponse {
+		t.Helper()
+		resp, err := o.Introspect(TokenActionRequest{Token: token, ClientID: resourceServer.Client.ClientID, ClientSecret: resourceServer.ClientSecret})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	machine, _ := o.CreateClient(CreateOAuthClientRequest{Name: "svc", GrantTypes: []string{model.GrantTypeClientCredentials}, AllowedScopes: []string{model.PermissionUsersRead}}, model.AllPermissions, RequestMeta{})
+	tokens, _ := o.Token(TokenRequest{GrantType: model.GrantTypeClientCredentials, ClientID: machine.Client.ClientID, ClientSecret: machine.ClientSecret}, RequestMeta{})
+	if resp := introspect(tokens.AccessToken); !resp.Active || resp.ClientID != machine.Client.ClientID || resp.Username != "" {
+		t.Fatalf("client credentials token = %+v", resp)
+	}
+	o.DeleteClient(machine.Client.ClientID, RequestMeta{})
+	if introspect(tokens.AccessToken).Active {
+		t.Fatal("token of a deleted client is active")
+	}
+	if _, err := o.auth.AuthenticateAccessToken(tokens.AccessToken); err == nil {
+		t.Fatal("token of a deleted client accepted as a bearer token")
+	}
+
+	key, err := o.apiKeyService.Create(user.ID, CreateAPIKeyRequest{Name: "ci", Scopes: []string{model.ScopeProfileRead}}, sessionScopes, RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := introspect(key.Key); !resp.Active || resp.TokenType != "api_key" || resp.Subject != user.ID || resp.Scope != model.ScopeProfileRead {
+		t.Fatalf("API key = %+v", resp)
+	}
+	if err := o.Revoke(TokenActionRequest{Token: key.Key, ClientID: resourceServer.Client.ClientID, ClientSecret: resourceServer.ClientSecret}, RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if introspect(key.Key).Active {
+		t.Fatal("revoked API key is active")
+	}
+}
+
+func TestRevocation(t *testing.T) {
+	user := &model.User{ID: "user-1", Email: "ana@example.com", IsActive: true}
+	o := newTestOIDCService(t, user)
+	client := o.createWebClient(t, false)
+	other := o.createWebClient(t, false)
+	tokens := o.issueCodeTokens(t, client, user.ID)
+
+	// Unknown tokens are not an error (RFC 7009 section 2.2)
+	if err := o.Revoke(TokenActionRequest{Token: "unknown", ClientID: client.Client.ClientID, ClientSecret: client.ClientSecret}, RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Revoke(TokenActionRequest{Token: tokens.RefreshToken, ClientID: client.Client.ClientID, ClientSecret: "wrong"}, RequestMeta{}); err == nil {
+		t.Fatal("revocation accepted without client authentication")
+	}
+	if err := o.Revoke(TokenActionRequest{Token: tokens.RefreshToken, ClientID: other.Client.ClientID, ClientSecret: other.ClientSecret}, RequestMeta{}); err == nil {
+		t.Fatal("another client revoked the token")
+	}
+
+	// Tokens of other kinds are ignored even when they name the session
+	claims, _ := util.ValidateRefreshToken(tokens.RefreshToken, testJWTSecret)
+	untyped, _ := util.GenerateTokenWithClaims(util.JWTClaims{UserID: user.ID, SessionID: claims.SessionID}, testJWTSecret, time.Minute)
+	if err := o.Revoke(TokenActionRequest{Token: untyped, ClientID: client.Client.ClientID, ClientSecret: client.ClientSecret}, RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.auth.AuthenticateAccessToken(tokens.AccessToken); err != nil {
+		t.Fatalf("token without a type revoked the session: %v", err)
+	}
+
+	if err := o.Revoke(TokenActionRequest{Token: tokens.RefreshToken, TokenTypeHint: "refresh_token", ClientID: client.Client.ClientID, ClientSecret: client.ClientSecret}, RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Token(TokenRequest{GrantType: model.GrantTypeRefreshToken, RefreshToken: tokens.RefreshToken, ClientID: client.Client.ClientID, ClientSecret: client.ClientSecret}, RequestMeta{}); err == nil {
+		t.Fatal("revoked refresh token still refreshes")
+	}
+	if _, err := o.auth.AuthenticateAccessToken(tokens.AccessToken); err == nil {
+		t.Fatal("access token of a revoked session still works")
+	}
+}
+
+func oauthErrorCode(err error) string {
+	if oauthErr, ok := err.(*OAuthError); ok {
+		return oauthErr.Code
+	}
+	return ""
+}
+
+func (o *testOIDC) createDeviceClient(t *testing.T) *CreateOAuthClientResponse {
+	t.Helper()
+	resp, err := o.CreateClient(CreateOAuthClientRequest{
+		Name:          "tv",
+		GrantTypes:    []string{model.GrantTypeDeviceCode},
+		AllowedScopes: []string{model.ScopeOpenID, model.ScopeProfileRead},
+		IsPublic:      true,
+	}, nil, RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestDeviceFlow(t *testing.T) {
+	user := &model.User{ID: "user-1", Email: "ana@example.com", IsActive: true}
+	o := newTestOIDCService(t, user)
+	client := o.createDeviceClient(t)
+
+	if _, err := o.DeviceAuthorization(DeviceAuthorizationRequest{ClientID: client.Client.ClientID, Scope: "openid users:read"}); oauthErrorCode(err) != "invalid_scope" {
+		t.Fatalf("scope outside the client's allowed scopes: %v", err)
+	}
+	device, err := o.DeviceAuthorization(DeviceAuthorizationRequest{ClientID: client.Client.ClientID, Scope: "openid profile:read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.Interval != deviceCodeInterval || !strings.Contains(device.VerificationURIComplete, url.QueryEscape(device.UserCode)) {
+		t.Fatalf("device authorization = %+v", device)
+	}
+
+	poll := TokenRequest{GrantType: model.GrantTypeDeviceCode, DeviceCode: device.DeviceCode, ClientID: client.Client.ClientID}
+	if _, err := o.Token(poll, RequestMeta{}); oauthErrorCode(err) != "authorization_pending" {
+		t.Fatalf("first poll: %v", err)
+	}
+	if _, err := o.Token(poll, RequestMeta{}); oauthErrorCode(err) != "slow_down" {
+		t.Fatalf("immediate second poll: %v", err)
+	}
+
+	// Users may type the code in lower case and without the dash
+	typed := strings.ToLower(strings.ReplaceAll(device.UserCode, "-", ""))
+	details, err := o.GetDeviceConsent(user.ID, typed)
+	if err != nil || !details.ConsentRequired || details.ClientID != client.Client.ClientID {
+		t.Fatalf("device consent = %+v, %v", details, err)
+	}
+	if err := o.DecideDevice(user.ID, typed, true, RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.DecideDevice(user.ID, typed, false, RequestMeta{}); err == nil {
+		t.Fatal("decided device code decided again")
+	}
+
+	tokens, err := o.Token(poll, RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens.Scope != "openid profile:read" || tokens.IDToken == "" || tokens.RefreshToken != "" {
+		t.Fatalf("device tokens = %+v", tokens)
+	}
+	if _, err := o.Token(poll, RequestMeta{}); oauthErrorCode(err) != "invalid_grant" {
+		t.Fatalf("device code used twice: %v", err)
+	}
+}
+
+func TestDeviceFlowDeniedAndExpired(t *testing.T) {
+	user := &model.User{ID: "user-1", Email: "ana@example.com", IsActive: true}
+	o := newTestOIDCService(t, user)
+	client := o.createDeviceClient(t)
+
+	denied, _ := o.DeviceAuthorization(DeviceAuthorizationRequest{ClientID: client.Client.ClientID, Scope: "openid"})
+	if err := o.DecideDevice(user.ID, denied.UserCode, false, RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Token(TokenRequest{GrantType: model.GrantTypeDeviceCode, DeviceCode: denied.DeviceCode, ClientID: client.Client.ClientID}, RequestMeta{}); oauthErrorCode(err) != "access_denied" {
+		t.Fatalf("denied device: %v", err)
+	}
+
+	expired, _ := o.DeviceAuthorization(DeviceAuthorizationRequest{ClientID: client.Client.ClientID, Scope: "openid"})
+	for _, code := range o.oauthRepo.deviceCodes {
+		if code.UserCode == expired.UserCode {
+			code.ExpiresAt = time.Now().Add(-time.Second)
+		}
+	}
+	if err := o.DecideDevice(user.ID, expired.UserCode, true, RequestMeta{}); err == nil {
+		t.Fatal("expired user code approved")
+	}
+	if _, err := o.Token(TokenRequest{GrantType: model.GrantTypeDeviceCode, DeviceCode: expired.DeviceCode, ClientID: client.Client.ClientID}, RequestMeta{}); oauthErrorCode(err) != "expired_token" {
+		t.Fatalf("expired device code: %v", err)
+	}
+
+	// A device code only works for the client it was issued to
+	other := o.createDeviceClient(t)
+	pending, _ := o.DeviceAuthorization(DeviceAuthorizationRequest{ClientID: client.Client.ClientID, Scope: "openid"})
+	if _, err := o.Token(TokenRequest{GrantType: model.GrantTypeDeviceCode, DeviceCode: pending.DeviceCode, ClientID: other.Client.ClientID}, RequestMeta{}); oauthErrorCode(err) != "invalid_grant" {
+		t.Fatalf("device code of another client: %v", err)
+	}
+}
+
+func TestUserCodeFormat(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		code, err := generateUserCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(code) != 9 || code[4] != '-' || strings.Trim(strings.ReplaceAll(code, "-", ""), userCodeAlphabet) != "" {
+			t.Fatalf("user code %q", code)
+		}
+		if normalizeUserCode(" "+strings.ToLower(code[:4])+" "+code[5:]) != code {
+			t.Fatalf("user code %q does not survive normalization", code)
+		}
+	}
+}
@@ -0,0 +1,495 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"yourapp/internal/config"
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+	"yourapp/internal/util"
+
+	"github.com/google/uuid"
+)
+
+type OrganizationService interface {
+	CreateOrganization(req CreateOrganizationRequest, meta RequestMeta) (*model.Organization, error)
+	ListForUser(userID string) ([]model.Membership, error)
+	GetOrganization(orgID string) (*model.Organization, error)
+	GetMembership(orgID, userID string) (*model.Membership, error)
+	ListMembers(orgID string) ([]model.Membership, error)
+	RemoveMember(orgID, userID string, meta RequestMeta) error
+	Invite(orgID string, req InviteRequest, meta RequestMeta) (*model.Invitation, error)
+	ListInvitations(orgID string) ([]model.Invitation, error)
+	GetInvitation(token string) (*InvitationPreview, error)
+	AcceptInvitation(token string, meta RequestMeta) (*model.Membership, error)
+	AcceptInvitationWithRegistration(req InvitedRegisterRequest, meta RequestMeta) (*AuthResponse, *model.Membership, error)
+	SwitchOrganization(userID, sessionID, orgID string, scopes []string) (*AuthResponse, error)
+	AddDomain(orgID, domain string, meta RequestMeta) (*model.OrganizationDomain, error)
+	ListDomains(orgID string) ([]model.OrganizationDomain, error)
+	VerifyDomain(orgID, domain string, meta RequestMeta) (*model.OrganizationDomain, error)
+	RemoveDomain(orgID, domain string, meta RequestMeta) error
+}
+
+// invitationTTL is how long an emailed invitation link stays valid
+const invitationTTL = 7 * 24 * time.Hour
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+
+var domainPattern = regexp.MustCompile(`^(?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,}$`)
+
+type organizationService struct {
+	orgRepo     repository.OrganizationRepository
+	userRepo    repository.UserRepository
+	authService AuthService
+	auditLogger AuditLogger
+	jwtSecret   string
+	config      *config.Config
+
+	lookupTXT func(name string) ([]string, error)
+}
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+	Slug string `json:"slug,omitempty"`
+}
+
+type InviteRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role,omitempty"` // admin, member (default)
+}
+
+// InvitationPreview is shown to invitees before they accept
+type InvitationPreview struct {
+	Organization  *model.Organization `json:"organization"`
+	Email         string              `json:"email"`
+	Role          string              `json:"role"`
+	ExpiresAt     time.Time           `json:"expires_at"`
+	AccountExists bool                `json:"account_exists"`
+}
+
+func NewOrganizationService(orgRepo repository.OrganizationRepository, userRepo repository.UserRepository, authService AuthService, auditLogger AuditLogger, cfg *config.Config) OrganizationService {
+	return &organizationService{
+		orgRepo:     orgRepo,
+		userRepo:    userRepo,
+		authService: authService,
+		auditLogger: auditLogger,
+		jwtSecret:   cfg.JWTSecret,
+		config:      cfg,
+
+		lookupTXT: net.LookupTXT,
+	}
+}
+
+func (s *organizationService) CreateOrganization(req CreateOrganizationRequest, meta RequestMeta) (*model.Organization, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, errors.New("organization name is required")
+	}
+
+	slug := strings.ToLower(strings.TrimSpace(req.Slug))
+	if slug == "" {
+		generated, err := s.generateSlug(name)
+		if err != nil {
+			return nil, err
+		}
+		slug = generated
+	} else {
+		if !slugPattern.MatchString(slug) || len(slug) > 100 {
+			return nil, errors.New("slug may only contain lowercase letters, numbers and dashes")
+		}
+		if existing, _ := s.orgRepo.FindBySlug(slug); existing != nil {
+			return nil, errors.New("slug already taken")
+		}
+	}
+
+	org := &model.Organization{
+		Name:        name,
+		Slug:        slug,
+		CreatedByID: meta.ActorID,
+	}
+	if err := s.orgRepo.CreateWithOwner(org, meta.ActorID); err != nil {
+		return nil, fmt.Errorf("failed to create organization: %w", err)
+	}
+
+	s.auditLogger.Log(model.AuditActionOrgCreated, meta, meta.ActorID, model.JSONMap{
+		"org_id": org.ID,
+		"slug":   org.Slug,
+	})
+	return org, nil
+}
+
+// generateSlug derives a URL-safe slug from the name, adding a random suffix on collision
+func (s *organizationService) generateSlug(name string) (string, error) {
+	base := strings.Trim(regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if base == "" {
+		base = "org"
+	}
+	if len(base) > 80 {
+		base = strings.TrimRight(base[:80], "-")
+	}
+
+	slug := base
+	for attempt := 0; attempt < 5; attempt++ {
+		if existing, _ := s.orgRepo.FindBySlug(slug); existing == nil {
+			return slug, nil
+		}
+		suffix, err := util.GenerateSecureToken(3)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate slug: %w", err)
+		}
+		slug = base + "-" + suffix
+	}
+	return "", errors.New("could not generate a unique slug, please choose one")
+}
+
+func (s *organizationService) ListForUser(userID string) ([]model.Membership, error) {
+	return s.orgRepo.FindMembershipsByUserID(userID)
+}
+
+func (s *organizationService) GetOrganization(orgID string) (*model.Organization, error) {
+	org, err := s.orgRepo.FindByID(orgID)
+	if err != nil {
+		return nil, errors.New("organization not found")
+	}
+	return org, nil
+}
+
+// GetMembership returns the user's membership in a live organization
+func (s *organizationService) GetMembership(orgID, userID string) (*model.Membership, error) {
+	if _, err := s.orgRepo.FindByID(orgID); err != nil {
+		return nil, errors.New("organization not found")
+	}
+
+	membership, err := s.orgRepo.FindMembership(orgID, userID)
+	if err != nil {
+		return nil, errors.New("you are not a member of this organization")
+	}
+	return membership, nil
+}
+
+func (s *organizationService) ListMembers(orgID string) ([]model.Membership, error) {
+	return s.orgRepo.FindMembersByOrgID(orgID)
+}
+
+// RemoveMember removes a member; owners cannot be removed and admins may
+// only remove plain members
+func (s *organizationService) RemoveMember(orgID, userID string, meta RequestMeta) error {
+	actor, err := s.orgRepo.FindMembership(orgID, meta.ActorID)
+	if err != nil {
+		return errors.New("you are not a member of this organization")
+	}
+
+	target, err := s.orgRepo.FindMembership(orgID, userID)
+	if err != nil {
+		return errors.New("member not found")
+	}
+
+	if target.Role == model.OrgRoleOwner {
+		return errors.New("the organization owner cannot be removed")
+	}
+	if actor.Role != model.OrgRoleOwner && target.Role != model.OrgRoleMember {
+		return errors.New("only the owner can remove admins")
+	}
+
+	if err := s.orgRepo.DeleteMembership(orgID, userID); err != nil {
+		return fmt.Errorf("failed to remove member: %w", err)
+	}
+
+	s.auditLogger.Log(model.AuditActionOrgMemberRemoved, meta, userID, model.JSONMap{
+		"org_id": orgID,
+		"role":   target.Role,
+	})
+	return nil
+}
+
+// Invite emails a signed invitation link; a newer invitation to the same
+// address replaces any pending one
+func (s *organizationService) Invite(orgID string, req InviteRequest, meta RequestMeta) (*model.Invitation, error) {
+	org, err := s.orgRepo.FindByID(orgID)
+	if err != nil {
+		return nil, errors.New("organization not found")
+	}
+
+	inviter, err := s.orgRepo.FindMembership(orgID, meta.ActorID)
+	if err != nil {
+		return nil, errors.New("you are not a member of this organization")
+	}
+
+	role := req.Role
+	if role == "" {
+		role = model.OrgRoleMember
+	}
+	if role != model.OrgRoleMember && role != model.OrgRoleAdmin {
+		return nil, errors.New("role must be admin or member")
+	}
+	if role == model.OrgRoleAdmin && inviter.Role != model.OrgRoleOwner {
+		return nil, errors.New("only the owner can invite admins")
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	locale := "" // Unknown invitees get the default language
+	if user, _ := s.userRepo.FindByEmail(email); user != nil {
+		if _, err := s.orgRepo.FindMembership(orgID, user.ID); err == nil {
+			return nil, errors.New("user is already a member of this organization")
+		}
+		locale = user.Locale
+	}
+
+	if err := s.orgRepo.DeletePendingInvitations(orgID, email); err != nil {
+		return nil, fmt.Errorf("failed to replace pending invitation: %w", err)
+	}
+
+	invitation := &model.Invitation{
+		ID:             uuid.New().String(), // The emailed token embeds it, so it is set before saving
+		OrganizationID: orgID,
+		Email:          email,
+		Role:           role,
+		InvitedByID:    meta.ActorID,
+		ExpiresAt:      time.Now().Add(invitationTTL),
+	}
+
+	token, err := util.GenerateInviteToken(invitation.ID, orgID, email, s.jwtSecret, invitation.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate invitation token: %w", err)
+	}
+	inviteEmail, err := newEmailOutboxMessage(email, locale, util.OrgInviteEmailData{
+		OrgName:     org.Name,
+		Link:        fmt.Sprintf("%s/invitations/accept?token=%s", s.config.ClientURL, token),
+		ExpiresDays: int(invitationTTL / (24 * time.Hour)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.orgRepo.CreateInvitationWithOutbox(invitation, inviteEmail); err != nil {
+		return nil, fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	s.auditLogger.Log(model.AuditActionOrgInvitationSent, meta, "", model.JSONMap{
+		"org_id":        orgID,
+		"invitation_id": invitation.ID,
+		"email":         email,
+		"role":          role,
+	})
+	return invitation, nil
+}
+
+func (s *organizationService) ListInvitations(orgID string) ([]model.Invitation, error) {
+	return s.orgRepo.FindPendingInvitationsByOrgID(orgID)
+}
+
+// resolveInvitation validates the signed token and loads the pending invitation
+func (s *organizationService) resolveInvitation(token string) (*model.Invitation, error) {
+	claims, err := util.ValidateInviteToken(token, s.jwtSecret)
+	if err != nil {
+		return nil, errors.New("invalid or expired invitation")
+	}
+
+	invitation, err := s.orgRepo.FindInvitationByID(claims.InvitationID)
+	if err != nil || invitation.OrganizationID != claims.OrgID || !strings.EqualFold(invitation.Email, claims.Email) {
+		return nil, errors.New("invalid or expired invitation")
+	}
+
+	if !invitation.IsPending() || invitation.Organization == nil {
+		return nil, errors.New("invitation has already been used or has expired")
+	}
+
+	return invitation, nil
+}
+
+func (s *organizationService) GetInvitation(token string) (*InvitationPreview, error) {
+	invitation, err := s.resolveInvitation(token)
+	if err != nil {
+		return nil, err
+	}
+
+	existingUser, _ := s.userRepo.FindByEmail(invitation.Email)
+	return &InvitationPreview{
+		Organization:  invitation.Organization,
+		Email:         invitation.Email,
+		Role:          invitation.Role,
+		ExpiresAt:     invitation.ExpiresAt,
+		AccountExists: existingUser != nil,
+	}, nil
+}
+
+// AcceptInvitation adds the signed-in user to the organization; the account
+// email must match the invited address
+func (s *organizationService) AcceptInvitation(token string, meta RequestMeta) (*model.Membership, error) {
+	invitation, err := s.resolveInvitation(token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(meta.ActorID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if !strings.EqualFold(user.Email, invitation.Email) {
+		return nil, errors.New("this invitation was sent to a different email address")
+	}
+
+	return s.accept(invitation, user.ID, meta)
+}
+
+// AcceptInvitationWithRegistration creates an account for an invitee who has
+// not signed up yet and adds it to the organization
+func (s *organizationService) AcceptInvitationWithRegistration(req InvitedRegisterRequest, meta RequestMeta) (*AuthResponse, *model.Membership, error) {
+	invitation, err := s.resolveInvitation(req.Token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := s.authService.RegisterInvited(req, invitation.Email, meta)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	meta.ActorID = resp.User.ID
+	membership, err := s.accept(invitation, resp.User.ID, meta)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return resp, membership, nil
+}
+
+func (s *organizationService) accept(invitation *model.Invitation, userID string, meta RequestMeta) (*model.Membership, error) {
+	if _, err := s.orgRepo.FindMembership(invitation.OrganizationID, userID); err == nil {
+		return nil, errors.New("you are already a member of this organization")
+	}
+
+	if err := s.orgRepo.AcceptInvitation(invitation, userID); err != nil {
+		return nil, errors.New("invitation has already been used or has expired")
+	}
+
+	membership, err := s.orgRepo.FindMembership(invitation.OrganizationID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load membership: %w", err)
+	}
+	membership.Organization = invitation.Organization
+
+	s.auditLogger.Log(model.AuditActionOrgInvitationAccepted, meta, userID, model.JSONMap{
+		"org_id":        invitation.OrganizationID,
+		"invitation_id": invitation.ID,
+		"role":          invitation.Role,
+	})
+	return membership, nil
+}
+
+// SwitchOrganization reissues the session's tokens with an org_id claim,
+// keeping the caller's current scopes
+func (s *organizationService) SwitchOrganization(userID, sessionID, orgID string, scopes []string) (*AuthResponse, error) {
+	if sessionID == "" {
+		return nil, errors.New("organization switching requires a session token")
+	}
+
+	if _, err := s.GetMembership(orgID, userID); err != nil {
+		return nil, err
+	}
+
+	return s.authService.SwitchOrganization(userID, sessionID, orgID, scopes)
+}
+
+// DomainVerificationRecord returns the DNS TXT record that proves the
+// organization controls the domain
+func DomainVerificationRecord(d *model.OrganizationDomain) (name, value string) {
+	return "_yourapp-verification." + d.Domain, "yourapp-verification=" + d.VerificationToken
+}
+
+// AddDomain claims an email domain for the organization. It counts for SSO
+// and SCIM provisioning only once verified.
+func (s *organizationService) AddDomain(orgID, domain string, meta RequestMeta) (*model.OrganizationDomain, error) {
+	domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+	if !domainPattern.MatchString(domain) {
+		return nil, errors.New("invalid domain")
+	}
+	if _, err := s.orgRepo.FindDomain(orgID, domain); err == nil {
+		return nil, errors.New("domain has already been added")
+	}
+
+	token, err := util.GenerateSecureToken(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate verification token: %w", err)
+	}
+	d := &model.OrganizationDomain{
+		OrganizationID:    orgID,
+		Domain:            domain,
+		VerificationToken: token,
+	}
+	if err := s.orgRepo.CreateDomain(d); err != nil {
+		return nil, fmt.Errorf("failed to add domain: %w", err)
+	}
+
+	s.auditLogger.Log(model.AuditActionOrgDomainAdded, meta, "", model.JSONMap{"org_id": orgID, "domain": domain})
+	return d, nil
+}
+
+func (s *organizationService) ListDomains(orgID string) ([]model.OrganizationDomain, error) {
+	return s.orgRepo.FindDomainsByOrgID(orgID)
+}
+
+// VerifyDomain looks up the domain's verification record. A domain can be
+// verified by one organization only.
+func (s *organizationService) VerifyDomain(orgID, domain string, meta RequestMeta) (*model.OrganizationDomain, error) {
+	d, err := s.orgRepo.FindDomain(orgID, strings.ToLower(domain))
+	if err != nil {
+		return nil, errors.New("domain not found")
+	}
+	if d.VerifiedAt != nil {
+		return d, nil
+	}
+	if verified, err := s.orgRepo.FindVerifiedDomain(d.Domain); err == nil && verified.OrganizationID != orgID {
+		return nil, errors.New("domain is verified by another organization")
+	}
+
+	name, value := DomainVerificationRecord(d)
+	records, err := s.lookupTXT(name)
+	if err != nil {
+		return nil, fmt.Errorf("verification record %s not found", name)
+	}
+	found := false
+	for _, record := range records {
+		if strings.TrimSpace(record) == value {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("verification record %s does not contain %s", name, value)
+	}
+
+	if err := s.orgRepo.MarkDomainVerified(d.ID); err != nil {
+		return nil, fmt.Errorf("failed to verify domain: %w", err)
+	}
+
+	s.auditLogger.Log(model.AuditActionOrgDomainVerified, meta, "", model.JSONMap{"org_id": orgID, "domain": d.Domain})
+	return s.orgRepo.FindDomain(orgID, d.Domain)
+}
+
+func (s *organizationService) RemoveDomain(orgID, domain string, meta RequestMeta) error {
+	deleted, err := s.orgRepo.DeleteDomain(orgID, strings.ToLower(domain))
+	if err != nil {
+		return fmt.Errorf("failed to remove domain: %w", err)
+	}
+	if deleted == 0 {
+		return errors.New("domain not found")
+	}
+
+	s.auditLogger.Log(model.AuditActionOrgDomainRemoved, meta, "", model.JSONMap{"org_id": orgID, "domain": strings.ToLower(domain)})
+	return nil
+}
+
+// domainVerifiedBy reports whether the organization has verified the domain
+// of the email address
+func domainVerifiedBy(orgRepo repository.OrganizationRepository, orgID, email string) bool {
+	domain := strings.ToLower(email[strings.LastIndex(email, "@")+1:])
+	verified, err := orgRepo.FindVerifiedDomain(domain)
+	return err == nil && verified.OrganizationID == orgID
+}
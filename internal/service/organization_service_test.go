@@ -0,0 +1,231 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"yourapp/internal/config"
+	"yourapp/internal/model"
+	"yourapp/internal/util"
+)
+
+func newTestOrganizationService(t *testing.T, users ...*model.User) (OrganizationService, *fakeOrgRepo, *fakeUserRepo) {
+	t.Helper()
+	auth, userRepo, _, _ := newTestAuthService(t, nil, users...)
+	orgRepo := newFakeOrgRepo()
+	cfg := &config.Config{JWTSecret: testJWTSecret, ClientURL: "https://app.example.com"}
+	return NewOrganizationService(orgRepo, userRepo, auth, &fakeAuditLogger{}, cfg), orgRepo, userRepo
+}
+
+// invitationToken pulls the signed token out of the queued invitation email
+func invitationToken(t *testing.T, orgRepo *fakeOrgRepo, to string) string {
+	t.Helper()
+	orgRepo.mu.Lock()
+	defer orgRepo.mu.Unlock()
+	for i := len(orgRepo.outbox) - 1; i >= 0; i-- {
+		job, data, err := util.DecodeEmailJob(orgRepo.outbox[i].Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		invite, ok := data.(*util.OrgInviteEmailData)
+		if !ok || job.To != to {
+			continue
+		}
+		link, err := url.Parse(invite.Link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return link.Query().Get("token")
+	}
+	t.Fatalf("no invitation email queued for %s", to)
+	return ""
+}
+
+func TestInvitationAcceptedByInvitedAccountOnly(t *testing.T) {
+	owner := &model.User{ID: "owner", Email: "owner@example.com", IsActive: true}
+	invitee := &model.User{ID: "invitee", Email: "ana@example.com", IsActive: true}
+	stranger := &model.User{ID: "stranger", Email: "eve@example.com", IsActive: true}
+	s, orgRepo, _ := newTestOrganizationService(t, owner, invitee, stranger)
+
+	org, err := s.CreateOrganization(CreateOrganizationRequest{Name: "Acme Corp"}, RequestMeta{ActorID: owner.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if org.Slug != "acme-corp" {
+		t.Fatalf("slug = %q", org.Slug)
+	}
+
+	if _, err := s.Invite(org.ID, InviteRequest{Email: "Ana@Example.com"}, RequestMeta{ActorID: owner.ID}); err != nil {
+		t.Fatal(err)
+	}
+	token := invitationToken(t, orgRepo, "ana@example.com")
+
+	if _, err := s.AcceptInvitation(token, RequestMeta{ActorID: stranger.ID}); err == nil {
+		t.Fatal("invitation accepted by an account with another email")
+	}
+
+	membership, err := s.AcceptInvitation(token, RequestMeta{ActorID: invitee.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if membership.Role != model.OrgRoleMember || membership.OrganizationID != org.ID {
+		t.Fatalf("membership = %+v", membership)
+	}
+
+	if _, err := s.AcceptInvitation(token, RequestMeta{ActorID: invitee.ID}); err == nil {
+		t.Fatal("invitation accepted twice")
+	}
+}
+
+func TestInvitationTokenIsBoundToItsOrganization(t *testing.T) {
+	owner := &model.User{ID: "owner", Email: "owner@example.com", IsActive: true}
+	invitee := &model.User{ID: "invitee", Email: "ana@example.com", IsActive: true}
+	s, orgRepo, _ := newTestOrganizationService(t, owner, invitee)
+
+	org, _ := s.CreateOrganization(CreateOrganizationRequest{Name: "Acme"}, RequestMeta{ActorID: owner.ID})
+	other, _ := s.CreateOrganization(CreateOrganizationRequest{Name: "Other"}, RequestMeta{ActorID: owner.ID})
+	invitation, err := s.Invite(org.ID, InviteRequest{Email: invitee.Email}, RequestMeta{ActorID: owner.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forged, _ := util.GenerateInviteToken(invitation.ID, other.ID, invitee.Email, testJWTSecret, invitation.ExpiresAt)
+	if _, err := s.AcceptInvitation(forged, RequestMeta{ActorID: invitee.ID}); err == nil {
+		t.Fatal("invitation accepted into another organization")
+	}
+	unsigned, _ := util.GenerateInviteToken(invitation.ID, org.ID, invitee.Email, "other-secret", invitation.ExpiresAt)
+	if _, err := s.AcceptInvitation(unsigned, RequestMeta{ActorID: invitee.ID}); err == nil {
+		t.Fatal("invitation signed with another secret accepted")
+	}
+
+	// A newer invitation replaces the pending one
+	first := invitationToken(t, orgRepo, invitee.Email)
+	s.Invite(org.ID, InviteRequest{Email: invitee.Email}, RequestMeta{ActorID: owner.ID})
+	if _, err := s.AcceptInvitation(first, RequestMeta{ActorID: invitee.ID}); err == nil {
+		t.Fatal("replaced invitation still accepted")
+	}
+}
+
+func TestInvitationRegistersNewAccount(t *testing.T) {
+	owner := &model.User{ID: "owner", Email: "owner@example.com", IsActive: true}
+	s, orgRepo, userRepo := newTestOrganizationService(t, owner)
+
+	org, _ := s.CreateOrganization(CreateOrganizationRequest{Name: "Acme"}, RequestMeta{ActorID: owner.ID})
+	if _, err := s.Invite(org.ID, InviteRequest{Email: "new@example.com", Role: model.OrgRoleAdmin}, RequestMeta{ActorID: owner.ID}); err != nil {
+		t.Fatal(err)
+	}
+	token := invitationToken(t, orgRepo, "new@example.com")
+
+	preview, err := s.GetInvitation(token)
+	if err != nil || preview.AccountExists || preview.Organization.ID != org.ID {
+		t.Fatalf("preview = %+v, %v", preview, err)
+	}
+
+	resp, membership, err := s.AcceptInvitationWithRegistration(InvitedRegisterRequest{Token: token, FullName: "New", Password: "Secret123!"}, RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.AccessToken == "" || membership.Role != model.OrgRoleAdmin || membership.UserID != resp.User.ID {
+		t.Fatalf("registration = %+v, membership = %+v", resp, membership)
+	}
+	user, err := userRepo.FindByEmail("new@example.com")
+	if err != nil || !user.IsVerified {
+		t.Fatalf("invited account not created verified: %+v", user)
+	}
+}
+
+func TestOrganizationRolesLimitInvitesAndRemovals(t *testing.T) {
+	owner := &model.User{ID: "owner", Email: "owner@example.com", IsActive: true}
+	admin := &model.User{ID: "admin", Email: "admin@example.com", IsActive: true}
+	admin2 := &model.User{ID: "admin2", Email: "admin2@example.com", IsActive: true}
+	member := &model.User{ID: "member", Email: "member@example.com", IsActive: true}
+	s, orgRepo, _ := newTestOrganizationService(t, owner, admin, admin2, member)
+
+	org, _ := s.CreateOrganization(CreateOrganizationRequest{Name: "Acme"}, RequestMeta{ActorID: owner.ID})
+	orgRepo.CreateMembership(&model.Membership{OrganizationID: org.ID, UserID: admin.ID, Role: model.OrgRoleAdmin})
+	orgRepo.CreateMembership(&model.Membership{OrganizationID: org.ID, UserID: admin2.ID, Role: model.OrgRoleAdmin})
+	orgRepo.CreateMembership(&model.Membership{OrganizationID: org.ID, UserID: member.ID, Role: model.OrgRoleMember})
+
+	if _, err := s.Invite(org.ID, InviteRequest{Email: "x@example.com", Role: model.OrgRoleAdmin}, RequestMeta{ActorID: admin.ID}); err == nil {
+		t.Fatal("admin invited another admin")
+	}
+	if _, err := s.Invite(org.ID, InviteRequest{Email: "x@example.com", Role: model.OrgRoleOwner}, RequestMeta{ActorID: owner.ID}); err == nil {
+		t.Fatal("owner role handed out by invitation")
+	}
+	if _, err := s.Invite(org.ID, InviteRequest{Email: member.Email}, RequestMeta{ActorID: owner.ID}); err == nil {
+		t.Fatal("existing member invited again")
+	}
+
+	if err := s.RemoveMember(org.ID, owner.ID, RequestMeta{ActorID: admin.ID}); err == nil {
+		t.Fatal("owner removed")
+	}
+	if err := s.RemoveMember(org.ID, admin2.ID, RequestMeta{ActorID: admin.ID}); err == nil {
+		t.Fatal("admin removed another admin")
+	}
+	if err := s.RemoveMember(org.ID, member.ID, RequestMeta{ActorID: admin.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetMembership(org.ID, member.ID); err == nil {
+		t.Fatal("removed member still has a membership")
+	}
+}
+
+func TestDomainVerification(t *testing.T) {
+	s, orgRepo, _ := newTestOrganizationService(t)
+	records := map[string][]string{}
+	s.(*organizationService).lookupTXT = func(name string) ([]string, error) {
+		if values, ok := records[name]; ok {
+			return values, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	if _, err := s.AddDomain("org-a", "not a domain", RequestMeta{}); err == nil {
+		t.Fatal("invalid domain added")
+	}
+	domain, err := s.AddDomain("org-a", " Example.COM. ", RequestMeta{})
+	if err != nil || domain.Domain != "example.com" || domain.VerifiedAt != nil {
+		t.Fatalf("domain = %+v: %v", domain, err)
+	}
+	if _, err := s.AddDomain("org-a", "example.com", RequestMeta{}); err == nil {
+		t.Fatal("domain added twice")
+	}
+
+	name, value := DomainVerificationRecord(domain)
+	if _, err := s.VerifyDomain("org-a", "example.com", RequestMeta{}); err == nil {
+		t.Fatal("domain verified without its DNS record")
+	}
+	records[name] = []string{"v=spf1 -all", "yourapp-verification=wrong"}
+	if _, err := s.VerifyDomain("org-a", "example.com", RequestMeta{}); err == nil {
+		t.Fatal("domain verified by another token")
+	}
+	records[name] = append(records[name], value)
+	if verified, err := s.VerifyDomain("org-a", "example.com", RequestMeta{}); err != nil || verified.VerifiedAt == nil {
+		t.Fatalf("domain = %+v: %v", verified, err)
+	}
+	if !domainVerifiedBy(orgRepo, "org-a", "ana@Example.com") || domainVerifiedBy(orgRepo, "org-b", "ana@example.com") {
+		t.Fatal("verified domain attributed to the wrong organization")
+	}
+
+	// Another organization can claim the domain but never verify it
+	other, err := s.AddDomain("org-b", "example.com", RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, value = DomainVerificationRecord(other)
+	records[name] = []string{value}
+	if _, err := s.VerifyDomain("org-b", "example.com", RequestMeta{}); err == nil {
+		t.Fatal("a second organization verified the domain")
+	}
+
+	if err := s.RemoveDomain("org-a", "example.com", RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if domainVerifiedBy(orgRepo, "org-a", "ana@example.com") {
+		t.Fatal("removed domain still verified")
+	}
+	if err := s.RemoveDomain("org-a", "example.com", RequestMeta{}); err == nil {
+		t.Fatal("removed a domain that does not exist")
+	}
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+	"yourapp/internal/util"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	outboxPollInterval = time.Second
+	outboxBatchSize    = 100
+	// outboxLease is how long a claimed message is hidden from other relays
+	outboxLease = time.Minute
+	// outboxMaxRetryDelay caps the backoff between failed publishes
+	outboxMaxRetryDelay = 5 * time.Minute
+	// outboxRetention is how long sent messages are kept for troubleshooting
+	outboxRetention = 7 * 24 * time.Hour
+)
+
+// outboxPublisher is the part of util.RabbitMQClient the relay uses
+type outboxPublisher interface {
+	PublishConfirmed(exchange, routingKey string, msg amqp.Publishing) error
+}
+
+// OutboxRelay publishes committed outbox messages to RabbitMQ. A message is
+// marked sent only after the broker confirms it, so every message is
+// delivered at least once; the email worker's idempotency keys absorb the
+// duplicates this can cause.
+type OutboxRelay struct {
+	outboxRepo repository.OutboxRepository
+	rabbitMQ   outboxPublisher
+	metrics    *WorkerMetrics
+
+	started  atomic.Bool
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func NewOutboxRelay(outboxRepo repository.OutboxRepository, rabbitMQ *util.RabbitMQClient, metrics *WorkerMetrics) *OutboxRelay {
+	return &OutboxRelay{
+		outboxRepo: outboxRepo,
+		rabbitMQ:   rabbitMQ,
+		metrics:    metrics,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// Start polls the outbox in the background until Stop is called
+func (r *OutboxRelay) Start() {
+	r.started.Store(true)
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(outboxPollInterval)
+		defer ticker.Stop()
+		lastCleanup := time.Time{}
+
+		for {
+			// Keep draining while batches come back full
+			for {
+				relayed, err := r.relayBatch()
+				if err != nil {
+					log.Printf("Outbox relay error: %v", err)
+				}
+				if relayed < outboxBatchSize {
+					break
+				}
+			}
+
+			if time.Since(lastCleanup) > time.Hour {
+				if deleted, err := r.outboxRepo.DeleteSentBefore(time.Now().Add(-outboxRetention)); err != nil {
+					log.Printf("Failed to clean up outbox: %v", err)
+				} else if deleted > 0 {
+					log.Printf("Removed %d sent outbox messages", deleted)
+				}
+				lastCleanup = time.Now()
+			}
+
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	log.Println("Outbox relay started")
+}
+
+// Stop stops polling and waits for the batch in flight to finish
+func (r *OutboxRelay) Stop() {
+	r.stopOnce.Do(func() {
+		log.Println("Stopping outbox relay...")
+		close(r.stop)
+	})
+	if r.started.Load() {
+		<-r.done
+	}
+}
+
+// relayBatch publishes one batch of due messages and returns how many it claimed
+func (r *OutboxRelay) relayBatch() (int, error) {
+	messages, err := r.outboxRepo.ClaimPending(outboxBatchSize, outboxLease)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim outbox messages: %w", err)
+	}
+
+	for i := range messages {
+		message := &messages[i]
+		err := r.rabbitMQ.PublishConfirmed(message.Exchange, message.RoutingKey, amqp.Publishing{
+			ContentType:  "application/json",
+			Body:         message.Payload,
+			DeliveryMode: amqp.Persistent,
+			MessageId:    message.MessageID,
+			Type:         message.Type,
+			Timestamp:    message.CreatedAt,
+		})
+		r.metrics.recordOutbox(err == nil)
+		if err != nil {
+			retryAt := time.Now().Add(outboxRetryDelay(message.Attempts))
+			log.Printf("Failed to relay outbox message %s (attempt %d), retrying at %s: %v", message.ID, message.Attempts, retryAt.Format(time.RFC3339), err)
+			if markErr := r.outboxRepo.MarkFailed(message.ID, err.Error(), retryAt); markErr != nil {
+				log.Printf("Failed to record outbox failure %s: %v", message.ID, markErr)
+			}
+			continue
+		}
+
+		// If this fails the message is published again once its lease ends
+		if err := r.outboxRepo.MarkSent(message.ID); err != nil {
+			log.Printf("Failed to mark outbox message %s sent: %v", message.ID, err)
+		}
+	}
+	return len(messages), nil
+}
+
+// outboxRetryDelay doubles from one second per attempt up to the cap
+func outboxRetryDelay(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	if attempts > 10 {
+		return outboxMaxRetryDelay
+	}
+	delay := time.Second << uint(attempts-1)
+	if delay > outboxMaxRetryDelay {
+		delay = outboxMaxRetryDelay
+	}
+	return delay
+}
+
+// newEmailOutboxMessage wraps an email job for the outbox
+func newEmailOutboxMessage(to, locale string, data util.EmailData) (*model.OutboxMessage, error) {
+	job, err := util.NewEmailJob(to, locale, data)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal email job: %w", err)
+	}
+	return &model.OutboxMessage{
+		Exchange:   util.EmailExchange,
+		RoutingKey: util.EmailRoutingKey,
+		MessageID:  job.IdempotencyKey,
+		Type:       job.Type,
+		Payload:    payload,
+		CreatedAt:  job.CreatedAt,
+	}, nil
+}
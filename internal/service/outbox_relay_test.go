@@ -0,0 +1,226 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+	"yourapp/internal/util"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// fakeOutboxRepo hands out every unsent message that is due, like
+// ClaimPending does for a single relay
+type fakeOutboxRepo struct {
+	repository.OutboxRepository
+	mu       sync.Mutex
+	messages []*model.OutboxMessage
+}
+
+func (r *fakeOutboxRepo) ClaimPending(limit int, lease time.Duration) ([]model.OutboxMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var claimed []model.OutboxMessage
+	for _, m := range r.messages {
+		if len(claimed) == limit {
+			break
+		}
+		if m.SentAt == nil && !m.AvailableAt.After(now) {
+			m.AvailableAt = now.Add(lease)
+			m.Attempts++
+			claimed = append(claimed, *m)
+		}
+	}
+	return claimed, nil
+}
+
+func (r *fakeOutboxRepo) find(id string) *model.OutboxMessage {
+	for _, m := range r.messages {
+		if m.ID == id {
+			return m
+		}
+	}
+	return nil
+}
+
+func (r *fakeOutboxRepo) MarkSent(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.find(id).SentAt = &now
+	return nil
+}
+
+func (r *fakeOutboxRepo) MarkFailed(id string, reason string, retryAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := r.find(id)
+	m.LastError = reason
+	m.AvailableAt = retryAt
+	return nil
+}
+
+func (r *fakeOutboxRepo) DeleteSentBefore(before time.Time) (int64, error) {
+	return 0, nil
+}
+
+// fakePublisher confirms every publish unless the broker is down
+type fakePublisher struct {
+	mu        sync.Mutex
+	down      bool
+	published []amqp.Publishing
+}
+
+func (p *fakePublisher) PublishConfirmed(exchange, routingKey string, msg amqp.Publishing) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.down {
+		return errors.New("message was not confirmed")
+	}
+	p.published = append(p.published, msg)
+	return nil
+}
+
+func newTestOutboxRelay(t *testing.T, messages ...*model.OutboxMessage) (*OutboxRelay, *fakePublisher) {
+	t.Helper()
+	for i, m := range messages {
+		m.ID = fmt.Sprintf("outbox-%d", i+1)
+	}
+	repo := &fakeOutboxRepo{messages: messages}
+	publisher := &fakePublisher{}
+	r := NewOutboxRelay(repo, nil, NewWorkerMetrics())
+	r.rabbitMQ = publisher
+	return r, publisher
+}
+
+func testOutboxEmail(t *testing.T) *model.OutboxMessage {
+	t.Helper()
+	m, err := newEmailOutboxMessage("ana@example.com", "en", util.OTPEmailData{Code: "123456", ExpiresMinutes: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestNewEmailOutboxMessage(t *testing.T) {
+	m := testOutboxEmail(t)
+	if m.Exchange != util.EmailExchange || m.RoutingKey != util.EmailRoutingKey || m.Type != util.EmailTypeOTP {
+		t.Fatalf("message = %+v", m)
+	}
+	// The worker decodes exactly what the relay publishes
+	job, data, err := util.DecodeEmailJob(m.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.IdempotencyKey != m.MessageID || job.To != "ana@example.com" || data.(*util.OTPEmailData).Code != "123456" {
+		t.Fatalf("job = %+v, data = %+v", job, data)
+	}
+}
+
+func TestOutboxRelayPublishesAndMarksSent(t *testing.T) {
+	first, second := testOutboxEmail(t), testOutboxEmail(t)
+	r, publisher := newTestOutboxRelay(t, first, second)
+
+	relayed, err := r.relayBatch()
+	if err != nil || relayed != 2 {
+		t.Fatalf("relayed %d: %v", relayed, err)
+	}
+	if len(publisher.published) != 2 {
+		t.Fatalf("published %d messages", len(publisher.published))
+	}
+	p := publisher.published[0]
+	if p.MessageId != first.MessageID || p.Type != util.EmailTypeOTP || p.DeliveryMode != amqp.Persistent || string(p.Body) != string(first.Payload) {
+		t.Fatalf("publishing = %+v", p)
+	}
+	if first.SentAt == nil || second.SentAt == nil {
+		t.Fatal("confirmed messages were not marked sent")
+	}
+
+	// Sent messages are not published again
+	if relayed, _ := r.relayBatch(); relayed != 0 {
+		t.Fatalf("relayed %d sent messages again", relayed)
+	}
+	if r.metrics.outboxPublished.Load() != 2 {
+		t.Fatalf("published metric = %d", r.metrics.outboxPublished.Load())
+	}
+}
+
+func TestOutboxRelayBacksOffWhenTheBrokerIsDown(t *testing.T) {
+	m := testOutboxEmail(t)
+	r, publisher := newTestOutboxRelay(t, m)
+	publisher.down = true
+
+	before := time.Now()
+	if _, err := r.relayBatch(); err != nil {
+		t.Fatal(err)
+	}
+	if m.SentAt != nil || m.LastError == "" {
+		t.Fatalf("unconfirmed message: sent %v, last error %q", m.SentAt, m.LastError)
+	}
+	// The first failure waits a second, well inside the lease
+	if wait := m.AvailableAt.Sub(before); wait < time.Second || wait > 2*time.Second {
+		t.Fatalf("retry in %v, want about a second", wait)
+	}
+	if r.metrics.outboxFailed.Load() != 1 {
+		t.Fatalf("failed metric = %d", r.metrics.outboxFailed.Load())
+	}
+
+	// Once due again it is published after the broker recovers
+	publisher.down = false
+	m.AvailableAt = time.Now()
+	if _, err := r.relayBatch(); err != nil {
+		t.Fatal(err)
+	}
+	if m.SentAt == nil || m.Attempts != 2 {
+		t.Fatalf("sent %v after %d attempts", m.SentAt, m.Attempts)
+	}
+}
+
+func TestOutboxRetryDelay(t *testing.T) {
+	cases := map[int]time.Duration{
+		0:    time.Second,
+		1:    time.Second,
+		2:    2 * time.Second,
+		5:    16 * time.Second,
+		9:    256 * time.Second,
+		10:   outboxMaxRetryDelay,
+		1000: outboxMaxRetryDelay, // No overflow however often it failed
+	}
+	for attempts, want := range cases {
+		if got := outboxRetryDelay(attempts); got != want {
+			t.Errorf("attempt %d: delay = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestOutboxRelayStartStop(t *testing.T) {
+	m := testOutboxEmail(t)
+	r, publisher := newTestOutboxRelay(t, m)
+
+	r.Start()
+	deadline := time.Now().Add(time.Second)
+	for {
+		publisher.mu.Lock()
+		published := len(publisher.published)
+		publisher.mu.Unlock()
+		if published == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("relay did not publish the pending message")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	r.Stop()
+	r.Stop()
+
+	// A relay that never started stops without waiting
+	unstarted, _ := newTestOutboxRelay(t)
+	unstarted.Stop()
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"yourapp/internal/config"
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+)
+
+// defaultRoles are created on startup; admin is granted every known permission
+var defaultRoles = []struct {
+	Name        string
+	Description string
+	Permissions []string
+}{
+	{
+		Name:        model.RoleMember,
+		Description: "Default role for registered users",
+	},
+	{
+		Name:        model.RoleAdmin,
+		Description: "Full administrative access",
+		Permissions: model.AllPermissions,
+	},
+}
+
+type RBACService interface {
+	SeedDefaults() error
+	AssignDefaultRoles(user *model.User) error
+	PromoteConfiguredAdmin(user *model.User) error
+	SetUserRoles(userID string, roleNames []string) error
+	GetUserRoleNames(user *model.User) ([]string, error)
+	GetUserPermissions(user *model.User) ([]string, error)
+	GetDefaultScopes(user *model.User) ([]string, error)
+	ListRoles() ([]model.Role, error)
+}
+
+type rbacService struct {
+	roleRepo repository.RoleRepository
+	userRepo repository.UserRepository
+	config   *config.Config
+}
+
+func NewRBACService(roleRepo repository.RoleRepository, userRepo repository.UserRepository, cfg *config.Config) RBACService {
+	return &rbacService{
+		roleRepo: roleRepo,
+		userRepo: userRepo,
+		config:   cfg,
+	}
+}
+
+// SeedDefaults creates the built-in roles, clears untrusted legacy user types
+// and promotes configured admin users
+func (s *rbacService) SeedDefaults() error {
+	for _, role := range defaultRoles {
+		if _, err := s.roleRepo.EnsureRole(role.Name, role.Description, role.Permissions); err != nil {
+			return fmt.Errorf("failed to seed role %s: %w", role.Name, err)
+		}
+	}
+
+	if reset, err := s.roleRepo.ResetLegacyUserTypes(); err != nil {
+		return fmt.Errorf("failed to reset legacy user types: %w", err)
+	} else if reset > 0 {
+		log.Printf("Reset the legacy user type of %d users without roles to %s", reset, model.RoleMember)
+	}
+
+	for _, email := range s.config.AdminEmails {
+		user, err := s.userRepo.FindByEmail(email)
+		if err != nil {
+			continue // Promoted once they verify their email instead
+		}
+		// Only accounts whose owner proved the address with our own
+		// verification; IdP, directory and SCIM accounts are never promoted
+		if !user.IsVerified || user.LoginType != "credential" {
+			log.Printf("Warning: %s is listed in ADMIN_EMAILS but is not a verified password account, admin role not granted", email)
+			continue
+		}
+		if err := s.grantRole(user, model.RoleAdmin); err != nil {
+			return fmt.Errorf("failed to grant admin role to %s: %w", email, err)
+		}
+		log.Printf("Admin role granted to %s", email)
+	}
+
+	return nil
+}
+
+// AssignDefaultRoles gives a newly created user the member role. Admins
+// listed in ADMIN_EMAILS are promoted separately, once they prove they own
+// the address.
+func (s *rbacService) AssignDefaultRoles(user *model.User) error {
+	roleNames := []string{model.RoleMember}
+	if err := s.SetUserRoles(user.ID, roleNames); err != nil {
+		return err
+	}
+	user.UserType = primaryRole(roleNames)
+	return nil
+}
+
+// PromoteConfiguredAdmin grants the admin role to a user listed in
+// ADMIN_EMAILS. Callers must only use it right after the user proved
+// ownership of the address, by an emailed OTP or invitation token; an email
+// asserted by an identity provider, the directory or SCIM proves nothing.
+func (s *rbacService) PromoteConfiguredAdmin(user *model.User) error {
+	if !s.isAdminEmail(user.Email) {
+		return nil
+	}
+	if err := s.grantRole(user, model.RoleAdmin); err != nil {
+		return fmt.Errorf("failed to grant admin role: %w", err)
+	}
+	user.UserType = model.RoleAdmin
+	log.Printf("Admin role granted to %s", user.Email)
+	return nil
+}
+
+// SetUserRoles replaces the user's roles and keeps users.user_type in sync
+func (s *rbacService) SetUserRoles(userID string, roleNames []string) error {
+	if len(roleNames) == 0 {
+		return errors.New("at least one role is required")
+	}
+
+	roleIDs := make([]string, 0, len(roleNames))
+	seen := make(map[string]bool, len(roleNames))
+	for _, name := range roleNames {
+		// A repeated name would insert the same user_roles row twice
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		role, err := s.roleRepo.FindByName(name)
+		if err != nil {
+			return fmt.Errorf("role %q not found", name)
+		}
+		roleIDs = append(roleIDs, role.ID)
+	}
+
+	if err := s.roleRepo.SetUserRoles(userID, roleIDs); err != nil {
+		return fmt.Errorf("failed to set user roles: %w", err)
+	}
+
+	return s.userRepo.UpdateUserType(userID, primaryRole(roleNames))
+}
+
+// GetUserRoleNames returns the user's role names. Accounts created before
+// roles existed have none and are members; their legacy user_type came from
+// the registration request and is never trusted.
+func (s *rbacService) GetUserRoleNames(user *model.User) ([]string, error) {
+	roles, err := s.roleRepo.FindByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(roles) == 0 {
+		return []string{model.RoleMember}, nil
+	}
+
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	return names, nil
+}
+
+func (s *rbacService) GetUserPermissions(user *model.User) ([]string, error) {
+	roleNames, err := s.GetUserRoleNames(user)
+	if err != nil {
+		return nil, err
+	}
+	return s.roleRepo.FindPermissionNamesByRoleNames(roleNames)
+}
+
+// GetDefaultScopes returns the scopes granted to a full login: every user
+// scope plus the permissions of the user's roles
+func (s *rbacService) GetDefaultScopes(user *model.User) ([]string, error) {
+	permissions, err := s.GetUserPermissions(user)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := append([]string{}, model.UserScopes...)
+	return append(scopes, permissions...), nil
+}
+
+func (s *rbacService) ListRoles() ([]model.Role, error) {
+	return s.roleRepo.FindAll()
+}
+
+// grantRole adds a role to the user without removing existing ones
+func (s *rbacService) grantRole(user *model.User, roleName string) error {
+	role, err := s.roleRepo.FindByName(roleName)
+	if err != nil {
+		return fmt.Errorf("role %q not found", roleName)
+	}
+
+	roleNames, err := s.GetUserRoleNames(user)
+	if err != nil {
+		return err
+	}
+
+	// Users without roles are implicitly members; make that explicit so the
+	// new role does not replace it
+	if roles, err := s.roleRepo.FindByUserID(user.ID); err == nil && len(roles) == 0 {
+		if member, err := s.roleRepo.FindByName(model.RoleMember); err == nil {
+			s.roleRepo.AddUserRole(user.ID, member.ID)
+		}
+	}
+
+	if err := s.roleRepo.AddUserRole(user.ID, role.ID); err != nil {
+		return err
+	}
+	return s.userRepo.UpdateUserType(user.ID, primaryRole(append(roleNames, roleName)))
+}
+
+func (s *rbacService) isAdminEmail(email string) bool {
+	for _, adminEmail := range s.config.AdminEmails {
+		if strings.EqualFold(adminEmail, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// primaryRole picks the role exposed in the legacy "role" token claim
+func primaryRole(roleNames []string) string {
+	for _, name := range roleNames {
+		if name == model.RoleAdmin {
+			return model.RoleAdmin
+		}
+	}
+	if len(roleNames) == 0 {
+		return model.RoleMember
+	}
+	return roleNames[0]
+}
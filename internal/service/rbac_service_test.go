@@ -0,0 +1,107 @@
+package service
+
+import (
+	"testing"
+
+	"yourapp/internal/config"
+	"yourapp/internal/model"
+)
+
+func TestLegacyUserTypeIsNotTrusted(t *testing.T) {
+	// Before roles existed, Register copied user_type from the request
+	user := &model.User{ID: "legacy", Email: "legacy@example.com", UserType: model.RoleAdmin}
+	rbac, _ := newTestRBAC(newFakeUserRepo(user), nil)
+
+	roles, err := rbac.GetUserRoleNames(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 1 || roles[0] != model.RoleMember {
+		t.Fatalf("roles = %v, want [member]", roles)
+	}
+
+	permissions, _ := rbac.GetUserPermissions(user)
+	if hasString(permissions, model.PermissionUsersWrite) {
+		t.Fatalf("legacy admin user_type granted %v", permissions)
+	}
+}
+
+func TestGrantRoleDoesNotPersistLegacyUserType(t *testing.T) {
+	user := &model.User{ID: "legacy", Email: "boss@example.com", UserType: "superuser", IsVerified: true, LoginType: "credential"}
+	rbac, roleRepo := newTestRBAC(newFakeUserRepo(user), &config.Config{AdminEmails: []string{"boss@example.com"}})
+
+	if err := rbac.PromoteConfiguredAdmin(user); err != nil {
+		t.Fatal(err)
+	}
+	roles, _ := rbac.GetUserRoleNames(user)
+	if len(roles) != 2 || !hasString(roles, model.RoleMember) || !hasString(roles, model.RoleAdmin) {
+		t.Fatalf("roles = %v, want member and admin", roles)
+	}
+	if roleRepo.hasRole(user.ID, "superuser") {
+		t.Fatal("legacy user_type was saved as a role")
+	}
+}
+
+func TestAssignDefaultRolesNeverGrantsAdmin(t *testing.T) {
+	user := &model.User{ID: "new", Email: "Boss@Example.com"}
+	rbac, roleRepo := newTestRBAC(newFakeUserRepo(user), &config.Config{AdminEmails: []string{"boss@example.com"}})
+
+	if err := rbac.AssignDefaultRoles(user); err != nil {
+		t.Fatal(err)
+	}
+	if roleRepo.hasRole(user.ID, model.RoleAdmin) || user.UserType != model.RoleMember {
+		t.Fatalf("new account listed in ADMIN_EMAILS was made admin before verifying its email")
+	}
+
+	if err := rbac.PromoteConfiguredAdmin(user); err != nil {
+		t.Fatal(err)
+	}
+	if !roleRepo.hasRole(user.ID, model.RoleAdmin) || user.UserType != model.RoleAdmin {
+		t.Fatal("verified account listed in ADMIN_EMAILS was not promoted")
+	}
+}
+
+func TestPromoteConfiguredAdminIgnoresUnlistedEmails(t *testing.T) {
+	user := &model.User{ID: "u", Email: "someone@example.com"}
+	rbac, roleRepo := newTestRBAC(newFakeUserRepo(user), &config.Config{AdminEmails: []string{"boss@example.com"}})
+
+	if err := rbac.PromoteConfiguredAdmin(user); err != nil {
+		t.Fatal(err)
+	}
+	if roleRepo.hasRole(user.ID, model.RoleAdmin) {
+		t.Fatal("unlisted user was promoted")
+	}
+}
+
+func TestSeedDefaultsOnlyPromotesVerifiedPasswordAccounts(t *testing.T) {
+	verified := &model.User{ID: "verified", Email: "a@example.com", IsVerified: true, LoginType: "credential"}
+	unverified := &model.User{ID: "unverified", Email: "b@example.com", LoginType: "credential"}
+	provisioned := &model.User{ID: "scim", Email: "c@example.com", IsVerified: true, LoginType: "saml"}
+	directory := &model.User{ID: "ldap", Email: "d@example.com", IsVerified: true, LoginType: model.LoginTypeLDAP}
+
+	_, roleRepo := newTestRBAC(newFakeUserRepo(verified, unverified, provisioned, directory), &config.Config{
+		AdminEmails: []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com"},
+	})
+
+	if !roleRepo.hasRole(verified.ID, model.RoleAdmin) {
+		t.Error("verified password account was not promoted")
+	}
+	for _, user := range []*model.User{unverified, provisioned, directory} {
+		if roleRepo.hasRole(user.ID, model.RoleAdmin) {
+			t.Errorf("%s account %s was promoted", user.LoginType, user.Email)
+		}
+	}
+}
+
+func TestSetUserRolesIgnoresRepeatedNames(t *testing.T) {
+	user := &model.User{ID: "user-1", Email: "ana@example.com"}
+	rbac, roleRepo := newTestRBAC(newFakeUserRepo(user), nil)
+
+	if err := rbac.SetUserRoles(user.ID, []string{model.RoleAdmin, model.RoleMember, model.RoleAdmin}); err != nil {
+		t.Fatal(err)
+	}
+	roles, _ := rbac.GetUserRoleNames(user)
+	if len(roles) != 2 || !roleRepo.hasRole(user.ID, model.RoleAdmin) || !roleRepo.hasRole(user.ID, model.RoleMember) {
+		t.Fatalf("roles = %v", roles)
+	}
+}
@@ -0,0 +1,11 @@
+package service
+
+// RequestMeta describes who made a request and from where, for sessions and audit records
+type RequestMeta struct {
+	ActorID        string // Authenticated user performing the action, empty for anonymous requests
+	ImpersonatorID string // Admin acting as ActorID through an impersonation token, if any
+	ClientID       string // OAuth client the request was made through; alone for service principals
+	IPAddress      string
+	UserAgent      string
+	RequestID      string
+}
@@ -0,0 +1,332 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"yourapp/internal/config"
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+	"yourapp/internal/util"
+)
+
+type SAMLService interface {
+	ConfigureProvider(orgID string, req ConfigureSAMLRequest, meta RequestMeta) (*model.SAMLProvider, error)
+	GetProvider(orgID string) (*model.SAMLProvider, error)
+	DeleteProvider(orgID string, meta RequestMeta) error
+	Metadata(slug string) ([]byte, error)
+	StartLogin(slug string) (string, error)
+	ConsumeResponse(slug, samlResponse string, meta RequestMeta) string
+	ExchangeCode(code string, meta RequestMeta) (*AuthResponse, error)
+}
+
+const (
+	// samlLoginTTL is how long the user has to sign in at the IdP
+	samlLoginTTL = 10 * time.Minute
+	// samlCodeTTL limits the one-time code the frontend exchanges for tokens
+	samlCodeTTL = 2 * time.Minute
+	// samlClockSkew tolerates clock differences with the IdP
+	samlClockSkew = 3 * time.Minute
+)
+
+type samlService struct {
+	samlRepo    repository.SAMLRepository
+	orgRepo     repository.OrganizationRepository
+	userRepo    repository.UserRepository
+	authService AuthService
+	rbacService RBACService
+	auditLogger AuditLogger
+	config      *config.Config
+}
+
+type ConfigureSAMLRequest struct {
+	MetadataXML    string `json:"metadata_xml" binding:"required"`
+	EmailAttribute string `json:"email_attribute,omitempty"`
+	NameAttribute  string `json:"name_attribute,omitempty"`
+}
+
+func NewSAMLService(samlRepo repository.SAMLRepository, orgRepo repository.OrganizationRepository, userRepo repository.UserRepository, authService AuthService, rbacService RBACService, auditLogger AuditLogger, cfg *config.Config) SAMLService {
+	return &samlService{
+		samlRepo:    samlRepo,
+		orgRepo:     orgRepo,
+		userRepo:    userRepo,
+		authService: authService,
+		rbacService: rbacService,
+		auditLogger: auditLogger,
+		config:      cfg,
+	}
+}
+
+// serviceProvider describes our SP for an organization. Each organization
+// gets its own entity ID so IdPs can tell tenants apart.
+func (s *samlService) serviceProvider(org *model.Organization) util.SAMLServiceProvider {
+	base := strings.TrimRight(s.config.APIURL, "/") + "/saml/" + org.Slug
+	return util.SAMLServiceProvider{
+		EntityID: base + "/metadata",
+		ACSURL:   base + "/acs",
+	}
+}
+
+func (s *samlService) ConfigureProvider(orgID string, req ConfigureSAMLRequest, meta RequestMeta) (*model.SAMLProvider, error) {
+	metadata, err := util.ParseSAMLIdPMetadata([]byte(req.MetadataXML))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := &model.SAMLProvider{
+		OrganizationID: orgID,
+		IdPEntityID:    metadata.EntityID,
+		SSOURL:         metadata.SSOURL,
+		Certificates:   metadata.Certificates,
+		EmailAttribute: strings.TrimSpace(req.EmailAttribute),
+		NameAttribute:  strings.TrimSpace(req.NameAttribute),
+	}
+	if err := s.samlRepo.SaveProvider(provider); err != nil {
+		return nil, fmt.Errorf("failed to save identity provider: %w", err)
+	}
+
+	s.auditLogger.Log(model.AuditActionOrgSAMLConfigured, meta, "", model.JSONMap{
+		"org_id":        orgID,
+		"idp_entity_id": metadata.EntityID,
+	})
+
+	return s.samlRepo.FindProviderByOrgID(orgID)
+}
+
+func (s *samlService) GetProvider(orgID string) (*model.SAMLProvider, error) {
+	provider, err := s.samlRepo.FindProviderByOrgID(orgID)
+	if err != nil {
+		return nil, errors.New("SAML is not configured for this organization")
+	}
+	return provider, nil
+}
+
+func (s *samlService) DeleteProvider(orgID string, meta RequestMeta) error {
+	deleted, err := s.samlRepo.DeleteProvider(orgID)
+	if err != nil {
+		return fmt.Errorf("failed to delete identity provider: %w", err)
+	}
+	if deleted == 0 {
+		return errors.New("SAML is not configured for this organization")
+	}
+
+	s.auditLogger.Log(model.AuditActionOrgSAMLRemoved, meta, "", model.JSONMap{"org_id": orgID})
+	return nil
+}
+
+func (s *samlService) Metadata(slug string) ([]byte, error) {
+	org, err := s.orgRepo.FindBySlug(slug)
+	if err != nil {
+		return nil, errors.New("organization not found")
+	}
+	return util.SAMLServiceProviderMetadata(s.serviceProvider(org)), nil
+}
+
+// StartLogin records a login request and returns the IdP URL carrying its AuthnRequest
+func (s *samlService) StartLogin(slug string) (string, error) {
+	org, provider, err := s.findProvider(slug)
+	if err != nil {
+		return "", err
+	}
+
+	// SAML IDs must not start with a digit
+	token, err := util.GenerateSecureToken(20)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate request ID: %w", err)
+	}
+	request := &model.SAMLLoginRequest{
+		ID:             "id-" + token,
+		OrganizationID: org.ID,
+		ExpiresAt:      time.Now().Add(samlLoginTTL),
+	}
+	if err := s.samlRepo.CreateLoginRequest(request); err != nil {
+		return "", fmt.Errorf("failed to start login: %w", err)
+	}
+
+	return util.SAMLAuthnRequestURL(s.serviceProvider(org), provider.SSOURL, request.ID, "", time.Now())
+}
+
+func (s *samlService) findProvider(slug string) (*model.Organization, *model.SAMLProvider, error) {
+	org, err := s.orgRepo.FindBySlug(slug)
+	if err != nil {
+		return nil, nil, errors.New("organization not found")
+	}
+	provider, err := s.samlRepo.FindProviderByOrgID(org.ID)
+	if err != nil {
+		return nil, nil, errors.New("SAML is not configured for this organization")
+	}
+	return org, provider, nil
+}
+
+// ConsumeResponse validates the IdP's response at the assertion consumer
+// service and returns where to send the browser: the frontend callback with
+// either a one-time code or an error
+func (s *samlService) ConsumeResponse(slug, samlResponse string, meta RequestMeta) string {
+	callback := s.config.ClientURL + "/sso/callback"
+
+	code, err := s.consumeResponse(slug, samlResponse, meta)
+	if err != nil {
+		log.Printf("SAML login for %s rejected: %v", slug, err)
+		s.auditLogger.Log(model.AuditActionLoginFailed, meta, "", model.JSONMap{
+			"via":    "saml",
+			"org":    slug,
+			"reason": err.Error(),
+		})
+		return callback + "?" + url.Values{"error": {err.Error()}}.Encode()
+	}
+
+	return callback + "?" + url.Values{"code": {code}}.Encode()
+}
+
+func (s *samlService) consumeResponse(slug, samlResponse string, meta RequestMeta) (string, error) {
+	org, provider, err := s.findProvider(slug)
+	if err != nil {
+		return "", err
+	}
+
+	certs, err := util.ParseSAMLCertificates(provider.Certificates)
+	if err != nil {
+		return "", err
+	}
+
+	assertion, err := util.ParseSAMLResponse(samlResponse, s.serviceProvider(org), provider.IdPEntityID, certs, time.Now(), samlClockSkew)
+	if err != nil {
+		return "", err
+	}
+
+	// IdP-initiated logins are refused: every assertion must answer one of
+	// our requests, which also makes it single-use
+	if assertion.InResponseTo == "" {
+		return "", errors.New("unsolicited responses are not accepted")
+	}
+	if claimed, err := s.samlRepo.AuthenticateLoginRequest(assertion.InResponseTo, org.ID); err != nil || claimed == 0 {
+		return "", errors.New("login request is unknown, expired or already used")
+	}
+
+	user, err := s.provisionUser(org, provider, assertion, meta)
+	if err != nil {
+		return "", err
+	}
+
+	code, err := util.GenerateSecureToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate login code: %w", err)
+	}
+	if err := s.samlRepo.SetLoginCode(assertion.InResponseTo, user.ID, util.HashToken(code)); err != nil {
+		return "", fmt.Errorf("failed to store login code: %w", err)
+	}
+	return code, nil
+}
+
+// provisionUser finds the assertion's user or creates it just in time as a
+// member of the organization. Existing accounts are only signed in when this
+// organization provisioned them, so an IdP cannot take over other accounts.
+// New accounts are verified only in domains the organization has verified.
+func (s *samlService) provisionUser(org *model.Organization, provider *model.SAMLProvider, assertion *util.SAMLAssertion, meta RequestMeta) (*model.User, error) {
+	email := assertion.NameID
+	if provider.EmailAttribute != "" {
+		email = assertion.Attribute(provider.EmailAttribute)
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return nil, errors.New("identity provider did not supply a valid email address")
+	}
+
+	if user, _ := s.userRepo.FindByEmail(email); user != nil {
+		if user.LoginType != model.LoginTypeSAML {
+			return nil, errors.New("an account with this email already exists; sign in with your password instead")
+		}
+		if !provisionedBy(s.orgRepo, user, org.ID) {
+			return nil, errors.New("account was provisioned by another organization")
+		}
+		return user, nil
+	}
+
+	name := ""
+	if provider.NameAttribute != "" {
+		name = assertion.Attribute(provider.NameAttribute)
+	}
+	if name == "" {
+		name = assertion.Attribute("displayName")
+	}
+	if name == "" {
+		name = email[:strings.Index(email, "@")]
+	}
+
+	user := &model.User{
+		Email:         email,
+		FullName:      name,
+		UserType:      model.RoleMember,
+		IsActive:      true,
+		IsVerified:    domainVerifiedBy(s.orgRepo, org.ID, email),
+		LoginType:     model.LoginTypeSAML,
+		ProvisionedBy: &org.ID,
+	}
+	if err := s.userRepo.Create(user); err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	if err := s.rbacService.AssignDefaultRoles(user); err != nil {
+		return nil, fmt.Errorf("failed to assign roles: %w", err)
+	}
+	if err := s.orgRepo.CreateMembership(&model.Membership{
+		OrganizationID: org.ID,
+		UserID:         user.ID,
+		Role:           model.OrgRoleMember,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to add member: %w", err)
+	}
+
+	meta.ActorID = user.ID
+	s.auditLogger.Log(model.AuditActionRegister, meta, user.ID, model.JSONMap{
+		"via":    "saml",
+		"org_id": org.ID,
+	})
+	return user, nil
+}
+
+// provisionedBy reports whether the organization created a SAML account and
+// so may sign it in or change it. SAML users can join other organizations by
+// invitation, and those must never control the account. Accounts created
+// before the provisioning organization was recorded count as provisioned by
+// their only organization.
+func provisionedBy(orgRepo repository.OrganizationRepository, user *model.User, orgID string) bool {
+	if user.LoginType != model.LoginTypeSAML {
+		return false
+	}
+	if user.ProvisionedBy != nil {
+		return *user.ProvisionedBy == orgID
+	}
+	memberships, err := orgRepo.FindMembershipsByUserID(user.ID)
+	return err == nil && len(memberships) == 1 && memberships[0].OrganizationID == orgID
+}
+
+// ExchangeCode trades the one-time code from the SSO callback for our usual tokens
+func (s *samlService) ExchangeCode(code string, meta RequestMeta) (*AuthResponse, error) {
+	invalid := errors.New("invalid or expired login code")
+
+	request, err := s.samlRepo.FindLoginRequestByCodeHash(util.HashToken(code))
+	if err != nil || request.UserID == nil || request.AuthenticatedAt == nil {
+		return nil, invalid
+	}
+	if request.ExchangedAt != nil || time.Since(*request.AuthenticatedAt) > samlCodeTTL {
+		return nil, invalid
+	}
+	if exchanged, err := s.samlRepo.MarkLoginExchanged(request.ID); err != nil || exchanged == 0 {
+		return nil, invalid
+	}
+
+	user, err := s.userRepo.FindByID(*request.UserID)
+	if err != nil {
+		return nil, invalid
+	}
+
+	return s.authService.SSOLogin(user, model.JSONMap{
+		"via":    "saml",
+		"org_id": request.OrganizationID,
+	}, meta)
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"testing"
+
+	"yourapp/internal/config"
+	"yourapp/internal/model"
+	"yourapp/internal/util"
+)
+
+func TestSAMLProvisioningVerifiesOnlyVerifiedDomains(t *testing.T) {
+	userRepo := newFakeUserRepo()
+	rbac, _ := newTestRBAC(userRepo, nil)
+	orgRepo := newFakeOrgRepo()
+	orgRepo.verifyDomain("org-a", "example.com")
+	s := NewSAMLService(nil, orgRepo, userRepo, nil, rbac, &fakeAuditLogger{}, &config.Config{}).(*samlService)
+	org := &model.Organization{ID: "org-a"}
+
+	inDomain, err := s.provisionUser(org, &model.SAMLProvider{}, &util.SAMLAssertion{NameID: "ana@example.com"}, RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !inDomain.IsVerified {
+		t.Fatal("user in a verified domain was not verified")
+	}
+
+	// The IdP vouches only for domains the organization proved it controls
+	outside, err := s.provisionUser(org, &model.SAMLProvider{}, &util.SAMLAssertion{NameID: "boss@other.com"}, RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outside.IsVerified {
+		t.Fatal("user outside the organization's domains was verified")
+	}
+	if membership, err := orgRepo.FindMembership(org.ID, outside.ID); err != nil || membership.Role != model.OrgRoleMember {
+		t.Fatalf("membership = %+v: %v", membership, err)
+	}
+}
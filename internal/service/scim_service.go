@@ -0,0 +1,1079 @@
+package service
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"yourapp/internal/config"
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+	"yourapp/internal/util"
+)
+
+// SCIMService provisions an organization's users from its identity provider.
+// Users are the organization's SAML members, so SCIM-created accounts sign in
+// through the organization's SAML connection. Only accounts the organization
+// provisioned can be changed; other SAML members can only be removed. Groups
+// are the organization roles admin and member.
+type SCIMService interface {
+	CreateToken(orgID string, req CreateSCIMTokenRequest, meta RequestMeta) (*CreateSCIMTokenResponse, error)
+	ListTokens(orgID string) ([]model.SCIMToken, error)
+	RevokeToken(orgID, tokenID string, meta RequestMeta) error
+	Authenticate(rawToken string) (*model.SCIMToken, error)
+	ServiceProviderConfig() map[string]interface{}
+	ResourceTypes() *SCIMListResponse
+	ListUsers(orgID string, query SCIMListQuery) (*SCIMListResponse, error)
+	GetUser(orgID, userID string) (*SCIMUser, error)
+	CreateUser(orgID string, req SCIMUser, meta RequestMeta) (*SCIMUser, error)
+	ReplaceUser(orgID, userID string, req SCIMUser, meta RequestMeta) (*SCIMUser, error)
+	PatchUser(orgID, userID string, req SCIMPatchRequest, meta RequestMeta) (*SCIMUser, error)
+	DeleteUser(orgID, userID string, meta RequestMeta) error
+	ListGroups(orgID string, query SCIMListQuery) (*SCIMListResponse, error)
+	GetGroup(orgID, groupID string) (*SCIMGroup, error)
+	ReplaceGroup(orgID, groupID string, req SCIMGroup, meta RequestMeta) (*SCIMGroup, error)
+	PatchGroup(orgID, groupID string, req SCIMPatchRequest, meta RequestMeta) (*SCIMGroup, error)
+}
+
+const (
+	// scimDefaultCount and scimMaxCount bound list page sizes
+	scimDefaultCount = 100
+	scimMaxCount     = 200
+	// scimTokenTouchInterval limits last-used writes to one per token per interval
+	scimTokenTouchInterval = time.Minute
+)
+
+// scimGroups are the organization roles exposed as groups. Owners are not
+// manageable through SCIM.
+var scimGroups = []string{model.OrgRoleAdmin, model.OrgRoleMember}
+
+type scimService struct {
+	scimRepo    repository.SCIMRepository
+	orgRepo     repository.OrganizationRepository
+	userRepo    repository.UserRepository
+	sessionRepo repository.SessionRepository
+	rbacService RBACService
+	auditLogger AuditLogger
+	config      *config.Config
+}
+
+type CreateSCIMTokenRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// CreateSCIMTokenResponse carries the plaintext token, which is only shown once
+type CreateSCIMTokenResponse struct {
+	SCIMToken *model.SCIMToken `json:"scim_token"`
+	Token     string           `json:"token"`
+}
+
+// SCIMError is an error answered with the SCIM error schema
+type SCIMError struct {
+	Status   int
+	ScimType string
+	Detail   string
+}
+
+func (e *SCIMError) Error() string {
+	return e.Detail
+}
+
+func scimError(status int, scimType, format string, args ...interface{}) *SCIMError {
+	return &SCIMError{Status: status, ScimType: scimType, Detail: fmt.Sprintf(format, args...)}
+}
+
+type SCIMName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type SCIMEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type SCIMMeta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location"`
+}
+
+// SCIMRef points at a related resource, such as a group member
+type SCIMRef struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type SCIMUser struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	UserName    string      `json:"userName"`
+	Name        *SCIMName   `json:"name,omitempty"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Emails      []SCIMEmail `json:"emails,omitempty"`
+	Active      *bool       `json:"active,omitempty"`
+	Groups      []SCIMRef   `json:"groups,omitempty"`
+	Meta        *SCIMMeta   `json:"meta,omitempty"`
+}
+
+type SCIMGroup struct {
+	Schemas     []string  `json:"schemas"`
+	ID          string    `json:"id,omitempty"`
+	DisplayName string    `json:"displayName"`
+	Members     []SCIMRef `json:"members"`
+	Meta        *SCIMMeta `json:"meta,omitempty"`
+}
+
+type SCIMListResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int64         `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+// SCIMListQuery holds the list parameters of RFC 7644 section 3.4.2
+type SCIMListQuery struct {
+	Filter     string `form:"filter"`
+	StartIndex int    `form:"startIndex"`
+	Count      *int   `form:"count"`
+}
+
+type SCIMPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []SCIMPatchOperation `json:"Operations" binding:"required,min=1"`
+}
+
+type SCIMPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+func NewSCIMService(scimRepo repository.SCIMRepository, orgRepo repository.OrganizationRepository, userRepo repository.UserRepository, sessionRepo repository.SessionRepository, rbacService RBACService, auditLogger AuditLogger, cfg *config.Config) SCIMService {
+	return &scimService{
+		scimRepo:    scimRepo,
+		orgRepo:     orgRepo,
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		rbacService: rbacService,
+		auditLogger: auditLogger,
+		config:      cfg,
+	}
+}
+
+func (s *scimService) CreateToken(orgID string, req CreateSCIMTokenRequest, meta RequestMeta) (*CreateSCIMTokenResponse, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, errors.New("name is required")
+	}
+
+	prefix, err := util.GenerateSecureToken(6)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate SCIM token: %w", err)
+	}
+	secret, err := util.GenerateSecureToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate SCIM token: %w", err)
+	}
+
+	token := &model.SCIMToken{
+		OrganizationID: orgID,
+		Name:           name,
+		Prefix:         model.SCIMTokenPrefix + prefix,
+		SecretHash:     util.HashToken(secret),
+		CreatedByID:    meta.ActorID,
+	}
+	if err := s.scimRepo.CreateToken(token); err != nil {
+		return nil, fmt.Errorf("failed to create SCIM token: %w", err)
+	}
+
+	s.auditLogger.Log(model.AuditActionOrgSCIMTokenCreated, meta, "", model.JSONMap{
+		"org_id":        orgID,
+		"scim_token_id": token.ID,
+		"prefix":        token.Prefix,
+	})
+
+	return &CreateSCIMTokenResponse{
+		SCIMToken: token,
+		Token:     token.Prefix + "_" + secret,
+	}, nil
+}
+
+func (s *scimService) ListTokens(orgID string) ([]model.SCIMToken, error) {
+	return s.scimRepo.FindTokensByOrgID(orgID)
+}
+
+func (s *scimService) RevokeToken(orgID, tokenID string, meta RequestMeta) error {
+	revoked, err := s.scimRepo.RevokeToken(tokenID, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke SCIM token: %w", err)
+	}
+	if revoked == 0 {
+		return errors.New("SCIM token not found")
+	}
+
+	s.auditLogger.Log(model.AuditActionOrgSCIMTokenRevoked, meta, "", model.JSONMap{
+		"org_id":        orgID,
+		"scim_token_id": tokenID,
+	})
+	return nil
+}
+
+// Authenticate resolves a raw "scim_<prefix>_<secret>" token
+func (s *scimService) Authenticate(rawToken string) (*model.SCIMToken, error) {
+	invalid := errors.New("invalid SCIM token")
+
+	if !strings.HasPrefix(rawToken, model.SCIMTokenPrefix) {
+		return nil, invalid
+	}
+	sep := strings.LastIndex(rawToken, "_")
+	if sep <= len(model.SCIMTokenPrefix) {
+		return nil, invalid
+	}
+	prefix, secret := rawToken[:sep], rawToken[sep+1:]
+
+	token, err := s.scimRepo.FindTokenByPrefix(prefix)
+	if err != nil {
+		return nil, invalid
+	}
+	if subtle.ConstantTimeCompare([]byte(util.HashToken(secret)), []byte(token.SecretHash)) != 1 {
+		return nil, invalid
+	}
+	if _, err := s.orgRepo.FindByID(token.OrganizationID); err != nil {
+		return nil, invalid
+	}
+
+	if token.LastUsedAt == nil || time.Since(*token.LastUsedAt) > scimTokenTouchInterval {
+		if err := s.scimRepo.TouchToken(token.ID); err != nil {
+			log.Printf("Failed to record SCIM token use %s: %v", token.ID, err)
+		}
+	}
+	return token, nil
+}
+
+func (s *scimService) baseURL() string {
+	return strings.TrimRight(s.config.APIURL, "/") + "/scim/v2"
+}
+
+// ServiceProviderConfig describes the SCIM features we support (RFC 7643 section 5)
+func (s *scimService) ServiceProviderConfig() map[string]interface{} {
+	unsupported := map[string]bool{"supported": false}
+	return map[string]interface{}{
+		"schemas":          []string{util.SCIMSchemaSPConfig},
+		"documentationUri": strings.TrimRight(s.config.APIURL, "/"),
+		"patch":            map[string]bool{"supported": true},
+		"bulk":             map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":           map[string]interface{}{"supported": true, "maxResults": scimMaxCount},
+		"changePassword":   unsupported,
+		"sort":             unsupported,
+		"etag":             unsupported,
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "Organization SCIM token sent as an Authorization bearer token",
+			"primary":     true,
+		}},
+		"meta": map[string]string{
+			"resourceType": "ServiceProviderConfig",
+			"location":     s.baseURL() + "/ServiceProviderConfig",
+		},
+	}
+}
+
+func (s *scimService) ResourceTypes() *SCIMListResponse {
+	types := []interface{}{
+		map[string]interface{}{
+			"schemas":  []string{util.SCIMSchemaResourceType},
+			"id":       "User",
+			"name":     "User",
+			"endpoint": "/Users",
+			"schema":   util.SCIMSchemaUser,
+			"meta":     map[string]string{"resourceType": "ResourceType", "location": s.baseURL() + "/ResourceTypes/User"},
+		},
+		map[string]interface{}{
+			"schemas":  []string{util.SCIMSchemaResourceType},
+			"id":       "Group",
+			"name":     "Group",
+			"endpoint": "/Groups",
+			"schema":   util.SCIMSchemaGroup,
+			"meta":     map[string]string{"resourceType": "ResourceType", "location": s.baseURL() + "/ResourceTypes/Group"},
+		},
+	}
+	return listResponse(types, int64(len(types)), 1)
+}
+
+func listResponse(resources []interface{}, total int64, startIndex int) *SCIMListResponse {
+	if resources == nil {
+		resources = []interface{}{}
+	}
+	return &SCIMListResponse{
+		Schemas:      []string{util.SCIMSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}
+}
+
+// parseListQuery applies the defaults and limits of RFC 7644 section 3.4.2.4
+func parseListQuery(query SCIMListQuery) (*util.SCIMFilter, int, int, error) {
+	startIndex := query.StartIndex
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	count := scimDefaultCount
+	if query.Count != nil {
+		count = *query.Count
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > scimMaxCount {
+		count = scimMaxCount
+	}
+
+	if strings.TrimSpace(query.Filter) == "" {
+		return nil, startIndex, count, nil
+	}
+	filter, err := util.ParseSCIMFilter(query.Filter)
+	if err != nil {
+		return nil, 0, 0, scimError(http.StatusBadRequest, "invalidFilter", "%s", err.Error())
+	}
+	return filter, startIndex, count, nil
+}
+
+func (s *scimService) ListUsers(orgID string, query SCIMListQuery) (*SCIMListResponse, error) {
+	filter, startIndex, count, err := parseListQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	memberships, total, err := s.scimRepo.ListMembers(orgID, filter, startIndex-1, count)
+	if err != nil {
+		if errors.Is(err, util.ErrSCIMInvalidFilter) {
+			return nil, scimError(http.StatusBadRequest, "invalidFilter", "%s", err.Error())
+		}
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	resources := make([]interface{}, 0, len(memberships))
+	for i := range memberships {
+		resources = append(resources, s.userResource(&memberships[i]))
+	}
+	return listResponse(resources, total, startIndex), nil
+}
+
+func (s *scimService) GetUser(orgID, userID string) (*SCIMUser, error) {
+	membership, err := s.findMember(orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.userResource(membership), nil
+}
+
+func (s *scimService) findMember(orgID, userID string) (*model.Membership, error) {
+	membership, err := s.scimRepo.FindMember(orgID, userID)
+	if err != nil {
+		return nil, scimError(http.StatusNotFound, "", "User %s not found", userID)
+	}
+	return membership, nil
+}
+
+func (s *scimService) userResource(membership *model.Membership) *SCIMUser {
+	user := membership.User
+	active := user.IsActive
+	userName := user.Email
+	if user.Username != nil {
+		userName = *user.Username
+	}
+
+	resource := &SCIMUser{
+		Schemas:     []string{util.SCIMSchemaUser},
+		ID:          user.ID,
+		UserName:    userName,
+		Name:        &SCIMName{Formatted: user.FullName},
+		DisplayName: user.FullName,
+		Emails:      []SCIMEmail{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Meta: &SCIMMeta{
+			ResourceType: "User",
+			Created:      &user.CreatedAt,
+			LastModified: &user.UpdatedAt,
+			Location:     s.baseURL() + "/Users/" + user.ID,
+		},
+	}
+	if membership.Role != model.OrgRoleOwner {
+		resource.Groups = []SCIMRef{{
+			Value:   membership.Role,
+			Display: membership.Role,
+			Ref:     s.baseURL() + "/Groups/" + membership.Role,
+		}}
+	}
+	return resource
+}
+
+// scimUserFields are the local fields a User resource maps onto
+type scimUserFields struct {
+	Email    string
+	Username *string
+	FullName string
+	Active   bool
+}
+
+// userFields validates a User resource and maps it onto our fields
+func userFields(req *SCIMUser) (*scimUserFields, error) {
+	userName := strings.TrimSpace(req.UserName)
+	if userName == "" {
+		return nil, scimError(http.StatusBadRequest, "invalidValue", "userName is required")
+	}
+
+	email := ""
+	for _, e := range req.Emails {
+		if e.Primary || email == "" {
+			email = e.Value
+		}
+	}
+	if email == "" {
+		email = userName
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return nil, scimError(http.StatusBadRequest, "invalidValue", "a valid email address is required")
+	}
+
+	fields := &scimUserFields{Email: email, Active: true}
+	if req.Active != nil {
+		fields.Active = *req.Active
+	}
+
+	// A userName that is just the email needs no separate username
+	if !strings.EqualFold(userName, email) {
+		if len(userName) > 100 {
+			return nil, scimError(http.StatusBadRequest, "invalidValue", "userName must be at most 100 characters")
+		}
+		fields.Username = &userName
+	}
+
+	fields.FullName = strings.TrimSpace(req.DisplayName)
+	if fields.FullName == "" && req.Name != nil {
+		fields.FullName = strings.TrimSpace(req.Name.Formatted)
+		if fields.FullName == "" {
+			fields.FullName = strings.TrimSpace(req.Name.GivenName + " " + req.Name.FamilyName)
+		}
+	}
+	if fields.FullName == "" {
+		fields.FullName = email[:strings.Index(email, "@")]
+	}
+	return fields, nil
+}
+
+// checkUnique rejects an email or username held by another user
+func (s *scimService) checkUnique(fields *scimUserFields, userID string) error {
+	if existing, _ := s.userRepo.FindByEmail(fields.Email); existing != nil && existing.ID != userID {
+		return scimError(http.StatusConflict, "uniqueness", "a user with this email already exists")
+	}
+	if fields.Username != nil {
+		if existing, _ := s.userRepo.FindByUsername(*fields.Username); existing != nil && existing.ID != userID {
+			return scimError(http.StatusConflict, "uniqueness", "a user with this userName already exists")
+		}
+	}
+	return nil
+}
+
+func (s *scimService) CreateUser(orgID string, req SCIMUser, meta RequestMeta) (*SCIMUser, error) {
+	fields, err := userFields(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	// A SAML user removed from every organization may be provisioned again
+	if existing, _ := s.userRepo.FindByEmail(fields.Email); existing != nil {
+		if existing.LoginType != model.LoginTypeSAML {
+			return nil, scimError(http.StatusConflict, "uniqueness", "a user with this email already exists")
+		}
+		memberships, err := s.orgRepo.FindMembershipsByUserID(existing.ID)
+		if err != nil || len(memberships) > 0 {
+			return nil, scimError(http.StatusConflict, "uniqueness", "a user with this email already exists")
+		}
+		existing.ProvisionedBy = &orgID
+		if err := s.userRepo.Update(existing); err != nil {
+			return nil, fmt.Errorf("failed to update user: %w", err)
+		}
+		if err := s.orgRepo.CreateMembership(&model.Membership{
+			OrganizationID: orgID,
+			UserID:         existing.ID,
+			Role:           model.OrgRoleMember,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to add member: %w", err)
+		}
+		return s.ReplaceUser(orgID, existing.ID, req, meta)
+	}
+	if err := s.checkUnique(fields, ""); err != nil {
+		return nil, err
+	}
+
+	user := &model.User{
+		Email:         fields.Email,
+		Username:      fields.Username,
+		FullName:      fields.FullName,
+		UserType:      model.RoleMember,
+		IsActive:      fields.Active,
+		IsVerified:    domainVerifiedBy(s.orgRepo, orgID, fields.Email),
+		LoginType:     model.LoginTypeSAML,
+		ProvisionedBy: &orgID,
+	}
+	if err := s.userRepo.Create(user); err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	if !fields.Active {
+		// The column defaults to true, so an inactive user needs an explicit update
+		if err := s.userRepo.SetActive(user.ID, false); err != nil {
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
+	}
+	if err := s.rbacService.AssignDefaultRoles(user); err != nil {
+		return nil, fmt.Errorf("failed to assign roles: %w", err)
+	}
+	if err := s.orgRepo.CreateMembership(&model.Membership{
+		OrganizationID: orgID,
+		UserID:         user.ID,
+		Role:           model.OrgRoleMember,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to add member: %w", err)
+	}
+
+	s.auditLogger.Log(model.AuditActionRegister, meta, user.ID, model.JSONMap{
+		"via":    "scim",
+		"org_id": orgID,
+	})
+
+	return s.GetUser(orgID, user.ID)
+}
+
+func (s *scimService) ReplaceUser(orgID, userID string, req SCIMUser, meta RequestMeta) (*SCIMUser, error) {
+	membership, err := s.findMember(orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := userFields(&req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.updateUser(orgID, membership.User, fields, meta); err != nil {
+		return nil, err
+	}
+	return s.GetUser(orgID, userID)
+}
+
+// updateUser saves the changed fields and signs the user out when deactivated.
+// Only accounts this organization provisioned can be changed; a resource
+// resent unchanged for any other member is accepted.
+func (s *scimService) updateUser(orgID string, user *model.User, fields *scimUserFields, meta RequestMeta) error {
+
+	var changes []string
+	if user.Email != fields.Email {
+		user.Email = fields.Email
+		// The organization vouches only for addresses in its verified domains
+		user.IsVerified = domainVerifiedBy(s.orgRepo, orgID, fields.Email)
+		changes = append(changes, "email")
+	}
+	if derefString(user.Username) != derefString(fields.Username) {
+		user.Username = fields.Username
+		changes = append(changes, "username")
+	}
+	if user.FullName != fields.FullName {
+		user.FullName = fields.FullName
+		changes = append(changes, "full_name")
+	}
+	deactivated := user.IsActive && !fields.Active
+	if user.IsActive != fields.Active {
+		user.IsActive = fields.Active
+		changes = append(changes, "active")
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	if !provisionedBy(s.orgRepo, user, orgID) {
+		return scimError(http.StatusBadRequest, "mutability", "user %s was not provisioned by this organization and can only be removed from it", user.ID)
+	}
+	if err := s.checkUnique(fields, user.ID); err != nil {
+		return err
+	}
+
+	if err := s.userRepo.Update(user); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	if deactivated {
+		if _, err := s.sessionRepo.RevokeAllByUserID(user.ID); err != nil {
+			return fmt.Errorf("failed to revoke sessions: %w", err)
+		}
+	}
+
+	s.auditLogger.Log(model.AuditActionSCIMUserUpdated, meta, user.ID, model.JSONMap{
+		"org_id":  orgID,
+		"changes": changes,
+		"active":  user.IsActive,
+	})
+	return nil
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// PatchUser applies the operations to the current resource and saves it like a replace
+func (s *scimService) PatchUser(orgID, userID string, req SCIMPatchRequest, meta RequestMeta) (*SCIMUser, error) {
+	membership, err := s.findMember(orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	resource := s.userResource(membership)
+	for _, op := range req.Operations {
+		if err := patchUserResource(resource, op); err != nil {
+			return nil, err
+		}
+	}
+
+	fields, err := userFields(resource)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.updateUser(orgID, membership.User, fields, meta); err != nil {
+		return nil, err
+	}
+	return s.GetUser(orgID, userID)
+}
+
+func patchUserResource(resource *SCIMUser, op SCIMPatchOperation) error {
+	switch strings.ToLower(op.Op) {
+	case "add", "replace":
+	case "remove":
+		return scimError(http.StatusBadRequest, "mutability", "remove is not supported for %q", op.Path)
+	default:
+		return scimError(http.StatusBadRequest, "invalidSyntax", "unknown operation %q", op.Op)
+	}
+
+	// Without a path the value holds the attributes to set
+	if op.Path == "" {
+		var attributes map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &attributes); err != nil {
+			return scimError(http.StatusBadRequest, "invalidValue", "value must be an object when path is omitted")
+		}
+		for name, value := range attributes {
+			if err := patchUserResource(resource, SCIMPatchOperation{Op: op.Op, Path: name, Value: value}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	path, err := util.ParseSCIMPath(op.Path)
+	if err != nil {
+		return scimError(http.StatusBadRequest, "invalidPath", "%s", err.Error())
+	}
+
+	switch path.Attr {
+	case "active":
+		active, err := scimBool(op.Value)
+		if err != nil {
+			return err
+		}
+		resource.Active = &active
+	case "username":
+		return unmarshalSCIMString(op.Value, &resource.UserName)
+	case "displayname":
+		return unmarshalSCIMString(op.Value, &resource.DisplayName)
+	case "name":
+		return patchUserName(resource, path.SubAttr, op.Value)
+	case "emails":
+		if path.SubAttr == "" && path.Filter == nil {
+			var emails []SCIMEmail
+			if err := json.Unmarshal(op.Value, &emails); err != nil {
+				return scimError(http.StatusBadRequest, "invalidValue", "emails must be a list")
+			}
+			resource.Emails = emails
+			return nil
+		}
+		// We keep one address, so emails[type eq "work"].value replaces it
+		var email string
+		if err := unmarshalSCIMString(op.Value, &email); err != nil {
+			return err
+		}
+		resource.Emails = []SCIMEmail{{Value: email, Primary: true}}
+	case "externalid", "schemas", "id", "meta", "groups":
+		// Not stored, read-only, or managed through Groups
+	default:
+		// Extension attributes such as the enterprise user schema are not stored
+		if !strings.HasPrefix(path.Attr, "urn:") {
+			return scimError(http.StatusBadRequest, "invalidPath", "unsupported attribute %q", op.Path)
+		}
+	}
+	return nil
+}
+
+func patchUserName(resource *SCIMUser, subAttr string, value json.RawMessage) error {
+	// Name parts are not stored; split the current name so one part can change
+	name := &SCIMName{}
+	if resource.Name != nil && (resource.Name.GivenName != "" || resource.Name.FamilyName != "") {
+		name.GivenName, name.FamilyName = resource.Name.GivenName, resource.Name.FamilyName
+	} else if i := strings.Index(resource.DisplayName, " "); i > 0 {
+		name.GivenName, name.FamilyName = resource.DisplayName[:i], resource.DisplayName[i+1:]
+	} else {
+		name.GivenName = resource.DisplayName
+	}
+
+	switch subAttr {
+	case "":
+		var replacement SCIMName
+		if err := json.Unmarshal(value, &replacement); err != nil {
+			return scimError(http.StatusBadRequest, "invalidValue", "name must be an object")
+		}
+		name = &replacement
+	case "formatted":
+		if err := unmarshalSCIMString(value, &name.Formatted); err != nil {
+			return err
+		}
+	case "givenname":
+		if err := unmarshalSCIMString(value, &name.GivenName); err != nil {
+			return err
+		}
+	case "familyname":
+		if err := unmarshalSCIMString(value, &name.FamilyName); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+
+	resource.Name = name
+	resource.DisplayName = ""
+	return nil
+}
+
+func unmarshalSCIMString(value json.RawMessage, target *string) error {
+	if err := json.Unmarshal(value, target); err != nil {
+		return scimError(http.StatusBadRequest, "invalidValue", "expected a string value")
+	}
+	return nil
+}
+
+// scimBool accepts JSON booleans and the "True"/"False" strings some IdPs send
+func scimBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		switch strings.ToLower(s) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return false, scimError(http.StatusBadRequest, "invalidValue", "active must be a boolean")
+}
+
+// DeleteUser removes the user from the organization. Accounts the
+// organization provisioned are deactivated too; anyone else keeps their
+// account and only loses the membership.
+func (s *scimService) DeleteUser(orgID, userID string, meta RequestMeta) error {
+	membership, err := s.findMember(orgID, userID)
+	if err != nil {
+		return err
+	}
+	if membership.Role == model.OrgRoleOwner {
+		return scimError(http.StatusBadRequest, "mutability", "organization owners cannot be deleted through SCIM")
+	}
+	// Decided before the membership goes, which the legacy check relies on
+	provisioned := provisionedBy(s.orgRepo, membership.User, orgID)
+
+	if err := s.orgRepo.DeleteMembership(orgID, userID); err != nil {
+		return fmt.Errorf("failed to remove member: %w", err)
+	}
+	if provisioned {
+		if err := s.userRepo.SetActive(userID, false); err != nil {
+			return fmt.Errorf("failed to deactivate user: %w", err)
+		}
+		if _, err := s.sessionRepo.RevokeAllByUserID(userID); err != nil {
+			return fmt.Errorf("failed to revoke sessions: %w", err)
+		}
+	}
+
+	s.auditLogger.Log(model.AuditActionSCIMUserDeleted, meta, userID, model.JSONMap{
+		"org_id":      orgID,
+		"deactivated": provisioned,
+	})
+	return nil
+}
+
+func (s *scimService) ListGroups(orgID string, query SCIMListQuery) (*SCIMListResponse, error) {
+	filter, startIndex, count, err := parseListQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []interface{}
+	for _, role := range scimGroups {
+		group, err := s.GetGroup(orgID, role)
+		if err != nil {
+			return nil, err
+		}
+		if filter == nil || filter.Match(groupValues(group)) {
+			matched = append(matched, group)
+		}
+	}
+
+	total := int64(len(matched))
+	page := []interface{}{}
+	if start := startIndex - 1; start < len(matched) {
+		end := start + count
+		if end > len(matched) {
+			end = len(matched)
+		}
+		page = matched[start:end]
+	}
+	return listResponse(page, total, startIndex), nil
+}
+
+// groupValues exposes a group's attributes to filter matching
+func groupValues(group *SCIMGroup) func(attr string) []interface{} {
+	return func(attr string) []interface{} {
+		switch attr {
+		case "id":
+			return []interface{}{group.ID}
+		case "displayname":
+			return []interface{}{group.DisplayName}
+		case "members", "members.value":
+			values := make([]interface{}, 0, len(group.Members))
+			for _, m := range group.Members {
+				values = append(values, m.Value)
+			}
+			return values
+		}
+		return nil
+	}
+}
+
+func (s *scimService) GetGroup(orgID, groupID string) (*SCIMGroup, error) {
+	if !hasString(scimGroups, groupID) {
+		return nil, scimError(http.StatusNotFound, "", "Group %s not found", groupID)
+	}
+
+	memberships, err := s.scimRepo.FindMembersByRole(orgID, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list members: %w", err)
+	}
+
+	members := make([]SCIMRef, 0, len(memberships))
+	for _, m := range memberships {
+		members = append(members, SCIMRef{
+			Value:   m.UserID,
+			Display: m.User.FullName,
+			Ref:     s.baseURL() + "/Users/" + m.UserID,
+		})
+	}
+	return &SCIMGroup{
+		Schemas:     []string{util.SCIMSchemaGroup},
+		ID:          groupID,
+		DisplayName: groupID,
+		Members:     members,
+		Meta: &SCIMMeta{
+			ResourceType: "Group",
+			Location:     s.baseURL() + "/Groups/" + groupID,
+		},
+	}, nil
+}
+
+// ReplaceGroup sets the group's members. Users dropped from the admin group
+// become plain members.
+func (s *scimService) ReplaceGroup(orgID, groupID string, req SCIMGroup, meta RequestMeta) (*SCIMGroup, error) {
+	group, err := s.GetGroup(orgID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if req.DisplayName != "" && req.DisplayName != group.DisplayName {
+		return nil, scimError(http.StatusBadRequest, "mutability", "groups cannot be renamed")
+	}
+
+	wanted := map[string]bool{}
+	for _, m := range req.Members {
+		wanted[m.Value] = true
+	}
+
+	var added, removed []string
+	for id := range wanted {
+		if !hasGroupMember(group, id) {
+			added = append(added, id)
+		}
+	}
+	for _, m := range group.Members {
+		if !wanted[m.Value] {
+			removed = append(removed, m.Value)
+		}
+	}
+	return s.changeGroup(orgID, groupID, added, removed, meta)
+}
+
+func (s *scimService) PatchGroup(orgID, groupID string, req SCIMPatchRequest, meta RequestMeta) (*SCIMGroup, error) {
+	group, err := s.GetGroup(orgID, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	var added, removed []string
+	for _, op := range req.Operations {
+		path := &util.SCIMPath{Attr: "members"}
+		if op.Path != "" {
+			if path, err = util.ParseSCIMPath(op.Path); err != nil {
+				return nil, scimError(http.StatusBadRequest, "invalidPath", "%s", err.Error())
+			}
+		}
+
+		switch path.Attr {
+		case "members":
+		case "displayname":
+			var name string
+			if err := unmarshalSCIMString(op.Value, &name); err != nil {
+				return nil, err
+			}
+			if name != group.DisplayName {
+				return nil, scimError(http.StatusBadRequest, "mutability", "groups cannot be renamed")
+			}
+			continue
+		case "externalid":
+			continue
+		default:
+			return nil, scimError(http.StatusBadRequest, "invalidPath", "unsupported attribute %q", op.Path)
+		}
+
+		var refs []SCIMRef
+		if len(op.Value) > 0 {
+			if op.Path == "" {
+				// Pathless operations carry {"members": [...]}
+				var attributes struct {
+					Members []SCIMRef `json:"members"`
+				}
+				if err := json.Unmarshal(op.Value, &attributes); err != nil {
+					return nil, scimError(http.StatusBadRequest, "invalidValue", "value must contain members")
+				}
+				refs = attributes.Members
+			} else if err := json.Unmarshal(op.Value, &refs); err != nil {
+				return nil, scimError(http.StatusBadRequest, "invalidValue", "members must be a list")
+			}
+		}
+
+		switch strings.ToLower(op.Op) {
+		case "add":
+			for _, ref := range refs {
+				added = append(added, ref.Value)
+			}
+		case "remove":
+			if path.Filter != nil {
+				// members[value eq "id"]
+				for _, m := range group.Members {
+					if path.Filter.Match(func(attr string) []interface{} {
+						if attr == "value" {
+							return []interface{}{m.Value}
+						}
+						return nil
+					}) {
+						removed = append(removed, m.Value)
+					}
+				}
+			} else if len(refs) > 0 {
+				for _, ref := range refs {
+					removed = append(removed, ref.Value)
+				}
+			} else {
+				for _, m := range group.Members {
+					removed = append(removed, m.Value)
+				}
+			}
+		case "replace":
+			wanted := map[string]bool{}
+			for _, ref := range refs {
+				wanted[ref.Value] = true
+				added = append(added, ref.Value)
+			}
+			for _, m := range group.Members {
+				if !wanted[m.Value] {
+					removed = append(removed, m.Value)
+				}
+			}
+		default:
+			return nil, scimError(http.StatusBadRequest, "invalidSyntax", "unknown operation %q", op.Op)
+		}
+	}
+	return s.changeGroup(orgID, groupID, added, removed, meta)
+}
+
+func hasGroupMember(group *SCIMGroup, userID string) bool {
+	for _, m := range group.Members {
+		if m.Value == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// changeGroup moves users between the admin and member roles. Everyone SCIM
+// manages is a member, so only the admin group can lose members.
+func (s *scimService) changeGroup(orgID, groupID string, added, removed []string, meta RequestMeta) (*SCIMGroup, error) {
+	if groupID == model.OrgRoleMember && len(removed) > 0 {
+		return nil, scimError(http.StatusBadRequest, "mutability", "users leave the member group by being deleted")
+	}
+
+	changes := map[string]string{}
+	for _, id := range removed {
+		changes[id] = model.OrgRoleMember
+	}
+	for _, id := range added {
+		changes[id] = groupID
+	}
+
+	for userID, role := range changes {
+		membership, err := s.scimRepo.FindMember(orgID, userID)
+		if err != nil {
+			return nil, scimError(http.StatusBadRequest, "invalidValue", "user %s is not provisioned in this organization", userID)
+		}
+		if membership.Role == model.OrgRoleOwner {
+			return nil, scimError(http.StatusBadRequest, "mutability", "organization owners cannot be changed through SCIM")
+		}
+		if membership.Role == role {
+			delete(changes, userID)
+		}
+	}
+
+	for userID, role := range changes {
+		if err := s.orgRepo.UpdateMembershipRole(orgID, userID, role); err != nil {
+			return nil, fmt.Errorf("failed to update member: %w", err)
+		}
+	}
+
+	if len(changes) > 0 {
+		s.auditLogger.Log(model.AuditActionSCIMGroupUpdated, meta, "", model.JSONMap{
+			"org_id":  orgID,
+			"group":   groupID,
+			"changes": changes,
+		})
+	}
+	return s.GetGroup(orgID, groupID)
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"yourapp/internal/config"
+	"yourapp/internal/model"
+)
+
+const (
+	scimOrgA = "org-a"
+	scimOrgB = "org-b"
+)
+
+type testSCIM struct {
+	*scimService
+	orgRepo  *fakeOrgRepo
+	userRepo *fakeUserRepo
+	sessions *fakeSessionRepo
+}
+
+func newTestSCIMService(t *testing.T, users ...*model.User) *testSCIM {
+	t.Helper()
+	userRepo := newFakeUserRepo(users...)
+	rbac, _ := newTestRBAC(userRepo, nil)
+	orgRepo := newFakeOrgRepo()
+	sessions := newFakeSessionRepo()
+	scimRepo := &fakeSCIMRepo{orgRepo: orgRepo, userRepo: userRepo}
+	cfg := &config.Config{APIURL: "https://api.example.com"}
+	s := NewSCIMService(scimRepo, orgRepo, userRepo, sessions, rbac, &fakeAuditLogger{}, cfg).(*scimService)
+	return &testSCIM{scimService: s, orgRepo: orgRepo, userRepo: userRepo, sessions: sessions}
+}
+
+func (s *testSCIM) join(orgID, userID string) {
+	s.orgRepo.CreateMembership(&model.Membership{OrganizationID: orgID, UserID: userID, Role: model.OrgRoleMember})
+}
+
+func samlUser(id, email string, provisionedBy *string) *model.User {
+	return &model.User{ID: id, Email: email, FullName: "Ana", IsActive: true, IsVerified: true, LoginType: model.LoginTypeSAML, ProvisionedBy: provisionedBy}
+}
+
+func scimResource(email string, active bool) SCIMUser {
+	return SCIMUser{UserName: email, DisplayName: "Ana", Active: &active}
+}
+
+func TestSCIMChangesOnlyAccountsTheOrganizationProvisioned(t *testing.T) {
+	orgA := scimOrgA
+	user := samlUser("user-1", "ana@acme.example", &orgA)
+	s := newTestSCIMService(t, user)
+	s.join(scimOrgA, user.ID)
+	// The user later accepted an invitation to org B
+	s.join(scimOrgB, user.ID)
+
+	if _, err := s.ReplaceUser(scimOrgB, user.ID, scimResource("ana@attacker.example", true), RequestMeta{}); err == nil {
+		t.Fatal("org B rewrote the email of a user org A provisioned")
+	}
+	deactivate := SCIMPatchRequest{Operations: []SCIMPatchOperation{{Op: "replace", Path: "active", Value: json.RawMessage(`false`)}}}
+	if _, err := s.PatchUser(scimOrgB, user.ID, deactivate, RequestMeta{}); err == nil {
+		t.Fatal("org B deactivated a user org A provisioned")
+	}
+	stored, _ := s.userRepo.FindByID(user.ID)
+	if stored.Email != "ana@acme.example" || !stored.IsActive {
+		t.Fatalf("user changed by another organization: %+v", stored)
+	}
+
+	// IdPs resend unchanged resources, which is harmless
+	if _, err := s.ReplaceUser(scimOrgB, user.ID, scimResource("ana@acme.example", true), RequestMeta{}); err != nil {
+		t.Fatalf("unchanged resource rejected: %v", err)
+	}
+
+	if resource, err := s.ReplaceUser(scimOrgA, user.ID, scimResource("ana.new@acme.example", true), RequestMeta{}); err != nil || resource.UserName != "ana.new@acme.example" {
+		t.Fatalf("provisioning org update: %+v, %v", resource, err)
+	}
+}
+
+func TestSCIMLegacyAccountsBelongToTheirOnlyOrganization(t *testing.T) {
+	user := samlUser("user-1", "ana@acme.example", nil)
+	s := newTestSCIMService(t, user)
+	s.join(scimOrgA, user.ID)
+
+	if _, err := s.ReplaceUser(scimOrgA, user.ID, scimResource("ana@acme.example", false), RequestMeta{}); err != nil {
+		t.Fatalf("only organization could not update its user: %v", err)
+	}
+
+	s.join(scimOrgB, user.ID)
+	if _, err := s.ReplaceUser(scimOrgB, user.ID, scimResource("ana@acme.example", true), RequestMeta{}); err == nil {
+		t.Fatal("second organization changed a legacy account")
+	}
+}
+
+func TestSCIMDeleteOfAnotherOrganizationsUserOnlyRemovesMembership(t *testing.T) {
+	orgA := scimOrgA
+	user := samlUser("user-1", "ana@acme.example", &orgA)
+	s := newTestSCIMService(t, user)
+	s.join(scimOrgA, user.ID)
+	s.join(scimOrgB, user.ID)
+	s.sessions.Create(&model.Session{ID: "session-1", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+
+	if err := s.DeleteUser(scimOrgB, user.ID, RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.orgRepo.FindMembership(scimOrgB, user.ID); err == nil {
+		t.Fatal("membership in org B was kept")
+	}
+	stored, _ := s.userRepo.FindByID(user.ID)
+	session, _ := s.sessions.FindByID("session-1")
+	if !stored.IsActive || session.RevokedAt != nil {
+		t.Fatal("org B deactivated a user org A provisioned")
+	}
+
+	if err := s.DeleteUser(scimOrgA, user.ID, RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ = s.userRepo.FindByID(user.ID)
+	session, _ = s.sessions.FindByID("session-1")
+	if stored.IsActive || session.RevokedAt == nil {
+		t.Fatal("provisioning organization's delete left the account usable")
+	}
+}
+
+func TestSCIMCannotSeeOtherLoginTypes(t *testing.T) {
+	user := &model.User{ID: "user-1", Email: "ana@acme.example", FullName: "Ana", IsActive: true, LoginType: "credential"}
+	s := newTestSCIMService(t, user)
+	s.join(scimOrgA, user.ID)
+
+	if _, err := s.GetUser(scimOrgA, user.ID); err == nil {
+		t.Fatal("credential member visible through SCIM")
+	}
+	if err := s.DeleteUser(scimOrgA, user.ID, RequestMeta{}); err == nil {
+		t.Fatal("credential member deleted through SCIM")
+	}
+	if _, err := s.CreateUser(scimOrgA, scimResource("ana@acme.example", true), RequestMeta{}); err == nil {
+		t.Fatal("SCIM claimed an existing credential account")
+	}
+}
+
+func TestSCIMCreateUserRecordsTheProvisioningOrganization(t *testing.T) {
+	s := newTestSCIMService(t)
+
+	created, err := s.CreateUser(scimOrgA, scimResource("ana@acme.example", true), RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, _ := s.userRepo.FindByID(created.ID)
+	if user.ProvisionedBy == nil || *user.ProvisionedBy != scimOrgA || user.LoginType != model.LoginTypeSAML {
+		t.Fatalf("created user = %+v", user)
+	}
+	if _, err := s.CreateUser(scimOrgB, scimResource("ana@acme.example", true), RequestMeta{}); err == nil {
+		t.Fatal("another organization provisioned an existing member")
+	}
+
+	// Once removed everywhere the account can be provisioned again, and then
+	// belongs to the organization that did so
+	if err := s.DeleteUser(scimOrgA, created.ID, RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateUser(scimOrgB, scimResource("ana@acme.example", true), RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	user, _ = s.userRepo.FindByID(created.ID)
+	if *user.ProvisionedBy != scimOrgB || !user.IsActive {
+		t.Fatalf("reprovisioned user = %+v", user)
+	}
+}
+
+func TestSCIMVerifiesOnlyAddressesInVerifiedDomains(t *testing.T) {
+	s := newTestSCIMService(t)
+	s.orgRepo.verifyDomain(scimOrgA, "acme.example")
+
+	inDomain, err := s.CreateUser(scimOrgA, scimResource("ana@acme.example", true), RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := s.userRepo.FindByID(inDomain.ID); !user.IsVerified {
+		t.Fatal("user in a verified domain was not verified")
+	}
+
+	outside, err := s.CreateUser(scimOrgA, scimResource("bob@other.example", true), RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := s.userRepo.FindByID(outside.ID); user.IsVerified {
+		t.Fatal("user outside the organization's domains was verified")
+	}
+
+	// Moving an address out of the verified domain drops the verification
+	if _, err := s.ReplaceUser(scimOrgA, inDomain.ID, scimResource("ana@other.example", true), RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := s.userRepo.FindByID(inDomain.ID); user.IsVerified {
+		t.Fatal("address changed to an unverified domain stayed verified")
+	}
+	if _, err := s.ReplaceUser(scimOrgA, outside.ID, scimResource("bob@acme.example", true), RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := s.userRepo.FindByID(outside.ID); !user.IsVerified {
+		t.Fatal("address changed to a verified domain was not verified")
+	}
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// WorkerMetrics counts what the email worker and outbox relay do. All
+// methods are safe on a nil receiver, so components can run without metrics.
+type WorkerMetrics struct {
+	emailsSent         atomic.Int64
+	emailsSkipped      atomic.Int64
+	emailsRetried      atomic.Int64
+	emailsDeadLettered atomic.Int64
+	emailsRequeued     atomic.Int64
+	emailsInFlight     atomic.Int64
+	sendNanos          atomic.Int64
+	sendCount          atomic.Int64
+
+	outboxPublished atomic.Int64
+	outboxFailed    atomic.Int64
+
+	startedAt time.Time
+}
+
+func NewWorkerMetrics() *WorkerMetrics {
+	return &WorkerMetrics{startedAt: time.Now()}
+}
+
+func (m *WorkerMetrics) emailStarted() {
+	if m != nil {
+		m.emailsInFlight.Add(1)
+	}
+}
+
+func (m *WorkerMetrics) emailFinished() {
+	if m != nil {
+		m.emailsInFlight.Add(-1)
+	}
+}
+
+func (m *WorkerMetrics) observeSend(took time.Duration) {
+	if m != nil {
+		m.sendNanos.Add(int64(took))
+		m.sendCount.Add(1)
+	}
+}
+
+// recordEmail counts a handled job by its result: sent, skipped, retried,
+// dead_lettered or requeued
+func (m *WorkerMetrics) recordEmail(result string) {
+	if m == nil {
+		return
+	}
+	switch result {
+	case "sent":
+		m.emailsSent.Add(1)
+	case "skipped":
+		m.emailsSkipped.Add(1)
+	case "retried":
+		m.emailsRetried.Add(1)
+	case "dead_lettered":
+		m.emailsDeadLettered.Add(1)
+	case "requeued":
+		m.emailsRequeued.Add(1)
+	}
+}
+
+func (m *WorkerMetrics) recordOutbox(published bool) {
+	if m == nil {
+		return
+	}
+	if published {
+		m.outboxPublished.Add(1)
+	} else {
+		m.outboxFailed.Add(1)
+	}
+}
+
+// WritePrometheus writes the metrics in the Prometheus text exposition format
+func (m *WorkerMetrics) WritePrometheus(w io.Writer) {
+	if m == nil {
+		return
+	}
+	fmt.Fprintln(w, "# HELP email_jobs_total Email jobs handled by the worker, by result.")
+	fmt.Fprintln(w, "# TYPE email_jobs_total counter")
+	for _, result := range []struct {
+		name  string
+		value *atomic.Int64
+	}{
+		{"sent", &m.emailsSent},
+		{"skipped", &m.emailsSkipped},
+		{"retried", &m.emailsRetried},
+		{"dead_lettered", &m.emailsDeadLettered},
+		{"requeued", &m.emailsRequeued},
+	} {
+		fmt.Fprintf(w, "email_jobs_total{result=%q} %d\n", result.name, result.value.Load())
+	}
+
+	fmt.Fprintln(w, "# HELP email_jobs_in_flight Email jobs being handled right now.")
+	fmt.Fprintln(w, "# TYPE email_jobs_in_flight gauge")
+	fmt.Fprintf(w, "email_jobs_in_flight %d\n", m.emailsInFlight.Load())
+
+	fmt.Fprintln(w, "# HELP email_send_duration_seconds Time spent handing emails to the transport.")
+	fmt.Fprintln(w, "# TYPE email_send_duration_seconds summary")
+	fmt.Fprintf(w, "email_send_duration_seconds_sum %g\n", time.Duration(m.sendNanos.Load()).Seconds())
+	fmt.Fprintf(w, "email_send_duration_seconds_count %d\n", m.sendCount.Load())
+
+	fmt.Fprintln(w, "# HELP outbox_messages_total Outbox messages the relay tried to publish, by result.")
+	fmt.Fprintln(w, "# TYPE outbox_messages_total counter")
+	fmt.Fprintf(w, "outbox_messages_total{result=\"published\"} %d\n", m.outboxPublished.Load())
+	fmt.Fprintf(w, "outbox_messages_total{result=\"failed\"} %d\n", m.outboxFailed.Load())
+
+	fmt.Fprintln(w, "# HELP worker_uptime_seconds Seconds since the worker started.")
+	fmt.Fprintln(w, "# TYPE worker_uptime_seconds gauge")
+	fmt.Fprintf(w, "worker_uptime_seconds %g\n", time.Since(m.startedAt).Seconds())
+}
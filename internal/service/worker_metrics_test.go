@@ -0,0 +1,53 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWorkerMetricsWritePrometheus(t *testing.T) {
+	m := NewWorkerMetrics()
+	m.emailStarted()
+	m.observeSend(1500 * time.Millisecond)
+	m.recordEmail("sent")
+	m.recordEmail("sent")
+	m.recordEmail("dead_lettered")
+	m.recordOutbox(true)
+	m.recordOutbox(false)
+
+	var out strings.Builder
+	m.WritePrometheus(&out)
+	for _, line := range []string{
+		"# TYPE email_jobs_total counter",
+		`email_jobs_total{result="sent"} 2`,
+		`email_jobs_total{result="dead_lettered"} 1`,
+		`email_jobs_total{result="requeued"} 0`,
+		"email_jobs_in_flight 1",
+		"email_send_duration_seconds_sum 1.5",
+		"email_send_duration_seconds_count 1",
+		`outbox_messages_total{result="published"} 1`,
+		`outbox_messages_total{result="failed"} 1`,
+		"# TYPE worker_uptime_seconds gauge",
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestWorkerMetricsNil(t *testing.T) {
+	// Components built without metrics record nothing and do not panic
+	var m *WorkerMetrics
+	m.emailStarted()
+	m.emailFinished()
+	m.observeSend(time.Second)
+	m.recordEmail("sent")
+	m.recordOutbox(true)
+
+	var out strings.Builder
+	m.WritePrometheus(&out)
+	if out.Len() != 0 {
+		t.Fatalf("nil metrics wrote %q", out.String())
+	}
+}
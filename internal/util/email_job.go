@@ -0,0 +1,181 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EmailJobVersion is the envelope version published by this build. The
+// worker rejects other versions instead of guessing at their layout.
+const EmailJobVersion = 1
+
+// Email job types; each is also the name of the template it renders
+const (
+	EmailTypeOTP           = "otp"
+	EmailTypeResetPassword = "reset_password"
+	EmailTypeVerification  = "verification"
+	EmailTypeWelcome       = "welcome"
+	EmailTypeDataExport    = "data_export"
+	EmailTypeOrgInvite     = "org_invite"
+)
+
+// Errors returned by DecodeEmailJob; none of them can succeed on redelivery
+var (
+	ErrInvalidEmailJob         = errors.New("invalid email job")
+	ErrUnknownEmailType        = errors.New("unknown email type")
+	ErrUnsupportedEmailVersion = errors.New("unsupported email job version")
+)
+
+// EmailJob is the envelope queued for the email worker. IdempotencyKey
+// identifies the email across redeliveries so it is sent at most once.
+type EmailJob struct {
+	IdempotencyKey string          `json:"idempotency_key"`
+	Type           string          `json:"type"`
+	Version        int             `json:"version"`
+	To             string          `json:"to"`
+	Locale         string          `json:"locale,omitempty"`
+	Data           json.RawMessage `json:"data"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// EmailData is the template data of one email type
+type EmailData interface {
+	EmailType() string
+	Validate() error
+}
+
+// OTPEmailData carries an email verification code
+type OTPEmailData struct {
+	Code           string `json:"code"`
+	ExpiresMinutes int    `json:"expires_minutes"`
+}
+
+func (OTPEmailData) EmailType() string { return EmailTypeOTP }
+
+func (d OTPEmailData) Validate() error { return requireEmailFields("code", d.Code) }
+
+// ResetPasswordEmailData carries a password reset code
+type ResetPasswordEmailData struct {
+	Code           string `json:"code"`
+	ExpiresMinutes int    `json:"expires_minutes"`
+}
+
+func (ResetPasswordEmailData) EmailType() string { return EmailTypeResetPassword }
+
+func (d ResetPasswordEmailData) Validate() error { return requireEmailFields("code", d.Code) }
+
+// VerificationEmailData carries an email verification link token
+type VerificationEmailData struct {
+	Token string `json:"token"`
+}
+
+func (VerificationEmailData) EmailType() string { return EmailTypeVerification }
+
+func (d VerificationEmailData) Validate() error { return requireEmailFields("token", d.Token) }
+
+// WelcomeEmailData greets a new user by name
+type WelcomeEmailData struct {
+	Name string `json:"name"`
+}
+
+func (WelcomeEmailData) EmailType() string { return EmailTypeWelcome }
+
+func (d WelcomeEmailData) Validate() error { return requireEmailFields("name", d.Name) }
+
+// DataExportEmailData links to a finished personal data export
+type DataExportEmailData struct {
+	Link         string `json:"link"`
+	ExpiresHours int    `json:"expires_hours"`
+}
+
+func (DataExportEmailData) EmailType() string { return EmailTypeDataExport }
+
+func (d DataExportEmailData) Validate() error { return requireEmailFields("link", d.Link) }
+
+// OrgInviteEmailData invites someone to join an organization
+type OrgInviteEmailData struct {
+	OrgName     string `json:"org_name"`
+	Link        string `json:"link"`
+	ExpiresDays int    `json:"expires_days"`
+}
+
+func (OrgInviteEmailData) EmailType() string { return EmailTypeOrgInvite }
+
+func (d OrgInviteEmailData) Validate() error {
+	return requireEmailFields("org_name", d.OrgName, "link", d.Link)
+}
+
+// emailDataTypes decodes the data of each known email type
+var emailDataTypes = map[string]func() EmailData{
+	EmailTypeOTP:           func() EmailData { return &OTPEmailData{} },
+	EmailTypeResetPassword: func() EmailData { return &ResetPasswordEmailData{} },
+	EmailTypeVerification:  func() EmailData { return &VerificationEmailData{} },
+	EmailTypeWelcome:       func() EmailData { return &WelcomeEmailData{} },
+	EmailTypeDataExport:    func() EmailData { return &DataExportEmailData{} },
+	EmailTypeOrgInvite:     func() EmailData { return &OrgInviteEmailData{} },
+}
+
+// NewEmailJob builds a job for the current envelope version with a fresh
+// idempotency key
+func NewEmailJob(to, locale string, data EmailData) (*EmailJob, error) {
+	if err := data.Validate(); err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal email data: %w", err)
+	}
+	return &EmailJob{
+		IdempotencyKey: uuid.New().String(),
+		Type:           data.EmailType(),
+		Version:        EmailJobVersion,
+		To:             to,
+		Locale:         locale,
+		Data:           raw,
+		CreatedAt:      time.Now(),
+	}, nil
+}
+
+// DecodeEmailJob parses and validates a queued job and its typed data
+func DecodeEmailJob(body []byte) (*EmailJob, EmailData, error) {
+	var job EmailJob
+	if err := json.Unmarshal(body, &job); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidEmailJob, err)
+	}
+	if job.Version != EmailJobVersion {
+		return &job, nil, fmt.Errorf("%w: %d", ErrUnsupportedEmailVersion, job.Version)
+	}
+	newData, ok := emailDataTypes[job.Type]
+	if !ok {
+		return &job, nil, fmt.Errorf("%w: %q", ErrUnknownEmailType, job.Type)
+	}
+	if job.IdempotencyKey == "" || job.To == "" {
+		return &job, nil, fmt.Errorf("%w: idempotency_key and to are required", ErrInvalidEmailJob)
+	}
+
+	data := newData()
+	decoder := json.NewDecoder(bytes.NewReader(job.Data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(data); err != nil {
+		return &job, nil, fmt.Errorf("%w: %s data: %v", ErrInvalidEmailJob, job.Type, err)
+	}
+	if err := data.Validate(); err != nil {
+		return &job, nil, err
+	}
+	return &job, data, nil
+}
+
+// requireEmailFields takes name/value pairs and reports the first empty value
+func requireEmailFields(pairs ...string) error {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] == "" {
+			return fmt.Errorf("%w: %s is required", ErrInvalidEmailJob, pairs[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestEmailJobRoundTrip(t *testing.T) {
+	job, err := NewEmailJob("ana@example.com", "en", OrgInviteEmailData{OrgName: "Acme", Link: "https://app.example.com/invite", ExpiresDays: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Type != EmailTypeOrgInvite || job.Version != EmailJobVersion || job.IdempotencyKey == "" {
+		t.Fatalf("job = %+v", job)
+	}
+	body, err := json.Marshal(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, data, err := DecodeEmailJob(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invite, ok := data.(*OrgInviteEmailData)
+	if !ok || invite.OrgName != "Acme" || invite.ExpiresDays != 7 {
+		t.Fatalf("data = %#v", data)
+	}
+	if decoded.To != "ana@example.com" || decoded.Locale != "en" || decoded.IdempotencyKey != job.IdempotencyKey {
+		t.Fatalf("decoded = %+v", decoded)
+	}
+
+	// Every job gets its own key
+	again, _ := NewEmailJob("ana@example.com", "en", OTPEmailData{Code: "123456"})
+	if again.IdempotencyKey == job.IdempotencyKey {
+		t.Fatal("idempotency key reused")
+	}
+}
+
+func TestNewEmailJobValidatesData(t *testing.T) {
+	if _, err := NewEmailJob("ana@example.com", "", OTPEmailData{}); !errors.Is(err, ErrInvalidEmailJob) {
+		t.Fatalf("OTP without a code: %v", err)
+	}
+	if _, err := NewEmailJob("ana@example.com", "", OrgInviteEmailData{OrgName: "Acme"}); !errors.Is(err, ErrInvalidEmailJob) {
+		t.Fatalf("invite without a link: %v", err)
+	}
+}
+
+func TestDecodeEmailJobRejects(t *testing.T) {
+	cases := map[string]struct {
+		body string
+		want error
+	}{
+		"malformed JSON": {`{"type":`, ErrInvalidEmailJob},
+		"unknown type": {
+			`{"idempotency_key":"k","type":"newsletter","version":1,"to":"ana@example.com","data":{}}`,
+			ErrUnknownEmailType,
+		},
+		"missing type": {
+			`{"idempotency_key":"k","version":1,"to":"ana@example.com","data":{"code":"1"}}`,
+			ErrUnknownEmailType,
+		},
+		"future version": {
+			`{"idempotency_key":"k","type":"otp","version":2,"to":"ana@example.com","data":{"code":"1"}}`,
+			ErrUnsupportedEmailVersion,
+		},
+		"legacy message without version": {
+			`{"to":"ana@example.com","subject":"Ana","body":"123456","type":"otp"}`,
+			ErrUnsupportedEmailVersion,
+		},
+		"unknown data field": {
+			`{"idempotency_key":"k","type":"otp","version":1,"to":"ana@example.com","data":{"code":"1","link":"x"}}`,
+			ErrInvalidEmailJob,
+		},
+		"data of the wrong shape": {
+			`{"idempotency_key":"k","type":"otp","version":1,"to":"ana@example.com","data":"123456"}`,
+			ErrInvalidEmailJob,
+		},
+		"missing required data": {
+			`{"idempotency_key":"k","type":"welcome","version":1,"to":"ana@example.com","data":{}}`,
+			ErrInvalidEmailJob,
+		},
+		"missing idempotency key": {
+			`{"type":"otp","version":1,"to":"ana@example.com","data":{"code":"1"}}`,
+			ErrInvalidEmailJob,
+		},
+		"missing recipient": {
+			`{"idempotency_key":"k","type":"otp","version":1,"data":{"code":"1"}}`,
+			ErrInvalidEmailJob,
+		},
+	}
+	for name, c := range cases {
+		if _, data, err := DecodeEmailJob([]byte(c.body)); !errors.Is(err, c.want) || data != nil {
+			t.Errorf("%s: data = %v, err = %v, want %v", name, data, err, c.want)
+		}
+	}
+}
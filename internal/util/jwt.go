@@ -7,26 +7,72 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// ActorClaim identifies the party acting on behalf of the subject (RFC 8693 "act" claim)
+type ActorClaim struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email,omitempty"`
+}
+
+// Token types carried in the "typ" claim, so a refresh token is never
+// accepted where an access token is expected and vice versa
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
 type JWTClaims struct {
-	UserID   string `json:"userId"`
-	Email    string `json:"email"`
-	UserType string `json:"role"`
+	TokenType   string      `json:"typ,omitempty"`
+	UserID      string      `json:"userId"`
+	Email       string      `json:"email"`
+	UserType    string      `json:"role"`
+	Permissions []string    `json:"permissions,omitempty"`
+	SessionID   string      `json:"sid,omitempty"`
+	Actor       *ActorClaim `json:"act,omitempty"`
+	OrgID       string      `json:"org_id,omitempty"`
+	Scope       string      `json:"scope,omitempty"` // space-delimited, as in OAuth 2.0
+	ClientID    string      `json:"client_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// InviteClaims are carried by signed organization invitation tokens
+type InviteClaims struct {
+	InvitationID string `json:"inv"`
+	OrgID        string `json:"org_id"`
+	Email        string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// EmailVerificationClaims are carried by signed email verification tokens
+type EmailVerificationClaims struct {
+	UserID string `json:"userId"`
+	Email  string `json:"email"`
 	jwt.RegisteredClaims
 }
 
 // GenerateToken generates a JWT token
 func GenerateToken(userID, email, userType, secret string, expiresIn time.Duration) (string, error) {
-	claims := JWTClaims{
+	return GenerateTokenWithClaims(JWTClaims{
 		UserID:   userID,
 		Email:    email,
 		UserType: userType,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "yourapp",
-			Subject:   userID,
-		},
+	}, secret, expiresIn)
+}
+
+// GenerateTokenWithClaims signs the given claims, filling in the registered
+// claims. Tokens without a user are issued to the client itself.
+func GenerateTokenWithClaims(claims JWTClaims, secret string, expiresIn time.Duration) (string, error) {
+	subject := claims.UserID
+	if subject == "" {
+		subject = claims.ClientID
+	}
+
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		Issuer:    "yourapp",
+		Subject:   subject,
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -35,12 +81,32 @@ func GenerateToken(userID, email, userType, secret string, expiresIn time.Durati
 
 // GenerateAccessToken generates an access token (15 minutes)
 func GenerateAccessToken(userID, email, userType, secret string) (string, error) {
-	return GenerateToken(userID, email, userType, secret, 15*time.Minute)
+	return GenerateAccessTokenWithClaims(JWTClaims{
+		UserID:   userID,
+		Email:    email,
+		UserType: userType,
+	}, secret)
+}
+
+// GenerateAccessTokenWithClaims generates an access token (15 minutes) carrying extra claims
+func GenerateAccessTokenWithClaims(claims JWTClaims, secret string) (string, error) {
+	claims.TokenType = TokenTypeAccess
+	return GenerateTokenWithClaims(claims, secret, 15*time.Minute)
 }
 
 // GenerateRefreshToken generates a refresh token (7 days)
 func GenerateRefreshToken(userID, email, userType, secret string) (string, error) {
-	return GenerateToken(userID, email, userType, secret, 7*24*time.Hour)
+	return GenerateRefreshTokenWithClaims(JWTClaims{
+		UserID:   userID,
+		Email:    email,
+		UserType: userType,
+	}, secret)
+}
+
+// GenerateRefreshTokenWithClaims generates a refresh token (7 days) carrying extra claims
+func GenerateRefreshTokenWithClaims(claims JWTClaims, secret string) (string, error) {
+	claims.TokenType = TokenTypeRefresh
+	return GenerateTokenWithClaims(claims, secret, 7*24*time.Hour)
 }
 
 // GenerateResetPasswordToken generates a reset password token (1 hour)
@@ -61,7 +127,112 @@ func ValidateToken(tokenString, secret string) (*JWTClaims, error) {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
+	// Purpose-specific tokens (e.g. invitations) carry an audience and must
+	// never be accepted as access or refresh tokens
+	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid && len(claims.Audience) == 0 {
+		return claims, nil
+	}
+
+	return nil, errors.New("invalid token")
+}
+
+// GenerateEmailVerificationToken signs a token (24 hours) proving the user
+// received mail at the given address
+func GenerateEmailVerificationToken(userID, email, secret string) (string, error) {
+	now := time.Now()
+	claims := EmailVerificationClaims{
+		UserID: userID,
+		Email:  email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(24 * time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "yourapp",
+			Subject:   userID,
+			Audience:  jwt.ClaimStrings{"email_verification"},
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secret))
+}
+
+// ValidateEmailVerificationToken validates an email verification token
+func ValidateEmailVerificationToken(tokenString, secret string) (*EmailVerificationClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &EmailVerificationClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(secret), nil
+	}, jwt.WithAudience("email_verification"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*EmailVerificationClaims); ok && token.Valid && claims.UserID != "" && claims.Email != "" {
+		return claims, nil
+	}
+
+	return nil, errors.New("invalid token")
+}
+
+// ValidateAccessToken validates a JWT and requires it to be an access token
+func ValidateAccessToken(tokenString, secret string) (*JWTClaims, error) {
+	return validateTokenType(tokenString, secret, TokenTypeAccess)
+}
+
+// ValidateRefreshToken validates a JWT and requires it to be a refresh token
+func ValidateRefreshToken(tokenString, secret string) (*JWTClaims, error) {
+	return validateTokenType(tokenString, secret, TokenTypeRefresh)
+}
+
+func validateTokenType(tokenString, secret, tokenType string) (*JWTClaims, error) {
+	claims, err := ValidateToken(tokenString, secret)
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenType != tokenType {
+		return nil, errors.New("invalid token type")
+	}
+	return claims, nil
+}
+
+// GenerateInviteToken signs an organization invitation token that expires with the invitation
+func GenerateInviteToken(invitationID, orgID, email, secret string, expiresAt time.Time) (string, error) {
+	now := time.Now()
+	claims := InviteClaims{
+		InvitationID: invitationID,
+		OrgID:        orgID,
+		Email:        email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "yourapp",
+			Subject:   invitationID,
+			Audience:  jwt.ClaimStrings{"invite"},
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secret))
+}
+
+// ValidateInviteToken validates an organization invitation token
+func ValidateInviteToken(tokenString, secret string) (*InviteClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &InviteClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(secret), nil
+	}, jwt.WithAudience("invite"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*InviteClaims); ok && token.Valid && claims.InvitationID != "" {
 		return claims, nil
 	}
 
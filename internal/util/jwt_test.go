@@ -0,0 +1,85 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+const testSecret = "test-secret"
+
+func TestAccessAndRefreshTokensAreNotInterchangeable(t *testing.T) {
+	claims := JWTClaims{UserID: "user-1", Email: "ana@example.com", SessionID: "session-1"}
+
+	access, err := GenerateAccessTokenWithClaims(claims, testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refresh, err := GenerateRefreshTokenWithClaims(claims, testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := ValidateAccessToken(access, testSecret); err != nil || got.TokenType != TokenTypeAccess {
+		t.Fatalf("access token rejected: %v", err)
+	}
+	if _, err := ValidateAccessToken(refresh, testSecret); err == nil {
+		t.Fatal("refresh token accepted as an access token")
+	}
+	if got, err := ValidateRefreshToken(refresh, testSecret); err != nil || got.SessionID != "session-1" {
+		t.Fatalf("refresh token rejected: %v", err)
+	}
+	if _, err := ValidateRefreshToken(access, testSecret); err == nil {
+		t.Fatal("access token accepted as a refresh token")
+	}
+}
+
+func TestPurposeTokensAreNotAccessTokens(t *testing.T) {
+	reset, err := GenerateResetPasswordToken("user-1", "ana@example.com", testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateAccessToken(reset, testSecret); err == nil {
+		t.Fatal("password reset token accepted as an access token")
+	}
+
+	invite, err := GenerateInviteToken("inv-1", "org-1", "ana@example.com", testSecret, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateToken(invite, testSecret); err == nil {
+		t.Fatal("invitation token accepted as a session token")
+	}
+	if claims, err := ValidateInviteToken(invite, testSecret); err != nil || claims.InvitationID != "inv-1" {
+		t.Fatalf("invitation token rejected: %v", err)
+	}
+
+	verify, err := GenerateEmailVerificationToken("user-1", "ana@example.com", testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateToken(verify, testSecret); err == nil {
+		t.Fatal("email verification token accepted as a session token")
+	}
+	if claims, err := ValidateEmailVerificationToken(verify, testSecret); err != nil || claims.UserID != "user-1" || claims.Email != "ana@example.com" {
+		t.Fatalf("email verification token rejected: %v", err)
+	}
+	access, _ := GenerateAccessToken("user-1", "ana@example.com", "member", testSecret)
+	if _, err := ValidateEmailVerificationToken(access, testSecret); err == nil {
+		t.Fatal("access token accepted as an email verification token")
+	}
+	if _, err := ValidateEmailVerificationToken(invite, testSecret); err == nil {
+		t.Fatal("invitation token accepted as an email verification token")
+	}
+}
+
+func TestValidateTokenRejectsWrongSecretAndExpiry(t *testing.T) {
+	token, _ := GenerateAccessToken("user-1", "ana@example.com", "member", testSecret)
+	if _, err := ValidateAccessToken(token, "other-secret"); err == nil {
+		t.Fatal("token signed with another secret accepted")
+	}
+
+	expired, _ := GenerateTokenWithClaims(JWTClaims{TokenType: TokenTypeAccess, UserID: "user-1"}, testSecret, -time.Minute)
+	if _, err := ValidateAccessToken(expired, testSecret); err == nil {
+		t.Fatal("expired token accepted")
+	}
+}
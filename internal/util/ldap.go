@@ -0,0 +1,567 @@
+package util
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrLDAPInvalidCredentials is returned by Bind for a wrong DN or password
+var ErrLDAPInvalidCredentials = errors.New("invalid LDAP credentials")
+
+// LDAP result codes we act on (RFC 4511 section 4.1.9)
+const (
+	ldapResultSuccess            = 0
+	ldapResultSizeLimitExceeded  = 4
+	ldapResultInvalidCredentials = 49
+)
+
+// BER identifiers of the LDAP messages we send and receive
+const (
+	berSequence        = 0x30
+	berInteger         = 0x02
+	berOctetString     = 0x04
+	berEnumerated      = 0x0a
+	berBoolean         = 0x01
+	ldapBindRequest    = 0x60
+	ldapBindResponse   = 0x61
+	ldapUnbindRequest  = 0x42
+	ldapSearchRequest  = 0x63
+	ldapSearchEntry    = 0x64
+	ldapSearchDone     = 0x65
+	ldapSearchRef      = 0x73
+	ldapExtendedReq    = 0x77
+	ldapExtendedResp   = 0x78
+	ldapStartTLSOID    = "1.3.6.1.4.1.1466.20037"
+	ldapMaxMessageSize = 4 << 20
+)
+
+// LDAPEntry is a search result with attribute values keyed by lower-cased name
+type LDAPEntry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// Get returns the first value of an attribute, matched case-insensitively
+func (e *LDAPEntry) Get(attribute string) string {
+	if values := e.Attributes[strings.ToLower(attribute)]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Values returns all values of an attribute, matched case-insensitively
+func (e *LDAPEntry) Values(attribute string) []string {
+	return e.Attributes[strings.ToLower(attribute)]
+}
+
+// LDAPConn is a minimal LDAPv3 client: simple bind and search, which is all
+// directory logins need. Requests are sent one at a time.
+type LDAPConn struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	messageID int
+	timeout   time.Duration
+}
+
+// DialLDAP connects to an ldap:// or ldaps:// URL. With startTLS a plain
+// connection is upgraded before anything else is sent.
+func DialLDAP(rawURL string, startTLS bool, timeout time.Duration) (*LDAPConn, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP URL: %w", err)
+	}
+
+	host := parsed.Hostname()
+	port := parsed.Port()
+	dialer := &net.Dialer{Timeout: timeout}
+	tlsConfig := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+
+	var conn net.Conn
+	switch parsed.Scheme {
+	case "ldap":
+		if port == "" {
+			port = "389"
+		}
+		conn, err = dialer.Dial("tcp", net.JoinHostPort(host, port))
+	case "ldaps":
+		if port == "" {
+			port = "636"
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(host, port), tlsConfig)
+	default:
+		return nil, fmt.Errorf("unsupported LDAP URL scheme %q", parsed.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to LDAP server: %w", err)
+	}
+
+	c := &LDAPConn{conn: conn, reader: bufio.NewReader(conn), timeout: timeout}
+	if startTLS && parsed.Scheme == "ldap" {
+		if err := c.startTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *LDAPConn) startTLS(tlsConfig *tls.Config) error {
+	op := berTLV(ldapExtendedReq, berTLV(0x80, []byte(ldapStartTLSOID)))
+	resp, err := c.roundTrip(op, ldapExtendedResp)
+	if err != nil {
+		return err
+	}
+	if err := ldapResultError(resp); err != nil {
+		return fmt.Errorf("StartTLS refused: %w", err)
+	}
+
+	tlsConn := tls.Client(c.conn, tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		return fmt.Errorf("StartTLS handshake failed: %w", err)
+	}
+	c.conn = tlsConn
+	c.reader = bufio.NewReader(tlsConn)
+	return nil
+}
+
+// Bind performs a simple bind. An empty password is refused because servers
+// treat it as an unauthenticated bind that always succeeds.
+func (c *LDAPConn) Bind(dn, password string) error {
+	if dn != "" && password == "" {
+		return ErrLDAPInvalidCredentials
+	}
+
+	op := berTLV(ldapBindRequest, berConcat(
+		berInt(3),
+		berTLV(berOctetString, []byte(dn)),
+		berTLV(0x80, []byte(password)),
+	))
+	resp, err := c.roundTrip(op, ldapBindResponse)
+	if err != nil {
+		return err
+	}
+	return ldapResultError(resp)
+}
+
+// Search runs a subtree search and returns at most sizeLimit entries
+func (c *LDAPConn) Search(baseDN, filter string, attributes []string, sizeLimit int) ([]LDAPEntry, error) {
+	compiled, err := compileLDAPFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := make([][]byte, len(attributes))
+	for i, a := range attributes {
+		attrs[i] = berTLV(berOctetString, []byte(a))
+	}
+
+	c.messageID++
+	op := berTLV(ldapSearchRequest, berConcat(
+		berTLV(berOctetString, []byte(baseDN)),
+		berTLV(berEnumerated, []byte{2}), // wholeSubtree
+		berTLV(berEnumerated, []byte{0}), // neverDerefAliases
+		berInt(sizeLimit),
+		berInt(int(c.timeout.Seconds())),
+		berTLV(berBoolean, []byte{0}),
+		compiled,
+		berTLV(berSequence, berConcat(attrs...)),
+	))
+	if err := c.send(op); err != nil {
+		return nil, err
+	}
+
+	var entries []LDAPEntry
+	for {
+		packet, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+		switch packet.tag {
+		case ldapSearchEntry:
+			entry, err := parseLDAPEntry(packet)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		case ldapSearchRef:
+			// Referrals to other servers are not followed
+		case ldapSearchDone:
+			if err := ldapResultError(packet); err != nil && !errors.Is(err, errLDAPSizeLimit) {
+				return nil, err
+			}
+			return entries, nil
+		default:
+			return nil, fmt.Errorf("unexpected LDAP response 0x%x", packet.tag)
+		}
+	}
+}
+
+// Close sends an unbind request and closes the connection
+func (c *LDAPConn) Close() error {
+	c.messageID++
+	c.send(berTLV(ldapUnbindRequest, nil))
+	return c.conn.Close()
+}
+
+func (c *LDAPConn) roundTrip(op []byte, expected byte) (*berPacket, error) {
+	c.messageID++
+	if err := c.send(op); err != nil {
+		return nil, err
+	}
+	packet, err := c.receive()
+	if err != nil {
+		return nil, err
+	}
+	if packet.tag != expected {
+		return nil, fmt.Errorf("unexpected LDAP response 0x%x", packet.tag)
+	}
+	return packet, nil
+}
+
+func (c *LDAPConn) send(op []byte) error {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	message := berTLV(berSequence, berConcat(berInt(c.messageID), op))
+	_, err := c.conn.Write(message)
+	return err
+}
+
+// receive reads the next message for the current request and returns its protocol op
+func (c *LDAPConn) receive() (*berPacket, error) {
+	for {
+		c.conn.SetDeadline(time.Now().Add(c.timeout))
+		message, err := readBERPacket(c.reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read LDAP response: %w", err)
+		}
+		if message.tag != berSequence || len(message.children) < 2 {
+			return nil, errors.New("malformed LDAP message")
+		}
+		id, err := berParseInt(message.children[0].value)
+		if err != nil {
+			return nil, err
+		}
+		// Unsolicited notifications (ID 0) mean the server is closing the connection
+		if id == 0 {
+			return nil, errors.New("LDAP server closed the connection")
+		}
+		if id == c.messageID {
+			return message.children[1], nil
+		}
+	}
+}
+
+var errLDAPSizeLimit = errors.New("LDAP size limit exceeded")
+
+// ldapResultError converts an LDAPResult into an error
+func ldapResultError(packet *berPacket) error {
+	if len(packet.children) < 3 {
+		return errors.New("malformed LDAP result")
+	}
+	code, err := berParseInt(packet.children[0].value)
+	if err != nil {
+		return err
+	}
+	switch code {
+	case ldapResultSuccess:
+		return nil
+	case ldapResultInvalidCredentials:
+		return ErrLDAPInvalidCredentials
+	case ldapResultSizeLimitExceeded:
+		return errLDAPSizeLimit
+	}
+	if message := string(packet.children[2].value); message != "" {
+		return fmt.Errorf("LDAP error %d: %s", code, message)
+	}
+	return fmt.Errorf("LDAP error %d", code)
+}
+
+func parseLDAPEntry(packet *berPacket) (LDAPEntry, error) {
+	if len(packet.children) < 2 {
+		return LDAPEntry{}, errors.New("malformed LDAP search entry")
+	}
+	entry := LDAPEntry{
+		DN:         string(packet.children[0].value),
+		Attributes: map[string][]string{},
+	}
+	for _, attribute := range packet.children[1].children {
+		if len(attribute.children) < 2 {
+			continue
+		}
+		name := strings.ToLower(string(attribute.children[0].value))
+		for _, v := range attribute.children[1].children {
+			entry.Attributes[name] = append(entry.Attributes[name], string(v.value))
+		}
+	}
+	return entry, nil
+}
+
+// EscapeLDAPFilter escapes a value for use inside a search filter (RFC 4515)
+func EscapeLDAPFilter(value string) string {
+	var sb strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch b := value[i]; b {
+		case '\\', '*', '(', ')', 0:
+			fmt.Fprintf(&sb, "\\%02x", b)
+		default:
+			sb.WriteByte(b)
+		}
+	}
+	return sb.String()
+}
+
+// compileLDAPFilter encodes a string filter such as
+// "(&(objectClass=person)(mail=jane@example.com))". Supports and, or, not,
+// equality, presence, substrings and ordering matches.
+func compileLDAPFilter(filter string) ([]byte, error) {
+	encoded, rest, err := parseLDAPFilter(strings.TrimSpace(filter))
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("invalid LDAP filter: unexpected %q", rest)
+	}
+	return encoded, nil
+}
+
+func parseLDAPFilter(s string) ([]byte, string, error) {
+	if !strings.HasPrefix(s, "(") {
+		return nil, "", errors.New("invalid LDAP filter: expected (")
+	}
+	s = s[1:]
+	if s == "" {
+		return nil, "", errors.New("invalid LDAP filter: unexpected end")
+	}
+
+	switch s[0] {
+	case '&', '|':
+		tag := byte(0xa0)
+		if s[0] == '|' {
+			tag = 0xa1
+		}
+		s = s[1:]
+		var parts [][]byte
+		for strings.HasPrefix(s, "(") {
+			part, rest, err := parseLDAPFilter(s)
+			if err != nil {
+				return nil, "", err
+			}
+			parts = append(parts, part)
+			s = rest
+		}
+		if !strings.HasPrefix(s, ")") {
+			return nil, "", errors.New("invalid LDAP filter: expected )")
+		}
+		return berTLV(tag, berConcat(parts...)), s[1:], nil
+	case '!':
+		part, rest, err := parseLDAPFilter(s[1:])
+		if err != nil {
+			return nil, "", err
+		}
+		if !strings.HasPrefix(rest, ")") {
+			return nil, "", errors.New("invalid LDAP filter: expected )")
+		}
+		return berTLV(0xa2, part), rest[1:], nil
+	}
+
+	end := strings.IndexByte(s, ')')
+	if end < 0 {
+		return nil, "", errors.New("invalid LDAP filter: expected )")
+	}
+	item, rest := s[:end], s[end+1:]
+
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 {
+		return nil, "", fmt.Errorf("invalid LDAP filter item %q", item)
+	}
+	attr, value := item[:eq], item[eq+1:]
+
+	tag := byte(0xa3) // equalityMatch
+	switch attr[len(attr)-1] {
+	case '>':
+		tag, attr = 0xa5, attr[:len(attr)-1]
+	case '<':
+		tag, attr = 0xa6, attr[:len(attr)-1]
+	case '~':
+		tag, attr = 0xa8, attr[:len(attr)-1]
+	}
+	if attr == "" {
+		return nil, "", fmt.Errorf("invalid LDAP filter item %q", item)
+	}
+
+	if tag == 0xa3 && value == "*" {
+		return berTLV(0x87, []byte(attr)), rest, nil
+	}
+
+	if tag == 0xa3 && strings.Contains(value, "*") {
+		pieces := strings.Split(value, "*")
+		var subs [][]byte
+		for i, piece := range pieces {
+			if piece == "" {
+				continue
+			}
+			unescaped, err := unescapeLDAPFilterValue(piece)
+			if err != nil {
+				return nil, "", err
+			}
+			subTag := byte(0x81) // any
+			if i == 0 {
+				subTag = 0x80 // initial
+			} else if i == len(pieces)-1 {
+				subTag = 0x82 // final
+			}
+			subs = append(subs, berTLV(subTag, unescaped))
+		}
+		return berTLV(0xa4, berConcat(
+			berTLV(berOctetString, []byte(attr)),
+			berTLV(berSequence, berConcat(subs...)),
+		)), rest, nil
+	}
+
+	unescaped, err := unescapeLDAPFilterValue(value)
+	if err != nil {
+		return nil, "", err
+	}
+	return berTLV(tag, berConcat(
+		berTLV(berOctetString, []byte(attr)),
+		berTLV(berOctetString, unescaped),
+	)), rest, nil
+}
+
+func unescapeLDAPFilterValue(value string) ([]byte, error) {
+	out := make([]byte, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			out = append(out, value[i])
+			continue
+		}
+		if i+2 >= len(value) {
+			return nil, errors.New("invalid escape in LDAP filter")
+		}
+		b, err := strconv.ParseUint(value[i+1:i+3], 16, 8)
+		if err != nil {
+			return nil, errors.New("invalid escape in LDAP filter")
+		}
+		out = append(out, byte(b))
+		i += 2
+	}
+	return out, nil
+}
+
+// berPacket is a decoded BER element; constructed elements carry children
+type berPacket struct {
+	tag      byte
+	value    []byte
+	children []*berPacket
+}
+
+// readBERPacket reads one element. Long-form lengths are accepted since
+// servers such as Active Directory always use them.
+func readBERPacket(r io.Reader) (*berPacket, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	tag := header[0]
+	if tag&0x1f == 0x1f {
+		return nil, errors.New("multi-byte BER tags are not supported")
+	}
+
+	length := int(header[1])
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 {
+			return nil, errors.New("unsupported BER length")
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		length = 0
+		for _, b := range buf {
+			length = length<<8 | int(b)
+		}
+	}
+	if length > ldapMaxMessageSize {
+		return nil, errors.New("LDAP message too large")
+	}
+
+	value := make([]byte, length)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return nil, err
+	}
+	return decodeBER(tag, value)
+}
+
+func decodeBER(tag byte, value []byte) (*berPacket, error) {
+	packet := &berPacket{tag: tag, value: value}
+	if tag&0x20 == 0 {
+		return packet, nil
+	}
+
+	reader := bufio.NewReader(strings.NewReader(string(value)))
+	for {
+		child, err := readBERPacket(reader)
+		if err == io.EOF {
+			return packet, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("malformed BER element: %w", err)
+		}
+		packet.children = append(packet.children, child)
+	}
+}
+
+func berParseInt(value []byte) (int, error) {
+	if len(value) == 0 || len(value) > 4 {
+		return 0, errors.New("invalid BER integer")
+	}
+	n := int(int8(value[0]))
+	for _, b := range value[1:] {
+		n = n<<8 | int(b)
+	}
+	return n, nil
+}
+
+// berTLV encodes one element with a definite, minimal length
+func berTLV(tag byte, content []byte) []byte {
+	out := []byte{tag}
+	switch n := len(content); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n < 0x100:
+		out = append(out, 0x81, byte(n))
+	case n < 0x10000:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	default:
+		out = append(out, 0x84, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(out, content...)
+}
+
+func berInt(n int) []byte {
+	content := []byte{byte(n)}
+	for v := n >> 8; ; v >>= 8 {
+		// Stop once the remaining bits are pure sign extension of the top byte
+		if (v == 0 && content[0]&0x80 == 0) || (v == -1 && content[0]&0x80 != 0) {
+			break
+		}
+		content = append([]byte{byte(v)}, content...)
+	}
+	return berTLV(berInteger, content)
+}
+
+func berConcat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
@@ -0,0 +1,276 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testLDAPServer is an in-process directory that answers binds and searches
+// with canned data. Like real servers it accepts a DN with an empty password
+// as an unauthenticated bind.
+type testLDAPServer struct {
+	listener  net.Listener
+	passwords map[string]string
+	entries   []LDAPEntry
+	referral  bool
+
+	mu      sync.Mutex
+	binds   []string
+	filters []*berPacket
+}
+
+// newTestLDAPServer starts a directory; configure runs before it accepts
+// connections
+func newTestLDAPServer(t *testing.T, configure ...func(*testLDAPServer)) *testLDAPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testLDAPServer{listener: listener, passwords: map[string]string{}}
+	for _, f := range configure {
+		f(s)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *testLDAPServer) url() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *testLDAPServer) dial(t *testing.T) *LDAPConn {
+	t.Helper()
+	conn, err := DialLDAP(s.url(), false, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func (s *testLDAPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		message, err := readBERPacket(conn)
+		if err != nil || len(message.children) < 2 {
+			return
+		}
+		id, op := message.children[0].value, message.children[1]
+		reply := func(op []byte) {
+			conn.Write(berTLV(berSequence, berConcat(berTLV(berInteger, id), op)))
+		}
+		result := func(tag byte, code int) []byte {
+			return berTLV(tag, berConcat(
+				berTLV(berEnumerated, []byte{byte(code)}),
+				berTLV(berOctetString, nil),
+				berTLV(berOctetString, nil),
+			))
+		}
+
+		switch op.tag {
+		case ldapBindRequest:
+			dn, password := string(op.children[1].value), string(op.children[2].value)
+			s.mu.Lock()
+			s.binds = append(s.binds, dn)
+			s.mu.Unlock()
+			want, ok := s.passwords[dn]
+			if password == "" || (ok && want == password) {
+				reply(result(ldapBindResponse, ldapResultSuccess))
+			} else {
+				reply(result(ldapBindResponse, ldapResultInvalidCredentials))
+			}
+		case ldapSearchRequest:
+			s.mu.Lock()
+			s.filters = append(s.filters, op.children[6])
+			s.mu.Unlock()
+			if s.referral {
+				reply(berTLV(ldapSearchRef, berTLV(berOctetString, []byte("ldap://other.example.com/dc=example,dc=com"))))
+			}
+			for _, entry := range s.entries {
+				var attributes [][]byte
+				for name, values := range entry.Attributes {
+					var encoded [][]byte
+					for _, v := range values {
+						encoded = append(encoded, berTLV(berOctetString, []byte(v)))
+					}
+					attributes = append(attributes, berTLV(berSequence, berConcat(
+						berTLV(berOctetString, []byte(name)),
+						berTLV(0x31, berConcat(encoded...)),
+					)))
+				}
+				reply(berTLV(ldapSearchEntry, berConcat(
+					berTLV(berOctetString, []byte(entry.DN)),
+					berTLV(berSequence, berConcat(attributes...)),
+				)))
+			}
+			reply(result(ldapSearchDone, ldapResultSuccess))
+		case ldapUnbindRequest:
+			return
+		}
+	}
+}
+
+func (s *testLDAPServer) lastFilter() *berPacket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.filters[len(s.filters)-1]
+}
+
+func TestLDAPBind(t *testing.T) {
+	server := newTestLDAPServer(t, func(s *testLDAPServer) {
+		s.passwords["uid=ana,dc=example,dc=com"] = "correct horse"
+	})
+	conn := server.dial(t)
+
+	if err := conn.Bind("uid=ana,dc=example,dc=com", "correct horse"); err != nil {
+		t.Fatalf("bind with the right password: %v", err)
+	}
+	if err := conn.Bind("uid=ana,dc=example,dc=com", "wrong"); !errors.Is(err, ErrLDAPInvalidCredentials) {
+		t.Fatalf("bind with a wrong password: %v", err)
+	}
+	if err := conn.Bind("uid=nobody,dc=example,dc=com", "correct horse"); !errors.Is(err, ErrLDAPInvalidCredentials) {
+		t.Fatalf("bind as an unknown DN: %v", err)
+	}
+}
+
+func TestLDAPBindRefusesEmptyPassword(t *testing.T) {
+	server := newTestLDAPServer(t, func(s *testLDAPServer) {
+		s.passwords["uid=ana,dc=example,dc=com"] = "correct horse"
+	})
+	conn := server.dial(t)
+
+	// The server would accept this as an unauthenticated bind
+	if err := conn.Bind("uid=ana,dc=example,dc=com", ""); !errors.Is(err, ErrLDAPInvalidCredentials) {
+		t.Fatalf("bind with an empty password: %v", err)
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.binds) != 0 {
+		t.Fatalf("empty password was sent to the server: %v", server.binds)
+	}
+}
+
+func TestLDAPSearch(t *testing.T) {
+	server := newTestLDAPServer(t, func(s *testLDAPServer) {
+		s.referral = true
+		s.passwords["uid=ana,dc=example,dc=com"] = "secret"
+		s.entries = []LDAPEntry{
+			{DN: "uid=ana,dc=example,dc=com", Attributes: map[string][]string{
+				"mail":     {"ana@example.com"},
+				"memberOf": {"cn=admins,dc=example,dc=com", "cn=staff,dc=example,dc=com"},
+			}},
+			{DN: "uid=ana2,dc=example,dc=com", Attributes: map[string][]string{"mail": {"ana@example.com"}}},
+		}
+	})
+	conn := server.dial(t)
+
+	// The referral is skipped and both entries are returned, so callers can
+	// tell an ambiguous match from a unique one
+	entries, err := conn.Search("dc=example,dc=com", "(mail=ana@example.com)", []string{"mail", "memberOf"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].DN != "uid=ana,dc=example,dc=com" {
+		t.Fatalf("entries = %+v", entries)
+	}
+	if entries[0].Get("MAIL") != "ana@example.com" || len(entries[0].Values("memberof")) != 2 {
+		t.Fatalf("attributes = %v", entries[0].Attributes)
+	}
+
+	// The connection stays usable after the search
+	if err := conn.Bind(entries[0].DN, "secret"); err != nil {
+		t.Fatalf("bind after search: %v", err)
+	}
+}
+
+func TestLDAPFilterEscaping(t *testing.T) {
+	server := newTestLDAPServer(t)
+	conn := server.dial(t)
+
+	// A login email that tries to widen the filter stays a single equality match
+	hostile := "*)(uid=*))(|(mail=*\\"
+	if _, err := conn.Search("dc=example,dc=com", "(mail="+EscapeLDAPFilter(hostile)+")", nil, 2); err != nil {
+		t.Fatal(err)
+	}
+	filter := server.lastFilter()
+	if filter.tag != 0xa3 || len(filter.children) != 2 {
+		t.Fatalf("filter tag = 0x%x, want an equality match", filter.tag)
+	}
+	if attr, value := string(filter.children[0].value), string(filter.children[1].value); attr != "mail" || value != hostile {
+		t.Fatalf("filter = (%s=%s)", attr, value)
+	}
+}
+
+func TestCompileLDAPFilter(t *testing.T) {
+	equality := func(attr, value string) []byte {
+		return berTLV(0xa3, berConcat(berTLV(berOctetString, []byte(attr)), berTLV(berOctetString, []byte(value))))
+	}
+	cases := map[string][]byte{
+		"(mail=ana@example.com)": equality("mail", "ana@example.com"),
+		"(&(objectClass=person)(mail=a\\2ab))": berTLV(0xa0, berConcat(
+			equality("objectClass", "person"), equality("mail", "a*b"))),
+		"(|(!(uid=x))(mail=*))": berTLV(0xa1, berConcat(
+			berTLV(0xa2, equality("uid", "x")), berTLV(0x87, []byte("mail")))),
+		"(cn=an*a*)": berTLV(0xa4, berConcat(berTLV(berOctetString, []byte("cn")), berTLV(berSequence, berConcat(
+			berTLV(0x80, []byte("an")), berTLV(0x81, []byte("a")))))),
+	}
+	for filter, want := range cases {
+		got, err := compileLDAPFilter(filter)
+		if err != nil {
+			t.Errorf("%s: %v", filter, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: encoded as %x, want %x", filter, got, want)
+		}
+	}
+
+	for _, filter := range []string{"mail=x", "(mail=x", "(mail=x))", "(=x)", "(mail=\\zz)", "(&(mail=x)"} {
+		if _, err := compileLDAPFilter(filter); err == nil {
+			t.Errorf("%s: accepted", filter)
+		}
+	}
+}
+
+func TestLDAPTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		// Accept and never answer
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(2 * time.Second)
+		}
+	}()
+
+	conn, err := DialLDAP("ldap://"+listener.Addr().String(), false, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	start := time.Now()
+	if err := conn.Bind("uid=ana,dc=example,dc=com", "secret"); err == nil {
+		t.Fatal("bind against a silent server succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("bind took %v, want it bounded by the timeout", elapsed)
+	}
+}
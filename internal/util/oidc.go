@@ -0,0 +1,120 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is the RSA key used to sign ID tokens, published through JWKS
+type SigningKey struct {
+	PrivateKey *rsa.PrivateKey
+	KeyID      string
+}
+
+// JWK is the public part of a signing key in JSON Web Key format
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+}
+
+// IDTokenClaims are the OpenID Connect ID token claims we issue
+type IDTokenClaims struct {
+	Nonce         string `json:"nonce,omitempty"`
+	AuthTime      int64  `json:"auth_time,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	Name          string `json:"name,omitempty"`
+	Picture       string `json:"picture,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// LoadSigningKey reads a PEM-encoded RSA private key (PKCS#1 or PKCS#8). With
+// an empty path a new 2048-bit key is generated.
+func LoadSigningKey(path string) (*SigningKey, error) {
+	var key *rsa.PrivateKey
+	if path == "" {
+		generated, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate signing key: %w", err)
+		}
+		key = generated
+	} else {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key: %w", err)
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("signing key is not PEM encoded")
+		}
+		if parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+			key = parsed
+		} else {
+			parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse signing key: %w", err)
+			}
+			rsaKey, ok := parsed.(*rsa.PrivateKey)
+			if !ok {
+				return nil, errors.New("signing key must be an RSA key")
+			}
+			key = rsaKey
+		}
+	}
+
+	// Key ID is derived from the public key so it changes whenever the key does
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode public key: %w", err)
+	}
+	sum := sha256.Sum256(der)
+
+	return &SigningKey{
+		PrivateKey: key,
+		KeyID:      base64.RawURLEncoding.EncodeToString(sum[:12]),
+	}, nil
+}
+
+// PublicJWK returns the key's public part for the JWKS document
+func (k *SigningKey) PublicJWK() JWK {
+	pub := k.PrivateKey.PublicKey
+	return JWK{
+		KeyType:   "RSA",
+		Use:       "sig",
+		Algorithm: "RS256",
+		KeyID:     k.KeyID,
+		N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+// SignIDToken signs ID token claims with RS256, filling in the registered claims
+func (k *SigningKey) SignIDToken(claims IDTokenClaims, issuer, subject, audience string, expiresIn time.Duration) (string, error) {
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    issuer,
+		Subject:   subject,
+		Audience:  jwt.ClaimStrings{audience},
+		ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+		IssuedAt:  jwt.NewNumericDate(now),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = k.KeyID
+	return token.SignedString(k.PrivateKey)
+}
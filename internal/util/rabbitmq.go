@@ -1,166 +1,382 @@
 package util
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"yourapp/internal/config"
 
+	"github.com/google/uuid"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 type RabbitMQClient struct {
-	conn    *amqp.Connection
-	channel *amqp.Channel
-	config  *config.Config
+	config *config.Config
+
+	// mu guards the connection, the consumer channel and the consumers,
+	// all of which the supervisor replaces after a connection loss
+	mu        sync.RWMutex
+	conn      *amqp.Connection
+	channel   *amqp.Channel
+	consumers []*Consumer
+	closed    bool
+	done      chan struct{}
+
+	// confirmChannel is a separate channel in confirm mode that every
+	// publish goes through; returned messages arrive on confirmReturns
+	confirmMu      sync.Mutex
+	confirmChannel *amqp.Channel
+	confirmReturns chan amqp.Return
 }
 
-type EmailMessage struct {
-	To      string `json:"to"`
-	Subject string `json:"subject"`
-	Body    string `json:"body"`
-	Type    string `json:"type"` // "otp", "reset_password", "verification"
-}
+const (
+	EmailQueueName  = "email_queue"
+	EmailExchange   = "email_exchange"
+	EmailRoutingKey = "email"
+	EmailDLQName    = "email_dlq" // Jobs the worker can never send, kept for inspection
+)
 
+// Headers the email worker uses to track failed deliveries
 const (
-	EmailQueueName = "email_queue"
-	EmailExchange  = "email_exchange"
+	EmailRetryCountHeader   = "x-retry-count"
+	EmailLastErrorHeader    = "x-last-error"
+	EmailDeathReasonHeader  = "x-death-reason"
+	EmailDeadLetteredHeader = "x-dead-lettered-at"
 )
 
-func NewRabbitMQClient(cfg *config.Config) (*RabbitMQClient, error) {
-	url := fmt.Sprintf("amqp://%s:%s@%s:%s/",
-		cfg.RabbitMQUser,
-		cfg.RabbitMQPassword,
-		cfg.RabbitMQHost,
-		cfg.RabbitMQPort,
-	)
+// EmailRetryDelays are the backoff tiers for failed email jobs. Each tier is a
+// queue whose messages expire back into the email queue after the delay; jobs
+// retried more often than there are tiers keep waiting the last delay.
+var EmailRetryDelays = []time.Duration{
+	15 * time.Second,
+	time.Minute,
+	4 * time.Minute,
+	16 * time.Minute,
+	time.Hour,
+}
 
-	conn, err := amqp.Dial(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+// EmailRetryDelay returns the backoff before the given 1-based retry
+func EmailRetryDelay(retry int) time.Duration {
+	tier := retry - 1
+	if tier >= len(EmailRetryDelays) {
+		tier = len(EmailRetryDelays) - 1
 	}
-
-	channel, err := conn.Channel()
-	if err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("failed to open channel: %w", err)
+	if tier < 0 {
+		tier = 0
 	}
+	return EmailRetryDelays[tier]
+}
 
-	// Declare exchange
-	err = channel.ExchangeDeclare(
-		EmailExchange, // name
-		"direct",      // type
-		true,          // durable
-		false,         // auto-deleted
-		false,         // internal
-		false,         // no-wait
-		nil,           // arguments
-	)
-	if err != nil {
-		channel.Close()
-		conn.Close()
-		return nil, fmt.Errorf("failed to declare exchange: %w", err)
+// emailRetryQueueName names the retry queue of a backoff tier
+func emailRetryQueueName(delay time.Duration) string {
+	return fmt.Sprintf("email_retry_%ds", int(delay/time.Second))
+}
+
+// EmailRetryCount reads how many times a delivery has already been retried
+func EmailRetryCount(msg amqp.Delivery) int {
+	switch count := msg.Headers[EmailRetryCountHeader].(type) {
+	case int:
+		return count
+	case int8:
+		return int(count)
+	case int16:
+		return int(count)
+	case int32:
+		return int(count)
+	case int64:
+		return int(count)
+	default:
+		return 0
 	}
+}
 
-	// Declare queue
-	_, err = channel.QueueDeclare(
-		EmailQueueName, // name
-		true,           // durable
-		false,          // delete when unused
-		false,          // exclusive
-		false,          // no-wait
-		nil,            // arguments
-	)
-	if err != nil {
-		channel.Close()
-		conn.Close()
-		return nil, fmt.Errorf("failed to declare queue: %w", err)
+// ConsumeOptions tunes a queue subscription
+type ConsumeOptions struct {
+	Prefetch    int // Unacked deliveries the broker sends ahead (basic.qos)
+	Concurrency int // Deliveries handled at once
+}
+
+// Consumer is a queue subscription. The supervisor restarts it on every new
+// channel until Stop is called.
+type Consumer struct {
+	client *RabbitMQClient
+	queue  string
+	tag    string
+	opts   ConsumeOptions
+	handle func(amqp.Delivery)
+
+	stopping atomic.Bool
+	handlers sync.WaitGroup
+}
+
+// Backoff between connection attempts while RabbitMQ is unreachable
+const (
+	reconnectInitialDelay = time.Second
+	reconnectMaxDelay     = 30 * time.Second
+)
+
+// NewRabbitMQClient connects to RabbitMQ. When the broker is unreachable the
+// client is returned anyway and keeps connecting in the background, so the
+// first connection declares the topology and starts consumers exactly like a
+// reconnect does.
+func NewRabbitMQClient(cfg *config.Config) *RabbitMQClient {
+	client := &RabbitMQClient{
+		config: cfg,
+		done:   make(chan struct{}),
 	}
 
-	// Bind queue to exchange
-	err = channel.QueueBind(
-		EmailQueueName, // queue name
-		"email",        // routing key
-		EmailExchange,  // exchange
-		false,
-		nil,
-	)
-	if err != nil {
-		channel.Close()
-		conn.Close()
-		return nil, fmt.Errorf("failed to bind queue: %w", err)
+	if err := client.ensureConnection(); err != nil {
+		log.Printf("Failed to connect to RabbitMQ: %v. Retrying in the background...", err)
+		go client.reconnect()
 	}
 
-	return &RabbitMQClient{
-		conn:    conn,
-		channel: channel,
-		config:  cfg,
-	}, nil
+	return client
 }
 
 // ensureConnection ensures the RabbitMQ connection and channel are open
 func (r *RabbitMQClient) ensureConnection() error {
-	// Check if connection is closed
-	if r.conn == nil || r.conn.IsClosed() {
-		log.Println("RabbitMQ connection closed, reconnecting...")
-		if err := r.reconnect(); err != nil {
-			return fmt.Errorf("failed to reconnect: %w", err)
-		}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.connectLocked()
+}
+
+// connectLocked reopens whatever part of the connection is closed, declares
+// the topology on the new channel, restarts the consumers on it and starts a
+// supervisor for the new connection. The caller must hold mu.
+func (r *RabbitMQClient) connectLocked() error {
+	if r.closed {
+		return errors.New("RabbitMQ client is closed")
+	}
+
+	connectionOpen := r.conn != nil && !r.conn.IsClosed()
+	if connectionOpen && r.channel != nil && !r.channel.IsClosed() {
+		return nil
 	}
+	reconnecting := r.channel != nil
 
-	// Check if channel is closed
-	if r.channel == nil || r.channel.IsClosed() {
-		log.Println("RabbitMQ channel closed, recreating...")
-		channel, err := r.conn.Channel()
+	if !connectionOpen {
+		conn, err := amqp.Dial(r.url())
 		if err != nil {
-			return fmt.Errorf("failed to recreate channel: %w", err)
+			return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
 		}
+		r.conn = conn
+	}
 
-		// Re-declare exchange and queue
-		if err := r.setupChannel(channel); err != nil {
+	channel, err := r.conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open channel: %w", err)
+	}
+
+	// Re-declare exchange and queues
+	if err := r.setupChannel(channel); err != nil {
+		channel.Close()
+		return fmt.Errorf("failed to setup channel: %w", err)
+	}
+
+	for _, c := range r.consumers {
+		if err := r.startConsumer(channel, c); err != nil {
 			channel.Close()
-			return fmt.Errorf("failed to setup channel: %w", err)
+			return err
 		}
-
-		r.channel = channel
 	}
 
+	r.channel = channel
+	go r.supervise(r.conn, channel)
+
+	if reconnecting {
+		log.Printf("RabbitMQ reconnected successfully, %d consumer(s) restarted", len(r.consumers))
+	} else {
+		log.Printf("RabbitMQ connected successfully, %d consumer(s) started", len(r.consumers))
+	}
 	return nil
 }
 
-// reconnect reconnects to RabbitMQ
-func (r *RabbitMQClient) reconnect() error {
-	url := fmt.Sprintf("amqp://%s:%s@%s:%s/",
-		r.config.RabbitMQUser,
-		r.config.RabbitMQPassword,
-		r.config.RabbitMQHost,
-		r.config.RabbitMQPort,
-	)
+// supervise waits for the connection or the consumer channel to close and
+// then reconnects. The reconnect starts a new supervisor, so exactly one
+// watches each connection.
+func (r *RabbitMQClient) supervise(conn *amqp.Connection, channel *amqp.Channel) {
+	connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	channelClosed := channel.NotifyClose(make(chan *amqp.Error, 1))
+
+	var reason *amqp.Error
+	select {
+	case reason = <-connClosed:
+	case reason = <-channelClosed:
+	case <-r.done:
+		return
+	}
+	log.Printf("RabbitMQ connection lost: %v. Reconnecting...", reason)
+	r.reconnect()
+}
 
-	conn, err := amqp.Dial(url)
-	if err != nil {
-		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+// reconnect retries the connection with exponential backoff until it is open
+// or the client is closed
+func (r *RabbitMQClient) reconnect() {
+	delay := reconnectInitialDelay
+	for {
+		err := r.ensureConnection()
+		if err == nil {
+			return
+		}
+		log.Printf("Failed to reconnect to RabbitMQ: %v. Retrying in %v...", err, delay)
+
+		select {
+		case <-time.After(delay):
+		case <-r.done:
+			return
+		}
+		delay *= 2
+		if delay > reconnectMaxDelay {
+			delay = reconnectMaxDelay
+		}
 	}
+}
 
-	channel, err := conn.Channel()
-	if err != nil {
-		conn.Close()
-		return fmt.Errorf("failed to open channel: %w", err)
+// Consume subscribes handle to a queue with manual acks, running up to
+// opts.Concurrency handlers at once. The subscription survives reconnects;
+// while disconnected it starts once the connection is up.
+func (r *RabbitMQClient) Consume(queue string, opts ConsumeOptions, handle func(amqp.Delivery)) (*Consumer, error) {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	if opts.Prefetch < opts.Concurrency {
+		opts.Prefetch = opts.Concurrency
 	}
 
-	if err := r.setupChannel(channel); err != nil {
-		channel.Close()
-		conn.Close()
-		return err
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil, errors.New("RabbitMQ client is closed")
 	}
 
-	r.conn = conn
-	r.channel = channel
-	log.Println("RabbitMQ reconnected successfully")
+	c := &Consumer{
+		client: r,
+		queue:  queue,
+		tag:    fmt.Sprintf("%s-%s", queue, uuid.New().String()),
+		opts:   opts,
+		handle: handle,
+	}
+
+	// The reconnect in progress starts the consumer with the others
+	if err := r.connectLocked(); err != nil {
+		log.Printf("Consumer for %s waits for RabbitMQ: %v", queue, err)
+		r.consumers = append(r.consumers, c)
+		return c, nil
+	}
+
+	if err := r.startConsumer(r.channel, c); err != nil {
+		return nil, err
+	}
+	r.consumers = append(r.consumers, c)
+	return c, nil
+}
+
+func (r *RabbitMQClient) startConsumer(channel *amqp.Channel, c *Consumer) error {
+	// Applies to consumers started on the channel after this call
+	if err := channel.Qos(c.opts.Prefetch, 0, false); err != nil {
+		return fmt.Errorf("failed to set prefetch for %s: %w", c.queue, err)
+	}
+
+	msgs, err := channel.Consume(
+		c.queue, // queue
+		c.tag,   // consumer
+		false,   // auto-ack (set to false for manual ack)
+		false,   // exclusive
+		false,   // no-local
+		false,   // no-wait
+		nil,     // args
+	)
+	if err != nil {
+		return fmt.Errorf("failed to consume %s: %w", c.queue, err)
+	}
+
+	// The handlers end when the channel closes; the supervisor starts new ones
+	for i := 0; i < c.opts.Concurrency; i++ {
+		c.handlers.Add(1)
+		go func() {
+			defer c.handlers.Done()
+			for msg := range msgs {
+				if c.stopping.Load() {
+					// Prefetched after Stop; hand it back for another consumer
+					msg.Nack(false, true)
+					continue
+				}
+				c.handle(msg)
+			}
+		}()
+	}
 	return nil
 }
 
+// Stop cancels the subscription and waits until the handlers have finished
+// the deliveries in flight, or ctx is done. Deliveries prefetched but not yet
+// started are requeued. An error means some handlers were still running;
+// their unacked deliveries return to the queue when the connection closes.
+func (c *Consumer) Stop(ctx context.Context) error {
+	r := c.client
+	if c.stopping.Swap(true) {
+		return nil
+	}
+
+	r.mu.Lock()
+	for i, other := range r.consumers {
+		if other == c {
+			r.consumers = append(r.consumers[:i], r.consumers[i+1:]...)
+			break
+		}
+	}
+	if r.channel != nil && !r.channel.IsClosed() {
+		if err := r.channel.Cancel(c.tag, false); err != nil {
+			log.Printf("Failed to cancel consumer %s: %v", c.tag, err)
+		}
+	}
+	r.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		c.handlers.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("consumer %s did not drain: %w", c.tag, ctx.Err())
+	}
+}
+
+// openChannel opens an extra channel on the current connection
+func (r *RabbitMQClient) openChannel() (*amqp.Channel, error) {
+	if err := r.ensureConnection(); err != nil {
+		return nil, fmt.Errorf("connection error: %w", err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	channel, err := r.conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open channel: %w", err)
+	}
+	return channel, nil
+}
+
+func (r *RabbitMQClient) url() string {
+	return fmt.Sprintf("amqp://%s:%s@%s:%s/",
+		r.config.RabbitMQUser,
+		r.config.RabbitMQPassword,
+		r.config.RabbitMQHost,
+		r.config.RabbitMQPort,
+	)
+}
+
 // setupChannel sets up exchange, queue, and binding
 func (r *RabbitMQClient) setupChannel(channel *amqp.Channel) error {
 	// Declare exchange
@@ -190,69 +406,336 @@ func (r *RabbitMQClient) setupChannel(channel *amqp.Channel) error {
 
 	// Bind queue to exchange
 	if err := channel.QueueBind(
-		EmailQueueName, // queue name
-		"email",        // routing key
-		EmailExchange,  // exchange
+		EmailQueueName,  // queue name
+		EmailRoutingKey, // routing key
+		EmailExchange,   // exchange
 		false,
 		nil,
 	); err != nil {
 		return fmt.Errorf("failed to bind queue: %w", err)
 	}
 
+	// Declare the dead-letter queue, published to through the default exchange
+	if _, err := channel.QueueDeclare(
+		EmailDLQName, // name
+		true,         // durable
+		false,        // delete when unused
+		false,        // exclusive
+		false,        // no-wait
+		nil,          // arguments
+	); err != nil {
+		return fmt.Errorf("failed to declare dead-letter queue: %w", err)
+	}
+
+	// Declare one retry queue per backoff tier. They have no consumers; the
+	// broker dead-letters expired messages back to the email exchange.
+	for _, delay := range EmailRetryDelays {
+		if _, err := channel.QueueDeclare(
+			emailRetryQueueName(delay), // name
+			true,                       // durable
+			false,                      // delete when unused
+			false,                      // exclusive
+			false,                      // no-wait
+			amqp.Table{
+				"x-message-ttl":             int64(delay / time.Millisecond),
+				"x-dead-letter-exchange":    EmailExchange,
+				"x-dead-letter-routing-key": EmailRoutingKey,
+			},
+		); err != nil {
+			return fmt.Errorf("failed to declare retry queue: %w", err)
+		}
+	}
+
 	return nil
 }
 
-// PublishEmail publishes an email message to RabbitMQ
-func (r *RabbitMQClient) PublishEmail(message EmailMessage) error {
-	// Ensure connection is open
-	if err := r.ensureConnection(); err != nil {
-		return fmt.Errorf("connection error: %w", err)
-	}
+// Errors returned by PublishConfirmed when the broker does not take a message
+var (
+	ErrPublishNacked     = errors.New("message was nacked by RabbitMQ")
+	ErrPublishUnroutable = errors.New("message was returned by RabbitMQ as unroutable")
+)
 
-	body, err := json.Marshal(message)
-	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
-	}
-
-	err = r.channel.Publish(
-		EmailExchange, // exchange
-		"email",       // routing key
-		false,         // mandatory
-		false,         // immediate
-		amqp.Publishing{
-			ContentType:  "application/json",
-			Body:         body,
-			DeliveryMode: amqp.Persistent, // Make message persistent
-		},
-	)
+// PublishConfirmed publishes a mandatory message and waits for the broker to
+// confirm it, so a nil error means a queue has safely stored the message.
+// Messages no queue is bound for come back as ErrPublishUnroutable instead of
+// being dropped silently.
+func (r *RabbitMQClient) PublishConfirmed(exchange, routingKey string, msg amqp.Publishing) error {
+	r.confirmMu.Lock()
+	defer r.confirmMu.Unlock()
 
+	if err := r.ensureConfirmChannel(); err != nil {
+		return err
+	}
+	r.drainReturns()
+
+	timeout := time.Duration(r.config.RabbitMQPublishTimeoutSeconds) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	confirmation, err := r.confirmChannel.PublishWithDeferredConfirmWithContext(
+		ctx,
+		exchange,   // exchange
+		routingKey, // routing key
+		true,       // mandatory: return the message if no queue takes it
+		false,      // immediate
+		msg,
+	)
 	if err != nil {
 		return fmt.Errorf("failed to publish message: %w", err)
 	}
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		// The message may still be confirmed later; drop the channel so the
+		// late confirmation cannot be mistaken for the next publish
+		r.closeConfirmChannel()
+		return fmt.Errorf("failed to confirm message within %v: %w", timeout, err)
+	}
+	if !acked {
+		return ErrPublishNacked
+	}
 
-	log.Printf("Email message published to queue: %s -> %s", message.Type, message.To)
+	// The broker sends basic.return before the ack of an unroutable message,
+	// and publishes are serialized, so a return waiting now is for this one
+	if returns := r.drainReturns(); len(returns) > 0 {
+		return fmt.Errorf("%w: %s (exchange %q, routing key %q)", ErrPublishUnroutable, returns[0].ReplyText, exchange, routingKey)
+	}
 	return nil
 }
 
-// Close closes the RabbitMQ connection
-func (r *RabbitMQClient) Close() error {
-	if r.channel != nil {
-		if err := r.channel.Close(); err != nil {
-			return err
+// ensureConfirmChannel opens the confirm-mode channel and subscribes to its
+// returns. The caller must hold confirmMu.
+func (r *RabbitMQClient) ensureConfirmChannel() error {
+	if r.confirmChannel != nil && !r.confirmChannel.IsClosed() {
+		return nil
+	}
+
+	channel, err := r.openChannel()
+	if err != nil {
+		return err
+	}
+	if err := channel.Confirm(false); err != nil {
+		channel.Close()
+		return fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+	r.confirmChannel = channel
+	r.confirmReturns = channel.NotifyReturn(make(chan amqp.Return, 16))
+	return nil
+}
+
+// drainReturns collects the returned messages waiting on the confirm channel.
+// The caller must hold confirmMu.
+func (r *RabbitMQClient) drainReturns() []amqp.Return {
+	var returns []amqp.Return
+	for {
+		select {
+		case returned, ok := <-r.confirmReturns:
+			if !ok {
+				return returns
+			}
+			returns = append(returns, returned)
+		default:
+			return returns
 		}
 	}
-	if r.conn != nil {
-		return r.conn.Close()
+}
+
+// closeConfirmChannel discards the confirm channel. The caller must hold confirmMu.
+func (r *RabbitMQClient) closeConfirmChannel() {
+	if r.confirmChannel != nil {
+		r.confirmChannel.Close()
+	}
+	r.confirmChannel = nil
+	r.confirmReturns = nil
+}
+
+// PublishDeadLetter moves a delivery the worker rejected to the dead-letter
+// queue, recording why in the x-death-reason header
+func (r *RabbitMQClient) PublishDeadLetter(msg amqp.Delivery, reason string) error {
+	headers := copyHeaders(msg.Headers)
+	headers[EmailDeathReasonHeader] = reason
+	headers[EmailDeadLetteredHeader] = time.Now().UTC().Format(time.RFC3339)
+
+	// The default exchange routes by queue name
+	if err := r.PublishConfirmed("", EmailDLQName, republishing(msg, headers)); err != nil {
+		return fmt.Errorf("failed to publish dead letter: %w", err)
 	}
 	return nil
 }
 
-// GetChannel returns the channel for consuming messages
-func (r *RabbitMQClient) GetChannel() *amqp.Channel {
-	return r.channel
+// PublishRetry parks a failed delivery in the retry queue of its backoff
+// tier. retry is the 1-based number of the retry being scheduled.
+func (r *RabbitMQClient) PublishRetry(msg amqp.Delivery, retry int, reason string) (time.Duration, error) {
+	delay := EmailRetryDelay(retry)
+
+	headers := copyHeaders(msg.Headers)
+	headers[EmailRetryCountHeader] = int32(retry)
+	headers[EmailLastErrorHeader] = reason
+
+	if err := r.PublishConfirmed("", emailRetryQueueName(delay), republishing(msg, headers)); err != nil {
+		return 0, fmt.Errorf("failed to publish retry: %w", err)
+	}
+	return delay, nil
+}
+
+// DeadLetter is a message parked in the email dead-letter queue. Job is nil
+// when the body is not a valid job; Body then holds it as received.
+type DeadLetter struct {
+	MessageID      string    `json:"message_id"`
+	Type           string    `json:"type"`
+	Reason         string    `json:"reason"`
+	Retries        int       `json:"retries"`
+	DeadLetteredAt string    `json:"dead_lettered_at,omitempty"`
+	Job            *EmailJob `json:"job,omitempty"`
+	Body           string    `json:"body,omitempty"`
+}
+
+// PeekDeadLetters returns up to limit messages from the head of the
+// dead-letter queue without removing them, and the queue's total size
+func (r *RabbitMQClient) PeekDeadLetters(limit int) ([]DeadLetter, int, error) {
+	// Unacked messages return to the queue when this channel closes
+	channel, err := r.openChannel()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer channel.Close()
+
+	queue, err := channel.QueueDeclarePassive(EmailDLQName, true, false, false, false, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to inspect dead-letter queue: %w", err)
+	}
+
+	letters := make([]DeadLetter, 0, min(limit, queue.Messages))
+	for len(letters) < limit {
+		msg, ok, err := channel.Get(EmailDLQName, false)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read dead-letter queue: %w", err)
+		}
+		if !ok {
+			break
+		}
+		letters = append(letters, newDeadLetter(msg))
+	}
+	return letters, queue.Messages, nil
 }
 
-// GetQueueName returns the email queue name
-func (r *RabbitMQClient) GetQueueName() string {
-	return EmailQueueName
+// ReplayDeadLetters moves dead letters back to the email queue with their
+// retry count reset. Only the listed message IDs are replayed, or every
+// message when ids is empty; the rest stay in the dead-letter queue.
+func (r *RabbitMQClient) ReplayDeadLetters(ids []string) (int, error) {
+	channel, err := r.openChannel()
+	if err != nil {
+		return 0, err
+	}
+	defer channel.Close()
+
+	queue, err := channel.QueueDeclarePassive(EmailDLQName, true, false, false, false, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to inspect dead-letter queue: %w", err)
+	}
+
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	// Read at most the messages present now, so replayed jobs that fail
+	// again are not picked up a second time
+	replayed := 0
+	for i := 0; i < queue.Messages; i++ {
+		msg, ok, err := channel.Get(EmailDLQName, false)
+		if err != nil {
+			return replayed, fmt.Errorf("failed to read dead-letter queue: %w", err)
+		}
+		if !ok {
+			break
+		}
+		if len(wanted) > 0 && !wanted[msg.MessageId] {
+			continue
+		}
+
+		headers := copyHeaders(msg.Headers)
+		for _, key := range []string{EmailRetryCountHeader, EmailLastErrorHeader, EmailDeathReasonHeader, EmailDeadLetteredHeader} {
+			delete(headers, key)
+		}
+		if err := r.PublishConfirmed(EmailExchange, EmailRoutingKey, republishing(msg, headers)); err != nil {
+			return replayed, fmt.Errorf("failed to replay dead letter: %w", err)
+		}
+		if err := msg.Ack(false); err != nil {
+			return replayed, fmt.Errorf("failed to ack dead letter: %w", err)
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+func newDeadLetter(msg amqp.Delivery) DeadLetter {
+	letter := DeadLetter{
+		MessageID: msg.MessageId,
+		Type:      msg.Type,
+		Retries:   EmailRetryCount(msg),
+	}
+	letter.Reason, _ = msg.Headers[EmailDeathReasonHeader].(string)
+	letter.DeadLetteredAt, _ = msg.Headers[EmailDeadLetteredHeader].(string)
+
+	var job EmailJob
+	if err := json.Unmarshal(msg.Body, &job); err == nil {
+		// Data holds codes and links meant only for the recipient
+		job.Data = nil
+		letter.Job = &job
+	} else {
+		letter.Body = string(msg.Body)
+	}
+	return letter
+}
+
+func copyHeaders(headers amqp.Table) amqp.Table {
+	copied := amqp.Table{}
+	for key, value := range headers {
+		copied[key] = value
+	}
+	return copied
+}
+
+// republishing copies a delivery into a new persistent message
+func republishing(msg amqp.Delivery, headers amqp.Table) amqp.Publishing {
+	return amqp.Publishing{
+		Headers:      headers,
+		ContentType:  msg.ContentType,
+		Body:         msg.Body,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    msg.MessageId,
+		Type:         msg.Type,
+		Timestamp:    msg.Timestamp,
+	}
+}
+
+// IsConnected reports whether the connection and consumer channel are open.
+// It is false while the supervisor is reconnecting.
+func (r *RabbitMQClient) IsConnected() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return !r.closed && r.conn != nil && !r.conn.IsClosed() && r.channel != nil && !r.channel.IsClosed()
+}
+
+// Close stops the supervisor and closes the RabbitMQ connection
+func (r *RabbitMQClient) Close() error {
+	r.confirmMu.Lock()
+	r.closeConfirmChannel()
+	r.confirmMu.Unlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	close(r.done)
+
+	if r.channel != nil {
+		r.channel.Close()
+	}
+	if r.conn != nil {
+		return r.conn.Close()
+	}
+	return nil
 }
@@ -0,0 +1,803 @@
+package util
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"yourapp/internal/config"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestEmailRetryDelay(t *testing.T) {
+	cases := map[int]time.Duration{
+		0:   15 * time.Second, // Not a valid retry number; treated as the first
+		1:   15 * time.Second,
+		2:   time.Minute,
+		3:   4 * time.Minute,
+		5:   time.Hour,
+		6:   time.Hour, // Past the last tier the last delay repeats
+		100: time.Hour,
+	}
+	for retry, want := range cases {
+		if got := EmailRetryDelay(retry); got != want {
+			t.Errorf("retry %d: delay = %v, want %v", retry, got, want)
+		}
+	}
+}
+
+func TestEmailRetryQueueNames(t *testing.T) {
+	seen := map[string]bool{}
+	for _, delay := range EmailRetryDelays {
+		name := emailRetryQueueName(delay)
+		if seen[name] {
+			t.Fatalf("tiers share the retry queue %s", name)
+		}
+		seen[name] = true
+	}
+	if name := emailRetryQueueName(4 * time.Minute); name != "email_retry_240s" {
+		t.Fatalf("name = %s", name)
+	}
+}
+
+func TestEmailRetryCount(t *testing.T) {
+	// The broker hands integer headers back in whatever width it decoded
+	for _, count := range []interface{}{int(2), int8(2), int16(2), int32(2), int64(2)} {
+		msg := amqp.Delivery{Headers: amqp.Table{EmailRetryCountHeader: count}}
+		if got := EmailRetryCount(msg); got != 2 {
+			t.Errorf("%T header: count = %d, want 2", count, got)
+		}
+	}
+	for _, headers := range []amqp.Table{nil, {}, {EmailRetryCountHeader: "2"}} {
+		if got := EmailRetryCount(amqp.Delivery{Headers: headers}); got != 0 {
+			t.Errorf("headers %v: count = %d, want 0", headers, got)
+		}
+	}
+}
+
+func TestNewDeadLetter(t *testing.T) {
+	job, err := NewEmailJob("ana@example.com", "en", OTPEmailData{Code: "123456", ExpiresMinutes: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	letter := newDeadLetter(amqp.Delivery{
+		MessageId: job.IdempotencyKey,
+		Type:      job.Type,
+		Body:      body,
+		Headers: amqp.Table{
+			EmailRetryCountHeader:   int32(4),
+			EmailDeathReasonHeader:  "gave up after 5 attempts: connection refused",
+			EmailDeadLetteredHeader: "2026-01-02T03:04:05Z",
+		},
+	})
+
+	if letter.MessageID != job.IdempotencyKey || letter.Type != EmailTypeOTP || letter.Retries != 4 {
+		t.Fatalf("letter = %+v", letter)
+	}
+	if letter.Reason != "gave up after 5 attempts: connection refused" || letter.DeadLetteredAt != "2026-01-02T03:04:05Z" {
+		t.Fatalf("reason = %q at %q", letter.Reason, letter.DeadLetteredAt)
+	}
+	// The OTP code is not shown to whoever inspects the queue
+	if letter.Job == nil || letter.Job.To != "ana@example.com" || letter.Job.Data != nil || letter.Body != "" {
+		t.Fatalf("job = %+v, body = %q", letter.Job, letter.Body)
+	}
+
+	letter = newDeadLetter(amqp.Delivery{Body: []byte("not json")})
+	if letter.Job != nil || letter.Body != "not json" {
+		t.Fatalf("invalid body: job = %+v, body = %q", letter.Job, letter.Body)
+	}
+}
+
+func TestRepublishing(t *testing.T) {
+	headers := amqp.Table{"x-trace": "abc"}
+	msg := amqp.Delivery{
+		Headers:      headers,
+		ContentType:  "application/json",
+		Body:         []byte(`{}`),
+		DeliveryMode: amqp.Transient,
+		MessageId:    "key-1",
+		Type:         EmailTypeOTP,
+		Timestamp:    time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	copied := copyHeaders(msg.Headers)
+	copied[EmailRetryCountHeader] = int32(1)
+	if _, ok := headers[EmailRetryCountHeader]; ok {
+		t.Fatal("copyHeaders shares the delivery's header table")
+	}
+
+	p := republishing(msg, copied)
+	if p.DeliveryMode != amqp.Persistent {
+		t.Fatal("republished message is not persistent")
+	}
+	if p.MessageId != "key-1" || p.Type != EmailTypeOTP || p.ContentType != "application/json" || !p.Timestamp.Equal(msg.Timestamp) || string(p.Body) != "{}" {
+		t.Fatalf("publishing = %+v", p)
+	}
+	if p.Headers["x-trace"] != "abc" || p.Headers[EmailRetryCountHeader] != int32(1) {
+		t.Fatalf("headers = %v", p.Headers)
+	}
+}
+
+// testBroker is an in-process AMQP 0-9-1 server that speaks just enough of
+// the protocol for RabbitMQClient: the handshake, channels, declarations,
+// publisher confirms, mandatory returns and consumers. Messages are routed
+// through the default exchange and queue bindings like RabbitMQ routes them.
+type testBroker struct {
+	listener net.Listener
+	nack     bool // Nack every publish instead of acking it
+
+	down bool // Close every connection before the handshake
+
+	mu        sync.Mutex
+	silent    bool                       // Never confirm publishes
+	queues    map[string][]brokerMessage // Messages ready for delivery
+	bindings  map[string]string          // "exchange/routing key" to queue
+	published []brokerMessage
+	conns     map[*brokerConn]bool
+	accepted  int // Connections ever made
+	consumers []*brokerConsumer
+	consumes  []string // Queues of every basic.consume received
+	prefetch  []int    // Prefetch counts of every basic.qos received
+	acked     int
+}
+
+type brokerMessage struct {
+	exchange, routingKey string
+	queue                string // Empty when the message was unroutable
+	header, body         []byte
+}
+
+// brokerConsumer is a subscription; unacked holds its deliveries by tag. A
+// cancelled consumer gets no more deliveries but can still ack, like on
+// RabbitMQ, until its connection closes.
+type brokerConsumer struct {
+	conn      *brokerConn
+	channel   uint16
+	tag       string
+	queue     string
+	cancelled bool
+	delivered uint64
+	unacked   map[uint64]brokerMessage
+}
+
+// brokerConn is one client connection. Its reader owns channels; frames may
+// also be written by other connections delivering to its consumers.
+type brokerConn struct {
+	net.Conn
+	reader   *bufio.Reader
+	channels map[uint16]*brokerChannel
+	writeMu  sync.Mutex
+}
+
+type brokerChannel struct {
+	confirm   bool
+	published uint64 // Delivery tag of the last publish in confirm mode
+
+	// The publish whose content frames are being read
+	publish   *brokerMessage
+	mandatory bool
+	header    []byte
+	size      uint64
+}
+
+// newTestBroker starts a broker; configure runs before it accepts connections
+func newTestBroker(t *testing.T, configure ...func(*testBroker)) *testBroker {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &testBroker{
+		listener: listener,
+		queues:   map[string][]brokerMessage{},
+		bindings: map[string]string{},
+		conns:    map[*brokerConn]bool{},
+	}
+	for _, f := range configure {
+		f(b)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(&brokerConn{Conn: conn, reader: bufio.NewReader(conn), channels: map[uint16]*brokerChannel{}})
+		}
+	}()
+	return b
+}
+
+// client connects a RabbitMQClient that is closed when the test ends
+func (b *testBroker) client(t *testing.T) *RabbitMQClient {
+	t.Helper()
+	client := b.dial(t)
+	if !client.IsConnected() {
+		t.Fatal("client did not connect")
+	}
+	return client
+}
+
+// dial creates a RabbitMQClient, which may still be connecting
+func (b *testBroker) dial(t *testing.T) *RabbitMQClient {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(b.listener.Addr().String())
+	client := NewRabbitMQClient(&config.Config{
+		RabbitMQHost:                  host,
+		RabbitMQPort:                  port,
+		RabbitMQUser:                  "guest",
+		RabbitMQPassword:              "guest",
+		RabbitMQPublishTimeoutSeconds: 1,
+	})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func (b *testBroker) setDown(down bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.down = down
+}
+
+func (b *testBroker) setSilent(silent bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.silent = silent
+}
+
+func (b *testBroker) messages() []brokerMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]brokerMessage(nil), b.published...)
+}
+
+// drop closes every client connection, like a broker restart
+func (b *testBroker) drop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.conns {
+		c.Close()
+	}
+}
+
+func (b *testBroker) stats() (consumes []string, prefetch []int, acked int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.consumes...), append([]int(nil), b.prefetch...), b.acked
+}
+
+func (b *testBroker) serve(c *brokerConn) {
+	b.mu.Lock()
+	b.conns[c] = true
+	b.accepted++
+	down := b.down
+	b.mu.Unlock()
+	defer b.disconnect(c)
+	if down {
+		return
+	}
+	protocol := make([]byte, 8)
+	if _, err := io.ReadFull(c.reader, protocol); err != nil || string(protocol) != "AMQP\x00\x00\x09\x01" {
+		return
+	}
+	c.method(0, 10, 10, []byte{0, 9}, amqpLong(0), amqpLongString("PLAIN"), amqpLongString("en_US"))
+
+	for {
+		kind, channel, payload, err := c.readFrame()
+		if err != nil {
+			return
+		}
+		switch kind {
+		case 1:
+			if !b.handleMethod(c, channel, payload) {
+				return
+			}
+		case 2, 3:
+			b.handleContent(c, channel, kind, payload)
+		}
+	}
+}
+
+// handleMethod answers a method frame and reports whether the connection stays open
+func (b *testBroker) handleMethod(c *brokerConn, channel uint16, payload []byte) bool {
+	class, method := binary.BigEndian.Uint16(payload), binary.BigEndian.Uint16(payload[2:])
+	args := &amqpArgs{payload[4:]}
+	switch uint32(class)<<16 | uint32(method) {
+	case 10<<16 | 11: // connection.start-ok
+		c.method(0, 10, 30, amqpShort(0), amqpLong(131072), amqpShort(0))
+	case 10<<16 | 40: // connection.open
+		c.method(0, 10, 41, amqpShortString(""))
+	case 10<<16 | 50: // connection.close
+		c.method(0, 10, 51)
+		return false
+	case 20<<16 | 10: // channel.open
+		c.channels[channel] = &brokerChannel{}
+		c.method(channel, 20, 11, amqpLong(0))
+	case 20<<16 | 40: // channel.close
+		delete(c.channels, channel)
+		c.method(channel, 20, 41)
+	case 40<<16 | 10: // exchange.declare
+		c.method(channel, 40, 11)
+	case 50<<16 | 10: // queue.declare
+		args.short()
+		name := args.shortString()
+		b.mu.Lock()
+		if _, ok := b.queues[name]; !ok {
+			b.queues[name] = nil
+		}
+		b.mu.Unlock()
+		c.method(channel, 50, 11, amqpShortString(name), amqpLong(0), amqpLong(0))
+	case 50<<16 | 20: // queue.bind
+		args.short()
+		queue, exchange, key := args.shortString(), args.shortString(), args.shortString()
+		b.mu.Lock()
+		b.bindings[exchange+"/"+key] = queue
+		b.mu.Unlock()
+		c.method(channel, 50, 21)
+	case 60<<16 | 10: // basic.qos
+		args.b = args.b[4:]
+		b.mu.Lock()
+		b.prefetch = append(b.prefetch, int(args.short()))
+		b.mu.Unlock()
+		c.method(channel, 60, 11)
+	case 60<<16 | 20: // basic.consume
+		args.short()
+		consumer := &brokerConsumer{conn: c, channel: channel, queue: args.shortString(), tag: args.shortString(), unacked: map[uint64]brokerMessage{}}
+		c.method(channel, 60, 21, amqpShortString(consumer.tag))
+		b.mu.Lock()
+		b.consumers = append(b.consumers, consumer)
+		b.consumes = append(b.consumes, consumer.queue)
+		b.dispatchLocked(consumer.queue)
+		b.mu.Unlock()
+	case 60<<16 | 30: // basic.cancel
+		tag := args.shortString()
+		b.mu.Lock()
+		for _, consumer := range b.consumers {
+			if consumer.conn == c && consumer.tag == tag {
+				consumer.cancelled = true
+			}
+		}
+		b.mu.Unlock()
+		c.method(channel, 60, 31, amqpShortString(tag))
+	case 60<<16 | 80, 60<<16 | 120: // basic.ack, basic.nack
+		tag := binary.BigEndian.Uint64(args.b)
+		requeue := method == 120 && args.b[8]&2 != 0
+		b.mu.Lock()
+		for _, consumer := range b.consumers {
+			if msg, ok := consumer.unacked[tag]; ok && consumer.conn == c && consumer.channel == channel {
+				delete(consumer.unacked, tag)
+				if requeue {
+					b.queues[msg.queue] = append([]brokerMessage{msg}, b.queues[msg.queue]...)
+					b.dispatchLocked(msg.queue)
+				} else if method == 80 {
+					b.acked++
+				}
+			}
+		}
+		b.mu.Unlock()
+	case 85<<16 | 10: // confirm.select
+		c.channels[channel].confirm = true
+		c.method(channel, 85, 11)
+	case 60<<16 | 40: // basic.publish
+		args.short()
+		ch := c.channels[channel]
+		ch.publish = &brokerMessage{exchange: args.shortString(), routingKey: args.shortString()}
+		ch.mandatory = args.octet()&1 != 0
+	}
+	return true
+}
+
+// handleContent collects the header and body frames of a publish and then
+// routes, returns and confirms it
+func (b *testBroker) handleContent(c *brokerConn, channel uint16, kind byte, payload []byte) {
+	ch := c.channels[channel]
+	if kind == 2 {
+		ch.header = payload
+		ch.publish.header = payload
+		ch.size = binary.BigEndian.Uint64(payload[4:])
+	} else {
+		ch.publish.body = append(ch.publish.body, payload...)
+	}
+	if uint64(len(ch.publish.body)) < ch.size {
+		return
+	}
+
+	msg := ch.publish
+	ch.publish = nil
+	b.mu.Lock()
+	if _, ok := b.queues[msg.routingKey]; ok && msg.exchange == "" {
+		msg.queue = msg.routingKey
+	} else {
+		msg.queue = b.bindings[msg.exchange+"/"+msg.routingKey]
+	}
+	b.published = append(b.published, *msg)
+	if msg.queue != "" {
+		b.queues[msg.queue] = append(b.queues[msg.queue], *msg)
+		b.dispatchLocked(msg.queue)
+	}
+	silent := b.silent
+	b.mu.Unlock()
+
+	if msg.queue == "" && ch.mandatory {
+		c.method(channel, 60, 50, amqpShort(312), amqpShortString("NO_ROUTE"), amqpShortString(msg.exchange), amqpShortString(msg.routingKey))
+		c.content(channel, ch.header, msg.body)
+	}
+	if !ch.confirm {
+		return
+	}
+	ch.published++
+	switch {
+	case silent:
+	case b.nack:
+		c.method(channel, 60, 120, amqpLongLong(ch.published), []byte{0})
+	default:
+		c.method(channel, 60, 80, amqpLongLong(ch.published), []byte{0})
+	}
+}
+
+// dispatchLocked delivers a queue's ready messages to its first consumer.
+// The caller must hold mu.
+func (b *testBroker) dispatchLocked(queue string) {
+	for _, consumer := range b.consumers {
+		if consumer.queue != queue || consumer.cancelled {
+			continue
+		}
+		for _, msg := range b.queues[queue] {
+			consumer.delivered++
+			consumer.unacked[consumer.delivered] = msg
+			consumer.conn.method(consumer.channel, 60, 60, amqpShortString(consumer.tag), amqpLongLong(consumer.delivered), []byte{0}, amqpShortString(msg.exchange), amqpShortString(msg.routingKey))
+			consumer.conn.content(consumer.channel, msg.header, msg.body)
+		}
+		b.queues[queue] = nil
+		return
+	}
+}
+
+// removeConsumersLocked drops the matching consumers and requeues what they
+// had not acked. The caller must hold mu.
+func (b *testBroker) removeConsumersLocked(match func(*brokerConsumer) bool) {
+	var kept []*brokerConsumer
+	var requeued []*brokerConsumer
+	for _, consumer := range b.consumers {
+		if match(consumer) {
+			requeued = append(requeued, consumer)
+		} else {
+			kept = append(kept, consumer)
+		}
+	}
+	b.consumers = kept
+	for _, consumer := range requeued {
+		for _, msg := range consumer.unacked {
+			b.queues[msg.queue] = append(b.queues[msg.queue], msg)
+		}
+		b.dispatchLocked(consumer.queue)
+	}
+}
+
+// disconnect requeues the deliveries a closed connection had not acked
+func (b *testBroker) disconnect(c *brokerConn) {
+	c.Close()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.conns, c)
+	b.removeConsumersLocked(func(consumer *brokerConsumer) bool { return consumer.conn == c })
+}
+
+func (c *brokerConn) readFrame() (byte, uint16, []byte, error) {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return 0, 0, nil, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(header[3:])+1)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return 0, 0, nil, err
+	}
+	return header[0], binary.BigEndian.Uint16(header[1:]), payload[:len(payload)-1], nil
+}
+
+func (c *brokerConn) frame(kind byte, channel uint16, payload []byte) {
+	frame := []byte{kind}
+	frame = append(frame, amqpShort(channel)...)
+	frame = append(frame, amqpLong(uint32(len(payload)))...)
+	frame = append(frame, payload...)
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.Write(append(frame, 0xce))
+}
+
+func (c *brokerConn) method(channel, class, method uint16, args ...[]byte) {
+	payload := append(amqpShort(class), amqpShort(method)...)
+	for _, arg := range args {
+		payload = append(payload, arg...)
+	}
+	c.frame(1, channel, payload)
+}
+
+// content sends a message's header frame as the client published it, then its body
+func (c *brokerConn) content(channel uint16, header, body []byte) {
+	c.frame(2, channel, header)
+	if len(body) > 0 {
+		c.frame(3, channel, body)
+	}
+}
+
+func amqpShort(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+
+func amqpLong(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+
+func amqpLongLong(v uint64) []byte { return binary.BigEndian.AppendUint64(nil, v) }
+
+func amqpShortString(s string) []byte { return append([]byte{byte(len(s))}, s...) }
+
+func amqpLongString(s string) []byte { return append(amqpLong(uint32(len(s))), s...) }
+
+// amqpArgs reads method arguments in order
+type amqpArgs struct{ b []byte }
+
+func (a *amqpArgs) octet() byte {
+	v := a.b[0]
+	a.b = a.b[1:]
+	return v
+}
+
+func (a *amqpArgs) short() uint16 {
+	v := binary.BigEndian.Uint16(a.b)
+	a.b = a.b[2:]
+	return v
+}
+
+func (a *amqpArgs) shortString() string {
+	n := int(a.octet())
+	s := string(a.b[:n])
+	a.b = a.b[n:]
+	return s
+}
+
+func TestPublishConfirmed(t *testing.T) {
+	broker := newTestBroker(t)
+	client := broker.client(t)
+
+	if err := client.PublishConfirmed(EmailExchange, EmailRoutingKey, amqp.Publishing{Body: []byte(`{"to":"ana@example.com"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	// The default exchange routes to the queue of the same name
+	if err := client.PublishConfirmed("", EmailDLQName, amqp.Publishing{Body: []byte("dead")}); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := broker.messages()
+	if len(messages) != 2 || messages[0].queue != EmailQueueName || string(messages[0].body) != `{"to":"ana@example.com"}` || messages[1].queue != EmailDLQName {
+		t.Fatalf("messages = %+v", messages)
+	}
+}
+
+func TestPublishConfirmedUnroutable(t *testing.T) {
+	broker := newTestBroker(t)
+	client := broker.client(t)
+
+	err := client.PublishConfirmed(EmailExchange, "nowhere", amqp.Publishing{Body: []byte("lost")})
+	if !errors.Is(err, ErrPublishUnroutable) {
+		t.Fatalf("err = %v, want ErrPublishUnroutable", err)
+	}
+	// The return is not blamed on the next publish
+	if err := client.PublishConfirmed(EmailExchange, EmailRoutingKey, amqp.Publishing{Body: []byte("kept")}); err != nil {
+		t.Fatalf("publish after a return: %v", err)
+	}
+}
+
+func TestPublishConfirmedNacked(t *testing.T) {
+	broker := newTestBroker(t, func(b *testBroker) { b.nack = true })
+	client := broker.client(t)
+
+	if err := client.PublishConfirmed(EmailExchange, EmailRoutingKey, amqp.Publishing{}); !errors.Is(err, ErrPublishNacked) {
+		t.Fatalf("err = %v, want ErrPublishNacked", err)
+	}
+}
+
+func TestPublishConfirmedTimeout(t *testing.T) {
+	broker := newTestBroker(t, func(b *testBroker) { b.silent = true })
+	client := broker.client(t)
+
+	start := time.Now()
+	err := client.PublishConfirmed(EmailExchange, EmailRoutingKey, amqp.Publishing{})
+	if err == nil || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want a confirm timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("publish took %v, want it bounded by the publish timeout", elapsed)
+	}
+
+	// The next publish goes through a fresh confirm channel, so the
+	// unconfirmed one cannot be mistaken for it
+	broker.setSilent(false)
+	if err := client.PublishConfirmed(EmailExchange, EmailRoutingKey, amqp.Publishing{}); err != nil {
+		t.Fatalf("publish after a timeout: %v", err)
+	}
+}
+
+// eventually waits up to two seconds for cond to hold
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// consumeBodies subscribes to the email queue and acks every delivery,
+// sending its body on the returned channel
+func consumeBodies(t *testing.T, client *RabbitMQClient, opts ConsumeOptions) (*Consumer, <-chan string) {
+	t.Helper()
+	bodies := make(chan string, 10)
+	consumer, err := client.Consume(EmailQueueName, opts, func(msg amqp.Delivery) {
+		msg.Ack(false)
+		bodies <- string(msg.Body)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return consumer, bodies
+}
+
+func receive(t *testing.T, bodies <-chan string, want string) {
+	t.Helper()
+	select {
+	case body := <-bodies:
+		if body != want {
+			t.Fatalf("received %q, want %q", body, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("%q was not delivered", want)
+	}
+}
+
+func publish(t *testing.T, client *RabbitMQClient, body string) {
+	t.Helper()
+	if err := client.PublishConfirmed(EmailExchange, EmailRoutingKey, amqp.Publishing{Body: []byte(body)}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConsume(t *testing.T) {
+	broker := newTestBroker(t)
+	client := broker.client(t)
+
+	// Prefetch is raised to cover every handler
+	_, bodies := consumeBodies(t, client, ConsumeOptions{Prefetch: 1, Concurrency: 4})
+	publish(t, client, "first")
+	receive(t, bodies, "first")
+
+	consumes, prefetch, _ := broker.stats()
+	if len(consumes) != 1 || consumes[0] != EmailQueueName || prefetch[len(prefetch)-1] != 4 {
+		t.Fatalf("consumes = %v, prefetch = %v", consumes, prefetch)
+	}
+	eventually(t, "the ack", func() bool {
+		_, _, acked := broker.stats()
+		return acked == 1
+	})
+}
+
+func TestConsumerSurvivesReconnect(t *testing.T) {
+	broker := newTestBroker(t)
+	client := broker.client(t)
+	_, bodies := consumeBodies(t, client, ConsumeOptions{Prefetch: 2, Concurrency: 1})
+
+	broker.drop()
+	// The supervisor reconnects, redeclares the topology and resubscribes
+	eventually(t, "the consumer to restart", func() bool {
+		consumes, _, _ := broker.stats()
+		return len(consumes) == 2 && client.IsConnected()
+	})
+	if _, prefetch, _ := broker.stats(); len(prefetch) != 2 || prefetch[1] != 2 {
+		t.Fatalf("prefetch = %v, want it set again on the new channel", prefetch)
+	}
+
+	publish(t, client, "after reconnect")
+	receive(t, bodies, "after reconnect")
+}
+
+func TestClientConnectsOnceTheBrokerIsUp(t *testing.T) {
+	broker := newTestBroker(t, func(b *testBroker) { b.down = true })
+	client := broker.dial(t)
+	if client.IsConnected() {
+		t.Fatal("connected to a broker that is down")
+	}
+
+	// The subscription waits for the first connection
+	_, bodies := consumeBodies(t, client, ConsumeOptions{Concurrency: 1})
+	broker.setDown(false)
+	eventually(t, "the first connection", func() bool {
+		consumes, _, _ := broker.stats()
+		return len(consumes) == 1 && client.IsConnected()
+	})
+
+	publish(t, client, "first")
+	receive(t, bodies, "first")
+}
+
+func TestConsumerStop(t *testing.T) {
+	broker := newTestBroker(t)
+	client := broker.client(t)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	consumer, err := client.Consume(EmailQueueName, ConsumeOptions{Concurrency: 1}, func(msg amqp.Delivery) {
+		close(started)
+		<-release
+		msg.Ack(false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	publish(t, client, "slow")
+	<-started
+
+	// Stop gives up once its context ends while a handler is still busy
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	stopped := make(chan error, 1)
+	go func() { stopped <- consumer.Stop(ctx) }()
+	if err := <-stopped; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Stop with a busy handler = %v", err)
+	}
+	close(release)
+	eventually(t, "the in-flight delivery to be acked", func() bool {
+		_, _, acked := broker.stats()
+		return acked == 1
+	})
+
+	// A stopped consumer is not resubscribed after a reconnect
+	broker.drop()
+	eventually(t, "the reconnect", func() bool {
+		broker.mu.Lock()
+		defer broker.mu.Unlock()
+		return broker.accepted == 2 && client.IsConnected()
+	})
+	if consumes, _, _ := broker.stats(); len(consumes) != 1 {
+		t.Fatalf("consumes = %v, want the stopped consumer left cancelled", consumes)
+	}
+}
+
+func TestConsumerStopWaitsForHandlers(t *testing.T) {
+	broker := newTestBroker(t)
+	client := broker.client(t)
+
+	started := make(chan struct{})
+	acked := make(chan struct{})
+	consumer, err := client.Consume(EmailQueueName, ConsumeOptions{Concurrency: 2}, func(msg amqp.Delivery) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		msg.Ack(false)
+		close(acked)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	publish(t, client, "in flight")
+	<-started
+
+	if err := consumer.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-acked:
+	default:
+		t.Fatal("Stop returned before the handler finished")
+	}
+}
@@ -0,0 +1,363 @@
+package util
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SAML 2.0 namespaces, bindings and identifiers
+const (
+	SAMLAssertionNamespace = "urn:oasis:names:tc:SAML:2.0:assertion"
+	SAMLProtocolNamespace  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	SAMLMetadataNamespace  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	SAMLBindingRedirect    = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	SAMLBindingPOST        = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	SAMLNameIDEmail        = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	samlStatusSuccess      = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlBearer             = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+)
+
+// SAMLIdPMetadata is what we need from an identity provider's metadata
+type SAMLIdPMetadata struct {
+	EntityID     string
+	SSOURL       string   // HTTP-Redirect single sign-on endpoint
+	Certificates []string // Base64 DER signing certificates
+}
+
+// SAMLServiceProvider identifies our side of the federation
+type SAMLServiceProvider struct {
+	EntityID string
+	ACSURL   string
+}
+
+// SAMLAssertion is the validated content of an IdP response
+type SAMLAssertion struct {
+	ID           string
+	InResponseTo string
+	NameID       string
+	NameIDFormat string
+	SessionIndex string
+	Attributes   map[string][]string // By Name and, when present, FriendlyName
+}
+
+// Attribute returns the first value of a SAML attribute
+func (a *SAMLAssertion) Attribute(name string) string {
+	if values := a.Attributes[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+type samlEntityDescriptor struct {
+	XMLName          xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID         string   `xml:"entityID,attr"`
+	IDPSSODescriptor *struct {
+		KeyDescriptors []struct {
+			Use          string   `xml:"use,attr"`
+			Certificates []string `xml:"http://www.w3.org/2000/09/xmldsig# KeyInfo>X509Data>X509Certificate"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:metadata KeyDescriptor"`
+		SingleSignOnServices []struct {
+			Binding  string `xml:"Binding,attr"`
+			Location string `xml:"Location,attr"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:metadata SingleSignOnService"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:metadata IDPSSODescriptor"`
+}
+
+// ParseSAMLIdPMetadata extracts the entity ID, redirect SSO endpoint and
+// signing certificates from an IdP EntityDescriptor
+func ParseSAMLIdPMetadata(data []byte) (*SAMLIdPMetadata, error) {
+	// Reject DTDs before handing the document to the struct decoder
+	if _, err := parseXMLDocument(data); err != nil {
+		return nil, err
+	}
+
+	var descriptor samlEntityDescriptor
+	if err := xml.Unmarshal(data, &descriptor); err != nil {
+		return nil, fmt.Errorf("invalid IdP metadata: %w", err)
+	}
+	if descriptor.EntityID == "" || descriptor.IDPSSODescriptor == nil {
+		return nil, errors.New("metadata does not describe an identity provider")
+	}
+
+	metadata := &SAMLIdPMetadata{EntityID: descriptor.EntityID}
+	for _, sso := range descriptor.IDPSSODescriptor.SingleSignOnServices {
+		if sso.Binding == SAMLBindingRedirect {
+			metadata.SSOURL = sso.Location
+			break
+		}
+	}
+	if metadata.SSOURL == "" {
+		return nil, errors.New("identity provider has no HTTP-Redirect single sign-on service")
+	}
+	if parsed, err := url.Parse(metadata.SSOURL); err != nil || parsed.Scheme != "https" && parsed.Scheme != "http" {
+		return nil, errors.New("invalid single sign-on URL")
+	}
+
+	for _, key := range descriptor.IDPSSODescriptor.KeyDescriptors {
+		if key.Use != "" && key.Use != "signing" {
+			continue
+		}
+		for _, cert := range key.Certificates {
+			cert = strings.Join(strings.Fields(cert), "")
+			if _, err := ParseSAMLCertificates([]string{cert}); err != nil {
+				return nil, err
+			}
+			metadata.Certificates = append(metadata.Certificates, cert)
+		}
+	}
+	if len(metadata.Certificates) == 0 {
+		return nil, errors.New("identity provider metadata has no signing certificate")
+	}
+
+	return metadata, nil
+}
+
+// ParseSAMLCertificates decodes base64 DER certificates from IdP metadata
+func ParseSAMLCertificates(encoded []string) ([]*x509.Certificate, error) {
+	certs := make([]*x509.Certificate, 0, len(encoded))
+	for _, e := range encoded {
+		der, err := base64.StdEncoding.DecodeString(e)
+		if err != nil {
+			return nil, errors.New("invalid signing certificate encoding")
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signing certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// SAMLServiceProviderMetadata renders our SP metadata for the IdP administrator
+func SAMLServiceProviderMetadata(sp SAMLServiceProvider) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	fmt.Fprintf(&buf, `<md:EntityDescriptor xmlns:md="%s" entityID="%s">`, SAMLMetadataNamespace, xmlEscape(sp.EntityID))
+	fmt.Fprintf(&buf, `<md:SPSSODescriptor AuthnRequestsSigned="false" WantAssertionsSigned="true" protocolSupportEnumeration="%s">`, SAMLProtocolNamespace)
+	fmt.Fprintf(&buf, `<md:NameIDFormat>%s</md:NameIDFormat>`, SAMLNameIDEmail)
+	fmt.Fprintf(&buf, `<md:AssertionConsumerService Binding="%s" Location="%s" index="0" isDefault="true"/>`, SAMLBindingPOST, xmlEscape(sp.ACSURL))
+	buf.WriteString(`</md:SPSSODescriptor></md:EntityDescriptor>`)
+	return buf.Bytes()
+}
+
+// SAMLAuthnRequestURL builds the HTTP-Redirect binding URL that sends the
+// browser to the IdP with an unsigned AuthnRequest
+func SAMLAuthnRequestURL(sp SAMLServiceProvider, ssoURL, requestID, relayState string, issuedAt time.Time) (string, error) {
+	request := fmt.Sprintf(
+		`<samlp:AuthnRequest xmlns:samlp="%s" xmlns:saml="%s" ID="%s" Version="2.0" IssueInstant="%s" Destination="%s" AssertionConsumerServiceURL="%s" ProtocolBinding="%s">`+
+			`<saml:Issuer>%s</saml:Issuer><samlp:NameIDPolicy Format="%s" AllowCreate="true"/></samlp:AuthnRequest>`,
+		SAMLProtocolNamespace, SAMLAssertionNamespace, xmlEscape(requestID), issuedAt.UTC().Format(time.RFC3339),
+		xmlEscape(ssoURL), xmlEscape(sp.ACSURL), SAMLBindingPOST, xmlEscape(sp.EntityID), SAMLNameIDEmail,
+	)
+
+	var compressed bytes.Buffer
+	writer, err := flate.NewWriter(&compressed, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := writer.Write([]byte(request)); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("SAMLRequest", base64.StdEncoding.EncodeToString(compressed.Bytes()))
+	if relayState != "" {
+		params.Set("RelayState", relayState)
+	}
+
+	separator := "?"
+	if strings.Contains(ssoURL, "?") {
+		separator = "&"
+	}
+	return ssoURL + separator + params.Encode(), nil
+}
+
+// ParseSAMLResponse decodes a base64 HTTP-POST SAMLResponse and validates it
+// for sp: the response or its single assertion must be signed by one of the
+// IdP certificates, issued by idpEntityID, addressed to our ACS URL and
+// audience, and currently valid within clockSkew.
+func ParseSAMLResponse(encoded string, sp SAMLServiceProvider, idpEntityID string, certs []*x509.Certificate, now time.Time, clockSkew time.Duration) (*SAMLAssertion, error) {
+	data, err := decodeXMLBase64(encoded)
+	if err != nil {
+		return nil, errors.New("SAMLResponse is not valid base64")
+	}
+
+	response, err := parseXMLDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	if response.Space != SAMLProtocolNamespace || response.Local != "Response" {
+		return nil, errors.New("document is not a SAML response")
+	}
+
+	if destination := response.attr("Destination"); destination != "" && destination != sp.ACSURL {
+		return nil, errors.New("response destination does not match")
+	}
+	if issuer := response.child(SAMLAssertionNamespace, "Issuer"); issuer != nil && issuer.text() != idpEntityID {
+		return nil, errors.New("response issuer does not match the identity provider")
+	}
+
+	status := response.child(SAMLProtocolNamespace, "Status")
+	if status == nil {
+		return nil, errors.New("response has no status")
+	}
+	statusCode := status.child(SAMLProtocolNamespace, "StatusCode")
+	if statusCode == nil || statusCode.attr("Value") != samlStatusSuccess {
+		return nil, errors.New("identity provider did not authenticate the user")
+	}
+
+	if len(response.children(SAMLAssertionNamespace, "EncryptedAssertion")) > 0 {
+		return nil, errors.New("encrypted assertions are not supported")
+	}
+	// A single assertion anywhere in the document rules out signature wrapping
+	if response.countDescendants(SAMLAssertionNamespace, "Assertion") != 1 {
+		return nil, errors.New("response must contain exactly one assertion")
+	}
+	assertion := response.child(SAMLAssertionNamespace, "Assertion")
+	if assertion == nil {
+		return nil, errors.New("response must contain exactly one assertion")
+	}
+
+	responseErr := verifyEnvelopedSignature(response, certs)
+	assertionErr := verifyEnvelopedSignature(assertion, certs)
+	switch {
+	case responseErr != nil && responseErr != ErrXMLNotSigned:
+		return nil, fmt.Errorf("invalid response signature: %w", responseErr)
+	case assertionErr != nil && assertionErr != ErrXMLNotSigned:
+		return nil, fmt.Errorf("invalid assertion signature: %w", assertionErr)
+	case responseErr != nil && assertionErr != nil:
+		return nil, errors.New("response is not signed")
+	}
+
+	issuer := assertion.child(SAMLAssertionNamespace, "Issuer")
+	if issuer == nil || issuer.text() != idpEntityID {
+		return nil, errors.New("assertion issuer does not match the identity provider")
+	}
+
+	result := &SAMLAssertion{
+		ID:           assertion.attr("ID"),
+		InResponseTo: response.attr("InResponseTo"),
+		Attributes:   map[string][]string{},
+	}
+
+	if err := validateSAMLSubject(assertion, sp, result, now, clockSkew); err != nil {
+		return nil, err
+	}
+	if err := validateSAMLConditions(assertion, sp, now, clockSkew); err != nil {
+		return nil, err
+	}
+
+	if authn := assertion.children(SAMLAssertionNamespace, "AuthnStatement"); len(authn) > 0 {
+		result.SessionIndex = authn[0].attr("SessionIndex")
+	}
+	for _, statement := range assertion.children(SAMLAssertionNamespace, "AttributeStatement") {
+		for _, attribute := range statement.children(SAMLAssertionNamespace, "Attribute") {
+			var values []string
+			for _, v := range attribute.children(SAMLAssertionNamespace, "AttributeValue") {
+				values = append(values, v.text())
+			}
+			if name := attribute.attr("Name"); name != "" {
+				result.Attributes[name] = append(result.Attributes[name], values...)
+			}
+			if friendly := attribute.attr("FriendlyName"); friendly != "" {
+				result.Attributes[friendly] = append(result.Attributes[friendly], values...)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// validateSAMLSubject requires a NameID and a bearer confirmation for our ACS URL
+func validateSAMLSubject(assertion *xmlElement, sp SAMLServiceProvider, result *SAMLAssertion, now time.Time, clockSkew time.Duration) error {
+	subject := assertion.child(SAMLAssertionNamespace, "Subject")
+	if subject == nil {
+		return errors.New("assertion has no subject")
+	}
+	nameID := subject.child(SAMLAssertionNamespace, "NameID")
+	if nameID == nil || nameID.text() == "" {
+		return errors.New("assertion has no NameID")
+	}
+	result.NameID = nameID.text()
+	result.NameIDFormat = nameID.attr("Format")
+
+	for _, confirmation := range subject.children(SAMLAssertionNamespace, "SubjectConfirmation") {
+		if confirmation.attr("Method") != samlBearer {
+			continue
+		}
+		data := confirmation.child(SAMLAssertionNamespace, "SubjectConfirmationData")
+		if data == nil || data.attr("Recipient") != sp.ACSURL {
+			continue
+		}
+		notOnOrAfter, err := time.Parse(time.RFC3339, data.attr("NotOnOrAfter"))
+		if err != nil || !now.Before(notOnOrAfter.Add(clockSkew)) {
+			continue
+		}
+		if inResponseTo := data.attr("InResponseTo"); inResponseTo != "" {
+			if result.InResponseTo != "" && result.InResponseTo != inResponseTo {
+				continue
+			}
+			result.InResponseTo = inResponseTo
+		}
+		return nil
+	}
+	return errors.New("assertion has no valid bearer subject confirmation")
+}
+
+// validateSAMLConditions checks the validity window and that we are the audience
+func validateSAMLConditions(assertion *xmlElement, sp SAMLServiceProvider, now time.Time, clockSkew time.Duration) error {
+	conditions := assertion.child(SAMLAssertionNamespace, "Conditions")
+	if conditions == nil {
+		return errors.New("assertion has no conditions")
+	}
+
+	if v := conditions.attr("NotBefore"); v != "" {
+		notBefore, err := time.Parse(time.RFC3339, v)
+		if err != nil || now.Add(clockSkew).Before(notBefore) {
+			return errors.New("assertion is not yet valid")
+		}
+	}
+	if v := conditions.attr("NotOnOrAfter"); v != "" {
+		notOnOrAfter, err := time.Parse(time.RFC3339, v)
+		if err != nil || !now.Before(notOnOrAfter.Add(clockSkew)) {
+			return errors.New("assertion has expired")
+		}
+	}
+
+	restrictions := conditions.children(SAMLAssertionNamespace, "AudienceRestriction")
+	if len(restrictions) == 0 {
+		return errors.New("assertion has no audience restriction")
+	}
+	// Every restriction must name us (SAML core section 2.5.1.4)
+	for _, restriction := range restrictions {
+		found := false
+		for _, audience := range restriction.children(SAMLAssertionNamespace, "Audience") {
+			if audience.text() == sp.EntityID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New("assertion is intended for another audience")
+		}
+	}
+	return nil
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
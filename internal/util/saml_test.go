@@ -0,0 +1,326 @@
+package util
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	testSP = SAMLServiceProvider{
+		EntityID: "https://api.example.com/saml/acme/metadata",
+		ACSURL:   "https://api.example.com/saml/acme/acs",
+	}
+	testIdPEntityID = "https://idp.example.com"
+	testSAMLNow     = time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+)
+
+type testIdP struct {
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    testSAMLNow.Add(-time.Hour),
+		NotAfter:     testSAMLNow.Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testIdP{key: key, cert: cert}
+}
+
+// findByID returns the element carrying the ID attribute
+func findByID(e *xmlElement, id string) *xmlElement {
+	if e.attr("ID") == id {
+		return e
+	}
+	for _, n := range e.Children {
+		if n.Elem != nil {
+			if found := findByID(n.Elem, id); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// sign replaces the <!--sign:ID--> marker in doc with an enveloped signature
+// over the element with that ID. Markers are comments, so they do not take
+// part in canonicalization.
+func (idp *testIdP) sign(t *testing.T, doc, id string) string {
+	t.Helper()
+	root, err := parseXMLDocument([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := findByID(root, id)
+	if target == nil {
+		t.Fatalf("no element with ID %s", id)
+	}
+	digest := sha256.Sum256(canonicalize(target, nil, nil))
+
+	signedInfo := fmt.Sprintf(`<ds:SignedInfo xmlns:ds="%s">`+
+		`<ds:CanonicalizationMethod Algorithm="%s"/>`+
+		`<ds:SignatureMethod Algorithm="%s"/>`+
+		`<ds:Reference URI="#%s"><ds:Transforms>`+
+		`<ds:Transform Algorithm="%s"/><ds:Transform Algorithm="%s"/>`+
+		`</ds:Transforms><ds:DigestMethod Algorithm="%s"/>`+
+		`<ds:DigestValue>%s</ds:DigestValue></ds:Reference></ds:SignedInfo>`,
+		xmlDSigNamespace, xmlExcC14N, xmlDSigRSASHA256, id, xmlEnvelopedSig, xmlExcC14N, xmlDigestSHA256,
+		base64.StdEncoding.EncodeToString(digest[:]))
+	parsed, err := parseXMLDocument([]byte(signedInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(canonicalize(parsed, nil, nil))
+	value, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature := fmt.Sprintf(`<ds:Signature xmlns:ds="%s">%s<ds:SignatureValue>%s</ds:SignatureValue></ds:Signature>`,
+		xmlDSigNamespace, signedInfo, base64.StdEncoding.EncodeToString(value))
+	marker := "<!--sign:" + id + "-->"
+	if !strings.Contains(doc, marker) {
+		t.Fatalf("no signature marker for %s", id)
+	}
+	return strings.Replace(doc, marker, signature, 1)
+}
+
+// samlFixture holds the parts of a test response that cases vary
+type samlFixture struct {
+	ResponseInResponseTo string
+	ConfirmInResponseTo  string
+	NameID               string
+	Audience             string
+	ConfirmNotOnOrAfter  time.Time
+	NotOnOrAfter         time.Time
+}
+
+func defaultSAMLFixture() samlFixture {
+	return samlFixture{
+		ResponseInResponseTo: "id-request",
+		ConfirmInResponseTo:  "id-request",
+		NameID:               "ana@example.com",
+		Audience:             testSP.EntityID,
+		ConfirmNotOnOrAfter:  testSAMLNow.Add(5 * time.Minute),
+		NotOnOrAfter:         testSAMLNow.Add(5 * time.Minute),
+	}
+}
+
+func (f samlFixture) assertion(id string) string {
+	return fmt.Sprintf(`<saml:Assertion xmlns:saml="%[1]s" ID="%[2]s" Version="2.0" IssueInstant="%[3]s">`+
+		`<saml:Issuer>%[4]s</saml:Issuer><!--sign:%[2]s-->`+
+		`<saml:Subject><saml:NameID Format="%[5]s">%[6]s</saml:NameID>`+
+		`<saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">`+
+		`<saml:SubjectConfirmationData InResponseTo="%[7]s" NotOnOrAfter="%[8]s" Recipient="%[9]s"/>`+
+		`</saml:SubjectConfirmation></saml:Subject>`+
+		`<saml:Conditions NotBefore="%[3]s" NotOnOrAfter="%[10]s"><saml:AudienceRestriction><saml:Audience>%[11]s</saml:Audience></saml:AudienceRestriction></saml:Conditions>`+
+		`<saml:AuthnStatement AuthnInstant="%[3]s" SessionIndex="session-1"/>`+
+		`<saml:AttributeStatement><saml:Attribute Name="urn:oid:2.16.840.1.113730.3.1.241" FriendlyName="displayName"><saml:AttributeValue>Ana</saml:AttributeValue></saml:Attribute></saml:AttributeStatement>`+
+		`</saml:Assertion>`,
+		SAMLAssertionNamespace, id, testSAMLNow.Add(-time.Minute).Format(time.RFC3339), testIdPEntityID, SAMLNameIDEmail, f.NameID,
+		f.ConfirmInResponseTo, f.ConfirmNotOnOrAfter.Format(time.RFC3339), testSP.ACSURL, f.NotOnOrAfter.Format(time.RFC3339), f.Audience)
+}
+
+func (f samlFixture) response(assertions ...string) string {
+	return fmt.Sprintf(`<samlp:Response xmlns:samlp="%s" xmlns:saml="%s" ID="id-response" Version="2.0" InResponseTo="%s" Destination="%s">`+
+		`<saml:Issuer>%s</saml:Issuer><!--sign:id-response-->`+
+		`<samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>%s</samlp:Response>`,
+		SAMLProtocolNamespace, SAMLAssertionNamespace, f.ResponseInResponseTo, testSP.ACSURL, testIdPEntityID, strings.Join(assertions, ""))
+}
+
+func (idp *testIdP) parse(doc string) (*SAMLAssertion, error) {
+	encoded := base64.StdEncoding.EncodeToString([]byte(doc))
+	return ParseSAMLResponse(encoded, testSP, testIdPEntityID, []*x509.Certificate{idp.cert}, testSAMLNow, time.Minute)
+}
+
+func TestSAMLSignedAssertion(t *testing.T) {
+	idp := newTestIdP(t)
+	f := defaultSAMLFixture()
+	doc := idp.sign(t, f.response(f.assertion("id-assertion")), "id-assertion")
+
+	assertion, err := idp.parse(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assertion.NameID != "ana@example.com" || assertion.InResponseTo != "id-request" || assertion.SessionIndex != "session-1" {
+		t.Fatalf("assertion = %+v", assertion)
+	}
+	if assertion.Attribute("displayName") != "Ana" || assertion.Attribute("urn:oid:2.16.840.1.113730.3.1.241") != "Ana" {
+		t.Fatalf("attributes = %v", assertion.Attributes)
+	}
+}
+
+func TestSAMLSignedResponseCoversItsAssertion(t *testing.T) {
+	idp := newTestIdP(t)
+	f := defaultSAMLFixture()
+
+	// An unsigned assertion is accepted only because the response signature covers it
+	doc := idp.sign(t, f.response(f.assertion("id-assertion")), "id-response")
+	if assertion, err := idp.parse(doc); err != nil || assertion.NameID != "ana@example.com" {
+		t.Fatalf("signed response: %+v, %v", assertion, err)
+	}
+
+	tampered := strings.Replace(doc, "ana@example.com", "admin@example.com", 1)
+	if _, err := idp.parse(tampered); err == nil {
+		t.Fatal("assertion changed after the response was signed was accepted")
+	}
+
+	// Both signed is fine too
+	both := idp.sign(t, idp.sign(t, f.response(f.assertion("id-assertion")), "id-assertion"), "id-response")
+	if _, err := idp.parse(both); err != nil {
+		t.Fatalf("response and assertion signed: %v", err)
+	}
+}
+
+func TestSAMLRejectsUnsignedAndForeignSignatures(t *testing.T) {
+	idp := newTestIdP(t)
+	f := defaultSAMLFixture()
+
+	if _, err := idp.parse(f.response(f.assertion("id-assertion"))); err == nil {
+		t.Fatal("unsigned response accepted")
+	}
+
+	attacker := newTestIdP(t)
+	forged := attacker.sign(t, f.response(f.assertion("id-assertion")), "id-assertion")
+	if _, err := idp.parse(forged); err == nil {
+		t.Fatal("assertion signed with another key accepted")
+	}
+
+	// A broken response signature is not rescued by a valid assertion signature
+	doc := idp.sign(t, f.response(f.assertion("id-assertion")), "id-assertion")
+	doc = attacker.sign(t, doc, "id-response")
+	if _, err := idp.parse(doc); err == nil {
+		t.Fatal("response with an invalid signature accepted")
+	}
+}
+
+func TestSAMLRejectsSignatureWrapping(t *testing.T) {
+	idp := newTestIdP(t)
+	f := defaultSAMLFixture()
+	signed := idp.sign(t, f.assertion("id-assertion"), "id-assertion")
+
+	evil := f
+	evil.NameID = "admin@example.com"
+	forged := evil.assertion("id-evil")
+
+	cases := map[string]string{
+		// A second, unsigned assertion next to the signed one
+		"duplicated assertion": f.response(forged, signed),
+		// The signed assertion hidden in an extension while the forged one is read
+		"wrapped in extensions": strings.Replace(f.response(forged), "<samlp:Status>",
+			`<samlp:Extensions>`+signed+`</samlp:Extensions><samlp:Status>`, 1),
+		// The signed assertion nested inside the forged one
+		"nested in forged assertion": f.response(strings.Replace(forged, "</saml:Assertion>", signed+"</saml:Assertion>", 1)),
+		// The forged assertion carries the legitimate signature, which references another ID
+		"copied signature": f.response(strings.Replace(forged, "<!--sign:id-evil-->",
+			signed[strings.Index(signed, "<ds:Signature"):strings.Index(signed, "</ds:Signature>")+len("</ds:Signature>")], 1)),
+		// The forged assertion reuses the legitimate ID
+		"reused ID": f.response(strings.Replace(strings.Replace(forged, "id-evil", "id-assertion", -1), "<!--sign:id-assertion-->",
+			signed[strings.Index(signed, "<ds:Signature"):strings.Index(signed, "</ds:Signature>")+len("</ds:Signature>")], 1)),
+	}
+	for name, doc := range cases {
+		if assertion, err := idp.parse(doc); err == nil {
+			t.Errorf("%s: accepted with NameID %s", name, assertion.NameID)
+		}
+	}
+}
+
+func TestSAMLValidatesConditions(t *testing.T) {
+	idp := newTestIdP(t)
+
+	cases := map[string]func(*samlFixture){
+		"expired confirmation": func(f *samlFixture) { f.ConfirmNotOnOrAfter = testSAMLNow.Add(-2 * time.Minute) },
+		"expired conditions":   func(f *samlFixture) { f.NotOnOrAfter = testSAMLNow.Add(-2 * time.Minute) },
+		"audience mismatch":    func(f *samlFixture) { f.Audience = "https://api.example.com/saml/other/metadata" },
+		"InResponseTo mismatch": func(f *samlFixture) {
+			f.ResponseInResponseTo = "id-request"
+			f.ConfirmInResponseTo = "id-other-request"
+		},
+	}
+	for name, change := range cases {
+		f := defaultSAMLFixture()
+		change(&f)
+		doc := idp.sign(t, f.response(f.assertion("id-assertion")), "id-assertion")
+		if _, err := idp.parse(doc); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+
+	// Within the clock skew an expiry has not passed yet
+	f := defaultSAMLFixture()
+	f.NotOnOrAfter = testSAMLNow.Add(-30 * time.Second)
+	if _, err := idp.parse(idp.sign(t, f.response(f.assertion("id-assertion")), "id-assertion")); err != nil {
+		t.Fatalf("assertion within the clock skew rejected: %v", err)
+	}
+}
+
+func TestSAMLNameIDCommentInjection(t *testing.T) {
+	idp := newTestIdP(t)
+	f := defaultSAMLFixture()
+	// Canonicalization drops comments, so the signature stays valid. The
+	// NameID must still be read in full, not cut at the comment.
+	f.NameID = "admin@example.com<!---->.evil.example"
+	doc := idp.sign(t, f.response(f.assertion("id-assertion")), "id-assertion")
+
+	assertion, err := idp.parse(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assertion.NameID != "admin@example.com.evil.example" {
+		t.Fatalf("NameID = %q", assertion.NameID)
+	}
+}
+
+func TestSAMLRejectsDTD(t *testing.T) {
+	idp := newTestIdP(t)
+	f := defaultSAMLFixture()
+	doc := `<!DOCTYPE r [<!ENTITY e "ana@example.com">]>` + idp.sign(t, f.response(f.assertion("id-assertion")), "id-assertion")
+	if _, err := idp.parse(doc); err == nil {
+		t.Fatal("document with a DTD accepted")
+	}
+}
+
+func TestSAMLIdPMetadata(t *testing.T) {
+	idp := newTestIdP(t)
+	cert := base64.StdEncoding.EncodeToString(idp.cert.Raw)
+	metadata := fmt.Sprintf(`<md:EntityDescriptor xmlns:md="%s" xmlns:ds="%s" entityID="%s"><md:IDPSSODescriptor>`+
+		`<md:KeyDescriptor use="encryption"><ds:KeyInfo><ds:X509Data><ds:X509Certificate>bm90IGEgY2VydA==</ds:X509Certificate></ds:X509Data></ds:KeyInfo></md:KeyDescriptor>`+
+		`<md:KeyDescriptor use="signing"><ds:KeyInfo><ds:X509Data><ds:X509Certificate>%s</ds:X509Certificate></ds:X509Data></ds:KeyInfo></md:KeyDescriptor>`+
+		`<md:SingleSignOnService Binding="%s" Location="https://idp.example.com/post"/>`+
+		`<md:SingleSignOnService Binding="%s" Location="https://idp.example.com/sso"/>`+
+		`</md:IDPSSODescriptor></md:EntityDescriptor>`,
+		SAMLMetadataNamespace, xmlDSigNamespace, testIdPEntityID, cert, SAMLBindingPOST, SAMLBindingRedirect)
+
+	parsed, err := ParseSAMLIdPMetadata([]byte(metadata))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.EntityID != testIdPEntityID || parsed.SSOURL != "https://idp.example.com/sso" || len(parsed.Certificates) != 1 || parsed.Certificates[0] != cert {
+		t.Fatalf("metadata = %+v", parsed)
+	}
+}
@@ -0,0 +1,332 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SCIM 2.0 schema URNs (RFC 7643, RFC 7644)
+const (
+	SCIMSchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SCIMSchemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SCIMSchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SCIMSchemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SCIMSchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SCIMSchemaSPConfig     = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SCIMSchemaResourceType = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+)
+
+// ErrSCIMInvalidFilter is returned for filters that cannot be parsed or
+// reference attributes that cannot be filtered on
+var ErrSCIMInvalidFilter = errors.New("invalid SCIM filter")
+
+// SCIMFilter is a parsed filter expression. Op is "and", "or" or "not" for
+// logical nodes, otherwise a comparison operator ("eq", "co", "pr", ...) on
+// Attr. Attribute paths are lower-cased since SCIM names are case-insensitive.
+type SCIMFilter struct {
+	Op    string
+	Attr  string
+	Value interface{} // string, bool, float64 or nil
+	Left  *SCIMFilter
+	Right *SCIMFilter
+}
+
+var scimComparisons = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true,
+	"gt": true, "ge": true, "lt": true, "le": true,
+}
+
+// ParseSCIMFilter parses a filter such as `userName eq "jane" and active eq true`
+func ParseSCIMFilter(filter string) (*SCIMFilter, error) {
+	tokens, err := tokenizeSCIMFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	p := &scimFilterParser{tokens: tokens}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrSCIMInvalidFilter, p.tokens[p.pos])
+	}
+	return f, nil
+}
+
+// SCIMPath is a PATCH operation path: attr[filter].subAttr
+type SCIMPath struct {
+	Attr    string
+	Filter  *SCIMFilter
+	SubAttr string
+}
+
+// ParseSCIMPath parses a PATCH path such as `members[value eq "123"]` or
+// `name.givenName`. Names are lower-cased.
+func ParseSCIMPath(path string) (*SCIMPath, error) {
+	path = strings.TrimSpace(path)
+	result := &SCIMPath{}
+
+	if open := strings.IndexByte(path, '['); open >= 0 {
+		end := strings.LastIndexByte(path, ']')
+		if end < open {
+			return nil, fmt.Errorf("%w: unbalanced brackets in path", ErrSCIMInvalidFilter)
+		}
+		filter, err := ParseSCIMFilter(path[open+1 : end])
+		if err != nil {
+			return nil, err
+		}
+		result.Filter = filter
+		rest := path[end+1:]
+		if rest != "" {
+			if !strings.HasPrefix(rest, ".") {
+				return nil, fmt.Errorf("%w: invalid path %q", ErrSCIMInvalidFilter, path)
+			}
+			result.SubAttr = strings.ToLower(rest[1:])
+		}
+		path = path[:open]
+	} else if dot := strings.LastIndexByte(path, '.'); dot >= 0 && !strings.Contains(path, ":") {
+		result.SubAttr = strings.ToLower(path[dot+1:])
+		path = path[:dot]
+	}
+
+	// Paths may be qualified with the schema URN
+	path = strings.TrimPrefix(path, SCIMSchemaUser+":")
+	path = strings.TrimPrefix(path, SCIMSchemaGroup+":")
+	if path == "" {
+		return nil, fmt.Errorf("%w: empty path", ErrSCIMInvalidFilter)
+	}
+	result.Attr = strings.ToLower(path)
+	return result, nil
+}
+
+// Match evaluates the filter against a resource. values returns the values of
+// an attribute path; a missing attribute has none.
+func (f *SCIMFilter) Match(values func(attr string) []interface{}) bool {
+	switch f.Op {
+	case "and":
+		return f.Left.Match(values) && f.Right.Match(values)
+	case "or":
+		return f.Left.Match(values) || f.Right.Match(values)
+	case "not":
+		return !f.Left.Match(values)
+	case "pr":
+		for _, v := range values(f.Attr) {
+			if v != nil && v != "" {
+				return true
+			}
+		}
+		return false
+	case "ne":
+		for _, v := range values(f.Attr) {
+			if compareSCIMValue("eq", v, f.Value) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, v := range values(f.Attr) {
+		if compareSCIMValue(f.Op, v, f.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+func compareSCIMValue(op string, actual, expected interface{}) bool {
+	switch a := actual.(type) {
+	case string:
+		e, ok := expected.(string)
+		if !ok {
+			return false
+		}
+		a, e = strings.ToLower(a), strings.ToLower(e)
+		switch op {
+		case "eq":
+			return a == e
+		case "co":
+			return strings.Contains(a, e)
+		case "sw":
+			return strings.HasPrefix(a, e)
+		case "ew":
+			return strings.HasSuffix(a, e)
+		case "gt":
+			return a > e
+		case "ge":
+			return a >= e
+		case "lt":
+			return a < e
+		case "le":
+			return a <= e
+		}
+	case bool:
+		e, ok := expected.(bool)
+		return ok && op == "eq" && a == e
+	case time.Time:
+		s, ok := expected.(string)
+		if !ok {
+			return false
+		}
+		e, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return false
+		}
+		switch op {
+		case "eq":
+			return a.Equal(e)
+		case "gt":
+			return a.After(e)
+		case "ge":
+			return !a.Before(e)
+		case "lt":
+			return a.Before(e)
+		case "le":
+			return !a.After(e)
+		}
+	}
+	return false
+}
+
+type scimFilterParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *scimFilterParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *scimFilterParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *scimFilterParser) parseOr() (*SCIMFilter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &SCIMFilter{Op: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseAnd() (*SCIMFilter, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "and") {
+		p.next()
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = &SCIMFilter{Op: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseFactor() (*SCIMFilter, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("%w: unexpected end of filter", ErrSCIMInvalidFilter)
+	case token == "(":
+		return p.parseGroup()
+	case strings.EqualFold(token, "not"):
+		if p.next() != "(" {
+			return nil, fmt.Errorf("%w: expected ( after not", ErrSCIMInvalidFilter)
+		}
+		inner, err := p.parseGroup()
+		if err != nil {
+			return nil, err
+		}
+		return &SCIMFilter{Op: "not", Left: inner}, nil
+	case token == ")" || strings.HasPrefix(token, `"`):
+		return nil, fmt.Errorf("%w: unexpected %q", ErrSCIMInvalidFilter, token)
+	}
+
+	attr := strings.ToLower(token)
+	attr = strings.TrimPrefix(attr, strings.ToLower(SCIMSchemaUser)+":")
+	attr = strings.TrimPrefix(attr, strings.ToLower(SCIMSchemaGroup)+":")
+	op := strings.ToLower(p.next())
+	if op == "pr" {
+		return &SCIMFilter{Op: op, Attr: attr}, nil
+	}
+	if !scimComparisons[op] {
+		return nil, fmt.Errorf("%w: unsupported operator %q", ErrSCIMInvalidFilter, op)
+	}
+
+	raw := p.next()
+	if raw == "" || raw == "(" || raw == ")" {
+		return nil, fmt.Errorf("%w: missing value for %s", ErrSCIMInvalidFilter, attr)
+	}
+	// Values are JSON literals; some IdPs capitalize true and false
+	if !strings.HasPrefix(raw, `"`) {
+		raw = strings.ToLower(raw)
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		return nil, fmt.Errorf("%w: invalid value %s", ErrSCIMInvalidFilter, raw)
+	}
+	return &SCIMFilter{Op: op, Attr: attr, Value: value}, nil
+}
+
+func (p *scimFilterParser) parseGroup() (*SCIMFilter, error) {
+	inner, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.next() != ")" {
+		return nil, fmt.Errorf("%w: expected )", ErrSCIMInvalidFilter)
+	}
+	return inner, nil
+}
+
+// tokenizeSCIMFilter splits a filter into parentheses, quoted strings (kept
+// quoted) and bare words
+func tokenizeSCIMFilter(filter string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(filter); {
+		switch c := filter[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"':
+			j := i + 1
+			for ; j < len(filter) && filter[j] != '"'; j++ {
+				if filter[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(filter) {
+				return nil, fmt.Errorf("%w: unterminated string", ErrSCIMInvalidFilter)
+			}
+			tokens = append(tokens, filter[i:j+1])
+			i = j + 1
+		default:
+			j := i
+			for j < len(filter) && !strings.ContainsRune(" \t()\"", rune(filter[j])) {
+				j++
+			}
+			tokens = append(tokens, filter[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,463 @@
+package util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	// Register the digest algorithms used by XML signatures
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// XML namespaces and algorithm identifiers used by XML signatures
+const (
+	xmlNamespace       = "http://www.w3.org/XML/1998/namespace"
+	xmlDSigNamespace   = "http://www.w3.org/2000/09/xmldsig#"
+	xmlExcC14N         = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	xmlEnvelopedSig    = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	xmlDSigRSASHA256   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	xmlDSigRSASHA512   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	xmlDigestSHA256    = "http://www.w3.org/2001/04/xmlenc#sha256"
+	xmlDigestSHA512    = "http://www.w3.org/2001/04/xmlenc#sha512"
+	xmlMaxDocumentSize = 1 << 20
+)
+
+// ErrXMLNotSigned is returned when an element carries no signature at all
+var ErrXMLNotSigned = errors.New("element is not signed")
+
+// xmlElement is a parsed XML element that keeps what canonicalization needs:
+// prefixes, the namespaces in scope and the exact child order
+type xmlElement struct {
+	Prefix   string
+	Local    string
+	Space    string // Namespace URI
+	Attrs    []xmlAttr
+	Scope    map[string]string // Namespaces in scope by prefix, "" for the default
+	Children []xmlNode
+}
+
+type xmlAttr struct {
+	Prefix string
+	Local  string
+	Space  string
+	Value  string
+}
+
+// xmlNode is either a child element or character data
+type xmlNode struct {
+	Elem *xmlElement
+	Text string
+}
+
+// parseXMLDocument builds an element tree. Documents with a DTD are refused.
+func parseXMLDocument(data []byte) (*xmlElement, error) {
+	if len(data) > xmlMaxDocumentSize {
+		return nil, errors.New("XML document is too large")
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var root *xmlElement
+	var stack []*xmlElement
+
+	for {
+		tok, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XML: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			parentScope := map[string]string{"xml": xmlNamespace}
+			if len(stack) > 0 {
+				parentScope = stack[len(stack)-1].Scope
+			} else if root != nil {
+				return nil, errors.New("invalid XML: multiple root elements")
+			}
+
+			el := &xmlElement{Prefix: t.Name.Space, Local: t.Name.Local, Scope: parentScope}
+			declared := false
+			for _, a := range t.Attr {
+				prefix := ""
+				switch {
+				case a.Name.Space == "xmlns":
+					prefix = a.Name.Local
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+				default:
+					continue
+				}
+				if !declared {
+					el.Scope = make(map[string]string, len(parentScope)+1)
+					for k, v := range parentScope {
+						el.Scope[k] = v
+					}
+					declared = true
+				}
+				el.Scope[prefix] = a.Value
+			}
+
+			var ok bool
+			if el.Space, ok = el.Scope[el.Prefix]; !ok && el.Prefix != "" {
+				return nil, fmt.Errorf("invalid XML: undeclared prefix %q", el.Prefix)
+			}
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns") {
+					continue
+				}
+				attr := xmlAttr{Prefix: a.Name.Space, Local: a.Name.Local, Value: a.Value}
+				if attr.Prefix != "" {
+					if attr.Space, ok = el.Scope[attr.Prefix]; !ok {
+						return nil, fmt.Errorf("invalid XML: undeclared prefix %q", attr.Prefix)
+					}
+				}
+				el.Attrs = append(el.Attrs, attr)
+			}
+
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, xmlNode{Elem: el})
+			} else {
+				root = el
+			}
+			stack = append(stack, el)
+
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, errors.New("invalid XML: unexpected end element")
+			}
+			el := stack[len(stack)-1]
+			if el.Prefix != t.Name.Space || el.Local != t.Name.Local {
+				return nil, fmt.Errorf("invalid XML: element <%s> closed by </%s>", el.Local, t.Name.Local)
+			}
+			stack = stack[:len(stack)-1]
+
+		case xml.CharData:
+			if len(stack) == 0 {
+				continue // whitespace around the root element
+			}
+			parent := stack[len(stack)-1]
+			if n := len(parent.Children); n > 0 && parent.Children[n-1].Elem == nil {
+				parent.Children[n-1].Text += string(t)
+			} else {
+				parent.Children = append(parent.Children, xmlNode{Text: string(t)})
+			}
+
+		case xml.Directive:
+			return nil, errors.New("XML documents with a DTD are not accepted")
+		}
+	}
+
+	if root == nil || len(stack) > 0 {
+		return nil, errors.New("invalid XML: incomplete document")
+	}
+	return root, nil
+}
+
+// attr returns the value of an unqualified attribute
+func (e *xmlElement) attr(local string) string {
+	for _, a := range e.Attrs {
+		if a.Space == "" && a.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// children returns the child elements with the given namespace and local name
+func (e *xmlElement) children(space, local string) []*xmlElement {
+	var found []*xmlElement
+	for _, n := range e.Children {
+		if n.Elem != nil && n.Elem.Space == space && n.Elem.Local == local {
+			found = append(found, n.Elem)
+		}
+	}
+	return found
+}
+
+// child returns the only child element with the given name, or nil
+func (e *xmlElement) child(space, local string) *xmlElement {
+	found := e.children(space, local)
+	if len(found) != 1 {
+		return nil
+	}
+	return found[0]
+}
+
+// text returns the element's character data, ignoring child elements
+func (e *xmlElement) text() string {
+	var sb strings.Builder
+	for _, n := range e.Children {
+		if n.Elem == nil {
+			sb.WriteString(n.Text)
+		}
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// countDescendants counts elements with the given name anywhere below e, e included
+func (e *xmlElement) countDescendants(space, local string) int {
+	count := 0
+	if e.Space == space && e.Local == local {
+		count++
+	}
+	for _, n := range e.Children {
+		if n.Elem != nil {
+			count += n.Elem.countDescendants(space, local)
+		}
+	}
+	return count
+}
+
+// canonicalize serializes e with Exclusive XML Canonicalization 1.0 (without
+// comments), leaving out the exclude subtree. Prefixes in inclusive are
+// treated as in inclusive canonicalization ("#default" is the default namespace).
+func canonicalize(e, exclude *xmlElement, inclusive []string) []byte {
+	var buf bytes.Buffer
+	writeCanonical(&buf, e, exclude, inclusive, map[string]string{})
+	return buf.Bytes()
+}
+
+func writeCanonical(buf *bytes.Buffer, e, exclude *xmlElement, inclusive []string, rendered map[string]string) {
+	// Namespaces visibly used by this element, plus the inclusive ones in scope
+	used := map[string]bool{e.Prefix: true}
+	for _, a := range e.Attrs {
+		if a.Prefix != "" {
+			used[a.Prefix] = true
+		}
+	}
+	for _, p := range inclusive {
+		if p == "#default" {
+			p = ""
+		}
+		if _, ok := e.Scope[p]; ok {
+			used[p] = true
+		}
+	}
+
+	var prefixes []string
+	for p := range used {
+		if p == "xml" {
+			continue
+		}
+		// An absent default namespace equals xmlns="", which is implied at the top
+		if uri, ok := rendered[p]; ok && uri == e.Scope[p] || !ok && p == "" && e.Scope[""] == "" {
+			continue
+		}
+		prefixes = append(prefixes, p)
+	}
+	sort.Strings(prefixes)
+
+	if len(prefixes) > 0 {
+		next := make(map[string]string, len(rendered)+len(prefixes))
+		for k, v := range rendered {
+			next[k] = v
+		}
+		for _, p := range prefixes {
+			next[p] = e.Scope[p]
+		}
+		rendered = next
+	}
+
+	attrs := append([]xmlAttr(nil), e.Attrs...)
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].Space != attrs[j].Space {
+			return attrs[i].Space < attrs[j].Space
+		}
+		return attrs[i].Local < attrs[j].Local
+	})
+
+	buf.WriteByte('<')
+	writeQName(buf, e.Prefix, e.Local)
+	for _, p := range prefixes {
+		buf.WriteString(" xmlns")
+		if p != "" {
+			buf.WriteByte(':')
+			buf.WriteString(p)
+		}
+		buf.WriteString(`="`)
+		buf.WriteString(escapeCanonicalAttr(e.Scope[p]))
+		buf.WriteByte('"')
+	}
+	for _, a := range attrs {
+		buf.WriteByte(' ')
+		writeQName(buf, a.Prefix, a.Local)
+		buf.WriteString(`="`)
+		buf.WriteString(escapeCanonicalAttr(a.Value))
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('>')
+
+	for _, n := range e.Children {
+		if n.Elem == nil {
+			buf.WriteString(escapeCanonicalText(n.Text))
+		} else if n.Elem != exclude {
+			writeCanonical(buf, n.Elem, exclude, inclusive, rendered)
+		}
+	}
+
+	buf.WriteString("</")
+	writeQName(buf, e.Prefix, e.Local)
+	buf.WriteByte('>')
+}
+
+func writeQName(buf *bytes.Buffer, prefix, local string) {
+	if prefix != "" {
+		buf.WriteString(prefix)
+		buf.WriteByte(':')
+	}
+	buf.WriteString(local)
+}
+
+var (
+	canonicalTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	canonicalAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+func escapeCanonicalText(s string) string { return canonicalTextEscaper.Replace(s) }
+func escapeCanonicalAttr(s string) string { return canonicalAttrEscaper.Replace(s) }
+
+// verifyEnvelopedSignature checks the XML signature that is a direct child of
+// e and covers e through a same-document reference to its ID attribute. Only
+// exclusive canonicalization with RSA SHA-256/512 is supported; the key must
+// be one of certs, whatever the signature's KeyInfo claims.
+func verifyEnvelopedSignature(e *xmlElement, certs []*x509.Certificate) error {
+	signatures := e.children(xmlDSigNamespace, "Signature")
+	if len(signatures) == 0 {
+		return ErrXMLNotSigned
+	}
+	if len(signatures) > 1 {
+		return errors.New("element has more than one signature")
+	}
+	signature := signatures[0]
+
+	signedInfo := signature.child(xmlDSigNamespace, "SignedInfo")
+	if signedInfo == nil {
+		return errors.New("signature has no SignedInfo")
+	}
+
+	c14nMethod := signedInfo.child(xmlDSigNamespace, "CanonicalizationMethod")
+	if c14nMethod == nil || c14nMethod.attr("Algorithm") != xmlExcC14N {
+		return errors.New("unsupported canonicalization method")
+	}
+
+	var signatureHash crypto.Hash
+	sigMethod := signedInfo.child(xmlDSigNamespace, "SignatureMethod")
+	if sigMethod == nil {
+		return errors.New("signature has no SignatureMethod")
+	}
+	switch sigMethod.attr("Algorithm") {
+	case xmlDSigRSASHA256:
+		signatureHash = crypto.SHA256
+	case xmlDSigRSASHA512:
+		signatureHash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported signature method %q", sigMethod.attr("Algorithm"))
+	}
+
+	reference := signedInfo.child(xmlDSigNamespace, "Reference")
+	if reference == nil {
+		return errors.New("signature must have exactly one reference")
+	}
+	id := e.attr("ID")
+	if id == "" || reference.attr("URI") != "#"+id {
+		return errors.New("signature does not reference the signed element")
+	}
+
+	enveloped := false
+	var inclusive []string
+	if transforms := reference.child(xmlDSigNamespace, "Transforms"); transforms != nil {
+		for _, t := range transforms.children(xmlDSigNamespace, "Transform") {
+			switch t.attr("Algorithm") {
+			case xmlEnvelopedSig:
+				enveloped = true
+			case xmlExcC14N:
+				inclusive = inclusivePrefixes(t)
+			default:
+				return fmt.Errorf("unsupported transform %q", t.attr("Algorithm"))
+			}
+		}
+	}
+	if !enveloped {
+		return errors.New("signature is not an enveloped signature")
+	}
+
+	var digestHash crypto.Hash
+	digestMethod := reference.child(xmlDSigNamespace, "DigestMethod")
+	if digestMethod == nil {
+		return errors.New("reference has no DigestMethod")
+	}
+	switch digestMethod.attr("Algorithm") {
+	case xmlDigestSHA256:
+		digestHash = crypto.SHA256
+	case xmlDigestSHA512:
+		digestHash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported digest method %q", digestMethod.attr("Algorithm"))
+	}
+
+	digestElem := reference.child(xmlDSigNamespace, "DigestValue")
+	if digestElem == nil {
+		return errors.New("reference has no DigestValue")
+	}
+	expectedDigest, err := decodeXMLBase64(digestElem.text())
+	if err != nil {
+		return errors.New("invalid digest value")
+	}
+
+	h := digestHash.New()
+	h.Write(canonicalize(e, signature, inclusive))
+	if subtle.ConstantTimeCompare(h.Sum(nil), expectedDigest) != 1 {
+		return errors.New("digest mismatch")
+	}
+
+	valueElem := signature.child(xmlDSigNamespace, "SignatureValue")
+	if valueElem == nil {
+		return errors.New("signature has no SignatureValue")
+	}
+	signatureValue, err := decodeXMLBase64(valueElem.text())
+	if err != nil {
+		return errors.New("invalid signature value")
+	}
+
+	h = signatureHash.New()
+	h.Write(canonicalize(signedInfo, nil, inclusivePrefixes(c14nMethod)))
+	sum := h.Sum(nil)
+
+	for _, cert := range certs {
+		pub, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			continue
+		}
+		if rsa.VerifyPKCS1v15(pub, signatureHash, sum, signatureValue) == nil {
+			return nil
+		}
+	}
+	return errors.New("signature verification failed")
+}
+
+// inclusivePrefixes reads the InclusiveNamespaces PrefixList of an exclusive
+// canonicalization transform
+func inclusivePrefixes(method *xmlElement) []string {
+	list := method.child(xmlExcC14N, "InclusiveNamespaces")
+	if list == nil {
+		return nil
+	}
+	return strings.Fields(list.attr("PrefixList"))
+}
+
+// decodeXMLBase64 decodes base64 content that may be wrapped over several lines
+func decodeXMLBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}